@@ -1,8 +1,6 @@
 
 %LINE-WIDTH = 0x1E
 
-%CALL-RETURN-ADDRESS = 0xFF33
-
 %ONE = 0x1
 
 %LINEX = 0xFF01
@@ -25,172 +23,148 @@ start:
 ROUTINES:
 
 ROUTINE-init-fontDescriptions:
-	DATA R0, 0x0108
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x0109
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x010A
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x010B
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x010C
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x010D
-	DATA R1, 0x0000
-	ST R0, R1
-	DATA R0, 0x010E
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x010F
+	DATA R0, 0x0150
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0200
-	DATA R1, 0x007C
-	ST R0, R1
-	DATA R0, 0x0201
-	DATA R1, 0x008A
+	DATA R0, 0x0151
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x0202
-	DATA R1, 0x009C
+	DATA R0, 0x0152
+	DATA R1, 0x0054
 	ST R0, R1
-	DATA R0, 0x0203
-	DATA R1, 0x00A8
+	DATA R0, 0x0153
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x0204
-	DATA R1, 0x0098
+	DATA R0, 0x0154
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x0205
-	DATA R1, 0x0084
+	DATA R0, 0x0155
+	DATA R1, 0x0054
 	ST R0, R1
-	DATA R0, 0x0206
-	DATA R1, 0x0078
+	DATA R0, 0x0156
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x0207
+	DATA R0, 0x0157
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0250
-	DATA R1, 0x0002
+	DATA R0, 0x01E8
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0251
-	DATA R1, 0x0002
+	DATA R0, 0x01E9
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0252
-	DATA R1, 0x0002
+	DATA R0, 0x01EA
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0253
-	DATA R1, 0x0002
+	DATA R0, 0x01EB
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0254
-	DATA R1, 0x0002
+	DATA R0, 0x01EC
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0255
-	DATA R1, 0x0002
+	DATA R0, 0x01ED
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0256
-	DATA R1, 0x00FC
+	DATA R0, 0x01EE
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0257
+	DATA R0, 0x01EF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0260
-	DATA R1, 0x0080
+	DATA R0, 0x02A0
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0261
-	DATA R1, 0x0080
+	DATA R0, 0x02A1
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0262
-	DATA R1, 0x0080
+	DATA R0, 0x02A2
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0263
-	DATA R1, 0x0080
+	DATA R0, 0x02A3
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0264
-	DATA R1, 0x0080
+	DATA R0, 0x02A4
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0265
-	DATA R1, 0x0080
+	DATA R0, 0x02A5
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0266
-	DATA R1, 0x007E
+	DATA R0, 0x02A6
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0267
+	DATA R0, 0x02A7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0288
-	DATA R1, 0x0078
+	DATA R0, 0x0390
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0289
-	DATA R1, 0x0084
+	DATA R0, 0x0391
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x028A
-	DATA R1, 0x0084
+	DATA R0, 0x0392
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x028B
-	DATA R1, 0x0084
+	DATA R0, 0x0393
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x028C
-	DATA R1, 0x0094
+	DATA R0, 0x0394
+	DATA R1, 0x00A0
 	ST R0, R1
-	DATA R0, 0x028D
-	DATA R1, 0x008C
+	DATA R0, 0x0395
+	DATA R1, 0x0090
 	ST R0, R1
-	DATA R0, 0x028E
-	DATA R1, 0x0076
+	DATA R0, 0x0396
+	DATA R1, 0x008E
 	ST R0, R1
-	DATA R0, 0x028F
-	DATA R1, 0x0007
+	DATA R0, 0x0397
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01A0
-	DATA R1, 0x001C
+	DATA R0, 0x0180
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x01A1
-	DATA R1, 0x0024
+	DATA R0, 0x0181
+	DATA R1, 0x00E2
 	ST R0, R1
-	DATA R0, 0x01A2
-	DATA R1, 0x0044
+	DATA R0, 0x0182
+	DATA R1, 0x00A2
 	ST R0, R1
-	DATA R0, 0x01A3
-	DATA R1, 0x0084
+	DATA R0, 0x0183
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x01A4
-	DATA R1, 0x00FE
+	DATA R0, 0x0184
+	DATA R1, 0x008A
 	ST R0, R1
-	DATA R0, 0x01A5
-	DATA R1, 0x0004
+	DATA R0, 0x0185
+	DATA R1, 0x008E
 	ST R0, R1
-	DATA R0, 0x01A6
-	DATA R1, 0x0004
+	DATA R0, 0x0186
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x01A7
+	DATA R0, 0x0187
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0128
-	DATA R1, 0x00C2
+	DATA R0, 0x0118
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x0129
-	DATA R1, 0x00C4
+	DATA R0, 0x0119
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x012A
-	DATA R1, 0x0008
+	DATA R0, 0x011A
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x012B
-	DATA R1, 0x0010
+	DATA R0, 0x011B
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x012C
-	DATA R1, 0x0020
+	DATA R0, 0x011C
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x012D
-	DATA R1, 0x004C
+	DATA R0, 0x011D
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x012E
-	DATA R1, 0x008C
+	DATA R0, 0x011E
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x012F
+	DATA R0, 0x011F
 	DATA R1, 0x0000
 	ST R0, R1
 	DATA R0, 0x0170
@@ -217,1084 +191,1180 @@ ROUTINE-init-fontDescriptions:
 	DATA R0, 0x0177
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0168
+	DATA R0, 0x03F0
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0169
+	DATA R0, 0x03F1
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x016A
+	DATA R0, 0x03F2
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x016B
-	DATA R1, 0x007C
+	DATA R0, 0x03F3
+	DATA R1, 0x0032
 	ST R0, R1
-	DATA R0, 0x016C
-	DATA R1, 0x0000
+	DATA R0, 0x03F4
+	DATA R1, 0x004C
 	ST R0, R1
-	DATA R0, 0x016D
+	DATA R0, 0x03F5
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x016E
+	DATA R0, 0x03F6
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x016F
+	DATA R0, 0x03F7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01E0
-	DATA R1, 0x0002
+	DATA R0, 0x0228
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x01E1
-	DATA R1, 0x0004
+	DATA R0, 0x0229
+	DATA R1, 0x00C0
 	ST R0, R1
-	DATA R0, 0x01E2
-	DATA R1, 0x0008
+	DATA R0, 0x022A
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x01E3
-	DATA R1, 0x0010
+	DATA R0, 0x022B
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x01E4
-	DATA R1, 0x0008
+	DATA R0, 0x022C
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x01E5
-	DATA R1, 0x0004
+	DATA R0, 0x022D
+	DATA R1, 0x00C0
 	ST R0, R1
-	DATA R0, 0x01E6
-	DATA R1, 0x0002
+	DATA R0, 0x022E
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x01E7
+	DATA R0, 0x022F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0218
-	DATA R1, 0x007E
+	DATA R0, 0x0268
+	DATA R1, 0x0066
 	ST R0, R1
-	DATA R0, 0x0219
-	DATA R1, 0x00C0
+	DATA R0, 0x0269
+	DATA R1, 0x00AA
 	ST R0, R1
-	DATA R0, 0x021A
-	DATA R1, 0x0080
+	DATA R0, 0x026A
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x021B
-	DATA R1, 0x0080
+	DATA R0, 0x026B
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x021C
-	DATA R1, 0x0080
+	DATA R0, 0x026C
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x021D
-	DATA R1, 0x00C0
+	DATA R0, 0x026D
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x021E
-	DATA R1, 0x007E
+	DATA R0, 0x026E
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x021F
+	DATA R0, 0x026F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0220
-	DATA R1, 0x00F8
+	DATA R0, 0x03A8
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x0221
-	DATA R1, 0x0086
+	DATA R0, 0x03A9
+	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x0222
-	DATA R1, 0x0082
+	DATA R0, 0x03AA
+	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x0223
-	DATA R1, 0x0082
+	DATA R0, 0x03AB
+	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x0224
-	DATA R1, 0x0082
+	DATA R0, 0x03AC
+	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x0225
-	DATA R1, 0x0086
+	DATA R0, 0x03AD
+	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x0226
-	DATA R1, 0x00F8
+	DATA R0, 0x03AE
+	DATA R1, 0x003C
 	ST R0, R1
-	DATA R0, 0x0227
+	DATA R0, 0x03AF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03C8
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x03C9
-	DATA R1, 0x0044
+	DATA R0, 0x01F0
+	DATA R1, 0x0040
 	ST R0, R1
-	DATA R0, 0x03CA
-	DATA R1, 0x0028
+	DATA R0, 0x01F1
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x03CB
+	DATA R0, 0x01F2
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x03CC
-	DATA R1, 0x0010
+	DATA R0, 0x01F3
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x03CD
+	DATA R0, 0x01F4
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x03CE
-	DATA R1, 0x0038
+	DATA R0, 0x01F5
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x03CF
-	DATA R1, 0x0000
+	DATA R0, 0x01F6
+	DATA R1, 0x0040
 	ST R0, R1
-	DATA R0, 0x03F0
+	DATA R0, 0x01F7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03F1
-	DATA R1, 0x0000
+	DATA R0, 0x03E8
+	DATA R1, 0x0030
 	ST R0, R1
-	DATA R0, 0x03F2
-	DATA R1, 0x0000
+	DATA R0, 0x03E9
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x03F3
-	DATA R1, 0x0032
+	DATA R0, 0x03EA
+	DATA R1, 0x000C
 	ST R0, R1
-	DATA R0, 0x03F4
-	DATA R1, 0x004C
+	DATA R0, 0x03EB
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x03F5
-	DATA R1, 0x0000
+	DATA R0, 0x03EC
+	DATA R1, 0x000C
 	ST R0, R1
-	DATA R0, 0x03F6
-	DATA R1, 0x0000
+	DATA R0, 0x03ED
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x03F7
-	DATA R1, 0x0000
+	DATA R0, 0x03EE
+	DATA R1, 0x0030
 	ST R0, R1
-	DATA R0, 0x03D8
-	DATA R1, 0x0010
+	DATA R0, 0x03EF
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03D9
-	DATA R1, 0x0020
+	DATA R0, 0x0248
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x03DA
-	DATA R1, 0x0060
+	DATA R0, 0x0249
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x03DB
-	DATA R1, 0x0080
+	DATA R0, 0x024A
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x03DC
-	DATA R1, 0x0060
+	DATA R0, 0x024B
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x03DD
-	DATA R1, 0x0020
+	DATA R0, 0x024C
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x03DE
+	DATA R0, 0x024D
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x03DF
+	DATA R0, 0x024E
+	DATA R1, 0x00FE
+	ST R0, R1
+	DATA R0, 0x024F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02B0
+	DATA R0, 0x0288
+	DATA R1, 0x0078
+	ST R0, R1
+	DATA R0, 0x0289
+	DATA R1, 0x0084
+	ST R0, R1
+	DATA R0, 0x028A
+	DATA R1, 0x0084
+	ST R0, R1
+	DATA R0, 0x028B
+	DATA R1, 0x0084
+	ST R0, R1
+	DATA R0, 0x028C
+	DATA R1, 0x0094
+	ST R0, R1
+	DATA R0, 0x028D
+	DATA R1, 0x008C
+	ST R0, R1
+	DATA R0, 0x028E
+	DATA R1, 0x0076
+	ST R0, R1
+	DATA R0, 0x028F
+	DATA R1, 0x0007
+	ST R0, R1
+	DATA R0, 0x03B0
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02B1
+	DATA R0, 0x03B1
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02B2
+	DATA R0, 0x03B2
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02B3
+	DATA R0, 0x03B3
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02B4
+	DATA R0, 0x03B4
 	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x02B5
+	DATA R0, 0x03B5
 	DATA R1, 0x006C
 	ST R0, R1
-	DATA R0, 0x02B6
+	DATA R0, 0x03B6
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02B7
+	DATA R0, 0x03B7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03A0
+	DATA R0, 0x03D0
 	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x03A1
-	DATA R1, 0x0010
+	DATA R0, 0x03D1
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03A2
-	DATA R1, 0x0010
+	DATA R0, 0x03D2
+	DATA R1, 0x000C
 	ST R0, R1
-	DATA R0, 0x03A3
-	DATA R1, 0x0010
+	DATA R0, 0x03D3
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x03A4
-	DATA R1, 0x0010
+	DATA R0, 0x03D4
+	DATA R1, 0x0060
 	ST R0, R1
-	DATA R0, 0x03A5
-	DATA R1, 0x0010
+	DATA R0, 0x03D5
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03A6
-	DATA R1, 0x0010
+	DATA R0, 0x03D6
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x03A7
+	DATA R0, 0x03D7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03C0
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x03C1
-	DATA R1, 0x0044
-	ST R0, R1
-	DATA R0, 0x03C2
+	DATA R0, 0x0110
 	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x03C3
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03C4
+	DATA R0, 0x0111
 	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x03C5
-	DATA R1, 0x0044
+	DATA R0, 0x0112
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03C6
-	DATA R1, 0x00C6
+	DATA R0, 0x0113
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03C7
+	DATA R0, 0x0114
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0120
-	DATA R1, 0x0010
+	DATA R0, 0x0115
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0121
-	DATA R1, 0x007E
+	DATA R0, 0x0116
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0122
-	DATA R1, 0x0090
+	DATA R0, 0x0117
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0123
-	DATA R1, 0x007C
+	DATA R0, 0x01E0
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x0124
-	DATA R1, 0x0012
-	ST R0, R1
-	DATA R0, 0x0125
-	DATA R1, 0x00FC
-	ST R0, R1
-	DATA R0, 0x0126
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x0127
-	DATA R1, 0x0000
-	ST R0, R1
-	DATA R0, 0x02E0
-	DATA R1, 0x0080
-	ST R0, R1
-	DATA R0, 0x02E1
-	DATA R1, 0x0040
+	DATA R0, 0x01E1
+	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x02E2
-	DATA R1, 0x0020
+	DATA R0, 0x01E2
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x02E3
+	DATA R0, 0x01E3
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02E4
+	DATA R0, 0x01E4
 	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x02E5
+	DATA R0, 0x01E5
 	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x02E6
+	DATA R0, 0x01E6
 	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x02E7
+	DATA R0, 0x01E7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0300
-	DATA R1, 0x0000
+	DATA R0, 0x0290
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0301
-	DATA R1, 0x0020
+	DATA R0, 0x0291
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0302
-	DATA R1, 0x0010
+	DATA R0, 0x0292
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0303
-	DATA R1, 0x0008
+	DATA R0, 0x0293
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0304
-	DATA R1, 0x0000
+	DATA R0, 0x0294
+	DATA R1, 0x00A0
 	ST R0, R1
-	DATA R0, 0x0305
-	DATA R1, 0x0000
+	DATA R0, 0x0295
+	DATA R1, 0x0090
 	ST R0, R1
-	DATA R0, 0x0306
-	DATA R1, 0x0000
+	DATA R0, 0x0296
+	DATA R1, 0x008E
 	ST R0, R1
-	DATA R0, 0x0307
+	DATA R0, 0x0297
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0230
+	DATA R0, 0x0330
 	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x0231
+	DATA R0, 0x0331
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0232
+	DATA R0, 0x0332
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0233
+	DATA R0, 0x0333
 	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0234
+	DATA R0, 0x0334
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0235
+	DATA R0, 0x0335
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0236
+	DATA R0, 0x0336
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0237
+	DATA R0, 0x0337
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0328
-	DATA R1, 0x007E
+	DATA R0, 0x0368
+	DATA R1, 0x0066
 	ST R0, R1
-	DATA R0, 0x0329
-	DATA R1, 0x00C0
+	DATA R0, 0x0369
+	DATA R1, 0x00AA
 	ST R0, R1
-	DATA R0, 0x032A
-	DATA R1, 0x0080
+	DATA R0, 0x036A
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x032B
-	DATA R1, 0x00FE
+	DATA R0, 0x036B
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x032C
-	DATA R1, 0x0080
+	DATA R0, 0x036C
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x032D
-	DATA R1, 0x00C0
+	DATA R0, 0x036D
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x032E
-	DATA R1, 0x007E
+	DATA R0, 0x036E
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x032F
+	DATA R0, 0x036F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0198
-	DATA R1, 0x007C
+	DATA R0, 0x03A0
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0199
-	DATA R1, 0x0002
+	DATA R0, 0x03A1
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x019A
-	DATA R1, 0x0002
+	DATA R0, 0x03A2
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x019B
-	DATA R1, 0x001E
+	DATA R0, 0x03A3
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x019C
-	DATA R1, 0x0002
+	DATA R0, 0x03A4
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x019D
-	DATA R1, 0x0002
+	DATA R0, 0x03A5
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x019E
-	DATA R1, 0x00FC
+	DATA R0, 0x03A6
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x019F
+	DATA R0, 0x03A7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02F8
-	DATA R1, 0x0000
+	DATA R0, 0x0120
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02F9
-	DATA R1, 0x0000
+	DATA R0, 0x0121
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x02FA
-	DATA R1, 0x0000
+	DATA R0, 0x0122
+	DATA R1, 0x0090
 	ST R0, R1
-	DATA R0, 0x02FB
-	DATA R1, 0x0000
+	DATA R0, 0x0123
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x02FC
-	DATA R1, 0x0000
+	DATA R0, 0x0124
+	DATA R1, 0x0012
 	ST R0, R1
-	DATA R0, 0x02FD
-	DATA R1, 0x0000
+	DATA R0, 0x0125
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x02FE
-	DATA R1, 0x007E
+	DATA R0, 0x0126
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02FF
+	DATA R0, 0x0127
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0268
-	DATA R1, 0x0066
+	DATA R0, 0x0148
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x0269
-	DATA R1, 0x00AA
+	DATA R0, 0x0149
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x026A
-	DATA R1, 0x0092
+	DATA R0, 0x014A
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x026B
-	DATA R1, 0x0092
+	DATA R0, 0x014B
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x026C
-	DATA R1, 0x0082
+	DATA R0, 0x014C
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x026D
-	DATA R1, 0x0082
+	DATA R0, 0x014D
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x026E
-	DATA R1, 0x0082
+	DATA R0, 0x014E
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x026F
+	DATA R0, 0x014F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0380
-	DATA R1, 0x00FC
+	DATA R0, 0x01D8
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0381
-	DATA R1, 0x0082
+	DATA R0, 0x01D9
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0382
-	DATA R1, 0x0082
+	DATA R0, 0x01DA
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0383
-	DATA R1, 0x01FC
+	DATA R0, 0x01DB
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0384
-	DATA R1, 0x0080
+	DATA R0, 0x01DC
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0385
+	DATA R0, 0x01DD
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x01DE
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x01DF
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0238
+	DATA R1, 0x007E
+	ST R0, R1
+	DATA R0, 0x0239
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0386
+	DATA R0, 0x023A
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0387
+	DATA R0, 0x023B
+	DATA R1, 0x009C
+	ST R0, R1
+	DATA R0, 0x023C
+	DATA R1, 0x0082
+	ST R0, R1
+	DATA R0, 0x023D
+	DATA R1, 0x0082
+	ST R0, R1
+	DATA R0, 0x023E
+	DATA R1, 0x00FE
+	ST R0, R1
+	DATA R0, 0x023F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03A8
+	DATA R0, 0x02A8
 	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x03A9
+	DATA R0, 0x02A9
 	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x03AA
+	DATA R0, 0x02AA
 	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x03AB
+	DATA R0, 0x02AB
 	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x03AC
+	DATA R0, 0x02AC
 	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x03AD
+	DATA R0, 0x02AD
 	DATA R1, 0x0042
 	ST R0, R1
-	DATA R0, 0x03AE
+	DATA R0, 0x02AE
 	DATA R1, 0x003C
 	ST R0, R1
-	DATA R0, 0x03AF
+	DATA R0, 0x02AF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0320
-	DATA R1, 0x00F8
+	DATA R0, 0x02C0
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x0321
-	DATA R1, 0x0086
+	DATA R0, 0x02C1
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x0322
-	DATA R1, 0x0082
+	DATA R0, 0x02C2
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x0323
-	DATA R1, 0x0082
+	DATA R0, 0x02C3
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0324
-	DATA R1, 0x0082
+	DATA R0, 0x02C4
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x0325
-	DATA R1, 0x0086
+	DATA R0, 0x02C5
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x0326
-	DATA R1, 0x00F8
+	DATA R0, 0x02C6
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x0327
+	DATA R0, 0x02C7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0100
-	DATA R1, 0x0000
+	DATA R0, 0x0318
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x0101
-	DATA R1, 0x0000
+	DATA R0, 0x0319
+	DATA R1, 0x00C0
 	ST R0, R1
-	DATA R0, 0x0102
-	DATA R1, 0x0000
+	DATA R0, 0x031A
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0103
-	DATA R1, 0x0000
+	DATA R0, 0x031B
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0104
-	DATA R1, 0x0000
+	DATA R0, 0x031C
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0105
-	DATA R1, 0x0000
+	DATA R0, 0x031D
+	DATA R1, 0x00C0
 	ST R0, R1
-	DATA R0, 0x0106
+	DATA R0, 0x031E
+	DATA R1, 0x007E
+	ST R0, R1
+	DATA R0, 0x031F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0107
+	DATA R0, 0x0328
+	DATA R1, 0x007E
+	ST R0, R1
+	DATA R0, 0x0329
+	DATA R1, 0x00C0
+	ST R0, R1
+	DATA R0, 0x032A
+	DATA R1, 0x0080
+	ST R0, R1
+	DATA R0, 0x032B
+	DATA R1, 0x00FE
+	ST R0, R1
+	DATA R0, 0x032C
+	DATA R1, 0x0080
+	ST R0, R1
+	DATA R0, 0x032D
+	DATA R1, 0x00C0
+	ST R0, R1
+	DATA R0, 0x032E
+	DATA R1, 0x007E
+	ST R0, R1
+	DATA R0, 0x032F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02E8
-	DATA R1, 0x0030
+	DATA R0, 0x03E0
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02E9
+	DATA R0, 0x03E1
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02EA
+	DATA R0, 0x03E2
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02EB
+	DATA R0, 0x03E3
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02EC
+	DATA R0, 0x03E4
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02ED
+	DATA R0, 0x03E5
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02EE
-	DATA R1, 0x0030
+	DATA R0, 0x03E6
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02EF
+	DATA R0, 0x03E7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01D0
+	DATA R0, 0x0300
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01D1
+	DATA R0, 0x0301
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x0302
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01D2
+	DATA R0, 0x0303
+	DATA R1, 0x0008
+	ST R0, R1
+	DATA R0, 0x0304
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01D3
+	DATA R0, 0x0305
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01D4
+	DATA R0, 0x0306
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0307
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02F0
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01D5
+	DATA R0, 0x02F1
+	DATA R1, 0x0028
+	ST R0, R1
+	DATA R0, 0x02F2
+	DATA R1, 0x0044
+	ST R0, R1
+	DATA R0, 0x02F3
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01D6
+	DATA R0, 0x02F4
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01D7
+	DATA R0, 0x02F5
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0240
-	DATA R1, 0x0082
+	DATA R0, 0x02F6
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0241
-	DATA R1, 0x0082
+	DATA R0, 0x02F7
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0242
+	DATA R0, 0x0200
+	DATA R1, 0x007C
+	ST R0, R1
+	DATA R0, 0x0201
+	DATA R1, 0x008A
+	ST R0, R1
+	DATA R0, 0x0202
+	DATA R1, 0x009C
+	ST R0, R1
+	DATA R0, 0x0203
+	DATA R1, 0x00A8
+	ST R0, R1
+	DATA R0, 0x0204
+	DATA R1, 0x0098
+	ST R0, R1
+	DATA R0, 0x0205
+	DATA R1, 0x0084
+	ST R0, R1
+	DATA R0, 0x0206
+	DATA R1, 0x0078
+	ST R0, R1
+	DATA R0, 0x0207
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0208
+	DATA R1, 0x007C
+	ST R0, R1
+	DATA R0, 0x0209
+	DATA R1, 0x00C6
+	ST R0, R1
+	DATA R0, 0x020A
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0243
+	DATA R0, 0x020B
 	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0244
+	DATA R0, 0x020C
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0245
+	DATA R0, 0x020D
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0246
+	DATA R0, 0x020E
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0247
+	DATA R0, 0x020F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0248
+	DATA R0, 0x0348
 	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0249
+	DATA R0, 0x0349
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x024A
+	DATA R0, 0x034A
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x024B
+	DATA R0, 0x034B
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x024C
+	DATA R0, 0x034C
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x024D
+	DATA R0, 0x034D
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x024E
+	DATA R0, 0x034E
 	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x024F
+	DATA R0, 0x034F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02B8
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x02B9
-	DATA R1, 0x0082
+	DATA R0, 0x03C0
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x02BA
-	DATA R1, 0x0082
+	DATA R0, 0x03C1
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x02BB
-	DATA R1, 0x0092
+	DATA R0, 0x03C2
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x02BC
-	DATA R1, 0x00BA
+	DATA R0, 0x03C3
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02BD
-	DATA R1, 0x00AA
+	DATA R0, 0x03C4
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x02BE
+	DATA R0, 0x03C5
 	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x02BF
+	DATA R0, 0x03C6
+	DATA R1, 0x00C6
+	ST R0, R1
+	DATA R0, 0x03C7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0308
+	DATA R0, 0x0198
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x0309
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x030A
-	DATA R1, 0x0082
+	DATA R0, 0x0199
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x030B
-	DATA R1, 0x00FE
+	DATA R0, 0x019A
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x030C
-	DATA R1, 0x0082
+	DATA R0, 0x019B
+	DATA R1, 0x001E
 	ST R0, R1
-	DATA R0, 0x030D
-	DATA R1, 0x0082
+	DATA R0, 0x019C
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x030E
-	DATA R1, 0x0082
+	DATA R0, 0x019D
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x030F
+	DATA R0, 0x019E
+	DATA R1, 0x00FC
+	ST R0, R1
+	DATA R0, 0x019F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0378
-	DATA R1, 0x007C
+	DATA R0, 0x0130
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x0379
-	DATA R1, 0x0082
+	DATA R0, 0x0131
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x037A
-	DATA R1, 0x0082
+	DATA R0, 0x0132
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x037B
-	DATA R1, 0x0082
+	DATA R0, 0x0133
+	DATA R1, 0x00E0
 	ST R0, R1
-	DATA R0, 0x037C
-	DATA R1, 0x0082
+	DATA R0, 0x0134
+	DATA R1, 0x0094
 	ST R0, R1
-	DATA R0, 0x037D
-	DATA R1, 0x0082
+	DATA R0, 0x0135
+	DATA R1, 0x0088
 	ST R0, R1
-	DATA R0, 0x037E
+	DATA R0, 0x0136
+	DATA R1, 0x00F4
+	ST R0, R1
+	DATA R0, 0x0137
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0158
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0159
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x015A
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x015B
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x037F
+	DATA R0, 0x015C
+	DATA R1, 0x0030
+	ST R0, R1
+	DATA R0, 0x015D
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x015E
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0398
+	DATA R0, 0x015F
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02E0
+	DATA R1, 0x0080
+	ST R0, R1
+	DATA R0, 0x02E1
+	DATA R1, 0x0040
+	ST R0, R1
+	DATA R0, 0x02E2
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x02E3
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x02E4
+	DATA R1, 0x0008
+	ST R0, R1
+	DATA R0, 0x02E5
+	DATA R1, 0x0004
+	ST R0, R1
+	DATA R0, 0x02E6
+	DATA R1, 0x0002
+	ST R0, R1
+	DATA R0, 0x02E7
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0298
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x0399
+	DATA R0, 0x0299
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x039A
+	DATA R0, 0x029A
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x039B
+	DATA R0, 0x029B
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x039C
+	DATA R0, 0x029C
 	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x039D
+	DATA R0, 0x029D
 	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x039E
+	DATA R0, 0x029E
 	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x039F
+	DATA R0, 0x029F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03D0
-	DATA R1, 0x00FE
+	DATA R0, 0x02B8
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03D1
+	DATA R0, 0x02B9
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03D2
-	DATA R1, 0x000C
+	DATA R0, 0x02BA
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03D3
-	DATA R1, 0x0038
+	DATA R0, 0x02BB
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x03D4
-	DATA R1, 0x0060
+	DATA R0, 0x02BC
+	DATA R1, 0x00BA
 	ST R0, R1
-	DATA R0, 0x03D5
-	DATA R1, 0x0082
+	DATA R0, 0x02BD
+	DATA R1, 0x00AA
 	ST R0, R1
-	DATA R0, 0x03D6
-	DATA R1, 0x007E
+	DATA R0, 0x02BE
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x03D7
+	DATA R0, 0x02BF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02D8
-	DATA R1, 0x0030
+	DATA R0, 0x0358
+	DATA R1, 0x00C4
 	ST R0, R1
-	DATA R0, 0x02D9
-	DATA R1, 0x0020
+	DATA R0, 0x0359
+	DATA R1, 0x00C8
 	ST R0, R1
-	DATA R0, 0x02DA
-	DATA R1, 0x0020
+	DATA R0, 0x035A
+	DATA R1, 0x00F0
 	ST R0, R1
-	DATA R0, 0x02DB
-	DATA R1, 0x0020
+	DATA R0, 0x035B
+	DATA R1, 0x00E0
 	ST R0, R1
-	DATA R0, 0x02DC
-	DATA R1, 0x0020
+	DATA R0, 0x035C
+	DATA R1, 0x00D8
 	ST R0, R1
-	DATA R0, 0x02DD
-	DATA R1, 0x0020
+	DATA R0, 0x035D
+	DATA R1, 0x00C4
 	ST R0, R1
-	DATA R0, 0x02DE
-	DATA R1, 0x0030
+	DATA R0, 0x035E
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x02DF
+	DATA R0, 0x035F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03E8
-	DATA R1, 0x0030
+	DATA R0, 0x0388
+	DATA R1, 0x0078
 	ST R0, R1
-	DATA R0, 0x03E9
-	DATA R1, 0x0008
+	DATA R0, 0x0389
+	DATA R1, 0x0084
 	ST R0, R1
-	DATA R0, 0x03EA
-	DATA R1, 0x000C
+	DATA R0, 0x038A
+	DATA R1, 0x0084
 	ST R0, R1
-	DATA R0, 0x03EB
-	DATA R1, 0x0002
+	DATA R0, 0x038B
+	DATA R1, 0x0084
 	ST R0, R1
-	DATA R0, 0x03EC
-	DATA R1, 0x000C
+	DATA R0, 0x038C
+	DATA R1, 0x0094
 	ST R0, R1
-	DATA R0, 0x03ED
-	DATA R1, 0x0008
+	DATA R0, 0x038D
+	DATA R1, 0x008C
 	ST R0, R1
-	DATA R0, 0x03EE
-	DATA R1, 0x0030
+	DATA R0, 0x038E
+	DATA R1, 0x0076
 	ST R0, R1
-	DATA R0, 0x03EF
-	DATA R1, 0x0000
+	DATA R0, 0x038F
+	DATA R1, 0x0007
 	ST R0, R1
-	DATA R0, 0x0278
+	DATA R0, 0x0190
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x0279
+	DATA R0, 0x0191
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x027A
-	DATA R1, 0x0082
+	DATA R0, 0x0192
+	DATA R1, 0x001C
 	ST R0, R1
-	DATA R0, 0x027B
-	DATA R1, 0x0082
+	DATA R0, 0x0193
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x027C
-	DATA R1, 0x0082
+	DATA R0, 0x0194
+	DATA R1, 0x0040
 	ST R0, R1
-	DATA R0, 0x027D
-	DATA R1, 0x0082
+	DATA R0, 0x0195
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x027E
-	DATA R1, 0x007C
+	DATA R0, 0x0196
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x027F
+	DATA R0, 0x0197
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0290
-	DATA R1, 0x00FC
+	DATA R0, 0x0168
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0291
-	DATA R1, 0x0082
+	DATA R0, 0x0169
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0292
-	DATA R1, 0x0082
+	DATA R0, 0x016A
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0293
-	DATA R1, 0x00FC
+	DATA R0, 0x016B
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x0294
-	DATA R1, 0x00A0
+	DATA R0, 0x016C
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0295
-	DATA R1, 0x0090
+	DATA R0, 0x016D
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0296
-	DATA R1, 0x008E
+	DATA R0, 0x016E
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0297
+	DATA R0, 0x016F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02C8
-	DATA R1, 0x00C6
+	DATA R0, 0x0210
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x02C9
-	DATA R1, 0x0044
+	DATA R0, 0x0211
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x02CA
-	DATA R1, 0x0028
+	DATA R0, 0x0212
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02CB
-	DATA R1, 0x0010
+	DATA R0, 0x0213
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x02CC
-	DATA R1, 0x0010
+	DATA R0, 0x0214
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02CD
-	DATA R1, 0x0010
+	DATA R0, 0x0215
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x02CE
-	DATA R1, 0x0038
+	DATA R0, 0x0216
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x02CF
+	DATA R0, 0x0217
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02F0
-	DATA R1, 0x0010
+	DATA R0, 0x01A8
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x02F1
-	DATA R1, 0x0028
+	DATA R0, 0x01A9
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x02F2
-	DATA R1, 0x0044
+	DATA R0, 0x01AA
+	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x02F3
-	DATA R1, 0x0000
+	DATA R0, 0x01AB
+	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x02F4
-	DATA R1, 0x0000
+	DATA R0, 0x01AC
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x02F5
-	DATA R1, 0x0000
+	DATA R0, 0x01AD
+	DATA R1, 0x0006
 	ST R0, R1
-	DATA R0, 0x02F6
-	DATA R1, 0x0000
+	DATA R0, 0x01AE
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x02F7
+	DATA R0, 0x01AF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0238
-	DATA R1, 0x007E
-	ST R0, R1
-	DATA R0, 0x0239
-	DATA R1, 0x0080
-	ST R0, R1
-	DATA R0, 0x023A
-	DATA R1, 0x0080
-	ST R0, R1
-	DATA R0, 0x023B
-	DATA R1, 0x009C
+	DATA R0, 0x01C0
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x023C
+	DATA R0, 0x01C1
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x023D
+	DATA R0, 0x01C2
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x023E
-	DATA R1, 0x00FE
-	ST R0, R1
-	DATA R0, 0x023F
-	DATA R1, 0x0000
-	ST R0, R1
-	DATA R0, 0x0258
-	DATA R1, 0x00C4
-	ST R0, R1
-	DATA R0, 0x0259
-	DATA R1, 0x00C8
-	ST R0, R1
-	DATA R0, 0x025A
-	DATA R1, 0x00F0
-	ST R0, R1
-	DATA R0, 0x025B
-	DATA R1, 0x00E0
-	ST R0, R1
-	DATA R0, 0x025C
-	DATA R1, 0x00D8
-	ST R0, R1
-	DATA R0, 0x025D
-	DATA R1, 0x00C4
-	ST R0, R1
-	DATA R0, 0x025E
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x025F
-	DATA R1, 0x0000
-	ST R0, R1
-	DATA R0, 0x02D0
-	DATA R1, 0x00FE
+	DATA R0, 0x01C3
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x02D1
+	DATA R0, 0x01C4
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02D2
-	DATA R1, 0x000C
-	ST R0, R1
-	DATA R0, 0x02D3
-	DATA R1, 0x0038
-	ST R0, R1
-	DATA R0, 0x02D4
-	DATA R1, 0x0060
-	ST R0, R1
-	DATA R0, 0x02D5
+	DATA R0, 0x01C5
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x02D6
-	DATA R1, 0x007E
+	DATA R0, 0x01C6
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x02D7
+	DATA R0, 0x01C7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0318
+	DATA R0, 0x0218
 	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x0319
+	DATA R0, 0x0219
 	DATA R1, 0x00C0
 	ST R0, R1
-	DATA R0, 0x031A
+	DATA R0, 0x021A
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x031B
+	DATA R0, 0x021B
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x031C
+	DATA R0, 0x021C
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x031D
+	DATA R0, 0x021D
 	DATA R1, 0x00C0
 	ST R0, R1
-	DATA R0, 0x031E
+	DATA R0, 0x021E
 	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x031F
+	DATA R0, 0x021F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0370
-	DATA R1, 0x00C2
+	DATA R0, 0x0260
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0371
-	DATA R1, 0x00A2
+	DATA R0, 0x0261
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0372
-	DATA R1, 0x0092
+	DATA R0, 0x0262
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0373
-	DATA R1, 0x0092
+	DATA R0, 0x0263
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0374
-	DATA R1, 0x008A
+	DATA R0, 0x0264
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0375
-	DATA R1, 0x008A
+	DATA R0, 0x0265
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0376
-	DATA R1, 0x0086
+	DATA R0, 0x0266
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x0377
+	DATA R0, 0x0267
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0148
-	DATA R1, 0x0020
+	DATA R0, 0x03B8
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0149
-	DATA R1, 0x0010
+	DATA R0, 0x03B9
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x014A
-	DATA R1, 0x0008
+	DATA R0, 0x03BA
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x014B
-	DATA R1, 0x0008
+	DATA R0, 0x03BB
+	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x014C
-	DATA R1, 0x0008
+	DATA R0, 0x03BC
+	DATA R1, 0x00BA
 	ST R0, R1
-	DATA R0, 0x014D
-	DATA R1, 0x0010
+	DATA R0, 0x03BD
+	DATA R1, 0x00AA
 	ST R0, R1
-	DATA R0, 0x014E
-	DATA R1, 0x0020
+	DATA R0, 0x03BE
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x014F
+	DATA R0, 0x03BF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0158
-	DATA R1, 0x0000
+	DATA R0, 0x0178
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x0159
-	DATA R1, 0x0010
+	DATA R0, 0x0179
+	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x015A
+	DATA R0, 0x017A
+	DATA R1, 0x0008
+	ST R0, R1
+	DATA R0, 0x017B
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x015B
-	DATA R1, 0x007C
+	DATA R0, 0x017C
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x015C
-	DATA R1, 0x0030
+	DATA R0, 0x017D
+	DATA R1, 0x0040
 	ST R0, R1
-	DATA R0, 0x015D
-	DATA R1, 0x0010
+	DATA R0, 0x017E
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x015E
+	DATA R0, 0x017F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x015F
+	DATA R0, 0x01D0
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01E8
-	DATA R1, 0x0000
+	DATA R0, 0x01D1
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01E9
+	DATA R0, 0x01D2
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01EA
-	DATA R1, 0x00FE
-	ST R0, R1
-	DATA R0, 0x01EB
+	DATA R0, 0x01D3
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01EC
-	DATA R1, 0x00FE
+	DATA R0, 0x01D4
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01ED
+	DATA R0, 0x01D5
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01EE
+	DATA R0, 0x01D6
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01EF
+	DATA R0, 0x01D7
 	DATA R1, 0x0000
 	ST R0, R1
 	DATA R0, 0x01F8
@@ -1321,676 +1391,676 @@ ROUTINE-init-fontDescriptions:
 	DATA R0, 0x01FF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0228
-	DATA R1, 0x007E
+	DATA R0, 0x0280
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0229
-	DATA R1, 0x00C0
+	DATA R0, 0x0281
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x022A
-	DATA R1, 0x0080
+	DATA R0, 0x0282
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x022B
-	DATA R1, 0x00FE
+	DATA R0, 0x0283
+	DATA R1, 0x01FC
 	ST R0, R1
-	DATA R0, 0x022C
+	DATA R0, 0x0284
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x022D
-	DATA R1, 0x00C0
+	DATA R0, 0x0285
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x022E
-	DATA R1, 0x007E
+	DATA R0, 0x0286
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x022F
+	DATA R0, 0x0287
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0388
-	DATA R1, 0x0078
+	DATA R0, 0x02B0
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0389
-	DATA R1, 0x0084
+	DATA R0, 0x02B1
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x038A
-	DATA R1, 0x0084
+	DATA R0, 0x02B2
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x038B
-	DATA R1, 0x0084
+	DATA R0, 0x02B3
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x038C
-	DATA R1, 0x0094
+	DATA R0, 0x02B4
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x038D
-	DATA R1, 0x008C
+	DATA R0, 0x02B5
+	DATA R1, 0x006C
 	ST R0, R1
-	DATA R0, 0x038E
-	DATA R1, 0x0076
+	DATA R0, 0x02B6
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x038F
-	DATA R1, 0x0007
+	DATA R0, 0x02B7
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01B0
-	DATA R1, 0x003E
+	DATA R0, 0x0340
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01B1
-	DATA R1, 0x0040
+	DATA R0, 0x0341
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01B2
-	DATA R1, 0x00F8
+	DATA R0, 0x0342
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01B3
-	DATA R1, 0x0084
+	DATA R0, 0x0343
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x01B4
+	DATA R0, 0x0344
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01B5
-	DATA R1, 0x0086
+	DATA R0, 0x0345
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01B6
-	DATA R1, 0x00FC
+	DATA R0, 0x0346
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01B7
+	DATA R0, 0x0347
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0130
-	DATA R1, 0x0038
+	DATA R0, 0x03C8
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x0131
+	DATA R0, 0x03C9
+	DATA R1, 0x0044
+	ST R0, R1
+	DATA R0, 0x03CA
 	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x0132
+	DATA R0, 0x03CB
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x03CC
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x03CD
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x03CE
 	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x0133
-	DATA R1, 0x00E0
+	DATA R0, 0x03CF
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0134
-	DATA R1, 0x0094
+	DATA R0, 0x0188
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x0135
-	DATA R1, 0x0088
+	DATA R0, 0x0189
+	DATA R1, 0x0058
 	ST R0, R1
-	DATA R0, 0x0136
-	DATA R1, 0x00F4
+	DATA R0, 0x018A
+	DATA R1, 0x0018
 	ST R0, R1
-	DATA R0, 0x0137
+	DATA R0, 0x018B
+	DATA R1, 0x0018
+	ST R0, R1
+	DATA R0, 0x018C
+	DATA R1, 0x0018
+	ST R0, R1
+	DATA R0, 0x018D
+	DATA R1, 0x0018
+	ST R0, R1
+	DATA R0, 0x018E
+	DATA R1, 0x007E
+	ST R0, R1
+	DATA R0, 0x018F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01A8
-	DATA R1, 0x00FE
+	DATA R0, 0x0108
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01A9
-	DATA R1, 0x0080
+	DATA R0, 0x0109
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01AA
-	DATA R1, 0x00F8
+	DATA R0, 0x010A
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01AB
-	DATA R1, 0x0004
+	DATA R0, 0x010B
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01AC
-	DATA R1, 0x0002
+	DATA R0, 0x010C
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01AD
-	DATA R1, 0x0006
+	DATA R0, 0x010D
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01AE
-	DATA R1, 0x00FC
+	DATA R0, 0x010E
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x01AF
+	DATA R0, 0x010F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0000
-	DATA R1, 0xFFFF
+	DATA R0, 0x0128
+	DATA R1, 0x00C2
 	ST R0, R1
-	DATA R0, 0x0001
-	DATA R1, 0xFFFF
+	DATA R0, 0x0129
+	DATA R1, 0x00C4
 	ST R0, R1
-	DATA R0, 0x0002
-	DATA R1, 0xFFFF
+	DATA R0, 0x012A
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x0003
-	DATA R1, 0xFFFF
+	DATA R0, 0x012B
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x0004
-	DATA R1, 0xFFFF
+	DATA R0, 0x012C
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x0005
-	DATA R1, 0xFFFF
+	DATA R0, 0x012D
+	DATA R1, 0x004C
 	ST R0, R1
-	DATA R0, 0x0006
-	DATA R1, 0xFFFF
+	DATA R0, 0x012E
+	DATA R1, 0x008C
 	ST R0, R1
-	DATA R0, 0x0007
-	DATA R1, 0xFFFF
+	DATA R0, 0x012F
+	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0358
-	DATA R1, 0x00C4
+	DATA R0, 0x02E8
+	DATA R1, 0x0030
 	ST R0, R1
-	DATA R0, 0x0359
-	DATA R1, 0x00C8
+	DATA R0, 0x02E9
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x035A
-	DATA R1, 0x00F0
+	DATA R0, 0x02EA
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x035B
-	DATA R1, 0x00E0
+	DATA R0, 0x02EB
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x035C
-	DATA R1, 0x00D8
+	DATA R0, 0x02EC
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x035D
-	DATA R1, 0x00C4
+	DATA R0, 0x02ED
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x035E
-	DATA R1, 0x00C6
+	DATA R0, 0x02EE
+	DATA R1, 0x0030
 	ST R0, R1
-	DATA R0, 0x035F
+	DATA R0, 0x02EF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0360
-	DATA R1, 0x0080
+	DATA R0, 0x02D8
+	DATA R1, 0x0030
 	ST R0, R1
-	DATA R0, 0x0361
-	DATA R1, 0x0080
+	DATA R0, 0x02D9
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x0362
-	DATA R1, 0x0080
+	DATA R0, 0x02DA
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x0363
-	DATA R1, 0x0080
+	DATA R0, 0x02DB
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x0364
-	DATA R1, 0x0080
+	DATA R0, 0x02DC
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x0365
-	DATA R1, 0x0080
+	DATA R0, 0x02DD
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x0366
+	DATA R0, 0x02DE
+	DATA R1, 0x0030
+	ST R0, R1
+	DATA R0, 0x02DF
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02F8
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02F9
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02FA
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02FB
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02FC
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02FD
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x02FE
 	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x0367
+	DATA R0, 0x02FF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0390
-	DATA R1, 0x00FC
+	DATA R0, 0x0240
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0391
+	DATA R0, 0x0241
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0392
+	DATA R0, 0x0242
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0393
-	DATA R1, 0x00FC
+	DATA R0, 0x0243
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0394
-	DATA R1, 0x00A0
+	DATA R0, 0x0244
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0395
-	DATA R1, 0x0090
+	DATA R0, 0x0245
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0396
-	DATA R1, 0x008E
+	DATA R0, 0x0246
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0397
+	DATA R0, 0x0247
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0180
-	DATA R1, 0x007C
-	ST R0, R1
-	DATA R0, 0x0181
-	DATA R1, 0x00E2
+	DATA R0, 0x0270
+	DATA R1, 0x00C2
 	ST R0, R1
-	DATA R0, 0x0182
+	DATA R0, 0x0271
 	DATA R1, 0x00A2
 	ST R0, R1
-	DATA R0, 0x0183
+	DATA R0, 0x0272
 	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x0184
+	DATA R0, 0x0273
+	DATA R1, 0x0092
+	ST R0, R1
+	DATA R0, 0x0274
 	DATA R1, 0x008A
 	ST R0, R1
-	DATA R0, 0x0185
-	DATA R1, 0x008E
+	DATA R0, 0x0275
+	DATA R1, 0x008A
 	ST R0, R1
-	DATA R0, 0x0186
-	DATA R1, 0x007C
+	DATA R0, 0x0276
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x0187
+	DATA R0, 0x0277
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0118
-	DATA R1, 0x0028
+	DATA R0, 0x0338
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x0119
-	DATA R1, 0x0028
+	DATA R0, 0x0339
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x011A
-	DATA R1, 0x007C
+	DATA R0, 0x033A
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x011B
-	DATA R1, 0x0028
+	DATA R0, 0x033B
+	DATA R1, 0x009C
 	ST R0, R1
-	DATA R0, 0x011C
-	DATA R1, 0x007C
+	DATA R0, 0x033C
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x011D
-	DATA R1, 0x0028
+	DATA R0, 0x033D
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x011E
-	DATA R1, 0x0028
+	DATA R0, 0x033E
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x011F
+	DATA R0, 0x033F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0140
-	DATA R1, 0x0008
+	DATA R0, 0x03D8
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x03D9
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x03DA
+	DATA R1, 0x0060
+	ST R0, R1
+	DATA R0, 0x03DB
+	DATA R1, 0x0080
+	ST R0, R1
+	DATA R0, 0x03DC
+	DATA R1, 0x0060
+	ST R0, R1
+	DATA R0, 0x03DD
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x03DE
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x03DF
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0220
+	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x0141
-	DATA R1, 0x0010
+	DATA R0, 0x0221
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x0142
-	DATA R1, 0x0020
+	DATA R0, 0x0222
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0143
-	DATA R1, 0x0020
+	DATA R0, 0x0223
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0144
-	DATA R1, 0x0020
+	DATA R0, 0x0224
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0145
-	DATA R1, 0x0010
+	DATA R0, 0x0225
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x0146
-	DATA R1, 0x0008
+	DATA R0, 0x0226
+	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x0147
+	DATA R0, 0x0227
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0160
-	DATA R1, 0x0000
+	DATA R0, 0x0360
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0161
-	DATA R1, 0x0000
+	DATA R0, 0x0361
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0162
-	DATA R1, 0x0000
+	DATA R0, 0x0362
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0163
-	DATA R1, 0x0000
+	DATA R0, 0x0363
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0164
-	DATA R1, 0x0008
+	DATA R0, 0x0364
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0165
-	DATA R1, 0x0008
+	DATA R0, 0x0365
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0166
-	DATA R1, 0x0010
+	DATA R0, 0x0366
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x0167
+	DATA R0, 0x0367
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0270
+	DATA R0, 0x0370
 	DATA R1, 0x00C2
 	ST R0, R1
-	DATA R0, 0x0271
+	DATA R0, 0x0371
 	DATA R1, 0x00A2
 	ST R0, R1
-	DATA R0, 0x0272
+	DATA R0, 0x0372
 	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x0273
+	DATA R0, 0x0373
 	DATA R1, 0x0092
 	ST R0, R1
-	DATA R0, 0x0274
+	DATA R0, 0x0374
 	DATA R1, 0x008A
 	ST R0, R1
-	DATA R0, 0x0275
+	DATA R0, 0x0375
 	DATA R1, 0x008A
 	ST R0, R1
-	DATA R0, 0x0276
+	DATA R0, 0x0376
 	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x0277
+	DATA R0, 0x0377
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0298
-	DATA R1, 0x007C
+	DATA R0, 0x01A0
+	DATA R1, 0x001C
 	ST R0, R1
-	DATA R0, 0x0299
-	DATA R1, 0x0080
+	DATA R0, 0x01A1
+	DATA R1, 0x0024
 	ST R0, R1
-	DATA R0, 0x029A
-	DATA R1, 0x0080
+	DATA R0, 0x01A2
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x029B
-	DATA R1, 0x007C
+	DATA R0, 0x01A3
+	DATA R1, 0x0084
 	ST R0, R1
-	DATA R0, 0x029C
-	DATA R1, 0x0004
+	DATA R0, 0x01A4
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x029D
+	DATA R0, 0x01A5
 	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x029E
-	DATA R1, 0x00F8
+	DATA R0, 0x01A6
+	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x029F
+	DATA R0, 0x01A7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0330
-	DATA R1, 0x007E
+	DATA R0, 0x01B0
+	DATA R1, 0x003E
 	ST R0, R1
-	DATA R0, 0x0331
-	DATA R1, 0x0080
+	DATA R0, 0x01B1
+	DATA R1, 0x0040
 	ST R0, R1
-	DATA R0, 0x0332
-	DATA R1, 0x0080
+	DATA R0, 0x01B2
+	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x0333
-	DATA R1, 0x00FC
+	DATA R0, 0x01B3
+	DATA R1, 0x0084
 	ST R0, R1
-	DATA R0, 0x0334
-	DATA R1, 0x0080
+	DATA R0, 0x01B4
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0335
-	DATA R1, 0x0080
+	DATA R0, 0x01B5
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x0336
-	DATA R1, 0x0080
+	DATA R0, 0x01B6
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0337
+	DATA R0, 0x01B7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0178
-	DATA R1, 0x0002
-	ST R0, R1
-	DATA R0, 0x0179
-	DATA R1, 0x0004
-	ST R0, R1
-	DATA R0, 0x017A
-	DATA R1, 0x0008
-	ST R0, R1
-	DATA R0, 0x017B
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x017C
-	DATA R1, 0x0020
-	ST R0, R1
-	DATA R0, 0x017D
-	DATA R1, 0x0040
+	DATA R0, 0x0230
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x017E
+	DATA R0, 0x0231
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x017F
-	DATA R1, 0x0000
+	DATA R0, 0x0232
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0280
+	DATA R0, 0x0233
 	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0281
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0282
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0283
-	DATA R1, 0x01FC
-	ST R0, R1
-	DATA R0, 0x0284
+	DATA R0, 0x0234
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0285
+	DATA R0, 0x0235
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0286
+	DATA R0, 0x0236
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0287
+	DATA R0, 0x0237
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02A0
-	DATA R1, 0x00FE
-	ST R0, R1
-	DATA R0, 0x02A1
-	DATA R1, 0x0010
+	DATA R0, 0x02C8
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x02A2
-	DATA R1, 0x0010
+	DATA R0, 0x02C9
+	DATA R1, 0x0044
 	ST R0, R1
-	DATA R0, 0x02A3
-	DATA R1, 0x0010
+	DATA R0, 0x02CA
+	DATA R1, 0x0028
 	ST R0, R1
-	DATA R0, 0x02A4
+	DATA R0, 0x02CB
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02A5
+	DATA R0, 0x02CC
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02A6
+	DATA R0, 0x02CD
 	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x02A7
-	DATA R1, 0x0000
-	ST R0, R1
-	DATA R0, 0x02A8
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x02A9
-	DATA R1, 0x0042
-	ST R0, R1
-	DATA R0, 0x02AA
-	DATA R1, 0x0042
-	ST R0, R1
-	DATA R0, 0x02AB
-	DATA R1, 0x0042
-	ST R0, R1
-	DATA R0, 0x02AC
-	DATA R1, 0x0042
-	ST R0, R1
-	DATA R0, 0x02AD
-	DATA R1, 0x0042
-	ST R0, R1
-	DATA R0, 0x02AE
-	DATA R1, 0x003C
+	DATA R0, 0x02CE
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x02AF
+	DATA R0, 0x02CF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0310
-	DATA R1, 0x00FC
+	DATA R0, 0x0308
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x0311
-	DATA R1, 0x0086
+	DATA R0, 0x0309
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x0312
+	DATA R0, 0x030A
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0313
+	DATA R0, 0x030B
 	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0314
+	DATA R0, 0x030C
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0315
-	DATA R1, 0x0086
+	DATA R0, 0x030D
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0316
-	DATA R1, 0x00FC
+	DATA R0, 0x030E
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0317
+	DATA R0, 0x030F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03B0
-	DATA R1, 0x0082
+	DATA R0, 0x0320
+	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x03B1
-	DATA R1, 0x0082
+	DATA R0, 0x0321
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x03B2
+	DATA R0, 0x0322
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03B3
+	DATA R0, 0x0323
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03B4
-	DATA R1, 0x0044
+	DATA R0, 0x0324
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03B5
-	DATA R1, 0x006C
+	DATA R0, 0x0325
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x03B6
-	DATA R1, 0x0010
+	DATA R0, 0x0326
+	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x03B7
+	DATA R0, 0x0327
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01C8
+	DATA R0, 0x0378
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x01C9
+	DATA R0, 0x0379
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01CA
+	DATA R0, 0x037A
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01CB
-	DATA R1, 0x007E
+	DATA R0, 0x037B
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01CC
-	DATA R1, 0x0002
+	DATA R0, 0x037C
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01CD
+	DATA R0, 0x037D
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x01CE
+	DATA R0, 0x037E
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x01CF
+	DATA R0, 0x037F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0138
-	DATA R1, 0x0020
+	DATA R0, 0x0000
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x0139
-	DATA R1, 0x0020
+	DATA R0, 0x0001
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x013A
-	DATA R1, 0x0020
+	DATA R0, 0x0002
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x013B
-	DATA R1, 0x0000
+	DATA R0, 0x0003
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x013C
-	DATA R1, 0x0000
+	DATA R0, 0x0004
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x013D
-	DATA R1, 0x0000
+	DATA R0, 0x0005
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x013E
-	DATA R1, 0x0000
+	DATA R0, 0x0006
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x013F
-	DATA R1, 0x0000
+	DATA R0, 0x0007
+	DATA R1, 0xFFFF
 	ST R0, R1
-	DATA R0, 0x01D8
-	DATA R1, 0x0000
+	DATA R0, 0x0250
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x01D9
-	DATA R1, 0x0010
+	DATA R0, 0x0251
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x01DA
-	DATA R1, 0x0000
+	DATA R0, 0x0252
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x01DB
-	DATA R1, 0x0000
+	DATA R0, 0x0253
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x01DC
-	DATA R1, 0x0010
+	DATA R0, 0x0254
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x01DD
-	DATA R1, 0x0020
+	DATA R0, 0x0255
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x01DE
-	DATA R1, 0x0000
+	DATA R0, 0x0256
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x01DF
+	DATA R0, 0x0257
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0208
+	DATA R0, 0x0278
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x0209
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x020A
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x020B
-	DATA R1, 0x00FE
-	ST R0, R1
-	DATA R0, 0x020C
+	DATA R0, 0x0279
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x020D
+	DATA R0, 0x027A
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x020E
+	DATA R0, 0x027B
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x020F
-	DATA R1, 0x0000
-	ST R0, R1
-	DATA R0, 0x0338
-	DATA R1, 0x007E
-	ST R0, R1
-	DATA R0, 0x0339
-	DATA R1, 0x0080
-	ST R0, R1
-	DATA R0, 0x033A
-	DATA R1, 0x0080
-	ST R0, R1
-	DATA R0, 0x033B
-	DATA R1, 0x009C
-	ST R0, R1
-	DATA R0, 0x033C
+	DATA R0, 0x027C
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x033D
+	DATA R0, 0x027D
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x033E
-	DATA R1, 0x00FE
+	DATA R0, 0x027E
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x033F
+	DATA R0, 0x027F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0348
-	DATA R1, 0x00FE
+	DATA R0, 0x0310
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0349
-	DATA R1, 0x0010
+	DATA R0, 0x0311
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x034A
-	DATA R1, 0x0010
+	DATA R0, 0x0312
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x034B
-	DATA R1, 0x0010
+	DATA R0, 0x0313
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x034C
-	DATA R1, 0x0010
+	DATA R0, 0x0314
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x034D
-	DATA R1, 0x0010
+	DATA R0, 0x0315
+	DATA R1, 0x0086
 	ST R0, R1
-	DATA R0, 0x034E
-	DATA R1, 0x00FE
+	DATA R0, 0x0316
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x034F
+	DATA R0, 0x0317
 	DATA R1, 0x0000
 	ST R0, R1
 	DATA R0, 0x0350
@@ -2017,100 +2087,148 @@ ROUTINE-init-fontDescriptions:
 	DATA R0, 0x0357
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01C0
+	DATA R0, 0x0398
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x01C1
-	DATA R1, 0x0082
+	DATA R0, 0x0399
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x01C2
-	DATA R1, 0x0082
+	DATA R0, 0x039A
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x01C3
+	DATA R0, 0x039B
 	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x01C4
-	DATA R1, 0x0082
+	DATA R0, 0x039C
+	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x01C5
-	DATA R1, 0x0082
+	DATA R0, 0x039D
+	DATA R1, 0x0004
 	ST R0, R1
-	DATA R0, 0x01C6
-	DATA R1, 0x007C
+	DATA R0, 0x039E
+	DATA R1, 0x00F8
 	ST R0, R1
-	DATA R0, 0x01C7
+	DATA R0, 0x039F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0368
-	DATA R1, 0x0066
+	DATA R0, 0x0140
+	DATA R1, 0x0008
 	ST R0, R1
-	DATA R0, 0x0369
-	DATA R1, 0x00AA
+	DATA R0, 0x0141
+	DATA R1, 0x0010
 	ST R0, R1
-	DATA R0, 0x036A
-	DATA R1, 0x0092
+	DATA R0, 0x0142
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x0143
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x0144
+	DATA R1, 0x0020
+	ST R0, R1
+	DATA R0, 0x0145
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x0146
+	DATA R1, 0x0008
+	ST R0, R1
+	DATA R0, 0x0147
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0160
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0161
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0162
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0163
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0164
+	DATA R1, 0x0008
+	ST R0, R1
+	DATA R0, 0x0165
+	DATA R1, 0x0008
+	ST R0, R1
+	DATA R0, 0x0166
+	DATA R1, 0x0010
+	ST R0, R1
+	DATA R0, 0x0167
+	DATA R1, 0x0000
+	ST R0, R1
+	DATA R0, 0x0258
+	DATA R1, 0x00C4
+	ST R0, R1
+	DATA R0, 0x0259
+	DATA R1, 0x00C8
+	ST R0, R1
+	DATA R0, 0x025A
+	DATA R1, 0x00F0
 	ST R0, R1
-	DATA R0, 0x036B
-	DATA R1, 0x0092
+	DATA R0, 0x025B
+	DATA R1, 0x00E0
 	ST R0, R1
-	DATA R0, 0x036C
-	DATA R1, 0x0082
+	DATA R0, 0x025C
+	DATA R1, 0x00D8
 	ST R0, R1
-	DATA R0, 0x036D
-	DATA R1, 0x0082
+	DATA R0, 0x025D
+	DATA R1, 0x00C4
 	ST R0, R1
-	DATA R0, 0x036E
-	DATA R1, 0x0082
+	DATA R0, 0x025E
+	DATA R1, 0x00C6
 	ST R0, R1
-	DATA R0, 0x036F
+	DATA R0, 0x025F
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0188
-	DATA R1, 0x0038
+	DATA R0, 0x02D0
+	DATA R1, 0x00FE
 	ST R0, R1
-	DATA R0, 0x0189
-	DATA R1, 0x0058
+	DATA R0, 0x02D1
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x018A
-	DATA R1, 0x0018
+	DATA R0, 0x02D2
+	DATA R1, 0x000C
 	ST R0, R1
-	DATA R0, 0x018B
-	DATA R1, 0x0018
+	DATA R0, 0x02D3
+	DATA R1, 0x0038
 	ST R0, R1
-	DATA R0, 0x018C
-	DATA R1, 0x0018
+	DATA R0, 0x02D4
+	DATA R1, 0x0060
 	ST R0, R1
-	DATA R0, 0x018D
-	DATA R1, 0x0018
+	DATA R0, 0x02D5
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x018E
+	DATA R0, 0x02D6
 	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x018F
+	DATA R0, 0x02D7
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0190
-	DATA R1, 0x007C
+	DATA R0, 0x0380
+	DATA R1, 0x00FC
 	ST R0, R1
-	DATA R0, 0x0191
+	DATA R0, 0x0381
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0192
-	DATA R1, 0x001C
+	DATA R0, 0x0382
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x0193
-	DATA R1, 0x0020
+	DATA R0, 0x0383
+	DATA R1, 0x01FC
 	ST R0, R1
-	DATA R0, 0x0194
-	DATA R1, 0x0040
+	DATA R0, 0x0384
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0195
+	DATA R0, 0x0385
 	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0196
-	DATA R1, 0x00FE
+	DATA R0, 0x0386
+	DATA R1, 0x0080
 	ST R0, R1
-	DATA R0, 0x0197
+	DATA R0, 0x0387
 	DATA R1, 0x0000
 	ST R0, R1
 	DATA R0, 0x01B8
@@ -2137,203 +2255,81 @@ ROUTINE-init-fontDescriptions:
 	DATA R0, 0x01BF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03B8
-	DATA R1, 0x0082
+	DATA R0, 0x01C8
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x03B9
+	DATA R0, 0x01C9
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03BA
+	DATA R0, 0x01CA
 	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03BB
-	DATA R1, 0x0092
+	DATA R0, 0x01CB
+	DATA R1, 0x007E
 	ST R0, R1
-	DATA R0, 0x03BC
-	DATA R1, 0x00BA
+	DATA R0, 0x01CC
+	DATA R1, 0x0002
 	ST R0, R1
-	DATA R0, 0x03BD
-	DATA R1, 0x00AA
+	DATA R0, 0x01CD
+	DATA R1, 0x0082
 	ST R0, R1
-	DATA R0, 0x03BE
-	DATA R1, 0x0044
+	DATA R0, 0x01CE
+	DATA R1, 0x007C
 	ST R0, R1
-	DATA R0, 0x03BF
+	DATA R0, 0x01CF
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0110
-	DATA R1, 0x0028
-	ST R0, R1
-	DATA R0, 0x0111
-	DATA R1, 0x0028
-	ST R0, R1
-	DATA R0, 0x0112
+	DATA R0, 0x0100
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0113
+	DATA R0, 0x0101
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0114
+	DATA R0, 0x0102
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0115
+	DATA R0, 0x0103
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0116
+	DATA R0, 0x0104
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0117
+	DATA R0, 0x0105
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0150
+	DATA R0, 0x0106
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0151
-	DATA R1, 0x0092
-	ST R0, R1
-	DATA R0, 0x0152
-	DATA R1, 0x0054
-	ST R0, R1
-	DATA R0, 0x0153
-	DATA R1, 0x0038
-	ST R0, R1
-	DATA R0, 0x0154
-	DATA R1, 0x0038
-	ST R0, R1
-	DATA R0, 0x0155
-	DATA R1, 0x0054
-	ST R0, R1
-	DATA R0, 0x0156
-	DATA R1, 0x0092
-	ST R0, R1
-	DATA R0, 0x0157
+	DATA R0, 0x0107
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x01F0
-	DATA R1, 0x0040
-	ST R0, R1
-	DATA R0, 0x01F1
+	DATA R0, 0x0138
 	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x01F2
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x01F3
-	DATA R1, 0x0008
-	ST R0, R1
-	DATA R0, 0x01F4
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x01F5
+	DATA R0, 0x0139
 	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x01F6
-	DATA R1, 0x0040
+	DATA R0, 0x013A
+	DATA R1, 0x0020
 	ST R0, R1
-	DATA R0, 0x01F7
+	DATA R0, 0x013B
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x03E0
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03E1
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03E2
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03E3
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03E4
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03E5
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03E6
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x03E7
+	DATA R0, 0x013C
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0210
-	DATA R1, 0x00FC
-	ST R0, R1
-	DATA R0, 0x0211
-	DATA R1, 0x0086
-	ST R0, R1
-	DATA R0, 0x0212
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0213
-	DATA R1, 0x00FE
-	ST R0, R1
-	DATA R0, 0x0214
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0215
-	DATA R1, 0x0086
-	ST R0, R1
-	DATA R0, 0x0216
-	DATA R1, 0x00FC
-	ST R0, R1
-	DATA R0, 0x0217
+	DATA R0, 0x013D
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x02C0
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x02C1
-	DATA R1, 0x0044
-	ST R0, R1
-	DATA R0, 0x02C2
-	DATA R1, 0x0028
-	ST R0, R1
-	DATA R0, 0x02C3
-	DATA R1, 0x0010
-	ST R0, R1
-	DATA R0, 0x02C4
-	DATA R1, 0x0028
-	ST R0, R1
-	DATA R0, 0x02C5
-	DATA R1, 0x0044
-	ST R0, R1
-	DATA R0, 0x02C6
-	DATA R1, 0x00C6
-	ST R0, R1
-	DATA R0, 0x02C7
+	DATA R0, 0x013E
 	DATA R1, 0x0000
 	ST R0, R1
-	DATA R0, 0x0340
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0341
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0342
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0343
-	DATA R1, 0x00FE
-	ST R0, R1
-	DATA R0, 0x0344
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0345
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0346
-	DATA R1, 0x0082
-	ST R0, R1
-	DATA R0, 0x0347
+	DATA R0, 0x013F
 	DATA R1, 0x0000
 	ST R0, R1
-	JR R3
+	RET
 
 ROUTINE-io-drawFontCharacter:
-	DATA R2, %CALL-RETURN-ADDRESS
-	ST R2, R3
 	DATA R2, %PEN-POSITION-ADDR
 	LD R2, R2
 	DATA R0, 0xFF00
@@ -2441,13 +2437,9 @@ ROUTINE-io-drawFontCharacter-deselectIO:
 	XOR R3, R3
 	OUT Addr, R3
 	CLF
-	DATA R3, %CALL-RETURN-ADDRESS
-	LD R3, R3
-	JR R3
+	RET
 
 ROUTINE-io-pollKeyboard:
-	DATA R2, %CALL-RETURN-ADDRESS
-	ST R2, R3
 	DATA R2, 0x000F
 	OUT Addr, R2
 
@@ -2462,9 +2454,7 @@ ROUTINE-io-pollKeyboard-ENDLOOP:
 	XOR R2, R2
 	OUT Addr, R2
 	CLF
-	DATA R3, %CALL-RETURN-ADDRESS
-	LD R3, R3
-	JR R3
+	RET
 
 main:
 	DATA R0, %PEN-POSITION-ADDR
@@ -20,7 +20,20 @@ const (
 	CMP
 )
 
+// SUBTRACTION
+// there is no subtracter, the adder works out A - B as A + NOT B + 1. InvertB puts B
+// through a row of XOR gates on its way into the adder and CarryIn is the + 1
+// ----------------------
+// ADD                         A + B + carry in
+// ADD, InvertB, CarryIn       A - B
+// ADD, InvertB, no CarryIn    A - B - 1, i.e. A - B with a borrow
+//
+// the carry out of a subtraction is set when there was no borrow, when A >= B. So in
+// multi-word arithmetic the carry out of one word is the carry in of the next, for both
+// addition and subtraction. The comparator and the other operations see B as it is
+
 type ALU struct {
+	width          int
 	inputABus      *components.Bus
 	inputBBus      *components.Bus
 	outputBus      *components.Bus
@@ -28,6 +41,7 @@ type ALU struct {
 
 	Op      [3]circuit.Wire
 	CarryIn circuit.Wire
+	InvertB circuit.Wire
 
 	carryOut  circuit.Wire
 	aIsLarger circuit.Wire
@@ -43,13 +57,16 @@ type ALU struct {
 	leftShifer  components.LeftShifter
 	rightShifer components.RightShifter
 	adder       components.Adder
+	bInverters  []circuit.XORGate
 	isZero      components.IsZero
 	enablers    [7]components.Enabler
 	andGates    [3]circuit.ANDGate
 }
 
+// NewALU builds an ALU as wide as its input buses
 func NewALU(inputABus, inputBBus, outputBus, flagsOutputBus *components.Bus) *ALU {
 	a := new(ALU)
+	a.width = inputABus.Width()
 	a.inputABus = inputABus
 	a.inputBBus = inputBBus
 	a.outputBus = outputBus
@@ -57,26 +74,42 @@ func NewALU(inputABus, inputBBus, outputBus, flagsOutputBus *components.Bus) *AL
 
 	a.opDecoder = *components.NewDecoder3x8()
 
-	a.comparator = *components.NewComparator()
-	a.xorer = *components.NewXORer()
-	a.orer = *components.NewORer()
-	a.ander = *components.NewANDer()
-	a.notter = *components.NewNOTer()
-	a.leftShifer = *components.NewLeftShifter()
-	a.rightShifer = *components.NewRightShifter()
-	a.adder = *components.NewAdder()
-	a.isZero = *components.NewIsZero()
+	a.comparator = *components.NewComparator(a.width)
+	a.xorer = *components.NewXORer(a.width)
+	a.orer = *components.NewORer(a.width)
+	a.ander = *components.NewANDer(a.width)
+	a.notter = *components.NewNOTer(a.width)
+	a.leftShifer = *components.NewLeftShifter(a.width)
+	a.rightShifer = *components.NewRightShifter(a.width)
+	a.adder = *components.NewAdder(a.width)
+	a.bInverters = make([]circuit.XORGate, a.width)
+	for i := range a.bInverters {
+		a.bInverters[i] = *circuit.NewXORGate()
+	}
+	a.isZero = *components.NewIsZero(a.width)
 	a.andGates[0] = *circuit.NewANDGate()
 	a.andGates[1] = *circuit.NewANDGate()
 	a.andGates[2] = *circuit.NewANDGate()
 
 	for i := range a.enablers {
-		a.enablers[i] = *components.NewEnabler()
+		a.enablers[i] = *components.NewEnabler(a.width)
 	}
 
 	return a
 }
 
+// AddSignals names the ALU's op and flag wires, and the adder's wires under adder. The op
+// wires are added with Op[2] first so the signal reads as the operation, e.g. ADD or CMP
+func (a *ALU) AddSignals(s circuit.Scope) {
+	s.Add("op", &a.Op[2], &a.Op[1], &a.Op[0])
+	s.Add("carryIn", &a.CarryIn)
+	s.Add("invertB", &a.InvertB)
+	s.Add("carryOut", &a.carryOut)
+	s.Add("aIsLarger", &a.aIsLarger)
+	s.Add("isEqual", &a.isEqual)
+	a.adder.AddSignals(s.Scope("adder"))
+}
+
 func (a *ALU) updateOpDecoder() {
 	a.opDecoder.Update(a.Op[2].Get(), a.Op[1].Get(), a.Op[0].Get())
 }
@@ -108,7 +141,7 @@ func (a *ALU) updateAnder() {
 }
 
 func (a *ALU) updateNotter() {
-	for i := (arch.BUS_WIDTH - 1); i >= 0; i-- {
+	for i := (a.width - 1); i >= 0; i-- {
 		a.notter.SetInputWire(i, a.inputABus.GetOutputWire(i))
 	}
 	a.notter.Update()
@@ -116,7 +149,7 @@ func (a *ALU) updateNotter() {
 }
 
 func (a *ALU) updateLeftShifter() {
-	for i := (arch.BUS_WIDTH - 1); i >= 0; i-- {
+	for i := (a.width - 1); i >= 0; i-- {
 		a.leftShifer.SetInputWire(i, a.inputABus.GetOutputWire(i))
 	}
 	a.leftShifer.Update(a.CarryIn.Get())
@@ -124,7 +157,7 @@ func (a *ALU) updateLeftShifter() {
 }
 
 func (a *ALU) updateRightShifter() {
-	for i := (arch.BUS_WIDTH - 1); i >= 0; i-- {
+	for i := (a.width - 1); i >= 0; i-- {
 		a.rightShifer.SetInputWire(i, a.inputABus.GetOutputWire(i))
 	}
 	a.rightShifer.Update(a.CarryIn.Get())
@@ -132,24 +165,30 @@ func (a *ALU) updateRightShifter() {
 }
 
 func (a *ALU) updateAdder() {
-	a.setWireOnComponent(&a.adder)
+	for i := a.width - 1; i >= 0; i-- {
+		a.adder.SetInputWire(i, a.inputABus.GetOutputWire(i))
+	}
+	for i := a.width - 1; i >= 0; i-- {
+		a.bInverters[i].Update(a.inputBBus.GetOutputWire(i), a.InvertB.Get())
+		a.adder.SetInputWire(a.width+i, a.bInverters[i].Output())
+	}
 	a.adder.Update(a.CarryIn.Get())
 	a.wireToEnabler(&a.adder, 0)
 }
 
 func (a *ALU) wireToEnabler(b components.Component, enablerIndex int) {
-	for i := 0; i < arch.BUS_WIDTH; i++ {
+	for i := 0; i < a.width; i++ {
 		a.enablers[enablerIndex].SetInputWire(i, b.GetOutputWire(i))
 	}
 }
 
 func (a *ALU) setWireOnComponent(b components.Component) {
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+	for i := a.width - 1; i >= 0; i-- {
 		b.SetInputWire(i, a.inputABus.GetOutputWire(i))
 	}
 
-	for i := (arch.BUS_WIDTH * 2) - 1; i >= arch.BUS_WIDTH; i-- {
-		b.SetInputWire(i, a.inputBBus.GetOutputWire(i-16))
+	for i := (a.width * 2) - 1; i >= a.width; i-- {
+		b.SetInputWire(i, a.inputBBus.GetOutputWire(i-a.width))
 	}
 }
 
@@ -163,11 +202,11 @@ func (a *ALU) String() string {
 		}
 	}
 
-	var inputA uint16
-	var inputB uint16
-	var output uint16
-	var x uint16 = 0
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+	var inputA arch.Word
+	var inputB arch.Word
+	var output arch.Word
+	var x uint = 0
+	for i := a.width - 1; i >= 0; i-- {
 		if a.inputABus.GetOutputWire(i) {
 			inputA = inputA | (1 << x)
 		} else {
@@ -188,12 +227,13 @@ func (a *ALU) String() string {
 		x++
 	}
 	return fmt.Sprintf(
-		"ALU OP: %s, A: %s, B: %s, OUT: %s, carryin: %v, carryout: %v, larger: %v, eq: %v, zero: %v",
+		"ALU OP: %s, A: %s, B: %s, OUT: %s, carryin: %v, invertb: %v, carryout: %v, larger: %v, eq: %v, zero: %v",
 		s,
-		utils.ValueToString(inputA),
-		utils.ValueToString(inputB),
-		utils.ValueToString(output),
+		utils.WordToString(inputA, a.width),
+		utils.WordToString(inputB, a.width),
+		utils.WordToString(output, a.width),
 		a.CarryIn.Get(),
+		a.InvertB.Get(),
 		a.flagsOutputBus.GetOutputWire(0),
 		a.flagsOutputBus.GetOutputWire(1),
 		a.flagsOutputBus.GetOutputWire(2),
@@ -239,12 +279,12 @@ func (a *ALU) Update() {
 			a.carryOut.Update(a.andGates[2].Output())
 		}
 
-		for i := 0; i < arch.BUS_WIDTH; i++ {
+		for i := 0; i < a.width; i++ {
 			a.isZero.SetInputWire(i, a.enablers[enabler].GetOutputWire(i))
 			a.outputBus.SetInputWire(i, a.enablers[enabler].GetOutputWire(i))
 		}
 	} else {
-		for i := 0; i < arch.BUS_WIDTH; i++ {
+		for i := 0; i < a.width; i++ {
 			a.isZero.SetInputWire(i, true)
 			a.outputBus.SetInputWire(i, false)
 		}
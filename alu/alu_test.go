@@ -61,6 +61,60 @@ func TestAluAdd(t *testing.T) {
 	}
 }
 
+// subtraction is an ADD with B inverted, a carry in of 1 for SUB and the carry flag for SBB
+func TestAluSUB(t *testing.T) {
+	alu := NewALU(inputABus, inputBBus, outputBus, flagsBus)
+	defer alu.InvertB.Update(false)
+	alu.InvertB.Update(true)
+
+	testOp(alu, ADD, 0x0000, 0x0000, true, 0x0000, true, false, true, true, t)
+	testOp(alu, ADD, 0x0005, 0x0003, true, 0x0002, false, true, true, false, t)
+	testOp(alu, ADD, 0x1234, 0x1234, true, 0x0000, true, false, true, true, t)
+	testOp(alu, ADD, 0x8000, 0x0001, true, 0x7FFF, false, true, true, false, t)
+
+	// a borrow clears the carry out
+	testOp(alu, ADD, 0x0003, 0x0005, true, 0xFFFE, false, false, false, false, t)
+	testOp(alu, ADD, 0x0000, 0x0001, true, 0xFFFF, false, false, false, false, t)
+	testOp(alu, ADD, 0x0000, 0xFFFF, true, 0x0001, false, false, false, false, t)
+
+	for i := 0; i <= 0xFFFF; i += 0x0FF1 {
+		for j := 0; j <= 0xFFFF; j += 0x0EF3 {
+			testOp(alu, ADD, uint16(i), uint16(j), true, uint16(i-j), i == j, i > j, i >= j, i == j, t)
+		}
+	}
+}
+
+func TestAluSBB(t *testing.T) {
+	alu := NewALU(inputABus, inputBBus, outputBus, flagsBus)
+	defer alu.InvertB.Update(false)
+	alu.InvertB.Update(true)
+
+	// without a carry in there is a borrow from the word below, so one more is taken away
+	testOp(alu, ADD, 0x0005, 0x0003, false, 0x0001, false, true, true, false, t)
+	testOp(alu, ADD, 0x0005, 0x0004, false, 0x0000, false, true, true, true, t)
+	testOp(alu, ADD, 0x0005, 0x0005, false, 0xFFFF, true, false, false, false, t)
+	testOp(alu, ADD, 0x0000, 0x0000, false, 0xFFFF, true, false, false, false, t)
+
+	// with a carry in there was no borrow, the same as SUB
+	testOp(alu, ADD, 0x0005, 0x0005, true, 0x0000, true, false, true, true, t)
+
+	// 0x0001_0000 - 0x0000_0001 = 0x0000_FFFF, the lower word borrows from the upper one
+	testOp(alu, ADD, 0x0000, 0x0001, true, 0xFFFF, false, false, false, false, t)
+	testOp(alu, ADD, 0x0001, 0x0000, false, 0x0000, false, true, true, true, t)
+}
+
+// ADC is an ADD with the carry flag as the carry in, adding across words
+func TestAluADC(t *testing.T) {
+	alu := NewALU(inputABus, inputBBus, outputBus, flagsBus)
+
+	// 0x0001_FFFF + 0x0000_0001 = 0x0002_0000
+	testOp(alu, ADD, 0xFFFF, 0x0001, false, 0x0000, false, true, true, true, t)
+	testOp(alu, ADD, 0x0001, 0x0000, true, 0x0002, false, true, false, false, t)
+
+	// the carry in can carry out on its own
+	testOp(alu, ADD, 0xFFFF, 0x0000, true, 0x0000, false, true, true, true, t)
+}
+
 func TestAluSHR(t *testing.T) {
 	alu := NewALU(inputABus, inputBBus, outputBus, flagsBus)
 	for i := uint16(32768); i > 1; i /= 2 {
@@ -290,8 +344,8 @@ func TestCMP(t *testing.T) {
 }
 
 func testOp(alu *ALU, op uint16, inputA, inputB uint16, CarryIn bool, expectedOutput uint16, expectedEqual, expectedIsLarger, expectedCarry, expectedZero bool, t *testing.T) {
-	inputABus.SetValue(inputA)
-	inputBBus.SetValue(inputB)
+	inputABus.SetValue(arch.Word(inputA))
+	inputBBus.SetValue(arch.Word(inputB))
 	setOp(alu, op)
 	alu.CarryIn.Update(CarryIn)
 	alu.Update()
@@ -345,3 +399,46 @@ func getValueOfBus(bus *components.Bus) uint16 {
 	}
 	return result
 }
+
+func TestALUWidths(t *testing.T) {
+	for _, width := range arch.BUS_WIDTHS {
+		a, b, out, flags := components.NewBus(width), components.NewBus(width), components.NewBus(width), components.NewBus(width)
+		alu := NewALU(a, b, out, flags)
+		max := arch.Mask(width)
+		top := arch.Word(1) << uint(width-1)
+
+		cases := []struct {
+			op                           uint16
+			a, b                         arch.Word
+			carryIn                      bool
+			out                          arch.Word
+			carry, larger, equal, isZero bool
+		}{
+			{ADD, 2, 3, false, 5, false, false, false, false},
+			// adding all ones takes one away and carries
+			{ADD, 5, max, false, 4, true, false, false, false},
+			{ADD, max, 0, true, 0, true, true, false, true},
+			{SHL, top | 1, 0, false, 2, true, true, false, false},
+			{SHR, 1, 0, true, top, true, true, false, false},
+			{NOT, 0, 0, false, max, false, false, true, false},
+			{AND, max, top, false, top, false, true, false, false},
+			{XOR, max, max, false, 0, false, false, true, true},
+			{CMP, top, top - 1, false, 0, false, true, false, false},
+		}
+		for _, c := range cases {
+			a.SetValue(c.a)
+			b.SetValue(c.b)
+			setOp(alu, c.op)
+			alu.CarryIn.Update(c.carryIn)
+			alu.Update()
+
+			// only the adder and shifters drive the carry out
+			carry := flags.GetOutputWire(0) == c.carry || (c.op != ADD && c.op != SHL && c.op != SHR)
+			if out.Value() != c.out || !carry || flags.GetOutputWire(1) != c.larger || flags.GetOutputWire(2) != c.equal || flags.GetOutputWire(3) != c.isZero {
+				t.Logf("%d bits, op %d on 0x%X and 0x%X: expected 0x%X with carry %v, larger %v, equal %v, zero %v but got 0x%X with flags %s",
+					width, c.op, c.a, c.b, c.out, c.carry, c.larger, c.equal, c.isZero, out.Value(), flags.String()[:4])
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -2,3 +2,22 @@ package arch
 
 // BUS_WIDTH is the bit-width of the system bus and all registers.
 const BUS_WIDTH = 16
+
+// BUS_WIDTHS are the widths the datapath (components, alu, memory and the gate level cpu)
+// can be built with, the width is taken from the buses given to each part as it is built.
+// 8 bits is the machine from the book, 16 bits is the simple computer and 32 bits is a
+// wider variant of it. The rest of the simple computer (the fast core, the devices, the
+// assembler and executables) is 16 bits only
+var BUS_WIDTHS = []int{8, 16, 32}
+
+// MAX_BUS_WIDTH is the widest bus a Word can hold the value of
+const MAX_BUS_WIDTH = 32
+
+// Word is the value on a bus or in a register of any of the BUS_WIDTHS, the bits above the
+// width are zero
+type Word uint32
+
+// Mask has the lower width bits of a Word set
+func Mask(width int) Word {
+	return Word(uint64(1)<<uint(width) - 1)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/djhworld/simple-computer/executable"
 	"github.com/djhworld/simple-computer/utils"
 )
 
@@ -18,8 +19,29 @@ var reservedSymbols = map[string]interface{}{
 }
 
 type Assembler struct {
+	// Positions is the source position of each instruction passed to Process, as returned
+	// by Parser.Positions. It is optional, but without it errors do not say where they are
+	// and there can be no listing
+	Positions []Position
+
 	labels  map[string]uint16
 	symbols map[string]uint16
+
+	// symbols that have not been worked out yet, they can refer to labels and symbols
+	// defined after them
+	definitions map[string]definition
+	resolving   map[string]bool
+
+	// the instructions passed to the last call to Process, with the address of each one
+	// and the words it emitted
+	instructions []Instruction
+	addresses    []uint16
+	emitted      [][]uint16
+}
+
+// Labels returns the address of every label found by the last call to Process or ToString
+func (a *Assembler) Labels() map[string]uint16 {
+	return a.labels
 }
 
 func (a *Assembler) ResolveLabel(label LABEL) (uint16, error) {
@@ -31,41 +53,113 @@ func (a *Assembler) ResolveLabel(label LABEL) (uint16, error) {
 }
 
 func (a *Assembler) ResolveSymbol(symbol SYMBOL) (uint16, error) {
-	if v, ok := a.symbols[symbol.Name]; !ok {
-		fmt.Println(a.symbols)
+	if v, ok := a.symbols[symbol.Name]; ok {
+		return v, nil
+	}
+
+	def, ok := a.definitions[symbol.Name]
+	if !ok {
 		return 0x0000, fmt.Errorf("Cannot find symbol: %s in symbol map", symbol.Name)
+	}
+	if a.resolving[symbol.Name] {
+		return 0x0000, fmt.Errorf("symbol '%s' depends on its own value", symbol.Name)
+	}
+	a.resolving[symbol.Name] = true
+	defer delete(a.resolving, symbol.Name)
+
+	// $ is the address the symbol was defined at, rather than where it is used
+	current, hasCurrent := a.symbols[CURRENTINSTRUCTION]
+	a.symbols[CURRENTINSTRUCTION] = def.address
+	value, err := resolve(def.value, a.ResolveLabel, a.ResolveSymbol)
+	if hasCurrent {
+		a.symbols[CURRENTINSTRUCTION] = current
 	} else {
-		return v, nil
+		delete(a.symbols, CURRENTINSTRUCTION)
 	}
+	if err != nil {
+		return 0x0000, err
+	}
+
+	a.symbols[symbol.Name] = value
+	return value, nil
 }
 
-func (a *Assembler) Process(codeStartOffset uint16, instructions []Instruction) ([]uint16, error) {
+// definition is the value of a symbol and the address it was defined at
+type definition struct {
+	value   marker
+	address uint16
+}
+
+func (a *Assembler) reset() {
 	a.labels = make(map[string]uint16)
 	a.symbols = make(map[string]uint16)
+	a.definitions = make(map[string]definition)
+	a.resolving = make(map[string]bool)
+}
+
+// Process assembles the instructions to run from codeStartOffset. Every problem found
+// is reported, as an ErrorList
+func (a *Assembler) Process(codeStartOffset uint16, instructions []Instruction) ([]uint16, error) {
+	a.reset()
+	a.instructions = instructions
+	a.addresses = make([]uint16, len(instructions))
+	a.emitted = make([][]uint16, len(instructions))
 	position := uint16(0)
+	var errs ErrorList
+
+	// end is where the next instruction goes without wrapping round, so running off the
+	// top of memory is caught rather than writing over the start of it
+	end := int(codeStartOffset)
+	pastEnd := false
 
 	//calculate labels and symbols
-	for _, ins := range instructions {
+	for index, ins := range instructions {
 		position += uint16(ins.Size())
+		end += ins.Size()
+		if end > 0x10000 && !pastEnd {
+			errs.add(a.position(index), fmt.Errorf("0x%X words from 0x%04X runs past the end of memory at 0xFFFF", ins.Size(), end-ins.Size()))
+			pastEnd = true
+		}
+
+		if org, ok := ins.(ORG); ok {
+			if org.Address < position+codeStartOffset {
+				errs.add(a.position(index), fmt.Errorf(".org 0x%04X is before the current address 0x%04X, it can only move forwards", org.Address, position+codeStartOffset))
+				continue
+			}
+			position = org.Address - codeStartOffset
+			end = int(org.Address)
+		}
 
 		if label, ok := ins.(DEFLABEL); ok {
 			if _, ok := a.labels[label.Name]; ok {
-				return nil, fmt.Errorf("label '%s' already exists, all labels should be unique", label.Name)
+				errs.add(a.position(index), fmt.Errorf("label '%s' already exists, all labels should be unique", label.Name))
+				continue
 			}
 
 			a.labels[label.Name] = position + codeStartOffset
 		}
 
 		if symbol, ok := ins.(DEFSYMBOL); ok {
-			if _, ok := a.symbols[symbol.Name]; ok {
-				return nil, fmt.Errorf("symbol '%s' already exists, all symbols should be unique", symbol.Name)
+			if _, ok := a.definitions[symbol.Name]; ok {
+				errs.add(a.position(index), fmt.Errorf("symbol '%s' already exists, all symbols should be unique", symbol.Name))
+				continue
 			}
 
 			if isReservedSymbol(symbol.Name) {
-				return nil, fmt.Errorf("symbol '%s' is reserved for internal use, please use another symbol name", symbol.Name)
+				errs.add(a.position(index), fmt.Errorf("symbol '%s' is reserved for internal use, please use another symbol name", symbol.Name))
+				continue
 			}
 
-			a.symbols[symbol.Name] = symbol.Value
+			a.definitions[symbol.Name] = definition{symbol.Value, position + codeStartOffset}
+		}
+	}
+
+	//every label is known now, so work out the symbols
+	for index, ins := range instructions {
+		if symbol, ok := ins.(DEFSYMBOL); ok {
+			if _, err := a.ResolveSymbol(SYMBOL{symbol.Name}); err != nil {
+				errs.add(a.position(index), err)
+			}
 		}
 	}
 
@@ -73,6 +167,18 @@ func (a *Assembler) Process(codeStartOffset uint16, instructions []Instruction)
 
 	position = 0
 	for index, ins := range instructions {
+		if org, ok := ins.(ORG); ok {
+			// fill the gap, going backwards was reported above
+			for position+codeStartOffset < org.Address {
+				emitted = append(emitted, 0x0000)
+				position++
+			}
+		}
+		a.addresses[index] = position + codeStartOffset
+
+		if _, ok := ins.(ORG); ok {
+			continue
+		}
 		if _, ok := ins.(DEFLABEL); ok {
 			continue
 		}
@@ -84,31 +190,64 @@ func (a *Assembler) Process(codeStartOffset uint16, instructions []Instruction)
 		a.symbols[NEXTINSTRUCTION] = getNextExecutableInstructionLoc(a.symbols[CURRENTINSTRUCTION], index, instructions)
 		emit, err := ins.Emit(a.ResolveLabel, a.ResolveSymbol)
 		if err != nil {
-			return nil, err
+			errs.add(a.position(index), err)
+			emit = make([]uint16, ins.Size())
 		}
 
+		a.emitted[index] = emit
 		emitted = append(emitted, emit...)
 		position += uint16(ins.Size())
 	}
 
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
 	return emitted, nil
 }
 
+// Segments splits what the last call to Process emitted at each gap left by .org, so the
+// gaps do not have to be loaded
+func (a *Assembler) Segments() []executable.Segment {
+	segments := []executable.Segment{}
+	for index, emit := range a.emitted {
+		if len(emit) == 0 {
+			continue
+		}
+		address := a.addresses[index]
+		if n := len(segments); n > 0 && int(segments[n-1].Address)+len(segments[n-1].Words) == int(address) {
+			segments[n-1].Words = append(segments[n-1].Words, emit...)
+			continue
+		}
+		segments = append(segments, executable.Segment{Address: address, Words: append([]uint16{}, emit...)})
+	}
+	return segments
+}
+
+func (a *Assembler) position(index int) Position {
+	if index < len(a.Positions) {
+		return a.Positions[index]
+	}
+	return Position{}
+}
+
 func (a *Assembler) ToString(codeStartOffset uint16, instructions []Instruction) (string, error) {
-	a.labels = make(map[string]uint16)
-	a.symbols = make(map[string]uint16)
+	a.reset()
 	position := uint16(0)
 
 	//calculate lengths
 	for _, ins := range instructions {
 		position += uint16(ins.Size())
 
+		if org, ok := ins.(ORG); ok && org.Address >= position+codeStartOffset {
+			position = org.Address - codeStartOffset
+		}
+
 		if label, ok := ins.(DEFLABEL); ok {
 			a.labels[label.Name] = position + codeStartOffset
 		}
 
 		if symbol, ok := ins.(DEFSYMBOL); ok {
-			a.symbols[symbol.Name] = symbol.Value
+			a.definitions[symbol.Name] = definition{symbol.Value, position + codeStartOffset}
 		}
 	}
 
@@ -124,6 +263,13 @@ func (a *Assembler) ToString(codeStartOffset uint16, instructions []Instruction)
 		} else if _, ok := ins.(DEFSYMBOL); ok {
 			s := ins.(DEFSYMBOL)
 			result.WriteString(s.String())
+		} else if ins.Size() == 0 {
+			// directives such as .org that do not emit anything
+			if org, ok := ins.(ORG); ok && org.Address >= position+codeStartOffset {
+				position = org.Address - codeStartOffset
+			}
+			result.WriteString("\n")
+			result.WriteString(ins.String())
 		} else {
 			a.symbols[CURRENTINSTRUCTION] = position + codeStartOffset
 			a.symbols[NEXTINSTRUCTION] = getNextExecutableInstructionLoc(a.symbols[CURRENTINSTRUCTION], index, instructions)
@@ -0,0 +1,383 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/djhworld/simple-computer/executable"
+)
+
+func assemble(source string, t *testing.T) (*Assembler, []uint16, error) {
+	p := Parser{File: "test.asm"}
+	instructions, err := p.Parse(strings.NewReader(source))
+	if err != nil {
+		t.Logf("could not parse program: %v", err)
+		t.FailNow()
+	}
+
+	a := &Assembler{Positions: p.Positions()}
+	bin, err := a.Process(0x0500, instructions)
+	return a, bin, err
+}
+
+func TestProcessReportsEveryError(t *testing.T) {
+	_, _, err := assemble(`
+start:
+	JMP nowhere
+start:
+	DATA R0, %MISSING
+	`, t)
+
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 3 {
+		t.Logf("expected 3 errors but got %v", err)
+		t.FailNow()
+	}
+
+	expected := []string{
+		"test.asm:4:1: label 'start' already exists",
+		"test.asm:3:2: Cannot find label: nowhere",
+		"test.asm:5:2: Cannot find symbol: MISSING",
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Logf("expected error %d to start with %q but got %q", i, prefix, errs[i].Error())
+			t.FailNow()
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	source := `%ONE = 1
+start:
+	DATA R0, %ONE ; comment
+	JMP start
+`
+	a, _, err := assemble(source, t)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	out := new(bytes.Buffer)
+	if err := a.WriteListing(out, "test.asm", strings.NewReader(source)); err != nil {
+		t.Logf("could not write listing: %v", err)
+		t.FailNow()
+	}
+
+	expected := `                                  1  %ONE = 1
+0x0500                            2  start:
+0x0500  0x0020 0x0001             3  	DATA R0, %ONE ; comment
+0x0502  0x0040 0x0500             4  	JMP start
+`
+	if out.String() != expected {
+		t.Logf("expected listing\n%s\nbut got\n%s", expected, out.String())
+		t.FailNow()
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	a, _, err := assemble(`%ONE = 1
+start:
+	DATA R0, %ONE
+	.string "abc"
+	JMP start
+`, t)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	expected := []SourceLine{
+		{0x0500, Position{"test.asm", 3, 2}},
+		{0x0502, Position{"test.asm", 4, 2}},
+		{0x0504, Position{"test.asm", 5, 2}},
+	}
+	if lines := a.SourceMap(); !reflect.DeepEqual(lines, expected) {
+		t.Logf("expected %+v but got %+v", expected, lines)
+		t.FailNow()
+	}
+}
+
+func TestSegments(t *testing.T) {
+	a, _, err := assemble(`
+	JMP start
+.org 0x0510
+start:
+	HALT
+.org 0x0511
+	.word 1
+`, t)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	expected := []executable.Segment{
+		{Address: 0x0500, Words: []uint16{0x0040, 0x0510}},
+		{Address: 0x0510, Words: []uint16{0x0024, 0x0001}},
+	}
+	if segments := a.Segments(); !reflect.DeepEqual(segments, expected) {
+		t.Logf("expected %+v but got %+v", expected, segments)
+		t.FailNow()
+	}
+}
+
+func TestProcessDirectives(t *testing.T) {
+	_, bin, err := assemble(`
+%ONE = 1
+	JMP start
+.org 0x0504
+table:
+	.word %ONE, table, 0x1234
+	.fill 2, 0xFFFF
+	.string "abc"
+	.stringz "ab"
+start:
+	HALT
+	`, t)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	expected := []uint16{
+		0x0040, 0x050D,
+		0x0000, 0x0000,
+		0x0001, 0x0504, 0x1234,
+		0xFFFF, 0xFFFF,
+		0x6162, 0x6300,
+		0x6162, 0x0000,
+		0x0024,
+	}
+	if !reflect.DeepEqual(bin, expected) {
+		t.Logf("expected %X but got %X", expected, bin)
+		t.FailNow()
+	}
+}
+
+func TestProcessOrgCannotGoBackwards(t *testing.T) {
+	_, _, err := assemble(`
+	.fill 4
+.org 0x0502
+	`, t)
+	if err == nil || !strings.HasPrefix(err.Error(), "test.asm:3:1: .org 0x0502 is before the current address 0x0504") {
+		t.Logf("expected .org going backwards to be reported but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestProcessCannotRunPastEndOfMemory(t *testing.T) {
+	_, _, err := assemble(`
+.org 0xFFFC
+	.fill 4
+end:
+	DATA R0, 0x0001
+	`, t)
+	if err == nil || !strings.HasPrefix(err.Error(), "test.asm:5:2: 0x2 words from 0x10000 runs past the end of memory at 0xFFFF") {
+		t.Logf("expected running past 0xFFFF to be reported but got %v", err)
+		t.FailNow()
+	}
+
+	_, _, err = assemble(`
+.org 0xFFFE
+	.fill 3
+	`, t)
+	if err == nil || !strings.HasPrefix(err.Error(), "test.asm:3:2: 0x3 words from 0xFFFE runs past the end of memory at 0xFFFF") {
+		t.Logf("expected .fill past 0xFFFF to be reported but got %v", err)
+		t.FailNow()
+	}
+
+	// finishing on the last word is fine
+	_, bin, err := assemble(`
+.org 0xFFFC
+	.fill 4
+	`, t)
+	if err != nil || len(bin) != 0xFFFC-0x0500+4 {
+		t.Logf("expected to fill up to 0xFFFF but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestProcessExpressions(t *testing.T) {
+	_, bin, err := assemble(`
+%END = %START + 0x100
+%START = 0x0600
+%SIZE = end - start
+%HERE = $
+start:
+	DATA R0, %END
+	DATA R1, start - 1
+	DATA R2, $ + 2
+	.word %SIZE, $, 'A', %HERE
+end:
+	`, t)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	expected := []uint16{
+		0x0020, 0x0700,
+		0x0021, 0x04FF,
+		0x0022, 0x0506,
+		0x000A, 0x0506, 0x0041, 0x0500,
+	}
+	if !reflect.DeepEqual(bin, expected) {
+		t.Logf("expected %X but got %X", expected, bin)
+		t.FailNow()
+	}
+}
+
+func TestProcessReportsExpressionErrors(t *testing.T) {
+	_, _, err := assemble(`
+%A = %B + 1
+%B = %A
+%C = 1
+start:
+	DATA R0, start + 0xFFFF
+	DATA R1, 10 / (%C - 1)
+	DATA R2, %MISSING - 1
+	`, t)
+
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 5 {
+		t.Logf("expected 5 errors but got %v", err)
+		t.FailNow()
+	}
+
+	expected := []string{
+		"test.asm:2:1: symbol 'A' depends on its own value",
+		"test.asm:3:1: symbol 'B' depends on its own value",
+		"test.asm:6:2: 66815 does not fit in 16 bits",
+		"test.asm:7:2: division by zero",
+		"test.asm:8:2: Cannot find symbol: MISSING in symbol map",
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Logf("expected error %q but got %q", expected[i], e.Error())
+			t.FailNow()
+		}
+	}
+}
+
+func TestProcessMacroLabelsAreUnique(t *testing.T) {
+	a, bin, err := assemble(`
+.include <std.asm>
+	POLL-KEYBOARD
+	POLL-KEYBOARD
+	`, t)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	// each poll is DATA, OUT, IN, AND, JMPZ, DATA, ST, XOR, OUT
+	if len(bin) != 24 {
+		t.Logf("expected 24 words but got %d", len(bin))
+		t.FailNow()
+	}
+	if a.Labels()["POLL-KEYBOARD-1-poll"] != 0x0503 || a.Labels()["POLL-KEYBOARD-4-poll"] != 0x050F {
+		t.Logf("unexpected labels %v", a.Labels())
+		t.FailNow()
+	}
+}
+
+func TestObject(t *testing.T) {
+	p := Parser{File: "main.asm"}
+	instructions, err := p.Parse(strings.NewReader(`
+.extern print, message
+.global start
+start:
+	DATA R0, message
+	CALL print
+	JMP start
+.data
+count:
+	.word count, start + 1, 7
+	`))
+	if err != nil {
+		t.Logf("could not parse program: %v", err)
+		t.FailNow()
+	}
+
+	a := Assembler{Positions: p.Positions()}
+	object, err := a.Object(instructions)
+	if err != nil {
+		t.Logf("could not assemble object: %v", err)
+		t.FailNow()
+	}
+
+	expected := &Object{
+		Text: []uint16{0x0020, 0x0000, 0x0120, 0x0000, 0x0040, 0x0000},
+		Data: []uint16{0x0000, 0x0001, 0x0007},
+		Symbols: []ObjectSymbol{
+			{"start", TEXT_SECTION, 0},
+			{"print", UNDEFINED_SECTION, 0},
+			{"message", UNDEFINED_SECTION, 0},
+		},
+		Relocations: []Relocation{
+			{TEXT_SECTION, 5, TEXT_SECTION, ""},
+			{DATA_SECTION, 1, TEXT_SECTION, ""},
+			{DATA_SECTION, 0, DATA_SECTION, ""},
+			{TEXT_SECTION, 3, UNDEFINED_SECTION, "print"},
+			{TEXT_SECTION, 1, UNDEFINED_SECTION, "message"},
+		},
+	}
+	if !reflect.DeepEqual(object, expected) {
+		t.Logf("expected %+v but got %+v", expected, object)
+		t.FailNow()
+	}
+
+	buffer := bytes.Buffer{}
+	if err := WriteObject(&buffer, object); err != nil {
+		t.Logf("could not write object: %v", err)
+		t.FailNow()
+	}
+	read, err := ReadObject(&buffer)
+	if err != nil || !reflect.DeepEqual(read, expected) {
+		t.Logf("expected to read back %+v but got %+v, %v", expected, read, err)
+		t.FailNow()
+	}
+
+	if _, err := ReadObject(strings.NewReader("SCOB\x01\x00\x05")); err == nil {
+		t.Logf("expected a cut short object to be an error")
+		t.FailNow()
+	}
+}
+
+func TestObjectReportsEveryError(t *testing.T) {
+	p := Parser{File: "test.asm"}
+	instructions, _ := p.Parse(strings.NewReader(`
+.extern print
+.global missing
+print:
+start:
+	DATA R0, start * 2
+.org 0x0600
+	`))
+
+	a := Assembler{Positions: p.Positions()}
+	_, err := a.Object(instructions)
+
+	expected := []string{
+		"test.asm:7:1: .org cannot be used in an object",
+		"test.asm:4:1: label 'print' is defined here but is also .extern",
+		"test.asm:3:1: .global label 'missing' is not defined",
+		"test.asm:6:2: a value that depends on where the .text section goes cannot be relocated",
+	}
+
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != len(expected) {
+		t.Logf("expected %d errors but got %v", len(expected), err)
+		t.FailNow()
+	}
+	for i, e := range errs {
+		if !strings.HasPrefix(e.Error(), expected[i]) {
+			t.Logf("expected error %q but got %q", expected[i], e.Error())
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DIRECTIVES
+// these place raw data in the image rather than emitting instructions, they start
+// with a . so they cannot be mistaken for labels or instructions
+// ----------------------
+// .org <address>           continue from the given constant address, the gap is filled with zeros
+// .word <value>, ...       one word for each value, see EXPRESSIONS for what a value can be
+// .fill <count>[, <value>] count words of the value (default 0), the count has to be a constant
+// .string "<text>"         the text packed two characters per word, high byte first
+// .stringz "<text>"        as .string, but always ending with a zero byte
+// .include "<file>"        parse another file in place, relative to the including file
+// .text                    put what follows in the code section of an object (the default)
+// .data                    put what follows in the data section of an object
+// .global <label>, ...     let other objects use these labels
+// .extern <label>, ...     use these labels from another object, the linker fills them in
+
+// ORG moves the address of the next instruction, it can only move forwards
+type ORG struct {
+	Address uint16
+}
+
+// Size is 0 as the gap depends on where the ORG is, the assembler fills it in
+func (o ORG) Size() int {
+	return 0
+}
+
+func (o ORG) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	// noop, the assembler fills the gap
+	return nil, nil
+}
+
+func (o ORG) String() string {
+	return fmt.Sprintf(".org 0x%04X", o.Address)
+}
+
+// WORD places each value in memory as it is
+type WORD struct {
+	Values []marker
+}
+
+func (w WORD) Size() int {
+	return len(w.Values)
+}
+
+func (w WORD) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	emitted := make([]uint16, len(w.Values))
+	for i, value := range w.Values {
+		var err error
+		if emitted[i], err = resolve(value, labelResolver, symbolResolver); err != nil {
+			return nil, err
+		}
+	}
+	return emitted, nil
+}
+
+func (w WORD) String() string {
+	values := make([]string, len(w.Values))
+	for i, value := range w.Values {
+		values[i] = fmt.Sprint(value)
+	}
+	return ".word " + strings.Join(values, ", ")
+}
+
+// FILL places Count copies of Value in memory
+type FILL struct {
+	Count uint16
+	Value marker
+}
+
+func (f FILL) Size() int {
+	return int(f.Count)
+}
+
+func (f FILL) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	value, err := resolve(f.Value, labelResolver, symbolResolver)
+	if err != nil {
+		return nil, err
+	}
+	emitted := make([]uint16, f.Count)
+	for i := range emitted {
+		emitted[i] = value
+	}
+	return emitted, nil
+}
+
+func (f FILL) String() string {
+	return fmt.Sprintf(".fill %d, %v", f.Count, f.Value)
+}
+
+// STRING packs text two characters per word, the first character in the high byte.
+// If Zero is set there is always a zero byte after the text, otherwise the last word
+// is padded with a zero byte if the text has an odd length
+type STRING struct {
+	Text string
+	Zero bool
+}
+
+func (s STRING) Size() int {
+	if s.Zero {
+		return len(s.Text)/2 + 1
+	}
+	return (len(s.Text) + 1) / 2
+}
+
+func (s STRING) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	emitted := make([]uint16, s.Size())
+	for i := 0; i < len(s.Text); i++ {
+		if s.Text[i] > 0x7F {
+			return nil, fmt.Errorf("only ASCII characters can be packed into a string, not %q", s.Text[i])
+		}
+		emitted[i/2] |= uint16(s.Text[i]) << (8 * uint(1-i%2))
+	}
+	return emitted, nil
+}
+
+func (s STRING) String() string {
+	if s.Zero {
+		return ".stringz " + strconv.Quote(s.Text)
+	}
+	return ".string " + strconv.Quote(s.Text)
+}
+
+// SECTION is a part of an object that the linker places on its own
+type SECTION int
+
+const (
+	TEXT_SECTION = SECTION(iota)
+	DATA_SECTION
+	// UNDEFINED_SECTION is where the labels from other objects are
+	UNDEFINED_SECTION
+)
+
+func (s SECTION) String() string {
+	switch s {
+	case TEXT_SECTION:
+		return ".text"
+	case DATA_SECTION:
+		return ".data"
+	}
+	return "undefined"
+}
+
+// SETSECTION puts the instructions after it in a section. Without the linker the
+// sections are kept in the order they are written
+type SETSECTION struct {
+	Section SECTION
+}
+
+func (s SETSECTION) Size() int {
+	return 0
+}
+
+func (s SETSECTION) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	// noop
+	return nil, nil
+}
+
+func (s SETSECTION) String() string {
+	return s.Section.String()
+}
+
+// GLOBAL makes labels defined in this object available to other objects
+type GLOBAL struct {
+	Names []string
+}
+
+func (g GLOBAL) Size() int {
+	return 0
+}
+
+func (g GLOBAL) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	// noop
+	return nil, nil
+}
+
+func (g GLOBAL) String() string {
+	return ".global " + strings.Join(g.Names, ", ")
+}
+
+// EXTERN declares labels that are defined by another object
+type EXTERN struct {
+	Names []string
+}
+
+func (e EXTERN) Size() int {
+	return 0
+}
+
+func (e EXTERN) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	// noop
+	return nil, nil
+}
+
+func (e EXTERN) String() string {
+	return ".extern " + strings.Join(e.Names, ", ")
+}
@@ -0,0 +1,190 @@
+package asm
+
+import (
+	"fmt"
+)
+
+// DISASSEMBLY_WORDS_PER_LINE is how many words that are not instructions are put in each .word
+const DISASSEMBLY_WORDS_PER_LINE = 8
+
+// decodeTable maps the first word of every instruction the assembler can emit back to
+// the instruction, jumps, DATA, the immediates and the offsets have their second word filled in by decode
+var decodeTable = buildDecodeTable()
+
+func buildDecodeTable() map[uint16]Instruction {
+	instructions := []Instruction{CLF{}, HALT{}, RET{}, IRET{}, EI{}, DI{}, JMP{}, CALL{}}
+	for _, a := range REGISTERS {
+		instructions = append(instructions,
+			DATA{a, NUMBER{}}, ADDI{a, NUMBER{}}, ANDI{a, NUMBER{}}, ORI{a, NUMBER{}}, XORI{a, NUMBER{}}, CMPI{a, NUMBER{}},
+			JR{a}, SHR{a}, SHL{a}, NOT{a}, PUSH{a}, POP{a},
+			IN{DATA_MODE, a}, IN{ADDRESS_MODE, a}, OUT{DATA_MODE, a}, OUT{ADDRESS_MODE, a},
+		)
+		for _, b := range REGISTERS {
+			instructions = append(instructions,
+				LOAD{a, b}, STORE{a, b}, ADD{a, b}, AND{a, b}, OR{a, b}, XOR{a, b}, CMP{a, b},
+				SUB{a, b}, ADC{a, b}, SBB{a, b}, MOV{a, b},
+				LOADINDEXED{b, a, NUMBER{}}, STOREINDEXED{a, NUMBER{}, b}, LOADINCREMENT{b, a}, STOREINCREMENT{a, b},
+			)
+		}
+	}
+	for flags := range jmpfOpcodes {
+		f, _ := extractFlagsFrom("JMP" + flags)
+		instructions = append(instructions, JMPF{f, LABEL{}})
+	}
+
+	resolveLabel := func(LABEL) (uint16, error) { return 0, nil }
+	table := make(map[uint16]Instruction)
+	for _, ins := range instructions {
+		emitted, err := ins.Emit(resolveLabel, nil)
+		if err != nil {
+			panic(fmt.Sprintf("could not emit %s for the decode table: %v", ins, err))
+		}
+		table[emitted[0]] = ins
+	}
+	return table
+}
+
+// decoded is an instruction found by the disassembler, jumps are given a label once all
+// of the instructions are known
+type decoded struct {
+	address     uint16
+	instruction Instruction
+	words       []uint16
+	target      uint16
+	jump        bool
+}
+
+// decode returns the instruction starting at program[index], or nil if the words are not
+// an instruction the assembler would emit
+func decode(program []uint16, index int, address uint16) decoded {
+	ins, ok := decodeTable[program[index]]
+	if !ok || index+ins.Size() > len(program) {
+		return decoded{address: address, words: program[index : index+1]}
+	}
+
+	d := decoded{address: address, instruction: ins, words: program[index : index+ins.Size()]}
+	switch v := ins.(type) {
+	case DATA:
+		d.instruction = DATA{v.ToRegister, NUMBER{program[index+1]}}
+	case ADDI:
+		d.instruction = ADDI{v.Register, NUMBER{program[index+1]}}
+	case ANDI:
+		d.instruction = ANDI{v.Register, NUMBER{program[index+1]}}
+	case ORI:
+		d.instruction = ORI{v.Register, NUMBER{program[index+1]}}
+	case XORI:
+		d.instruction = XORI{v.Register, NUMBER{program[index+1]}}
+	case CMPI:
+		d.instruction = CMPI{v.Register, NUMBER{program[index+1]}}
+	case LOADINDEXED:
+		d.instruction = LOADINDEXED{v.ToRegister, v.MemoryAddressReg, NUMBER{program[index+1]}}
+	case STOREINDEXED:
+		d.instruction = STOREINDEXED{v.MemoryAddressReg, NUMBER{program[index+1]}, v.FromRegister}
+	case JMP, JMPF, CALL:
+		d.target = program[index+1]
+		d.jump = true
+	}
+	return d
+}
+
+// Disassemble turns a program that starts at origin back into instructions. Jump targets
+// in the program are given labels named after their address, e.g. L0510, and anything that
+// is not an instruction the assembler would emit becomes a .word, so assembling the result
+// at origin gives back the same words
+func Disassemble(program []uint16, origin uint16) ([]Instruction, error) {
+	if int(origin)+len(program) > 0x10000 {
+		return nil, fmt.Errorf("a program of %d words does not fit in memory from 0x%04X", len(program), origin)
+	}
+
+	all := []decoded{}
+	starts := make(map[uint16]bool)
+	for index := 0; index < len(program); {
+		d := decode(program, index, origin+uint16(index))
+		all = append(all, d)
+		starts[d.address] = true
+		index += len(d.words)
+	}
+
+	// only jumps to the start of an instruction can use a label
+	labels := make(map[uint16]bool)
+	for i, d := range all {
+		if !d.jump {
+			continue
+		}
+		if !starts[d.target] {
+			all[i].instruction = nil
+			continue
+		}
+		labels[d.target] = true
+	}
+
+	instructions := Instructions{}
+	words := []marker{}
+	flush := func() {
+		if len(words) > 0 {
+			instructions.Add(WORD{words})
+			words = []marker{}
+		}
+	}
+
+	for _, d := range all {
+		if labels[d.address] {
+			flush()
+			instructions.Add(DEFLABEL{labelFor(d.address)})
+		}
+
+		if d.instruction == nil {
+			for _, w := range d.words {
+				words = append(words, NUMBER{w})
+				if len(words) == DISASSEMBLY_WORDS_PER_LINE {
+					flush()
+				}
+			}
+			continue
+		}
+		flush()
+
+		switch v := d.instruction.(type) {
+		case JMP:
+			instructions.Add(JMP{LABEL{labelFor(d.target)}})
+		case JMPF:
+			instructions.Add(JMPF{v.Flags, LABEL{labelFor(d.target)}})
+		case CALL:
+			instructions.Add(CALL{LABEL{labelFor(d.target)}})
+		default:
+			instructions.Add(d.instruction)
+		}
+	}
+	flush()
+	return instructions.Get(), nil
+}
+
+// DisassembleInstruction decodes the instruction at the start of words, returning it and
+// the number of words it takes. It is for showing a single instruction, so jump targets
+// are written as addresses rather than labels. Words that are not an instruction the
+// assembler would emit give nil and a size of 1
+func DisassembleInstruction(words []uint16) (Instruction, int) {
+	if len(words) == 0 {
+		return nil, 0
+	}
+
+	d := decode(words, 0, 0)
+	if d.instruction == nil {
+		return nil, 1
+	}
+
+	target := LABEL{fmt.Sprintf("0x%04X", d.target)}
+	switch v := d.instruction.(type) {
+	case JMP:
+		return JMP{target}, len(d.words)
+	case JMPF:
+		return JMPF{v.Flags, target}, len(d.words)
+	case CALL:
+		return CALL{target}, len(d.words)
+	}
+	return d.instruction, len(d.words)
+}
+
+func labelFor(address uint16) string {
+	return fmt.Sprintf("L%04X", address)
+}
@@ -0,0 +1,152 @@
+package asm
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func reassemble(instructions []Instruction, origin uint16, t *testing.T) []uint16 {
+	source := (&Instructions{instructions}).String()
+	parsed, err := (&Parser{}).Parse(strings.NewReader(source))
+	if err != nil {
+		t.Logf("could not parse disassembly: %v\n%s", err, source)
+		t.FailNow()
+	}
+
+	bin, err := (&Assembler{}).Process(origin, parsed)
+	if err != nil {
+		t.Logf("could not assemble disassembly: %v\n%s", err, source)
+		t.FailNow()
+	}
+	return bin
+}
+
+func TestDisassemble(t *testing.T) {
+	program := []uint16{
+		0x0020, 0x1234, // DATA R0, 0x1234
+		0x0087,         // ADD R1, R3
+		0x0095,         // SHR R1
+		0x0091,         // not a canonical SHR
+		0x005F, 0x0500, // JMPCAEZ 0x0500
+		0x0120, 0x0509, // CALL 0x0509
+		0x0130,         // RET
+		0x0040, 0x0501, // JMP into the middle of the DATA
+		0x0040, // JMP with its address missing
+	}
+
+	result, err := Disassemble(program, 0x0500)
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+
+	expected := []Instruction{
+		DEFLABEL{"L0500"},
+		DATA{REG0, NUMBER{0x1234}},
+		ADD{REG1, REG3},
+		SHR{REG1},
+		WORD{[]marker{NUMBER{0x0091}}},
+		JMPF{[]string{"C", "A", "E", "Z"}, LABEL{"L0500"}},
+		CALL{LABEL{"L0509"}},
+		DEFLABEL{"L0509"},
+		RET{},
+		WORD{[]marker{NUMBER{0x0040}, NUMBER{0x0501}, NUMBER{0x0040}}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Logf("expected %v but got %v", expected, result)
+		t.FailNow()
+	}
+
+	if bin := reassemble(result, 0x0500, t); !reflect.DeepEqual(bin, program) {
+		t.Logf("expected %X but got %X", program, bin)
+		t.FailNow()
+	}
+
+	if _, err := Disassemble(make([]uint16, 0x0101), 0xFF00); err == nil {
+		t.Logf("expected a program that does not fit in memory to be an error")
+		t.FailNow()
+	}
+}
+
+func TestDisassembleInstruction(t *testing.T) {
+	tests := []struct {
+		words    []uint16
+		expected string
+		size     int
+	}{
+		{[]uint16{0x0020, 0x1234, 0x0087}, "DATA R0, 0x1234", 2},
+		{[]uint16{0x0087}, "ADD R1, R3", 1},
+		{[]uint16{0x0406}, "MOV R1, R2", 1},
+		{[]uint16{0x04F3, 0x00FF}, "CMPI R3, 0x00FF", 2},
+		{[]uint16{0x0509, 0x0010}, "LD R1, [R2 + 0x0010]", 2},
+		{[]uint16{0x0536}, "ST [R1]+, R2", 1},
+		{[]uint16{0x005F, 0x0500}, "JMPCAEZ 0x0500", 2},
+		{[]uint16{0x0120, 0x0A09}, "CALL 0x0A09", 2},
+	}
+	for _, test := range tests {
+		ins, size := DisassembleInstruction(test.words)
+		if ins == nil || ins.String() != test.expected || size != test.size {
+			t.Logf("expected %s (%d words) but got %v (%d words)", test.expected, test.size, ins, size)
+			t.FailNow()
+		}
+	}
+
+	// not canonical, and a jump with its address missing
+	for _, words := range [][]uint16{{0x0091}, {0x0040}} {
+		if ins, size := DisassembleInstruction(words); ins != nil || size != 1 {
+			t.Logf("expected %X not to be an instruction but got %v", words, ins)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDisassembleEveryWord(t *testing.T) {
+	program := make([]uint16, 0x10000)
+	for i := range program {
+		program[i] = uint16(i)
+	}
+
+	result, err := Disassemble(program, 0x0000)
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	if bin := reassemble(result, 0x0000, t); !reflect.DeepEqual(bin, program) {
+		t.Logf("every word did not survive being disassembled and assembled again")
+		t.FailNow()
+	}
+}
+
+func TestDisassembleProgramsRoundTrip(t *testing.T) {
+	files, _ := filepath.Glob("../_programs/*.bin")
+	if len(files) == 0 {
+		t.Logf("no programs found")
+		t.FailNow()
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil || len(data)%2 != 0 {
+			t.Logf("could not read %s: %v", file, err)
+			t.FailNow()
+		}
+		program := make([]uint16, len(data)/2)
+		for i := range program {
+			program[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+
+		result, err := Disassemble(program, 0x0500)
+		if err != nil {
+			t.Logf("could not disassemble %s: %v", file, err)
+			t.FailNow()
+		}
+		if bin := reassemble(result, 0x0500, t); !reflect.DeepEqual(bin, program) {
+			t.Logf("%s did not survive being disassembled and assembled again", file)
+			t.FailNow()
+		}
+	}
+}
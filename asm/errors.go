@@ -0,0 +1,62 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position is where an instruction was found in the source, lines and columns start at 1
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	file := p.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%d:%d", file, p.Line, p.Column)
+}
+
+// Error is a problem with the instruction at Pos
+type Error struct {
+	Pos Position
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Pos.Line == 0 {
+		// the position is not known
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Pos, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList holds every problem found by the parser or assembler in a single pass
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	lines := make([]string, len(l))
+	for i, err := range l {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *ErrorList) add(pos Position, err error) {
+	*l = append(*l, &Error{pos, err})
+}
+
+// err returns nil if there are no errors, so the list can be returned as an error
+func (l ErrorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
@@ -0,0 +1,377 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EXPRESSIONS
+// anywhere a value is accepted it can be worked out from numbers, symbols and labels
+// ----------------------
+// 0x1F, 31, 0b11111    numbers in hex, decimal or binary
+// 'A'                  the ASCII code of a character
+// %SYMBOL, label       the value of a symbol or the address of a label
+// $                    the address of the current instruction
+// ( )                  grouping
+// - ~                  negate and bitwise not
+// * / %                multiply, divide and remainder
+// + -                  add and subtract
+// << >>                shift left and right
+// &                    bitwise and
+// ^                    bitwise xor
+// |                    bitwise or
+//
+// operators bind tightest first as listed, the same as in C rather than Go, so 1 + 2 << 3
+// is (1 + 2) << 3. Symbol and label names can contain a -, so put spaces around a minus
+// sign that follows one. Every step has to fit in 16 bits, negative numbers down to
+// -0x8000 are stored in two's complement
+
+// CURRENTADDRESS is how the address of the current instruction is written in an expression
+const CURRENTADDRESS = "$"
+
+// EXPRESSION is a value that depends on labels or symbols, so is worked out when the
+// program is assembled. Text is the expression as it was written
+type EXPRESSION struct {
+	Text string
+	root marker
+}
+
+func (e EXPRESSION) placeholder() {
+}
+
+func (e EXPRESSION) String() string {
+	return e.Text
+}
+
+// unaryOperation and binaryOperation are the operators in an expression, the operands can be any marker
+type unaryOperation struct {
+	op      string
+	operand marker
+}
+
+func (u unaryOperation) placeholder() {
+}
+
+type binaryOperation struct {
+	op          string
+	left, right marker
+}
+
+func (b binaryOperation) placeholder() {
+}
+
+var binaryPrecedence = map[string]int{
+	"|":  1,
+	"^":  2,
+	"&":  3,
+	"<<": 4,
+	">>": 4,
+	"+":  5,
+	"-":  5,
+	"*":  6,
+	"/":  6,
+	"%":  6,
+}
+
+// resolve works out the 16 bit value of a NUMBER, SYMBOL, LABEL or EXPRESSION
+func resolve(value marker, labelResolver LabelResolver, symbolResolver SymbolResolver) (uint16, error) {
+	result, err := evaluate(value, labelResolver, symbolResolver)
+	return uint16(result), err
+}
+
+// evaluate returns a value between -0x8000 and 0xFFFF, so it can be stored in a word
+func evaluate(value marker, labelResolver LabelResolver, symbolResolver SymbolResolver) (int, error) {
+	switch v := value.(type) {
+	case NUMBER:
+		return int(v.Value), nil
+	case SYMBOL:
+		result, err := symbolResolver(v)
+		return int(result), err
+	case LABEL:
+		result, err := labelResolver(v)
+		return int(result), err
+	case EXPRESSION:
+		return evaluate(v.root, labelResolver, symbolResolver)
+	case unaryOperation:
+		operand, err := evaluate(v.operand, labelResolver, symbolResolver)
+		if err != nil {
+			return 0, err
+		}
+		switch v.op {
+		case "-":
+			return checkRange(-operand)
+		case "~":
+			return ^operand & 0xFFFF, nil
+		}
+		return operand, nil
+	case binaryOperation:
+		left, err := evaluate(v.left, labelResolver, symbolResolver)
+		if err != nil {
+			return 0, err
+		}
+		right, err := evaluate(v.right, labelResolver, symbolResolver)
+		if err != nil {
+			return 0, err
+		}
+		return operate(v.op, left, right)
+	}
+	return 0, fmt.Errorf("Unsupported value %v", value)
+}
+
+func operate(op string, left, right int) (int, error) {
+	switch op {
+	case "|":
+		return checkRange(left | right)
+	case "^":
+		return checkRange(left ^ right)
+	case "&":
+		return checkRange(left & right)
+	case "<<", ">>":
+		if right < 0 {
+			return 0, fmt.Errorf("cannot shift by a negative amount %d", right)
+		}
+		if right > 16 {
+			right = 16
+		}
+		if op == "<<" {
+			return checkRange(left << uint(right))
+		}
+		return checkRange(left >> uint(right))
+	case "+":
+		return checkRange(left + right)
+	case "-":
+		return checkRange(left - right)
+	case "*":
+		return checkRange(left * right)
+	case "/", "%":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		if op == "/" {
+			return checkRange(left / right)
+		}
+		return checkRange(left % right)
+	}
+	return 0, fmt.Errorf("unknown operator %s", op)
+}
+
+func checkRange(value int) (int, error) {
+	if value < -0x8000 || value > 0xFFFF {
+		return 0, fmt.Errorf("%d does not fit in 16 bits", value)
+	}
+	return value, nil
+}
+
+// isConstant is true if the value does not depend on any labels or symbols
+func isConstant(value marker) bool {
+	switch v := value.(type) {
+	case NUMBER:
+		return true
+	case EXPRESSION:
+		return isConstant(v.root)
+	case unaryOperation:
+		return isConstant(v.operand)
+	case binaryOperation:
+		return isConstant(v.left) && isConstant(v.right)
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	numberToken = tokenKind(iota)
+	symbolToken
+	labelToken
+	operatorToken
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value uint16
+}
+
+// isOperand is true if the token can be the left hand side of a binary operator
+func (t token) isOperand() bool {
+	return t.kind != operatorToken || t.text == ")"
+}
+
+func isNameCharacter(c byte) bool {
+	return c == '-' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func tokenise(text string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(text) && isNameCharacter(text[end]) && text[end] != '-' {
+				end++
+			}
+			value, err := parseNumber(text[i:end])
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a 16 bit number", text[i:end])
+			}
+			tokens = append(tokens, token{numberToken, text[i:end], value})
+			i = end
+		case c == '\'':
+			end := i + 1
+			for end < len(text) && text[end] != '\'' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("character %s is missing its closing quote", text[i:])
+			}
+			character, err := strconv.Unquote(text[i : end+1])
+			if err != nil || len([]rune(character)) != 1 || []rune(character)[0] > 0xFFFF {
+				return nil, fmt.Errorf("%s is not a single character", text[i:end+1])
+			}
+			tokens = append(tokens, token{numberToken, text[i : end+1], uint16([]rune(character)[0])})
+			i = end + 1
+		case c == '%' && i+1 < len(text) && isNameCharacter(text[i+1]) && (len(tokens) == 0 || !tokens[len(tokens)-1].isOperand()):
+			end := i + 1
+			for end < len(text) && isNameCharacter(text[end]) {
+				end++
+			}
+			tokens = append(tokens, token{symbolToken, text[i+1 : end], 0})
+			i = end
+		case c == '$':
+			tokens = append(tokens, token{symbolToken, CURRENTINSTRUCTION, 0})
+			i++
+		case isNameCharacter(c) && c != '-':
+			end := i
+			for end < len(text) && isNameCharacter(text[end]) {
+				end++
+			}
+			tokens = append(tokens, token{labelToken, text[i:end], 0})
+			i = end
+		case strings.HasPrefix(text[i:], "<<") || strings.HasPrefix(text[i:], ">>"):
+			tokens = append(tokens, token{operatorToken, text[i : i+2], 0})
+			i += 2
+		case strings.IndexByte("+-*/%&|^~()", c) >= 0:
+			tokens = append(tokens, token{operatorToken, text[i : i+1], 0})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// expressionParser reads operators by precedence climbing, see binaryPrecedence
+type expressionParser struct {
+	tokens []token
+	next   int
+}
+
+// parseExpression parses text into a NUMBER, SYMBOL or LABEL if that is all it is, otherwise
+// an EXPRESSION. Expressions that do not depend on any labels or symbols are worked out
+// straight away, so any problems with them are found while parsing
+func parseExpression(text string) (marker, error) {
+	text = strings.TrimSpace(text)
+	tokens, err := tokenise(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	p := expressionParser{tokens, 0}
+	root, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if p.next < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in '%s'", p.tokens[p.next].text, text)
+	}
+
+	switch root.(type) {
+	case NUMBER, LABEL:
+		return root, nil
+	case SYMBOL:
+		if text != CURRENTADDRESS {
+			return root, nil
+		}
+	}
+	if isConstant(root) {
+		value, err := resolve(root, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return NUMBER{value}, nil
+	}
+	return EXPRESSION{text, root}, nil
+}
+
+func (p *expressionParser) peek() (token, bool) {
+	if p.next >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+func (p *expressionParser) parseBinary(precedence int) (marker, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != operatorToken || binaryPrecedence[t.text] < precedence {
+			return left, nil
+		}
+		p.next++
+		right, err := p.parseBinary(binaryPrecedence[t.text] + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryOperation{t.text, left, right}
+	}
+}
+
+func (p *expressionParser) parseUnary() (marker, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("expression ends too early")
+	}
+	p.next++
+
+	switch t.kind {
+	case numberToken:
+		return NUMBER{t.value}, nil
+	case symbolToken:
+		return SYMBOL{t.text}, nil
+	case labelToken:
+		return LABEL{t.text}, nil
+	}
+
+	switch t.text {
+	case "-", "~", "+":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryOperation{t.text, operand}, nil
+	case "(":
+		inner, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return nil, fmt.Errorf("missing closing bracket")
+		}
+		p.next++
+		return inner, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s'", t.text)
+}
@@ -50,18 +50,11 @@ func (d DATA) Size() int {
 func (d DATA) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
 	instruction := dataOpcodes[d.ToRegister]
 
-	if v, ok := d.Data.(SYMBOL); ok {
-		//TODO get value from symbols map....
-		resolvedSymbol, err := symbolResolver(v)
-		if err != nil {
-			return nil, err
-		}
-		return []uint16{instruction, resolvedSymbol}, nil
-	} else if v, ok := d.Data.(NUMBER); ok {
-		return []uint16{instruction, v.Value}, nil
-	} else {
-		return nil, fmt.Errorf("Unsupported operand for Data %v", d.Data)
+	value, err := resolve(d.Data, labelResolver, symbolResolver)
+	if err != nil {
+		return nil, err
 	}
+	return []uint16{instruction, value}, nil
 }
 
 func (d DATA) String() string {
@@ -74,6 +67,169 @@ func (d DATA) String() string {
 	return fmt.Sprintf("DATA R%d, %v", d.ToRegister, d.Data)
 }
 
+// MOV
+// copy register A into register B
+// ----------------------
+// 0x0400 = MOV R0, R0
+// ...
+// 0x040F = MOV R3, R3
+type MOV struct {
+	FromRegister REGISTER
+	ToRegister   REGISTER
+}
+
+func (m MOV) Size() int {
+	return 1
+}
+
+func (m MOV) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{movBases[m.FromRegister] + uint16(m.ToRegister)}, nil
+}
+
+func (m MOV) String() string {
+	result := fmt.Sprintf("MOV R%d, R%d", m.FromRegister, m.ToRegister)
+	return result
+}
+
+// ADDI
+// add value to register (2 byte instruction)
+// ----------------------
+// 0x0480 = ADDI R0
+// 0x0481 = ADDI R1
+// 0x0482 = ADDI R2
+// 0x0483 = ADDI R3
+type ADDI struct {
+	Register REGISTER
+	Value    marker
+}
+
+func (a ADDI) Size() int {
+	return 2
+}
+
+func (a ADDI) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return emitImmediate(addiOpcodes[a.Register], a.Value, labelResolver, symbolResolver)
+}
+
+func (a ADDI) String() string {
+	return immediateString("ADDI", a.Register, a.Value)
+}
+
+// ANDI
+// bitwise AND of register and value (2 byte instruction)
+// ----------------------
+// 0x04C0 = ANDI R0
+// 0x04C1 = ANDI R1
+// 0x04C2 = ANDI R2
+// 0x04C3 = ANDI R3
+type ANDI struct {
+	Register REGISTER
+	Value    marker
+}
+
+func (a ANDI) Size() int {
+	return 2
+}
+
+func (a ANDI) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return emitImmediate(andiOpcodes[a.Register], a.Value, labelResolver, symbolResolver)
+}
+
+func (a ANDI) String() string {
+	return immediateString("ANDI", a.Register, a.Value)
+}
+
+// ORI
+// bitwise OR of register and value (2 byte instruction)
+// ----------------------
+// 0x04D0 = ORI R0
+// 0x04D1 = ORI R1
+// 0x04D2 = ORI R2
+// 0x04D3 = ORI R3
+type ORI struct {
+	Register REGISTER
+	Value    marker
+}
+
+func (o ORI) Size() int {
+	return 2
+}
+
+func (o ORI) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return emitImmediate(oriOpcodes[o.Register], o.Value, labelResolver, symbolResolver)
+}
+
+func (o ORI) String() string {
+	return immediateString("ORI", o.Register, o.Value)
+}
+
+// XORI
+// bitwise XOR of register and value (2 byte instruction)
+// ----------------------
+// 0x04E0 = XORI R0
+// 0x04E1 = XORI R1
+// 0x04E2 = XORI R2
+// 0x04E3 = XORI R3
+type XORI struct {
+	Register REGISTER
+	Value    marker
+}
+
+func (x XORI) Size() int {
+	return 2
+}
+
+func (x XORI) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return emitImmediate(xoriOpcodes[x.Register], x.Value, labelResolver, symbolResolver)
+}
+
+func (x XORI) String() string {
+	return immediateString("XORI", x.Register, x.Value)
+}
+
+// CMPI
+// compare register with value, only sets the flags (2 byte instruction)
+// ----------------------
+// 0x04F0 = CMPI R0
+// 0x04F1 = CMPI R1
+// 0x04F2 = CMPI R2
+// 0x04F3 = CMPI R3
+type CMPI struct {
+	Register REGISTER
+	Value    marker
+}
+
+func (c CMPI) Size() int {
+	return 2
+}
+
+func (c CMPI) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return emitImmediate(cmpiOpcodes[c.Register], c.Value, labelResolver, symbolResolver)
+}
+
+func (c CMPI) String() string {
+	return immediateString("CMPI", c.Register, c.Value)
+}
+
+func emitImmediate(instruction uint16, value marker, labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	resolved, err := resolve(value, labelResolver, symbolResolver)
+	if err != nil {
+		return nil, err
+	}
+	return []uint16{instruction, resolved}, nil
+}
+
+// immediateString writes the value the same way as DATA
+func immediateString(name string, register REGISTER, value marker) string {
+	if v, ok := value.(NUMBER); ok {
+		return fmt.Sprintf("%s R%d, %s", name, register, utils.ValueToString(v.Value))
+	} else if v, ok := value.(SYMBOL); ok {
+		return fmt.Sprintf("%s R%d, %s", name, register, v.String())
+	}
+
+	return fmt.Sprintf("%s R%d, %v", name, register, value)
+}
+
 // SHL
 // ----------------------
 // 0x00A0 = SHL R0
@@ -250,6 +406,110 @@ func (l LOAD) String() string {
 	return result
 }
 
+// INDEXED LOADS AND STORES
+// the address is register A plus a value, or register A which is then incremented
+// ----------------------
+// 0x0500 = LD R0, [R0 + <value>] (2 byte instruction)
+// 0x0501 = LD R1, [R0 + <value>]
+// ...
+// 0x050F = LD R3, [R3 + <value>]
+
+// 0x0510 = ST [R0 + <value>], R0 (2 byte instruction)
+// ...
+// 0x051F = ST [R3 + <value>], R3
+
+// 0x0520 = LD R0, [R0]+
+// ...
+// 0x052F = LD R3, [R3]+
+
+// 0x0530 = ST [R0]+, R0
+// ...
+// 0x053F = ST [R3]+, R3
+type LOADINDEXED struct {
+	ToRegister       REGISTER
+	MemoryAddressReg REGISTER
+	Offset           marker
+}
+
+func (l LOADINDEXED) Size() int {
+	return 2
+}
+
+func (l LOADINDEXED) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return emitImmediate(ldxBases[l.MemoryAddressReg]+uint16(l.ToRegister), l.Offset, labelResolver, symbolResolver)
+}
+
+func (l LOADINDEXED) String() string {
+	return fmt.Sprintf("LD R%d, [R%d %s]", l.ToRegister, l.MemoryAddressReg, offsetString(l.Offset))
+}
+
+type STOREINDEXED struct {
+	MemoryAddressReg REGISTER
+	Offset           marker
+	FromRegister     REGISTER
+}
+
+func (s STOREINDEXED) Size() int {
+	return 2
+}
+
+func (s STOREINDEXED) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return emitImmediate(stxBases[s.MemoryAddressReg]+uint16(s.FromRegister), s.Offset, labelResolver, symbolResolver)
+}
+
+func (s STOREINDEXED) String() string {
+	return fmt.Sprintf("ST [R%d %s], R%d", s.MemoryAddressReg, offsetString(s.Offset), s.FromRegister)
+}
+
+type LOADINCREMENT struct {
+	ToRegister       REGISTER
+	MemoryAddressReg REGISTER
+}
+
+func (l LOADINCREMENT) Size() int {
+	return 1
+}
+
+func (l LOADINCREMENT) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{ldiBases[l.MemoryAddressReg] + uint16(l.ToRegister)}, nil
+}
+
+func (l LOADINCREMENT) String() string {
+	return fmt.Sprintf("LD R%d, [R%d]+", l.ToRegister, l.MemoryAddressReg)
+}
+
+type STOREINCREMENT struct {
+	MemoryAddressReg REGISTER
+	FromRegister     REGISTER
+}
+
+func (s STOREINCREMENT) Size() int {
+	return 1
+}
+
+func (s STOREINCREMENT) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{stiBases[s.MemoryAddressReg] + uint16(s.FromRegister)}, nil
+}
+
+func (s STOREINCREMENT) String() string {
+	return fmt.Sprintf("ST [R%d]+, R%d", s.MemoryAddressReg, s.FromRegister)
+}
+
+// offsetString writes an offset with its sign, an expression that starts with a minus keeps it
+func offsetString(offset marker) string {
+	switch v := offset.(type) {
+	case NUMBER:
+		return "+ " + utils.ValueToString(v.Value)
+	case SYMBOL:
+		return "+ " + v.String()
+	case EXPRESSION:
+		if strings.HasPrefix(v.Text, "-") {
+			return v.Text
+		}
+	}
+	return fmt.Sprintf("+ %v", offset)
+}
+
 // OUT
 // ----------------------
 // 0x0078 = OUT Data, R0
@@ -478,6 +738,78 @@ func (c CMP) String() string {
 	return result
 }
 
+// SUB
+// register B = register B - register A
+// ----------------------
+// 0x0300 = SUB R0, R0
+// ...
+// 0x030F = SUB R3, R3
+type SUB struct {
+	ARegister REGISTER
+	BRegister REGISTER
+}
+
+func (s SUB) Size() int {
+	return 1
+}
+
+func (s SUB) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{subBases[s.ARegister] + uint16(s.BRegister)}, nil
+}
+
+func (s SUB) String() string {
+	result := fmt.Sprintf("SUB R%d, R%d", s.ARegister, s.BRegister)
+	return result
+}
+
+// ADC (ADD WITH CARRY)
+// register B = register B + register A + carry
+// ----------------------
+// 0x0310 = ADC R0, R0
+// ...
+// 0x031F = ADC R3, R3
+type ADC struct {
+	ARegister REGISTER
+	BRegister REGISTER
+}
+
+func (a ADC) Size() int {
+	return 1
+}
+
+func (a ADC) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{adcBases[a.ARegister] + uint16(a.BRegister)}, nil
+}
+
+func (a ADC) String() string {
+	result := fmt.Sprintf("ADC R%d, R%d", a.ARegister, a.BRegister)
+	return result
+}
+
+// SBB (SUBTRACT WITH BORROW)
+// register B = register B - register A - borrow, there was a borrow if the carry flag is clear
+// ----------------------
+// 0x0320 = SBB R0, R0
+// ...
+// 0x032F = SBB R3, R3
+type SBB struct {
+	ARegister REGISTER
+	BRegister REGISTER
+}
+
+func (s SBB) Size() int {
+	return 1
+}
+
+func (s SBB) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{sbbBases[s.ARegister] + uint16(s.BRegister)}, nil
+}
+
+func (s SBB) String() string {
+	result := fmt.Sprintf("SBB R%d, R%d", s.ARegister, s.BRegister)
+	return result
+}
+
 // CLF (CLEAR FLAGS)
 // ----------------------
 // 0x0060 CLF
@@ -497,6 +829,24 @@ func (c CLF) String() string {
 	return result
 }
 
+// HALT
+// stop the CPU
+// ----------------------
+// 0x0024 = HALT
+type HALT struct{}
+
+func (h HALT) Size() int {
+	return 1
+}
+
+func (h HALT) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{opHALT}, nil
+}
+
+func (h HALT) String() string {
+	return "HALT"
+}
+
 type JMPF struct {
 	Flags   []string
 	JumpLoc LABEL
@@ -587,77 +937,178 @@ func (a ADD) String() string {
 	return result
 }
 
-// PLACEHOLDER INSTRUCTIONS - these are used by the assembler
-type DEFLABEL struct {
-	Name string
+// STACK
+// ----------------------
+// 0x0100 = PUSH R0
+// 0x0101 = PUSH R1
+// 0x0102 = PUSH R2
+// 0x0103 = PUSH R3
+type PUSH struct {
+	Register REGISTER
 }
 
-func (l DEFLABEL) Size() int {
-	return 0
+func (p PUSH) Size() int {
+	return 1
 }
 
-func (l DEFLABEL) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
-	// noop
-	return nil, nil
+func (p PUSH) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{pushOpcodes[p.Register]}, nil
 }
 
-func (l DEFLABEL) String() string {
-	return l.Name
+func (p PUSH) String() string {
+	return fmt.Sprintf("PUSH R%d", p.Register)
 }
 
-type DEFSYMBOL struct {
-	Name  string
-	Value uint16
+// 0x0110 = POP R0
+// 0x0111 = POP R1
+// 0x0112 = POP R2
+// 0x0113 = POP R3
+type POP struct {
+	Register REGISTER
 }
 
-func (s DEFSYMBOL) Size() int {
-	return 0
+func (p POP) Size() int {
+	return 1
 }
 
-func (s DEFSYMBOL) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
-	// noop
-	return nil, nil
+func (p POP) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{popOpcodes[p.Register]}, nil
 }
 
-func (s DEFSYMBOL) String() string {
-	return fmt.Sprintf("%%%s = 0x%X", s.Name, s.Value)
+func (p POP) String() string {
+	return fmt.Sprintf("POP R%d", p.Register)
 }
 
-// PSUEDO INSTRUCTIONS - these are  composite instructions that may map to multiple opcodes
-
+// CALL
+// push the address of the next instruction onto the stack and jump (2 byte instruction)
+// ----------------------
+// 0x0120 = CALL <value>
 type CALL struct {
 	Routine LABEL
 }
 
 func (c CALL) Size() int {
-	return 4
+	return 2
 }
 
 func (c CALL) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
-	nextInsAddress, err := symbolResolver(SYMBOL{NEXTINSTRUCTION})
+	resolvedAddress, err := labelResolver(c.Routine)
 	if err != nil {
 		return nil, err
 	}
+	return []uint16{opCALL, resolvedAddress}, nil
+}
 
-	compositeInstructions := []Instruction{
-		DATA{REG3, NUMBER{nextInsAddress}},
-		JMP{c.Routine},
-	}
+func (c CALL) String() string {
+	return fmt.Sprintf("CALL %s", c.Routine)
+}
 
-	emitted := []uint16{}
-	for _, ins := range compositeInstructions {
-		if e, err := ins.Emit(labelResolver, symbolResolver); err == nil {
-			emitted = append(emitted, e...)
-		} else {
-			return nil, err
-		}
-	}
+// RET
+// pop the return address off the stack into the instruction address register
+// ----------------------
+// 0x0130 = RET
+type RET struct{}
 
-	return emitted, nil
+func (r RET) Size() int {
+	return 1
 }
 
-func (c CALL) String() string {
-	return fmt.Sprintf("CALL %s", c.Routine)
+func (r RET) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{opRET}, nil
+}
+
+func (r RET) String() string {
+	return "RET"
+}
+
+// EI
+// enable interrupts
+// ----------------------
+// 0x0200 = EI
+type EI struct{}
+
+func (e EI) Size() int {
+	return 1
+}
+
+func (e EI) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{opEI}, nil
+}
+
+func (e EI) String() string {
+	return "EI"
+}
+
+// DI
+// disable interrupts
+// ----------------------
+// 0x0210 = DI
+type DI struct{}
+
+func (d DI) Size() int {
+	return 1
+}
+
+func (d DI) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{opDI}, nil
+}
+
+func (d DI) String() string {
+	return "DI"
+}
+
+// IRET
+// return from an interrupt handler, pops the flags and return address off the stack and enables interrupts
+// ----------------------
+// 0x0220 = IRET
+type IRET struct{}
+
+func (i IRET) Size() int {
+	return 1
+}
+
+func (i IRET) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	return []uint16{opIRET}, nil
+}
+
+func (i IRET) String() string {
+	return "IRET"
+}
+
+// PLACEHOLDER INSTRUCTIONS - these are used by the assembler
+type DEFLABEL struct {
+	Name string
+}
+
+func (l DEFLABEL) Size() int {
+	return 0
+}
+
+func (l DEFLABEL) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	// noop
+	return nil, nil
+}
+
+func (l DEFLABEL) String() string {
+	return l.Name
+}
+
+type DEFSYMBOL struct {
+	Name  string
+	Value marker
+}
+
+func (s DEFSYMBOL) Size() int {
+	return 0
+}
+
+func (s DEFSYMBOL) Emit(labelResolver LabelResolver, symbolResolver SymbolResolver) ([]uint16, error) {
+	// noop
+	return nil, nil
+}
+
+func (s DEFSYMBOL) String() string {
+	return fmt.Sprintf("%%%s = %v", s.Name, s.Value)
 }
 
 // Instructions - useful list data structure for convienience
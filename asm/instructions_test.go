@@ -126,6 +126,18 @@ func TestTwoRegInstructionsString(t *testing.T) {
 		CMP{REG3, REG1}: "CMP R3, R1",
 		CMP{REG3, REG2}: "CMP R3, R2",
 		CMP{REG3, REG3}: "CMP R3, R3",
+		SUB{REG0, REG0}: "SUB R0, R0",
+		SUB{REG1, REG2}: "SUB R1, R2",
+		SUB{REG3, REG3}: "SUB R3, R3",
+		ADC{REG0, REG0}: "ADC R0, R0",
+		ADC{REG2, REG1}: "ADC R2, R1",
+		ADC{REG3, REG3}: "ADC R3, R3",
+		SBB{REG0, REG0}: "SBB R0, R0",
+		SBB{REG3, REG0}: "SBB R3, R0",
+		SBB{REG3, REG3}: "SBB R3, R3",
+		MOV{REG0, REG0}: "MOV R0, R0",
+		MOV{REG1, REG3}: "MOV R1, R3",
+		MOV{REG3, REG3}: "MOV R3, R3",
 	}
 
 	for ins, expected := range TABLE {
@@ -256,6 +268,18 @@ func TestTwoRegInstructions(t *testing.T) {
 		CMP{REG3, REG1}: []uint16{0xFD},
 		CMP{REG3, REG2}: []uint16{0xFE},
 		CMP{REG3, REG3}: []uint16{0xFF},
+		SUB{REG0, REG0}: []uint16{0x0300},
+		SUB{REG1, REG2}: []uint16{0x0306},
+		SUB{REG3, REG3}: []uint16{0x030F},
+		ADC{REG0, REG0}: []uint16{0x0310},
+		ADC{REG2, REG1}: []uint16{0x0319},
+		ADC{REG3, REG3}: []uint16{0x031F},
+		SBB{REG0, REG0}: []uint16{0x0320},
+		SBB{REG3, REG0}: []uint16{0x032C},
+		SBB{REG3, REG3}: []uint16{0x032F},
+		MOV{REG0, REG0}: []uint16{0x0400},
+		MOV{REG1, REG3}: []uint16{0x0407},
+		MOV{REG3, REG3}: []uint16{0x040F},
 	}
 
 	for ins, expected := range TABLE {
@@ -398,6 +422,95 @@ func TestDATAInstruction(t *testing.T) {
 	}
 }
 
+func TestImmediateInstructionsString(t *testing.T) {
+	var TABLE map[Instruction]string = map[Instruction]string{
+		ADDI{REG0, NUMBER{0x0001}}: "ADDI R0, 0x0001",
+		ANDI{REG1, NUMBER{0x00FF}}: "ANDI R1, 0x00FF",
+		ORI{REG2, NUMBER{0x8000}}:  "ORI R2, 0x8000",
+		XORI{REG3, NUMBER{0xFFFF}}: "XORI R3, 0xFFFF",
+		CMPI{REG0, NUMBER{0x000A}}: "CMPI R0, 0x000A",
+		ADDI{REG3, SYMBOL{"aaa"}}:  "ADDI R3, %aaa",
+		CMPI{REG2, SYMBOL{"bbb"}}:  "CMPI R2, %bbb",
+	}
+
+	for ins, expected := range TABLE {
+		if ins.String() != expected {
+			t.Logf("Expected %s got %s when testing %s", expected, ins.String(), ins)
+			t.FailNow()
+		}
+	}
+}
+
+func TestImmediateInstruction(t *testing.T) {
+	var TABLE map[Instruction][]uint16 = map[Instruction][]uint16{
+		ADDI{REG0, NUMBER{0x0001}}: []uint16{0x0480, 0x0001},
+		ADDI{REG3, NUMBER{0x0002}}: []uint16{0x0483, 0x0002},
+		ANDI{REG1, NUMBER{0x00FF}}: []uint16{0x04C1, 0x00FF},
+		ORI{REG2, NUMBER{0x8000}}:  []uint16{0x04D2, 0x8000},
+		XORI{REG3, NUMBER{0xFFFF}}: []uint16{0x04E3, 0xFFFF},
+		CMPI{REG0, NUMBER{0x000A}}: []uint16{0x04F0, 0x000A},
+		CMPI{REG2, SYMBOL{"foo"}}:  []uint16{0x04F2, 0xA000},
+	}
+
+	dummySymbolResolver := func(s SYMBOL) (uint16, error) {
+		if s.Name == "foo" {
+			return 0xA000, nil
+		}
+		return 0x0000, fmt.Errorf("received unknown symbol")
+	}
+
+	for ins, expected := range TABLE {
+		if emit, err := ins.Emit(nil, dummySymbolResolver); err == nil {
+			if reflect.DeepEqual(emit, expected) == false {
+				t.Logf("Expected %v got %v when testing %s", expected, emit, ins)
+				t.FailNow()
+			}
+		} else {
+			t.Logf("Got error %v when testing %s", err, ins)
+			t.FailNow()
+		}
+	}
+}
+
+func TestIndexedInstructionsString(t *testing.T) {
+	var TABLE map[Instruction]string = map[Instruction]string{
+		LOADINDEXED{REG1, REG0, NUMBER{0x0100}}:          "LD R1, [R0 + 0x0100]",
+		STOREINDEXED{REG2, SYMBOL{"aaa"}, REG3}:          "ST [R2 + %aaa], R3",
+		LOADINCREMENT{REG3, REG2}:                        "LD R3, [R2]+",
+		STOREINCREMENT{REG0, REG1}:                       "ST [R0]+, R1",
+		LOADINDEXED{REG0, REG0, EXPRESSION{Text: "- 2"}}: "LD R0, [R0 - 2]",
+	}
+
+	for ins, expected := range TABLE {
+		if ins.String() != expected {
+			t.Logf("Expected %s got %s when testing %s", expected, ins.String(), ins)
+			t.FailNow()
+		}
+	}
+}
+
+func TestIndexedInstructions(t *testing.T) {
+	var TABLE map[Instruction][]uint16 = map[Instruction][]uint16{
+		LOADINDEXED{REG1, REG0, NUMBER{0x0100}}:  []uint16{0x0501, 0x0100},
+		LOADINDEXED{REG0, REG3, NUMBER{0xFFFF}}:  []uint16{0x050C, 0xFFFF},
+		STOREINDEXED{REG2, NUMBER{0x0002}, REG3}: []uint16{0x051B, 0x0002},
+		LOADINCREMENT{REG3, REG2}:                []uint16{0x052B},
+		STOREINCREMENT{REG0, REG1}:               []uint16{0x0531},
+	}
+
+	for ins, expected := range TABLE {
+		if emit, err := ins.Emit(nil, nil); err == nil {
+			if reflect.DeepEqual(emit, expected) == false {
+				t.Logf("Expected %v got %v when testing %s", expected, emit, ins)
+				t.FailNow()
+			}
+		} else {
+			t.Logf("Got error %v when testing %s", err, ins)
+			t.FailNow()
+		}
+	}
+}
+
 func TestIOInstructionsString(t *testing.T) {
 	var TABLE map[Instruction]string = map[Instruction]string{
 		IN{DATA_MODE, REG0}: "IN Data, R0",
@@ -518,6 +631,23 @@ func TestCLFInstructionString(t *testing.T) {
 	}
 }
 
+func TestHALTInstruction(t *testing.T) {
+	if s := (HALT{}).String(); s != "HALT" {
+		t.Logf("Expected HALT got %s", s)
+		t.FailNow()
+	}
+
+	emit, err := HALT{}.Emit(nil, nil)
+	if err != nil {
+		t.Logf("Got error %v when testing HALT", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(emit, []uint16{0x0024}) {
+		t.Logf("Expected [0x0024] got %v when testing HALT", emit)
+		t.FailNow()
+	}
+}
+
 func TestCALLInstructionString(t *testing.T) {
 	var TABLE map[Instruction]string = map[Instruction]string{
 		CALL{LABEL{"foo"}}: "CALL foo",
@@ -533,8 +663,8 @@ func TestCALLInstructionString(t *testing.T) {
 }
 func TestCALLInstruction(t *testing.T) {
 	var TABLE map[Instruction][]uint16 = map[Instruction][]uint16{
-		CALL{LABEL{"foo"}}: []uint16{0x23, 0x1234, 0x40, 0x0001},
-		CALL{LABEL{"bar"}}: []uint16{0x23, 0x1234, 0x40, 0x0002},
+		CALL{LABEL{"foo"}}: []uint16{0x0120, 0x0001},
+		CALL{LABEL{"bar"}}: []uint16{0x0120, 0x0002},
 	}
 	dummyLabelResolver := func(l LABEL) (uint16, error) {
 		if l.Name == "foo" {
@@ -546,17 +676,51 @@ func TestCALLInstruction(t *testing.T) {
 		return 0x0000, fmt.Errorf("received unknown label")
 	}
 
-	dummySymbolResolver := func(s SYMBOL) (uint16, error) {
-		if s.Name == "NEXTINSTRUCTION" {
-			return 0x1234, nil
+	for ins, expected := range TABLE {
+		if emit, err := ins.Emit(dummyLabelResolver, nil); err == nil {
+			if reflect.DeepEqual(emit, expected) == false {
+				t.Logf("Expected %v got %v when testing %s", expected, emit, ins)
+				t.FailNow()
+			}
+		} else {
+			t.Logf("Got error %v when testing %s", err, ins)
+			t.FailNow()
 		}
+	}
+}
 
-		return 0x0000, fmt.Errorf("received unknown label")
+func TestStackInstructionString(t *testing.T) {
+	var TABLE map[Instruction]string = map[Instruction]string{
+		PUSH{REG0}: "PUSH R0",
+		PUSH{REG3}: "PUSH R3",
+		POP{REG1}:  "POP R1",
+		POP{REG2}:  "POP R2",
+		RET{}:      "RET",
 	}
 
+	for ins, expected := range TABLE {
+		if ins.String() != expected {
+			t.Logf("Expected %s got %s when testing %s", expected, ins.String(), ins)
+			t.FailNow()
+		}
+	}
+}
+
+func TestStackInstruction(t *testing.T) {
+	var TABLE map[Instruction][]uint16 = map[Instruction][]uint16{
+		PUSH{REG0}: []uint16{0x0100},
+		PUSH{REG1}: []uint16{0x0101},
+		PUSH{REG2}: []uint16{0x0102},
+		PUSH{REG3}: []uint16{0x0103},
+		POP{REG0}:  []uint16{0x0110},
+		POP{REG1}:  []uint16{0x0111},
+		POP{REG2}:  []uint16{0x0112},
+		POP{REG3}:  []uint16{0x0113},
+		RET{}:      []uint16{0x0130},
+	}
 
 	for ins, expected := range TABLE {
-		if emit, err := ins.Emit(dummyLabelResolver, dummySymbolResolver); err == nil {
+		if emit, err := ins.Emit(nil, nil); err == nil {
 			if reflect.DeepEqual(emit, expected) == false {
 				t.Logf("Expected %v got %v when testing %s", expected, emit, ins)
 				t.FailNow()
@@ -567,6 +731,42 @@ func TestCALLInstruction(t *testing.T) {
 		}
 	}
 }
+
+func TestInterruptInstructionString(t *testing.T) {
+	var TABLE map[Instruction]string = map[Instruction]string{
+		EI{}:   "EI",
+		DI{}:   "DI",
+		IRET{}: "IRET",
+	}
+
+	for ins, expected := range TABLE {
+		if ins.String() != expected {
+			t.Logf("Expected %s got %s when testing %s", expected, ins.String(), ins)
+			t.FailNow()
+		}
+	}
+}
+
+func TestInterruptInstruction(t *testing.T) {
+	var TABLE map[Instruction][]uint16 = map[Instruction][]uint16{
+		EI{}:   []uint16{0x0200},
+		DI{}:   []uint16{0x0210},
+		IRET{}: []uint16{0x0220},
+	}
+
+	for ins, expected := range TABLE {
+		if emit, err := ins.Emit(nil, nil); err == nil {
+			if reflect.DeepEqual(emit, expected) == false {
+				t.Logf("Expected %v got %v when testing %s", expected, emit, ins)
+				t.FailNow()
+			}
+		} else {
+			t.Logf("Got error %v when testing %s", err, ins)
+			t.FailNow()
+		}
+	}
+}
+
 func TestCLFInstruction(t *testing.T) {
 	var TABLE map[Instruction][]uint16 = map[Instruction][]uint16{
 		CLF{}: []uint16{0x60},
@@ -0,0 +1,66 @@
+; standard macros for the simple computer, include with
+;
+;     .include <std.asm>
+;
+; these are the helpers the generator uses, so they share its RAM layout
+;     0x0000 - 0x03FF ASCII table
+;     0x0400          pen position
+;     0x0401          keycode register
+;     0xFF01          line x
+
+%DISPLAY-ADAPTER-ADDR = 0x0007
+%KEY-ADAPTER-ADDR = 0x000F
+%PEN-POSITION-ADDR = 0x0400
+%KEYCODE-REGISTER = 0x0401
+%LINEX = 0xFF01
+
+; select the display adapter so OUT Data writes to display RAM, using reg
+.macro SELECT-DISPLAY-ADAPTER reg
+	DATA \reg, %DISPLAY-ADAPTER-ADDR
+	OUT Addr, \reg
+.endm
+
+; select the keyboard adapter so IN Data reads the keycode, using reg
+.macro SELECT-KEYBOARD-ADAPTER reg
+	DATA \reg, %KEY-ADAPTER-ADDR
+	OUT Addr, \reg
+.endm
+
+; deselect whichever IO adapter is selected, using reg
+.macro DESELECT-IO reg
+	XOR \reg, \reg
+	OUT Addr, \reg
+.endm
+
+; move the pen to position, using R0 and R1
+.macro UPDATE-PEN-POSITION position
+	DATA R0, %PEN-POSITION-ADDR
+	DATA R1, \position
+	ST R0, R1
+.endm
+
+; put char in the keycode register, using R0 and R1
+.macro LOAD-KEYCODE char
+	DATA R0, %KEYCODE-REGISTER
+	DATA R1, \char
+	ST R0, R1
+.endm
+
+; set line x back to 0, using R2 and R3
+.macro RESET-LINEX
+	DATA R2, %LINEX
+	DATA R3, 0x0000
+	ST R2, R3
+.endm
+
+; wait for a key and put it in the keycode register, using R0, R2 and R3
+.macro POLL-KEYBOARD
+	SELECT-KEYBOARD-ADAPTER R2
+poll:
+	IN Data, R3
+	AND R3, R3
+	JMPZ poll
+	DATA R0, %KEYCODE-REGISTER
+	ST R0, R3
+	DESELECT-IO R2
+.endm
@@ -0,0 +1,108 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/djhworld/simple-computer/utils"
+)
+
+// LISTING_WORDS_PER_LINE is how many emitted words are shown next to each source line,
+// the rest go on the lines below
+const LISTING_WORDS_PER_LINE = 3
+
+// WriteListing writes each line of source next to the address and words emitted for it
+// by the last call to Process. file is the name the source was parsed with, only the
+// instructions from that file are listed
+func (a *Assembler) WriteListing(w io.Writer, file string, source io.Reader) error {
+	if a.addresses == nil {
+		return fmt.Errorf("nothing has been assembled yet")
+	}
+	if len(a.Positions) != len(a.addresses) {
+		return fmt.Errorf("a listing needs the position of every instruction")
+	}
+
+	// line number -> index of the instructions on that line
+	lines := make(map[int][]int)
+	for index, pos := range a.Positions {
+		if pos.File == file {
+			lines[pos.Line] = append(lines[pos.Line], index)
+		}
+	}
+
+	scanner := bufio.NewScanner(source)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		address := ""
+		var words []uint16
+		for _, index := range lines[lineNumber] {
+			if !a.hasAddress(index) {
+				continue
+			}
+			if address == "" {
+				address = utils.ValueToString(a.addresses[index])
+			}
+			words = append(words, a.emitted[index]...)
+		}
+
+		if err := writeListingLine(w, address, words, fmt.Sprintf("%5d  %s", lineNumber, scanner.Text())); err != nil {
+			return err
+		}
+
+		// anything that did not fit goes on its own lines below
+		for i := LISTING_WORDS_PER_LINE; i < len(words); i += LISTING_WORDS_PER_LINE {
+			end := i + LISTING_WORDS_PER_LINE
+			if end > len(words) {
+				end = len(words)
+			}
+			if err := writeListingLine(w, "", words[i:end], ""); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// SourceLine is the source position of the instruction emitted at Address
+type SourceLine struct {
+	Address  uint16
+	Position Position
+}
+
+// SourceMap gives the source position of each instruction emitted by the last call to
+// Process, in address order. Instructions that follow on from the same line, e.g. the
+// bytes of a .string or the body of a macro, only get one entry
+func (a *Assembler) SourceMap() []SourceLine {
+	lines := []SourceLine{}
+	for index, emit := range a.emitted {
+		if len(emit) == 0 {
+			continue
+		}
+		pos := a.position(index)
+		if n := len(lines); n > 0 && lines[n-1].Position == pos {
+			continue
+		}
+		lines = append(lines, SourceLine{a.addresses[index], pos})
+	}
+	return lines
+}
+
+// hasAddress is false for symbols, labels have an address even though they emit nothing
+func (a *Assembler) hasAddress(index int) bool {
+	_, ok := a.instructions[index].(DEFSYMBOL)
+	return !ok
+}
+
+func writeListingLine(w io.Writer, address string, words []uint16, source string) error {
+	var hex []string
+	for i := 0; i < len(words) && i < LISTING_WORDS_PER_LINE; i++ {
+		hex = append(hex, utils.ValueToString(words[i]))
+	}
+	line := fmt.Sprintf("%-8s%-22s%s", address, strings.Join(hex, " "), source)
+	_, err := fmt.Fprintln(w, strings.TrimRight(line, " "))
+	return err
+}
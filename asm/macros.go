@@ -0,0 +1,198 @@
+package asm
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+)
+
+// MACROS
+// a macro is a block of lines that is copied in wherever its name is used
+// ----------------------
+// .macro <NAME> [<arg>, ...]    start a macro, the arguments are used in its lines as \arg
+// .endm                         end the macro
+// <NAME> [<value>, ...]         copy in the macro's lines with \arg replaced by each value
+//
+// labels defined in a macro are renamed each time it is used, so a macro can have loops
+// and be used more than once. A macro can use other macros but not itself, and has to
+// be defined before it is used
+
+// library holds the files that can be included with .include <file>
+//
+//go:embed lib/*.asm
+var library embed.FS
+
+// MAX_MACRO_DEPTH is how deep macros can use other macros
+const MAX_MACRO_DEPTH = 64
+
+type macro struct {
+	name   string
+	params []string
+	lines  []macroLine
+	pos    Position
+}
+
+type macroLine struct {
+	pos  Position
+	text string
+}
+
+// expansion is a macro being copied in at pos
+type expansion struct {
+	name string
+	pos  Position
+}
+
+// startMacro begins collecting the lines of the macro defined by a .macro directive
+func (p *Parser) startMacro(pos Position, operands string) {
+	fields := strings.Fields(operands)
+	if len(fields) == 0 {
+		p.fail(pos, fmt.Errorf(".macro needs a name"))
+		return
+	}
+
+	m := &macro{name: fields[0], pos: pos}
+	// the lines are still collected so a bad definition does not cause errors on each of them
+	p.defining = m
+
+	if !LABEL_NAME.MatchString(m.name) {
+		p.fail(pos, fmt.Errorf("'%s' is not a valid macro name", m.name))
+		return
+	}
+	if _, ok := p.macros[m.name]; ok {
+		p.fail(pos, fmt.Errorf("macro %s already exists, all macros should be unique", m.name))
+		return
+	}
+
+	for _, param := range splitOperands(strings.TrimSpace(operands[strings.Index(operands, m.name)+len(m.name):])) {
+		if !LABEL_NAME.MatchString(param) {
+			p.fail(pos, fmt.Errorf("'%s' is not a valid argument name for macro %s", param, m.name))
+			return
+		}
+		for _, existing := range m.params {
+			if existing == param {
+				p.fail(pos, fmt.Errorf("macro %s has more than one argument called %s", m.name, param))
+				return
+			}
+		}
+		m.params = append(m.params, param)
+	}
+	p.macros[m.name] = m
+}
+
+// define adds a line to the macro being defined, until the .endm
+func (p *Parser) define(pos Position, line string) {
+	if tokens := IS_DIRECTIVE.FindStringSubmatch(line); tokens != nil {
+		switch tokens[1] {
+		case "endm":
+			p.defining = nil
+			return
+		case "macro":
+			p.fail(pos, fmt.Errorf("macro %s cannot be defined inside macro %s", strings.TrimSpace(tokens[2]), p.defining.name))
+			return
+		}
+	}
+	p.defining.lines = append(p.defining.lines, macroLine{pos, line})
+}
+
+// expand parses the lines of a macro in place of the line that used it
+func (p *Parser) expand(pos Position, m *macro, operands string, including []string) {
+	for _, e := range p.expanding {
+		if e.name == m.name {
+			p.fail(pos, fmt.Errorf("macro %s uses itself", m.name))
+			return
+		}
+	}
+	if len(p.expanding) >= MAX_MACRO_DEPTH {
+		p.fail(pos, fmt.Errorf("macros are used more than %d deep", MAX_MACRO_DEPTH))
+		return
+	}
+
+	args := splitOperands(operands)
+	if len(args) != len(m.params) {
+		p.fail(pos, fmt.Errorf("macro %s needs %d arguments but got %d", m.name, len(m.params), len(args)))
+		return
+	}
+
+	values := make(map[string]string)
+	for i, param := range m.params {
+		values[param] = args[i]
+	}
+
+	p.expansions++
+	labels := make(map[string]string)
+	for _, line := range m.lines {
+		if IS_DEFLABEL.MatchString(line.text) {
+			name := strings.TrimSuffix(line.text, ":")
+			labels[name] = fmt.Sprintf("%s-%d-%s", m.name, p.expansions, name)
+		}
+	}
+
+	p.expanding = append(p.expanding, expansion{m.name, pos})
+	defer func() {
+		p.expanding = p.expanding[:len(p.expanding)-1]
+	}()
+
+	for _, line := range m.lines {
+		text, err := substitute(line.text, values, labels)
+		if err != nil {
+			p.fail(line.pos, err)
+			continue
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			p.parseLine(line.pos, text, including)
+		}
+	}
+}
+
+// substitute replaces each \arg with its value and each label with its name for this
+// expansion. Nothing in quotes is changed
+func substitute(line string, values map[string]string, labels map[string]string) (string, error) {
+	result := strings.Builder{}
+	var quote byte
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(line) {
+				result.WriteByte(c)
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			result.WriteByte(line[i])
+			i++
+		case c == '"' || c == '\'':
+			quote = c
+			result.WriteByte(c)
+			i++
+		case c == '\\':
+			end := i + 1
+			for end < len(line) && isNameCharacter(line[end]) {
+				end++
+			}
+			value, ok := values[line[i+1:end]]
+			if !ok {
+				return "", fmt.Errorf("unknown macro argument '%s'", line[i:end])
+			}
+			result.WriteString(value)
+			i = end
+		case isNameCharacter(c):
+			end := i
+			for end < len(line) && isNameCharacter(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			// %word is a symbol, not a label
+			if name, ok := labels[word]; ok && (i == 0 || line[i-1] != '%') {
+				word = name
+			}
+			result.WriteString(word)
+			i = end
+		default:
+			result.WriteByte(c)
+			i++
+		}
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,353 @@
+package asm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// OBJECT_MAGIC starts every object file, followed by OBJECT_VERSION
+const OBJECT_MAGIC = "SCOB"
+const OBJECT_VERSION = uint16(1)
+
+// relocationProbe is how far a section or external label is moved to find the words
+// that depend on it, it is not a power of two so that masking a label is caught
+const relocationProbe = uint16(0x0101)
+
+// Object is code that can go anywhere in memory, the linker places the sections of
+// each object and fills in the words that depend on where they went
+type Object struct {
+	Text []uint16
+	Data []uint16
+
+	// Symbols are the .global labels defined by this object, and the .extern labels
+	// it uses with the UNDEFINED_SECTION
+	Symbols     []ObjectSymbol
+	Relocations []Relocation
+}
+
+// ObjectSymbol is a label at Offset words into Section
+type ObjectSymbol struct {
+	Name    string
+	Section SECTION
+	Offset  uint16
+}
+
+// Relocation is a word at Offset in Section that has the address of the Target section
+// added to it when it is linked. If the Target is UNDEFINED_SECTION the address of the
+// external label Symbol is added instead
+type Relocation struct {
+	Section SECTION
+	Offset  uint16
+	Target  SECTION
+	Symbol  string
+}
+
+// Object assembles the instructions into an Object, with each section starting at 0.
+// A value can only be relocated if it is a label plus or minus a constant, or the
+// difference between two labels in the same section. Every problem found is reported,
+// as an ErrorList
+func (a *Assembler) Object(instructions []Instruction) (*Object, error) {
+	var errs ErrorList
+
+	sections := make([]SECTION, len(instructions))
+	offsets := make([]uint16, len(instructions))
+	sizes := [2]int{}
+	section := TEXT_SECTION
+	externs := []string{}
+	isExtern := make(map[string]bool)
+	defined := make(map[string]int)
+
+	for index, ins := range instructions {
+		switch v := ins.(type) {
+		case SETSECTION:
+			section = v.Section
+		case ORG:
+			errs.add(a.position(index), fmt.Errorf(".org cannot be used in an object, the linker decides where each section goes"))
+		case EXTERN:
+			for _, name := range v.Names {
+				if !isExtern[name] {
+					isExtern[name] = true
+					externs = append(externs, name)
+				}
+			}
+		case DEFLABEL:
+			if _, ok := defined[v.Name]; !ok {
+				defined[v.Name] = index
+			}
+		}
+
+		sections[index] = section
+		offsets[index] = uint16(sizes[section])
+		sizes[section] += ins.Size()
+		if sizes[section] > 0x10000 {
+			errs.add(a.position(index), fmt.Errorf("the %s section is bigger than memory", section))
+			return nil, errs
+		}
+	}
+
+	for _, name := range externs {
+		if index, ok := defined[name]; ok {
+			errs.add(a.position(index), fmt.Errorf("label '%s' is defined here but is also .extern", name))
+		}
+	}
+
+	object := &Object{}
+	for index, ins := range instructions {
+		if global, ok := ins.(GLOBAL); ok {
+			for _, name := range global.Names {
+				label, ok := defined[name]
+				if !ok {
+					errs.add(a.position(index), fmt.Errorf(".global label '%s' is not defined", name))
+					continue
+				}
+				object.Symbols = append(object.Symbols, ObjectSymbol{name, sections[label], offsets[label]})
+			}
+		}
+	}
+	for _, name := range externs {
+		object.Symbols = append(object.Symbols, ObjectSymbol{name, UNDEFINED_SECTION, 0})
+	}
+
+	// everything at 0 gives the words as they are stored in the object
+	externals := make(map[string]uint16)
+	for _, name := range externs {
+		externals[name] = 0
+	}
+	words, emitErrs := a.emitSections(instructions, sections, offsets, [2]uint16{}, externals)
+	errs = append(errs, emitErrs...)
+	object.Text = words[TEXT_SECTION]
+	object.Data = words[DATA_SECTION]
+
+	// move each section and external label in turn, the words that move with it need relocating
+	probes := []Relocation{{Target: TEXT_SECTION}, {Target: DATA_SECTION}}
+	for _, name := range externs {
+		probes = append(probes, Relocation{Target: UNDEFINED_SECTION, Symbol: name})
+	}
+	for _, probe := range probes {
+		bases := [2]uint16{}
+		moved := make(map[string]uint16)
+		for _, name := range externs {
+			moved[name] = 0
+		}
+		if probe.Target == UNDEFINED_SECTION {
+			moved[probe.Symbol] = relocationProbe
+		} else {
+			bases[probe.Target] = relocationProbe
+		}
+
+		probed, _ := a.emitSections(instructions, sections, offsets, bases, moved)
+		for s := range words {
+			for offset := range words[s] {
+				delta := probed[s][offset] - words[s][offset]
+				if delta == 0 {
+					continue
+				}
+				if delta != relocationProbe {
+					errs.add(a.position(a.instructionAt(sections, offsets, SECTION(s), offset)), fmt.Errorf("a value that depends on %s cannot be relocated, only a label plus or minus a constant can", describeProbe(probe)))
+					continue
+				}
+				object.Relocations = append(object.Relocations, Relocation{SECTION(s), uint16(offset), probe.Target, probe.Symbol})
+			}
+		}
+	}
+
+	// the base run is the one to keep for the listing
+	a.emitSections(instructions, sections, offsets, [2]uint16{}, externals)
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func describeProbe(probe Relocation) string {
+	if probe.Target == UNDEFINED_SECTION {
+		return fmt.Sprintf("label '%s'", probe.Symbol)
+	}
+	return fmt.Sprintf("where the %s section goes", probe.Target)
+}
+
+// instructionAt finds the instruction that emitted the word at offset in section
+func (a *Assembler) instructionAt(sections []SECTION, offsets []uint16, section SECTION, offset int) int {
+	for index := len(offsets) - 1; index >= 0; index-- {
+		if sections[index] == section && int(offsets[index]) <= offset && a.instructions[index].Size() > 0 {
+			return index
+		}
+	}
+	return 0
+}
+
+// emitSections assembles the instructions with each section starting at bases and the
+// external labels at the given addresses
+func (a *Assembler) emitSections(instructions []Instruction, sections []SECTION, offsets []uint16, bases [2]uint16, externals map[string]uint16) ([2][]uint16, ErrorList) {
+	a.reset()
+	a.instructions = instructions
+	a.addresses = make([]uint16, len(instructions))
+	a.emitted = make([][]uint16, len(instructions))
+	var errs ErrorList
+
+	for index, ins := range instructions {
+		address := bases[sections[index]] + offsets[index]
+		a.addresses[index] = address
+
+		if label, ok := ins.(DEFLABEL); ok {
+			if _, ok := a.labels[label.Name]; ok {
+				errs.add(a.position(index), fmt.Errorf("label '%s' already exists, all labels should be unique", label.Name))
+				continue
+			}
+			a.labels[label.Name] = address
+		}
+
+		if symbol, ok := ins.(DEFSYMBOL); ok {
+			if _, ok := a.definitions[symbol.Name]; ok {
+				errs.add(a.position(index), fmt.Errorf("symbol '%s' already exists, all symbols should be unique", symbol.Name))
+				continue
+			}
+			if isReservedSymbol(symbol.Name) {
+				errs.add(a.position(index), fmt.Errorf("symbol '%s' is reserved for internal use, please use another symbol name", symbol.Name))
+				continue
+			}
+			a.definitions[symbol.Name] = definition{symbol.Value, address}
+		}
+	}
+	for name, address := range externals {
+		if _, ok := a.labels[name]; !ok {
+			a.labels[name] = address
+		}
+	}
+
+	for index, ins := range instructions {
+		if symbol, ok := ins.(DEFSYMBOL); ok {
+			if _, err := a.ResolveSymbol(SYMBOL{symbol.Name}); err != nil {
+				errs.add(a.position(index), err)
+			}
+		}
+	}
+
+	words := [2][]uint16{{}, {}}
+	for index, ins := range instructions {
+		if ins.Size() == 0 {
+			continue
+		}
+
+		a.symbols[CURRENTINSTRUCTION] = a.addresses[index]
+		a.symbols[NEXTINSTRUCTION] = a.addresses[index] + uint16(ins.Size())
+		emit, err := ins.Emit(a.ResolveLabel, a.ResolveSymbol)
+		if err != nil {
+			errs.add(a.position(index), err)
+			emit = make([]uint16, ins.Size())
+		}
+
+		a.emitted[index] = emit
+		words[sections[index]] = append(words[sections[index]], emit...)
+	}
+	return words, errs
+}
+
+// WriteObject writes the object in a little-endian binary format, see ReadObject
+func WriteObject(w io.Writer, object *Object) error {
+	out := bufio.NewWriter(w)
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(out, binary.LittleEndian, v)
+		}
+	}
+	writeString := func(s string) {
+		write(uint16(len(s)))
+		out.WriteString(s)
+	}
+
+	out.WriteString(OBJECT_MAGIC)
+	write(OBJECT_VERSION)
+	write(uint32(len(object.Text)), object.Text)
+	write(uint32(len(object.Data)), object.Data)
+
+	write(uint32(len(object.Symbols)))
+	for _, symbol := range object.Symbols {
+		writeString(symbol.Name)
+		write(uint8(symbol.Section), symbol.Offset)
+	}
+
+	write(uint32(len(object.Relocations)))
+	for _, relocation := range object.Relocations {
+		write(uint8(relocation.Section), relocation.Offset, uint8(relocation.Target))
+		writeString(relocation.Symbol)
+	}
+	return out.Flush()
+}
+
+// ReadObject reads an object written by WriteObject
+func ReadObject(r io.Reader) (*Object, error) {
+	in := bufio.NewReader(r)
+	var err error
+	read := func(values ...interface{}) {
+		for _, v := range values {
+			if err == nil {
+				err = binary.Read(in, binary.LittleEndian, v)
+			}
+		}
+	}
+	readString := func() string {
+		var length uint16
+		read(&length)
+		if err != nil {
+			return ""
+		}
+		s := make([]byte, length)
+		_, err = io.ReadFull(in, s)
+		return string(s)
+	}
+	readWords := func() []uint16 {
+		var length uint32
+		read(&length)
+		if err != nil || length > 0x10000 {
+			if err == nil {
+				err = fmt.Errorf("section of %d words is bigger than memory", length)
+			}
+			return nil
+		}
+		words := make([]uint16, length)
+		read(words)
+		return words
+	}
+
+	magic := make([]byte, len(OBJECT_MAGIC))
+	if _, err := io.ReadFull(in, magic); err != nil || string(magic) != OBJECT_MAGIC {
+		return nil, fmt.Errorf("not an object file")
+	}
+	var version uint16
+	read(&version)
+	if err == nil && version != OBJECT_VERSION {
+		return nil, fmt.Errorf("unsupported object version %d", version)
+	}
+
+	object := &Object{}
+	object.Text = readWords()
+	object.Data = readWords()
+
+	var count uint32
+	read(&count)
+	for i := uint32(0); i < count && err == nil; i++ {
+		symbol := ObjectSymbol{Name: readString()}
+		var section uint8
+		read(&section, &symbol.Offset)
+		symbol.Section = SECTION(section)
+		object.Symbols = append(object.Symbols, symbol)
+	}
+
+	read(&count)
+	for i := uint32(0); i < count && err == nil; i++ {
+		relocation := Relocation{}
+		var section, target uint8
+		read(&section, &relocation.Offset, &target)
+		relocation.Section, relocation.Target = SECTION(section), SECTION(target)
+		relocation.Symbol = readString()
+		object.Relocations = append(object.Relocations, relocation)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("object file is not valid: %v", err)
+	}
+	return object, nil
+}
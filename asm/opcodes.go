@@ -9,6 +9,14 @@ var andBases = [4]uint16{0x00C0, 0x00C4, 0x00C8, 0x00CC}
 var orBases  = [4]uint16{0x00D0, 0x00D4, 0x00D8, 0x00DC}
 var xorBases = [4]uint16{0x00E0, 0x00E4, 0x00E8, 0x00EC}
 var cmpBases = [4]uint16{0x00F0, 0x00F4, 0x00F8, 0x00FC}
+var subBases = [4]uint16{0x0300, 0x0304, 0x0308, 0x030C}
+var adcBases = [4]uint16{0x0310, 0x0314, 0x0318, 0x031C}
+var sbbBases = [4]uint16{0x0320, 0x0324, 0x0328, 0x032C}
+var movBases = [4]uint16{0x0400, 0x0404, 0x0408, 0x040C}
+var ldxBases = [4]uint16{0x0500, 0x0504, 0x0508, 0x050C}
+var stxBases = [4]uint16{0x0510, 0x0514, 0x0518, 0x051C}
+var ldiBases = [4]uint16{0x0520, 0x0524, 0x0528, 0x052C}
+var stiBases = [4]uint16{0x0530, 0x0534, 0x0538, 0x053C}
 
 // Full opcodes for single-register instructions (indexed by register: R0=0 … R3=3).
 var dataOpcodes = [4]uint16{0x0020, 0x0021, 0x0022, 0x0023}
@@ -16,15 +24,28 @@ var jrOpcodes   = [4]uint16{0x0030, 0x0031, 0x0032, 0x0033}
 var shrOpcodes  = [4]uint16{0x0090, 0x0095, 0x009A, 0x009F}
 var shlOpcodes  = [4]uint16{0x00A0, 0x00A5, 0x00AA, 0x00AF}
 var notOpcodes  = [4]uint16{0x00B0, 0x00B5, 0x00BA, 0x00BF}
+var pushOpcodes = [4]uint16{0x0100, 0x0101, 0x0102, 0x0103}
+var popOpcodes  = [4]uint16{0x0110, 0x0111, 0x0112, 0x0113}
+var addiOpcodes = [4]uint16{0x0480, 0x0481, 0x0482, 0x0483}
+var andiOpcodes = [4]uint16{0x04C0, 0x04C1, 0x04C2, 0x04C3}
+var oriOpcodes  = [4]uint16{0x04D0, 0x04D1, 0x04D2, 0x04D3}
+var xoriOpcodes = [4]uint16{0x04E0, 0x04E1, 0x04E2, 0x04E3}
+var cmpiOpcodes = [4]uint16{0x04F0, 0x04F1, 0x04F2, 0x04F3}
 
 // Fixed opcodes.
 const (
 	opJMP     = uint16(0x0040)
 	opCLF     = uint16(0x0060)
+	opHALT    = uint16(0x0024)
 	opINData  = uint16(0x0070)
 	opINAddr  = uint16(0x0074)
 	opOUTData = uint16(0x0078)
 	opOUTAddr = uint16(0x007C)
+	opCALL    = uint16(0x0120)
+	opRET     = uint16(0x0130)
+	opEI      = uint16(0x0200)
+	opDI      = uint16(0x0210)
+	opIRET    = uint16(0x0220)
 )
 
 // Conditional jump opcodes keyed by flag string (e.g. "CAEZ").
@@ -1,6 +1,8 @@
 package asm
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -40,10 +42,10 @@ func TestParseDefSymbol(t *testing.T) {
 	`))
 
 	expected := []Instruction{
-		DEFSYMBOL{"counter", 0x0015},
-		DEFSYMBOL{"foo", 91},
-		DEFSYMBOL{"bar", 0x2198},
-		DEFSYMBOL{"WOOHoo93", 0x104},
+		DEFSYMBOL{"counter", NUMBER{0x0015}},
+		DEFSYMBOL{"foo", NUMBER{91}},
+		DEFSYMBOL{"bar", NUMBER{0x2198}},
+		DEFSYMBOL{"WOOHoo93", NUMBER{0x104}},
 	}
 
 	if err != nil {
@@ -59,9 +61,8 @@ func TestParseDefSymbol(t *testing.T) {
 	}
 }
 
-
 func TestParseCALL(t *testing.T) {
-	input :=`
+	input := `
 	CALL foo
 	CALL    BAR
 	CALL 9384f-f
@@ -77,6 +78,55 @@ func TestParseCALL(t *testing.T) {
 
 }
 
+func TestParseStack(t *testing.T) {
+	input := `
+	PUSH R0
+	PUSH   R3
+	POP R1
+	POP R2
+	RET
+	`
+
+	expected := []Instruction{
+		PUSH{REG0},
+		PUSH{REG3},
+		POP{REG1},
+		POP{REG2},
+		RET{},
+	}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParseInterrupts(t *testing.T) {
+	input := `
+	EI
+	DI
+	IRET
+	RET
+	`
+
+	expected := []Instruction{
+		EI{},
+		DI{},
+		IRET{},
+		RET{},
+	}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParseHALT(t *testing.T) {
+	input := `
+	CLF
+	HALT
+	`
+
+	expected := []Instruction{CLF{}, HALT{}}
+
+	testParseInstructions(input, expected, t)
+}
+
 func TestParseADD(t *testing.T) {
 	input := `
 		ADD R0, R1
@@ -90,6 +140,50 @@ func TestParseADD(t *testing.T) {
 
 }
 
+func TestParseArithmetic(t *testing.T) {
+	input := `
+		SUB R0, R1
+		ADC R1,R0
+		SBB   R2,   R3
+	`
+
+	expected := []Instruction{SUB{REG0, REG1}, ADC{REG1, REG0}, SBB{REG2, REG3}}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParseMOV(t *testing.T) {
+	input := `
+		MOV R0, R1
+		MOV R1,R0
+		MOV   R2,   R3
+	`
+
+	expected := []Instruction{MOV{REG0, REG1}, MOV{REG1, REG0}, MOV{REG2, REG3}}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParseImmediates(t *testing.T) {
+	input := `
+		ADDI R0, 0x0001
+		ANDI R1,0x00FF
+		ORI R2,    %foo
+		XORI R3, 0xFFFF
+		CMPI R0,19
+	`
+
+	expected := []Instruction{
+		ADDI{REG0, NUMBER{0x0001}},
+		ANDI{REG1, NUMBER{0x00FF}},
+		ORI{REG2, SYMBOL{"foo"}},
+		XORI{REG3, NUMBER{0xFFFF}},
+		CMPI{REG0, NUMBER{19}},
+	}
+
+	testParseInstructions(input, expected, t)
+}
+
 func TestParseLD(t *testing.T) {
 	input := `
 		LD R0, R1
@@ -114,6 +208,41 @@ func TestParseST(t *testing.T) {
 	testParseInstructions(input, expected, t)
 }
 
+func TestParseIndexed(t *testing.T) {
+	input := `
+		LD R1, [R0 + 0x0100]
+		LD R2,[R3-1]
+		ST [R1 + %foo], R2
+		ST [ R0 + 2 ],R3
+		LD R1, [R0]+
+		ST [R2]+, R3
+		LD R1, [R0]
+		ST [R2], R3
+	`
+
+	expected := []Instruction{
+		LOADINDEXED{REG1, REG0, NUMBER{0x0100}},
+		LOADINDEXED{REG2, REG3, NUMBER{0xFFFF}},
+		STOREINDEXED{REG1, SYMBOL{"foo"}, REG2},
+		STOREINDEXED{REG0, NUMBER{2}, REG3},
+		LOADINCREMENT{REG1, REG0},
+		STOREINCREMENT{REG2, REG3},
+		LOAD{REG0, REG1},
+		STORE{REG2, REG3},
+	}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParseBadIndexed(t *testing.T) {
+	for _, input := range []string{"LD R1, [R0 + 1]+", "ST [R0]+, [R1]", "LD R1, [R4 + 1]", "ST [R0 + ], R1", "LD [R0], R1"} {
+		if result, err := (&Parser{}).Parse(strings.NewReader(input)); err == nil {
+			t.Logf("expected %q to be an error but got %v", input, result)
+			t.FailNow()
+		}
+	}
+}
+
 func TestParseXOR(t *testing.T) {
 	input := `
 		XOR R0, R1
@@ -432,3 +561,317 @@ func testParseInstructions(input string, expected []Instruction, t *testing.T) {
 		}
 	}
 }
+
+func TestParseComments(t *testing.T) {
+	input := `
+	; a whole line comment
+	# another one
+	start: ; the start
+		DATA R0, 0x0001 # load one
+		ADD R0, R1;no space
+	`
+
+	expected := []Instruction{
+		DEFLABEL{"start"},
+		DATA{REG0, NUMBER{0x0001}},
+		ADD{REG0, REG1},
+	}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParsePositions(t *testing.T) {
+	p := Parser{File: "test.asm"}
+	_, err := p.Parse(strings.NewReader("; comment\nstart:\n    DATA R0, 0x0001\n\n\tJMP start\n"))
+	if err != nil {
+		t.Logf("encountered error %v", err)
+		t.FailNow()
+	}
+
+	expected := []Position{{"test.asm", 2, 1}, {"test.asm", 3, 5}, {"test.asm", 5, 2}}
+	if !reflect.DeepEqual(p.Positions(), expected) {
+		t.Logf("expected positions %v but got %v", expected, p.Positions())
+		t.FailNow()
+	}
+}
+
+func TestParseReportsEveryError(t *testing.T) {
+	p := Parser{File: "test.asm"}
+	_, err := p.Parse(strings.NewReader("DATA R0, 0x0001\n  FOO R1\nADD R0, R1\n\tDATA R9, 0x0001\n"))
+
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Logf("expected 2 errors but got %v", err)
+		t.FailNow()
+	}
+	if errs[0].Pos != (Position{"test.asm", 2, 3}) || errs[1].Pos != (Position{"test.asm", 4, 2}) {
+		t.Logf("unexpected error positions %v", err)
+		t.FailNow()
+	}
+	if !strings.HasPrefix(errs[0].Error(), "test.asm:2:3: unsupported/unparseable line: FOO R1") {
+		t.Logf("unexpected error message %s", errs[0].Error())
+		t.FailNow()
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	input := `
+	.org 0x0600
+	.word 0x0001, 23, %ONE, start
+	.fill 4
+	.fill 2, 0xFFFF
+	.string "a;b#c"
+	.stringz "hi\n"
+	`
+
+	expected := []Instruction{
+		ORG{0x0600},
+		WORD{[]marker{NUMBER{0x0001}, NUMBER{23}, SYMBOL{"ONE"}, LABEL{"start"}}},
+		FILL{4, NUMBER{0x0000}},
+		FILL{2, NUMBER{0xFFFF}},
+		STRING{"a;b#c", false},
+		STRING{"hi\n", true},
+	}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParseBadDirectives(t *testing.T) {
+	p := Parser{}
+	_, err := p.Parse(strings.NewReader(".org\n.word\n.fill 1, 2, 3\n.string hello\n.bogus 1\n.string \"café\"\n"))
+
+	if errs, ok := err.(ErrorList); !ok || len(errs) != 6 {
+		t.Logf("expected 6 errors but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Logf("could not write %s: %v", name, err)
+			t.FailNow()
+		}
+		return path
+	}
+	writeFile("routines.asm", "routine:\n\tRET\n")
+	main := writeFile("main.asm", "\tCALL routine\n.include \"routines.asm\"\n\tCLF\n")
+
+	f, _ := os.Open(main)
+	defer f.Close()
+	p := Parser{File: main}
+	result, err := p.Parse(f)
+	if err != nil {
+		t.Logf("encountered error %v", err)
+		t.FailNow()
+	}
+
+	expected := []Instruction{CALL{LABEL{"routine"}}, DEFLABEL{"routine"}, RET{}, CLF{}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Logf("expected %v but got %v", expected, result)
+		t.FailNow()
+	}
+	if pos := p.Positions()[2]; pos.File != filepath.Join(dir, "routines.asm") || pos.Line != 2 {
+		t.Logf("expected RET to be at routines.asm:2 but got %s", pos)
+		t.FailNow()
+	}
+
+	writeFile("loop.asm", ".include \"loop.asm\"\n")
+	p = Parser{File: filepath.Join(dir, "loop.asm")}
+	if _, err := p.Parse(strings.NewReader(".include \"loop.asm\"\n")); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Logf("expected include loop to be reported but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestParseConstantExpressions(t *testing.T) {
+	tests := map[string]uint16{
+		"(1 << 4) | 3":  0x0013,
+		"2 + 3 * 4":     14,
+		"(2 + 3) * 4":   20,
+		"10 % 4":        2,
+		"0xF0 ^ 0xFF":   0x000F,
+		"0xFF & ~0x0F":  0x00F0,
+		"~0x00FF":       0xFF00,
+		"-1":            0xFFFF,
+		"0x8000 >> 15":  1,
+		"0b1010":        0x000A,
+		"'A'":           0x0041,
+		"'A' + 1":       0x0042,
+		"'\\n'":         0x000A,
+		"';'":           0x003B,
+		"0xFFFF - 0x10": 0xFFEF,
+		// C precedence, not Go's
+		"1 + 2 << 3": 0x0018,
+		"1 << 2 + 1": 0x0008,
+		"6 & 3 + 1":  0x0004,
+	}
+
+	for text, expected := range tests {
+		result, err := parseExpression(text)
+		if err != nil {
+			t.Logf("could not parse %s: %v", text, err)
+			t.FailNow()
+		}
+		if result != (NUMBER{expected}) {
+			t.Logf("expected %s to be 0x%04X but got %v", text, expected, result)
+			t.FailNow()
+		}
+	}
+}
+
+func TestParseBadExpressions(t *testing.T) {
+	for _, text := range []string{"1 / 0", "5 % 0", "0xFFFF + 1", "0x10000", "0x100 * 0x100", "-0x8001", "1 << 16", "(1", "1 +", "1 2", "'ab'", "'a", "1 @ 2", ""} {
+		if result, err := parseExpression(text); err == nil {
+			t.Logf("expected %q to be an error but got %v", text, result)
+			t.FailNow()
+		}
+	}
+}
+
+func TestParseExpressionOperands(t *testing.T) {
+	input := `
+	%END = %START + 0x100
+	%ONE = 1
+	DATA R0, %LINEX + 2
+	DATA R1, label - 1
+	DATA R2, label
+	DATA R3, $
+	DATA R0, %LINE-WIDTH*2
+	DATA R1, ((1 << 4) | 3)
+	.word 'A', %ONE % 2, ','
+	`
+
+	expected := []Instruction{
+		DEFSYMBOL{"END", EXPRESSION{"%START + 0x100", binaryOperation{"+", SYMBOL{"START"}, NUMBER{0x100}}}},
+		DEFSYMBOL{"ONE", NUMBER{1}},
+		DATA{REG0, EXPRESSION{"%LINEX + 2", binaryOperation{"+", SYMBOL{"LINEX"}, NUMBER{2}}}},
+		DATA{REG1, EXPRESSION{"label - 1", binaryOperation{"-", LABEL{"label"}, NUMBER{1}}}},
+		DATA{REG2, LABEL{"label"}},
+		DATA{REG3, EXPRESSION{"$", SYMBOL{CURRENTINSTRUCTION}}},
+		DATA{REG0, EXPRESSION{"%LINE-WIDTH*2", binaryOperation{"*", SYMBOL{"LINE-WIDTH"}, NUMBER{2}}}},
+		DATA{REG1, NUMBER{0x0013}},
+		WORD{[]marker{NUMBER{0x41}, EXPRESSION{"%ONE % 2", binaryOperation{"%", SYMBOL{"ONE"}, NUMBER{2}}}, NUMBER{','}}},
+	}
+
+	testParseInstructions(input, expected, t)
+}
+
+func TestParseMacros(t *testing.T) {
+	input := `
+.macro INCREMENT reg, by
+	DATA R3, \by
+	ADD R3, \reg
+.endm
+.macro WAIT reg
+loop:
+	INCREMENT \reg, 1
+	JMPC loop
+.endm
+	WAIT R0
+	WAIT R1
+	INCREMENT R2, %ONE + 1
+	`
+
+	expected := []Instruction{
+		DEFLABEL{"WAIT-1-loop"},
+		DATA{REG3, NUMBER{1}},
+		ADD{REG3, REG0},
+		JMPF{[]string{"C"}, LABEL{"WAIT-1-loop"}},
+		DEFLABEL{"WAIT-3-loop"},
+		DATA{REG3, NUMBER{1}},
+		ADD{REG3, REG1},
+		JMPF{[]string{"C"}, LABEL{"WAIT-3-loop"}},
+		DATA{REG3, EXPRESSION{"%ONE + 1", binaryOperation{"+", SYMBOL{"ONE"}, NUMBER{1}}}},
+		ADD{REG3, REG2},
+	}
+
+	testParseInstructions(input, expected, t)
+
+	p := Parser{File: "test.asm"}
+	p.Parse(strings.NewReader(input))
+	if pos := p.Positions()[5]; pos.Line != 12 || pos.Column != 2 {
+		t.Logf("expected macro instructions to be placed where it was used but got %s", pos)
+		t.FailNow()
+	}
+}
+
+func TestParseBadMacros(t *testing.T) {
+	p := Parser{File: "test.asm"}
+	_, err := p.Parse(strings.NewReader(`
+.macro LOOP
+	LOOP
+.endm
+.macro ADD-ONE reg
+	DATA R3, \value
+.endm
+.endm
+	LOOP
+	ADD-ONE R0, R1
+	ADD-ONE R0
+.macro UNFINISHED
+	CLF
+`))
+
+	expected := []string{
+		"test.asm:8:1: .endm without a .macro",
+		"test.asm:9:2: in macro LOOP at test.asm:3:2: macro LOOP uses itself",
+		"test.asm:10:2: macro ADD-ONE needs 1 arguments but got 2",
+		"test.asm:11:2: in macro ADD-ONE at test.asm:6:2: unknown macro argument '\\value'",
+		"test.asm:12:1: macro UNFINISHED is missing its .endm",
+	}
+
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != len(expected) {
+		t.Logf("expected %d errors but got %v", len(expected), err)
+		t.FailNow()
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Logf("expected error %q but got %q", expected[i], e.Error())
+			t.FailNow()
+		}
+	}
+}
+
+func TestParseStandardMacros(t *testing.T) {
+	p := Parser{}
+	result, err := p.Parse(strings.NewReader(`
+.include <std.asm>
+	SELECT-DISPLAY-ADAPTER R3
+	DESELECT-IO R3
+	UPDATE-PEN-POSITION 0x0010
+	LOAD-KEYCODE 'A'
+	`))
+	if err != nil {
+		t.Logf("encountered error %v", err)
+		t.FailNow()
+	}
+
+	// as the generator's selectDisplayAdapter, deselectIO, updatePenPosition and loadCharIntoKeycodeRegister
+	expected := []Instruction{
+		DATA{REG3, SYMBOL{"DISPLAY-ADAPTER-ADDR"}},
+		OUT{ADDRESS_MODE, REG3},
+		XOR{REG3, REG3},
+		OUT{ADDRESS_MODE, REG3},
+		DATA{REG0, SYMBOL{"PEN-POSITION-ADDR"}},
+		DATA{REG1, NUMBER{0x0010}},
+		STORE{REG0, REG1},
+		DATA{REG0, SYMBOL{"KEYCODE-REGISTER"}},
+		DATA{REG1, NUMBER{0x0041}},
+		STORE{REG0, REG1},
+	}
+
+	var code []Instruction
+	for _, ins := range result {
+		if _, ok := ins.(DEFSYMBOL); !ok {
+			code = append(code, ins)
+		}
+	}
+	if !reflect.DeepEqual(code, expected) {
+		t.Logf("expected %v but got %v", expected, code)
+		t.FailNow()
+	}
+}
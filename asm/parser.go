@@ -4,18 +4,26 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
-var IS_DEFLABEL *regexp.Regexp = regexp.MustCompile("[A-Za-z0-9-]+:")
-var IS_DEFSYMBOL *regexp.Regexp = regexp.MustCompile(`%([A-Za-z0-9-]+)\s*=\s*((0x)?[0-9a-fA-F]+)`)
-var INSTRUCTION *regexp.Regexp = regexp.MustCompile(`(CALL)\s*([A-Za-z0-9-]+)|(DATA)\s*(R\d,\s*.+)|(CLF)|(JR)\s*(R\d)|(NOT)\s*(R\d)|(SHL)\s*(R\d)|(SHR)\s*(R\d)|(ADD)\s*(R\d,\s*R\d)|(CMP)\s*(R\d,\s*R\d)|(AND)\s*(R\d,\s*R\d)|(OR)\s*(R\d,\s*R\d)|(LD)\s*(R\d,\s*R\d)|(ST)\s*(R\d,\s*R\d)|(XOR)\s*(R\d,\s*R\d)|(OUT)\s*([A-Za-z]+,\s*R\d)|(IN)\s*([A-Za-z]+,\s*R\d)|(JMP[A-Z]+)\s*([A-Za-z0-9-]+)|(JMP)\s*([A-Za-z0-9-]+)`)
+var IS_DIRECTIVE *regexp.Regexp = regexp.MustCompile(`^\.([a-z]+)\s*(.*)$`)
+var IS_DEFLABEL *regexp.Regexp = regexp.MustCompile("^[A-Za-z0-9-]+:$")
+var IS_DEFSYMBOL *regexp.Regexp = regexp.MustCompile(`^%([A-Za-z0-9-]+)\s*=\s*(.+)$`)
+var INSTRUCTION *regexp.Regexp = regexp.MustCompile(`(CALL)\s*([A-Za-z0-9-]+)|(RET)|(IRET)|(EI)|(DI)|(PUSH)\s*(R\d)|(POP)\s*(R\d)|(DATA)\s*(R\d,\s*.+)|(CLF)|(HALT)|(JR)\s*(R\d)|(NOT)\s*(R\d)|(SHL)\s*(R\d)|(SHR)\s*(R\d)|(MOV)\s*(R\d,\s*R\d)|(ADDI)\s*(R\d,\s*.+)|(ANDI)\s*(R\d,\s*.+)|(ORI)\s*(R\d,\s*.+)|(XORI)\s*(R\d,\s*.+)|(CMPI)\s*(R\d,\s*.+)|(ADD)\s*(R\d,\s*R\d)|(ADC)\s*(R\d,\s*R\d)|(SUB)\s*(R\d,\s*R\d)|(SBB)\s*(R\d,\s*R\d)|(CMP)\s*(R\d,\s*R\d)|(AND)\s*(R\d,\s*R\d)|(OR)\s*(R\d,\s*R\d)|(LD)\s*(R\d,\s*\[.+)|(ST)\s*(\[.+)|(LD)\s*(R\d,\s*R\d)|(ST)\s*(R\d,\s*R\d)|(XOR)\s*(R\d,\s*R\d)|(OUT)\s*([A-Za-z]+,\s*R\d)|(IN)\s*([A-Za-z]+,\s*R\d)|(JMP[A-Z]+)\s*([A-Za-z0-9-]+)|(JMP)\s*([A-Za-z0-9-]+)`)
 var TWO_REGISTER_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`R(\d),\s*R(\d)\s*`)
 var ONE_REGISTER_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`R(\d)\s*`)
-var DATA_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`R(\d),\s*((0x)?[0-9a-fA-F]+|(%)([A-Za-z0-9-]+))`)
+var DATA_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`R(\d),\s*(.+)`)
+var LOAD_INDEXED_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`^R(\d),\s*\[\s*R(\d)\s*([+-][^\]]+)?\](\+)?\s*$`)
+var STORE_INDEXED_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`^\[\s*R(\d)\s*([+-][^\]]+)?\](\+)?\s*,\s*R(\d)\s*$`)
 var IO_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`(Addr|Data),\s*R(\d)`)
+var LABEL_NAME *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
 var LABEL_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`([A-Za-z0-9-]+)`)
 var FLAGS_EXTRACTOR *regexp.Regexp = regexp.MustCompile(`([CAEZ]+)`)
 
@@ -27,65 +35,209 @@ var REGISTERS map[string]REGISTER = map[string]REGISTER{
 }
 
 type Parser struct {
+	// File is the name of the source, it is used in positions and errors and .include
+	// paths are relative to it
+	File string
+
+	instructions []Instruction
+	positions    []Position
+	errs         ErrorList
+
+	macros     map[string]*macro
+	defining   *macro
+	expanding  []expansion
+	expansions int
 }
 
+// Positions returns the source position of each instruction returned by the last call to Parse
+func (p *Parser) Positions() []Position {
+	return p.positions
+}
+
+// Parse reads one instruction, label, symbol or directive per line. Anything after a ;
+// or # is a comment. Every line that cannot be parsed is reported, as an ErrorList
 func (p *Parser) Parse(input io.Reader) ([]Instruction, error) {
+	p.instructions = []Instruction{}
+	p.positions = []Position{}
+	p.errs = nil
+	p.macros = make(map[string]*macro)
+	p.defining = nil
+	p.expanding = nil
+	p.expansions = 0
+
+	if err := p.parse(input, p.File, nil); err != nil {
+		return nil, err
+	}
+	if err := p.errs.err(); err != nil {
+		return nil, err
+	}
+	return p.instructions, nil
+}
+
+// parse adds the instructions in input to the parser, including is the chain of files
+// that included this one
+func (p *Parser) parse(input io.Reader, file string, including []string) error {
 	scanner := bufio.NewScanner(input)
-	instructions := []Instruction{}
 
+	lineNumber := 0
 	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
+		lineNumber++
+		text := stripComment(scanner.Text())
+		line := strings.TrimSpace(text)
 
 		if line == "" {
 			continue
 		}
 
-		if IS_DEFLABEL.MatchString(line) {
-			instructions = append(instructions, processLabel(line))
-		} else if IS_DEFSYMBOL.MatchString(line) {
-			if ins, err := parseDefSymbol(line); err == nil {
-				instructions = append(instructions, ins)
-			} else {
-				return nil, err
-			}
-		} else if INSTRUCTION.MatchString(line) {
-			if ins, err := parseInstruction(line); err == nil {
-				instructions = append(instructions, ins)
-			} else {
-				return nil, err
-			}
-		} else {
-			return nil, fmt.Errorf("unsupported/unparseable line: %s", line)
+		pos := Position{file, lineNumber, len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace)) + 1}
+		p.parseLine(pos, line, including)
+	}
+
+	if p.defining != nil && p.defining.pos.File == file {
+		p.errs.add(p.defining.pos, fmt.Errorf("macro %s is missing its .endm", p.defining.name))
+		p.defining = nil
+	}
+	return scanner.Err()
+}
+
+// parseLine parses a single line with its comment removed
+func (p *Parser) parseLine(pos Position, line string, including []string) {
+	if p.defining != nil {
+		p.define(pos, line)
+		return
+	}
+
+	var ins Instruction
+	var err error
+	if IS_DIRECTIVE.MatchString(line) {
+		tokens := IS_DIRECTIVE.FindStringSubmatch(line)
+		switch tokens[1] {
+		case "include":
+			p.include(pos, tokens[2], including)
+			return
+		case "macro":
+			p.startMacro(pos, tokens[2])
+			return
 		}
+		ins, err = parseDirective(tokens[1], tokens[2])
+	} else if m, ok := p.macros[strings.Fields(line)[0]]; ok {
+		p.expand(pos, m, strings.TrimSpace(line[len(m.name):]), including)
+		return
+	} else if IS_DEFLABEL.MatchString(line) {
+		ins = processLabel(line)
+	} else if IS_DEFSYMBOL.MatchString(line) {
+		ins, err = parseDefSymbol(line)
+	} else if INSTRUCTION.MatchString(line) {
+		ins, err = parseInstruction(line)
+	} else {
+		err = fmt.Errorf("unsupported/unparseable line: %s", line)
+	}
 
+	if err != nil {
+		p.fail(pos, err)
+		return
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	p.add(pos, ins)
+}
+
+// add keeps an instruction, anything from a macro is placed where the macro was used
+func (p *Parser) add(pos Position, ins Instruction) {
+	if len(p.expanding) > 0 {
+		pos = p.expanding[0].pos
 	}
-	return instructions, nil
+	p.instructions = append(p.instructions, ins)
+	p.positions = append(p.positions, pos)
 }
 
-func parseDefSymbol(line string) (Instruction, error) {
-	tokens := IS_DEFSYMBOL.FindStringSubmatch(line)
-	if len(tokens) != 4 {
-		return nil, fmt.Errorf("could not parse the arguments correctly out of DEFSYMBOL %s", line)
+// fail reports a problem, anything from a macro is reported where the macro was used
+func (p *Parser) fail(pos Position, err error) {
+	if len(p.expanding) > 0 {
+		err = fmt.Errorf("in macro %s at %s: %v", p.expanding[len(p.expanding)-1].name, pos, err)
+		pos = p.expanding[0].pos
 	}
+	p.errs.add(pos, err)
+}
 
-	var value uint64
-	var err error
-	// parse in base 16 or 10
-	if tokens[3] == "0x" {
-		value, err = strconv.ParseUint(strings.Replace(tokens[2], "0x", "", -1), 16, 16)
+// include parses the file named in an .include directive in place. A name in angle
+// brackets, like <std.asm>, is one of the files in the library that comes with the assembler
+func (p *Parser) include(pos Position, operands string, including []string) {
+	operands = strings.TrimSpace(operands)
+
+	var name string
+	var open func() (io.ReadCloser, error)
+	if strings.HasPrefix(operands, "<") && strings.HasSuffix(operands, ">") {
+		name = operands
+		open = func() (io.ReadCloser, error) {
+			return library.Open(path.Join("lib", operands[1:len(operands)-1]))
+		}
 	} else {
-		value, err = strconv.ParseUint(tokens[2], 10, 16)
+		var err error
+		if name, err = parseQuoted(operands); err != nil {
+			p.fail(pos, fmt.Errorf(".include needs a quoted file name: %v", err))
+			return
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(pos.File), name)
+		}
+		open = func() (io.ReadCloser, error) {
+			return os.Open(name)
+		}
 	}
 
+	including = append(including, filepath.Clean(pos.File))
+	for _, file := range including {
+		if file == filepath.Clean(name) {
+			p.fail(pos, fmt.Errorf("%s includes itself", name))
+			return
+		}
+	}
+
+	f, err := open()
 	if err != nil {
-		return nil, err
+		p.fail(pos, err)
+		return
+	}
+	defer f.Close()
+
+	if err := p.parse(f, name, including); err != nil {
+		p.fail(pos, err)
 	}
+}
 
-	return DEFSYMBOL{tokens[1], uint16(value)}, nil
+// stripComment removes anything after a ; or #, unless it is in quotes
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && c == '\\':
+			escaped = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';' || c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseDefSymbol(line string) (Instruction, error) {
+	tokens := IS_DEFSYMBOL.FindStringSubmatch(line)
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("could not parse the arguments correctly out of DEFSYMBOL %s", line)
+	}
+
+	value, err := parseExpression(tokens[2])
+	if err != nil {
+		return nil, fmt.Errorf("value of symbol '%s' is not valid: %v", tokens[1], err)
+	}
+
+	return DEFSYMBOL{tokens[1], value}, nil
 }
 
 func processLabel(line string) DEFLABEL {
@@ -117,14 +269,32 @@ func parseInstruction(line string) (Instruction, error) {
 	var instruction Instruction
 	var err error
 	switch instructionName {
-	case "ADD", "AND", "XOR", "OR", "CMP", "LD", "ST":
+	case "ADD", "ADC", "SUB", "SBB", "AND", "XOR", "OR", "CMP", "MOV":
 		instruction, err = parseTwoRegisterInstruction(instructionName, operands)
-	case "SHR", "SHL", "NOT", "JR":
+	case "LD", "ST":
+		if strings.Contains(operands, "[") {
+			instruction, err = parseIndexedInstruction(instructionName, operands)
+		} else {
+			instruction, err = parseTwoRegisterInstruction(instructionName, operands)
+		}
+	case "SHR", "SHL", "NOT", "JR", "PUSH", "POP":
 		instruction, err = parseOneRegisterInstruction(instructionName, operands)
 	case "DATA":
 		instruction, err = parseDataInstruction(operands)
+	case "ADDI", "ANDI", "ORI", "XORI", "CMPI":
+		instruction, err = parseImmediateInstruction(instructionName, operands)
 	case "CLF":
 		instruction = CLF{}
+	case "HALT":
+		instruction = HALT{}
+	case "RET":
+		instruction = RET{}
+	case "IRET":
+		instruction = IRET{}
+	case "EI":
+		instruction = EI{}
+	case "DI":
+		instruction = DI{}
 	case "OUT", "IN":
 		instruction, err = parseIOInstruction(instructionName, operands)
 	case "CALL", "JMP", "JMPZ", "JMPE", "JMPEZ", "JMPA", "JMPAZ", "JMPAE", "JMPAEZ", "JMPC", "JMPCZ", "JMPCE", "JMPCEZ", "JMPCA", "JMPCAZ", "JMPCAE", "JMPCAEZ":
@@ -223,6 +393,12 @@ func parseTwoRegisterInstruction(name string, operands string) (Instruction, err
 	switch name {
 	case "ADD":
 		return ADD{register1, register2}, nil
+	case "ADC":
+		return ADC{register1, register2}, nil
+	case "SUB":
+		return SUB{register1, register2}, nil
+	case "SBB":
+		return SBB{register1, register2}, nil
 	case "AND":
 		return AND{register1, register2}, nil
 	case "XOR":
@@ -235,6 +411,8 @@ func parseTwoRegisterInstruction(name string, operands string) (Instruction, err
 		return STORE{register1, register2}, nil
 	case "CMP":
 		return CMP{register1, register2}, nil
+	case "MOV":
+		return MOV{register1, register2}, nil
 	default:
 		return nil, fmt.Errorf("unknown/unsupported instruction %s", name)
 	}
@@ -263,6 +441,10 @@ func parseOneRegisterInstruction(name string, operands string) (Instruction, err
 		return NOT{register1}, nil
 	case "JR":
 		return JR{register1}, nil
+	case "PUSH":
+		return PUSH{register1}, nil
+	case "POP":
+		return POP{register1}, nil
 	default:
 		return nil, fmt.Errorf("unknown/unsupported instruction %s", name)
 	}
@@ -301,7 +483,7 @@ func parseDataInstruction(operands string) (Instruction, error) {
 
 func parseDataInstruction(operands string) (Instruction, error) {
 	arguments := DATA_EXTRACTOR.FindStringSubmatch(operands)
-	if len(arguments) != 6 {
+	if len(arguments) != 3 {
 		return nil, fmt.Errorf("could not parse the arguments correctly out of DATA %s", operands)
 	}
 
@@ -312,23 +494,243 @@ func parseDataInstruction(operands string) (Instruction, error) {
 		register = v
 	}
 
-	if arguments[4] == "%" {
-		return DATA{register, SYMBOL{arguments[5]}}, nil
-	} else {
-		var value uint64
-		var err error
-		// parse in base 16 or 10
-		if arguments[3] == "0x" {
-			value, err = strconv.ParseUint(strings.Replace(arguments[2], "0x", "", -1), 16, 16)
-		} else {
-			value, err = strconv.ParseUint(arguments[2], 10, 16)
+	value, err := parseExpression(arguments[2])
+	if err != nil {
+		return nil, fmt.Errorf("DATA value '%s' is not valid: %v", strings.TrimSpace(arguments[2]), err)
+	}
+
+	return DATA{register, value}, nil
+}
+
+// parseIndexedInstruction parses the LD and ST forms with the address in square brackets,
+// [Ra + value], [Ra - value], [Ra]+ or just [Ra] which is the same as the plain LD and ST
+func parseIndexedInstruction(name string, operands string) (Instruction, error) {
+	var address, register, offset, increment string
+	switch name {
+	case "LD":
+		arguments := LOAD_INDEXED_EXTRACTOR.FindStringSubmatch(strings.TrimSpace(operands))
+		if len(arguments) != 5 {
+			return nil, fmt.Errorf("could not parse the arguments correctly out of LD %s", operands)
+		}
+		register, address, offset, increment = arguments[1], arguments[2], arguments[3], arguments[4]
+	case "ST":
+		arguments := STORE_INDEXED_EXTRACTOR.FindStringSubmatch(strings.TrimSpace(operands))
+		if len(arguments) != 5 {
+			return nil, fmt.Errorf("could not parse the arguments correctly out of ST %s", operands)
 		}
+		address, offset, increment, register = arguments[1], arguments[2], arguments[3], arguments[4]
+	default:
+		return nil, fmt.Errorf("unknown/unsupported instruction %s", name)
+	}
 
+	addressRegister, ok := REGISTERS[address]
+	if !ok {
+		return nil, fmt.Errorf("Unknown register %s for instruction %s", address, name)
+	}
+	otherRegister, ok := REGISTERS[register]
+	if !ok {
+		return nil, fmt.Errorf("Unknown register %s for instruction %s", register, name)
+	}
+
+	if offset != "" && increment != "" {
+		return nil, fmt.Errorf("%s can either add a value to the address or increment it, not both", name)
+	}
+
+	if increment != "" {
+		if name == "LD" {
+			return LOADINCREMENT{otherRegister, addressRegister}, nil
+		}
+		return STOREINCREMENT{addressRegister, otherRegister}, nil
+	}
+
+	if offset == "" {
+		if name == "LD" {
+			return LOAD{addressRegister, otherRegister}, nil
+		}
+		return STORE{addressRegister, otherRegister}, nil
+	}
+
+	// a minus is kept as part of the expression
+	value, err := parseExpression(strings.TrimPrefix(offset, "+"))
+	if err != nil {
+		return nil, fmt.Errorf("%s offset '%s' is not valid: %v", name, strings.TrimSpace(offset), err)
+	}
+	if name == "LD" {
+		return LOADINDEXED{otherRegister, addressRegister, value}, nil
+	}
+	return STOREINDEXED{addressRegister, value, otherRegister}, nil
+}
+
+func parseImmediateInstruction(name string, operands string) (Instruction, error) {
+	arguments := DATA_EXTRACTOR.FindStringSubmatch(operands)
+	if len(arguments) != 3 {
+		return nil, fmt.Errorf("could not parse the arguments correctly out of %s %s", name, operands)
+	}
+
+	var register REGISTER
+	if v, ok := REGISTERS[arguments[1]]; !ok {
+		return nil, fmt.Errorf("Unknown register %s for instruction %s", arguments[1], name)
+	} else {
+		register = v
+	}
+
+	value, err := parseExpression(arguments[2])
+	if err != nil {
+		return nil, fmt.Errorf("%s value '%s' is not valid: %v", name, strings.TrimSpace(arguments[2]), err)
+	}
+
+	switch name {
+	case "ADDI":
+		return ADDI{register, value}, nil
+	case "ANDI":
+		return ANDI{register, value}, nil
+	case "ORI":
+		return ORI{register, value}, nil
+	case "XORI":
+		return XORI{register, value}, nil
+	case "CMPI":
+		return CMPI{register, value}, nil
+	default:
+		return nil, fmt.Errorf("unknown/unsupported instruction %s", name)
+	}
+}
+
+func parseDirective(name string, operands string) (Instruction, error) {
+	switch name {
+	case "org":
+		address, err := parseConstant(operands)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf(".org needs an address: %v", err)
+		}
+		return ORG{address}, nil
+	case "word":
+		values := []marker{}
+		for _, operand := range splitOperands(operands) {
+			value, err := parseExpression(operand)
+			if err != nil {
+				return nil, fmt.Errorf(".word value '%s' is not valid: %v", operand, err)
+			}
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf(".word needs at least one value")
+		}
+		return WORD{values}, nil
+	case "fill":
+		arguments := splitOperands(operands)
+		if len(arguments) < 1 || len(arguments) > 2 {
+			return nil, fmt.Errorf(".fill needs a count and an optional value")
+		}
+		count, err := parseConstant(arguments[0])
+		if err != nil {
+			return nil, fmt.Errorf(".fill count '%s' is not valid: %v", arguments[0], err)
+		}
+		var value marker = NUMBER{0x0000}
+		if len(arguments) == 2 {
+			if value, err = parseExpression(arguments[1]); err != nil {
+				return nil, fmt.Errorf(".fill value '%s' is not valid: %v", arguments[1], err)
+			}
+		}
+		return FILL{count, value}, nil
+	case "text", "data":
+		if strings.TrimSpace(operands) != "" {
+			return nil, fmt.Errorf(".%s does not take any operands", name)
+		}
+		if name == "text" {
+			return SETSECTION{TEXT_SECTION}, nil
+		}
+		return SETSECTION{DATA_SECTION}, nil
+	case "global", "extern":
+		names := splitOperands(operands)
+		if len(names) == 0 {
+			return nil, fmt.Errorf(".%s needs at least one label", name)
 		}
+		for _, n := range names {
+			if !LABEL_NAME.MatchString(n) {
+				return nil, fmt.Errorf("'%s' is not a valid label for .%s", n, name)
+			}
+		}
+		if name == "global" {
+			return GLOBAL{names}, nil
+		}
+		return EXTERN{names}, nil
+	case "endm":
+		return nil, fmt.Errorf(".endm without a .macro")
+	case "string", "stringz":
+		text, err := parseQuoted(operands)
+		if err != nil {
+			return nil, fmt.Errorf(".%s needs quoted text: %v", name, err)
+		}
+		for i := 0; i < len(text); i++ {
+			if text[i] > 0x7F {
+				return nil, fmt.Errorf("only ASCII characters can be packed into a string")
+			}
+		}
+		return STRING{text, name == "stringz"}, nil
+	}
+	return nil, fmt.Errorf("unknown directive '.%s'", name)
+}
 
-		return DATA{register, NUMBER{uint16(value)}}, nil
+// parseConstant parses an expression that does not depend on any labels or symbols,
+// for values that decide where the instructions after them go
+func parseConstant(s string) (uint16, error) {
+	value, err := parseExpression(s)
+	if err != nil {
+		return 0, err
+	}
+	if number, ok := value.(NUMBER); ok {
+		return number.Value, nil
+	}
+	return 0, fmt.Errorf("'%s' has to be a constant, it cannot use labels or symbols", strings.TrimSpace(s))
+}
+
+// parseNumber parses hex numbers starting with 0x, binary starting with 0b, otherwise decimal
+func parseNumber(s string) (uint16, error) {
+	s = strings.TrimSpace(s)
+	var value uint64
+	var err error
+	if strings.HasPrefix(s, "0x") {
+		value, err = strconv.ParseUint(s[2:], 16, 16)
+	} else if strings.HasPrefix(s, "0b") {
+		value, err = strconv.ParseUint(s[2:], 2, 16)
+	} else {
+		value, err = strconv.ParseUint(s, 10, 16)
+	}
+	return uint16(value), err
+}
+
+func parseQuoted(s string) (string, error) {
+	return strconv.Unquote(strings.TrimSpace(s))
+}
+
+// splitOperands splits on commas, unless they are in quotes
+func splitOperands(operands string) []string {
+	result := []string{}
+	add := func(operand string) {
+		if operand = strings.TrimSpace(operand); operand != "" {
+			result = append(result, operand)
+		}
 	}
 
+	var quote rune
+	escaped := false
+	start := 0
+	for i, c := range operands {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && c == '\\':
+			escaped = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			add(operands[start:i])
+			start = i + 1
+		}
+	}
+	add(operands[start:])
+	return result
 }
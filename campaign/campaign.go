@@ -0,0 +1,240 @@
+package campaign
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/djhworld/simple-computer/computer"
+	"github.com/djhworld/simple-computer/cpu"
+	"github.com/djhworld/simple-computer/executable"
+	"github.com/djhworld/simple-computer/fault"
+)
+
+// FAULT CAMPAIGNS
+// a campaign runs a program once without any faults, to find the state it should finish in,
+// then once for each fault from the same starting point. How each faulty run ends decides
+// its outcome:
+//
+//     masked  the program halted in the same state, the fault made no difference
+//     sdc     silent data corruption, the program halted but R0-R3, RAM or the screen differ
+//     hang    the program did not halt in twice as many instructions as it took without
+//             the fault (plus HANG_MARGIN), got stuck in a loop or an instruction never finished
+//     crash   the simulation panicked or the CPU jumped below the code region
+//
+// runs restore a snapshot of the computer taken after boot rather than building a new one,
+// as 64K of gate level RAM takes a while to put together
+
+// Outcome is how a run with a fault ended
+type Outcome string
+
+const (
+	OUTCOME_MASKED = Outcome("masked")
+	OUTCOME_SDC    = Outcome("sdc")
+	OUTCOME_HANG   = Outcome("hang")
+	OUTCOME_CRASH  = Outcome("crash")
+)
+
+// OUTCOMES is every outcome
+var OUTCOMES = []Outcome{OUTCOME_MASKED, OUTCOME_SDC, OUTCOME_HANG, OUTCOME_CRASH}
+
+// HANG_MARGIN is added to the instruction limit of a run with a fault, so short programs
+// aren't called hung for running a little longer
+const HANG_MARGIN = 100
+
+// Result is the outcome of a run with a fault
+type Result struct {
+	Fault        fault.Fault `json:"fault"`
+	Outcome      Outcome     `json:"outcome"`
+	Instructions int         `json:"instructions"`
+	// Detail says what differed for silent data corruption, or why the run hung or crashed
+	Detail string `json:"detail,omitempty"`
+}
+
+// Campaign runs a program under faults
+type Campaign struct {
+	comp   *computer.SimpleComputer
+	start  []byte
+	broken bool
+
+	expected     state
+	instructions int
+}
+
+// state is what the program leaves behind, compared between runs
+type state struct {
+	registers [4]uint16
+	ram       []uint16
+	screen    [160][240]byte
+}
+
+// New runs the program without any faults, it has to halt within maxInstructions (if above
+// zero) to be used in a campaign
+func New(ctx context.Context, program *executable.Executable, maxInstructions int) (*Campaign, error) {
+	c := &Campaign{comp: newComputer()}
+	if err := c.comp.Load(program); err != nil {
+		return nil, err
+	}
+	c.comp.Boot()
+
+	var start bytes.Buffer
+	if err := c.comp.Snapshot(&start); err != nil {
+		return nil, err
+	}
+	c.start = start.Bytes()
+
+	instructions, _, err := c.comp.RunUntil(ctx, maxInstructions)
+	if err != nil {
+		return nil, err
+	}
+	if !c.comp.CPU().Halted() {
+		return nil, fmt.Errorf("the program did not halt within %d instructions without any faults", instructions)
+	}
+	c.instructions = instructions
+	c.expected = c.state()
+	return c, nil
+}
+
+func newComputer() *computer.SimpleComputer {
+	// the screen is read once a run has finished rather than by screen control, so nothing
+	// reads these
+	return computer.NewComputer(make(chan *[160][240]byte), make(chan bool, 10))
+}
+
+// Instructions is the number of instructions the program runs without any faults
+func (c *Campaign) Instructions() int {
+	return c.instructions
+}
+
+// Run runs the program with a fault from the start. The error is for a fault whose target
+// doesn't exist or ctx being done, anything that happens to the program is in the result
+func (c *Campaign) Run(ctx context.Context, f fault.Fault) (result Result, err error) {
+	result.Fault = f
+
+	if c.broken {
+		// the last run panicked part way through a step, so nothing it left can be trusted
+		c.comp = newComputer()
+		c.broken = false
+	}
+	// the last run's fault is left in until now, so its final state is read with it
+	if err := c.comp.InjectFaults(nil); err != nil {
+		return result, err
+	}
+	if err := c.comp.Restore(bytes.NewReader(c.start)); err != nil {
+		return result, err
+	}
+	if err := c.comp.InjectFaults([]fault.Fault{f}); err != nil {
+		return result, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.broken = true
+			result.Outcome = OUTCOME_CRASH
+			result.Detail = fmt.Sprintf("panic: %v", r)
+			err = nil
+		}
+	}()
+
+	crashed := false
+	stuck := computer.StopWhenStuck()
+	conditions := []computer.StopCondition{
+		stuck,
+		func(core cpu.Core) bool {
+			crashed = core.IAR() < computer.CODE_REGION_START
+			return crashed
+		},
+	}
+	instructions, _, runErr := c.comp.RunUntil(ctx, 2*c.instructions+HANG_MARGIN, conditions...)
+	result.Instructions = instructions
+	if runErr != nil && runErr != computer.ErrInstructionStuck {
+		return result, runErr
+	}
+
+	switch {
+	case runErr != nil:
+		result.Outcome = OUTCOME_HANG
+		result.Detail = runErr.Error()
+	case crashed:
+		result.Outcome = OUTCOME_CRASH
+		result.Detail = fmt.Sprintf("jumped to 0x%04X", c.comp.CPU().IAR())
+	case !c.comp.CPU().Halted():
+		result.Outcome = OUTCOME_HANG
+		result.Detail = fmt.Sprintf("still running at 0x%04X", c.comp.CPU().IAR())
+	default:
+		differences := c.expected.compare(c.state())
+		if len(differences) == 0 {
+			result.Outcome = OUTCOME_MASKED
+		} else {
+			result.Outcome = OUTCOME_SDC
+			result.Detail = strings.Join(differences, ", ")
+		}
+	}
+	return result, nil
+}
+
+// RunAll runs the program with each fault in turn, calling report (if not nil) as each
+// finishes
+func (c *Campaign) RunAll(ctx context.Context, faults []fault.Fault, report func(Result)) ([]Result, error) {
+	var results []Result
+	for _, f := range faults {
+		result, err := c.Run(ctx, f)
+		if err != nil {
+			if f.Line > 0 {
+				return results, fmt.Errorf("line %d: %v", f.Line, err)
+			}
+			return results, err
+		}
+		results = append(results, result)
+		if report != nil {
+			report(result)
+		}
+	}
+	return results, nil
+}
+
+// Count returns how many of the results had each outcome
+func Count(results []Result) map[Outcome]int {
+	counts := make(map[Outcome]int)
+	for _, result := range results {
+		counts[result.Outcome]++
+	}
+	return counts
+}
+
+func (c *Campaign) state() state {
+	s := state{ram: c.comp.ReadRAM(0, 0x10000), screen: c.comp.Framebuffer()}
+	for i := range s.registers {
+		s.registers[i] = c.comp.CPU().Register(i)
+	}
+	return s
+}
+
+// compare lists how other differs from s, the first RAM word to differ stands for the rest
+func (s state) compare(other state) []string {
+	var differences []string
+	for i := range s.registers {
+		if s.registers[i] != other.registers[i] {
+			differences = append(differences, fmt.Sprintf("R%d is 0x%04X not 0x%04X", i, other.registers[i], s.registers[i]))
+		}
+	}
+
+	changed := 0
+	for address := range s.ram {
+		if s.ram[address] != other.ram[address] {
+			if changed == 0 {
+				differences = append(differences, fmt.Sprintf("RAM 0x%04X is 0x%04X not 0x%04X", address, other.ram[address], s.ram[address]))
+			}
+			changed++
+		}
+	}
+	if changed > 1 {
+		differences[len(differences)-1] += fmt.Sprintf(" (%d words differ)", changed)
+	}
+
+	if s.screen != other.screen {
+		differences = append(differences, "the screen differs")
+	}
+	return differences
+}
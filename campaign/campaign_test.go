@@ -0,0 +1,105 @@
+package campaign
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/djhworld/simple-computer/asm"
+	"github.com/djhworld/simple-computer/computer"
+	"github.com/djhworld/simple-computer/executable"
+	"github.com/djhworld/simple-computer/fault"
+)
+
+func setUpCampaign(program string, t *testing.T) *Campaign {
+	instructions, err := (&asm.Parser{}).Parse(strings.NewReader(program))
+	if err != nil {
+		t.Logf("could not parse program: %v", err)
+		t.FailNow()
+	}
+	bin, err := (&asm.Assembler{}).Process(computer.CODE_REGION_START, instructions)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	c, err := New(context.Background(), executable.Raw(bin), 100)
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	return c
+}
+
+func TestCampaign(t *testing.T) {
+	c := setUpCampaign(`
+		DATA R0, 0x0A00
+		DATA R1, 0x0002
+		DATA R2, 0x0003
+		ADD R1, R2
+		ST R0, R2
+		HALT
+	`, t)
+	if c.Instructions() != 6 {
+		t.Logf("expected the program to run 6 instructions but got %d", c.Instructions())
+		t.FailNow()
+	}
+
+	faults := []fault.Fault{
+		// nothing uses R3
+		{Target: "cpu.r3.word", Kind: fault.STUCK_AT_0},
+		// 3 + 3 is stored rather than 2 + 3
+		{Target: "cpu.r1.word[15]", Kind: fault.STUCK_AT_1},
+		// the stepper never moves on
+		{Target: "cpu.clock", Kind: fault.STUCK_AT_0},
+		// the next instruction is fetched from 0x0100
+		{Target: "cpu.iar.word[5]", Kind: fault.STUCK_AT_0},
+		// the same fault as before, to check the computer is put back each run
+		{Target: "cpu.r3.word", Kind: fault.STUCK_AT_0},
+	}
+	var reported []Result
+	results, err := c.RunAll(context.Background(), faults, func(r Result) { reported = append(reported, r) })
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	if len(results) != len(faults) || len(reported) != len(faults) {
+		t.Logf("expected a result for each fault but got %v", results)
+		t.FailNow()
+	}
+
+	expected := []Outcome{OUTCOME_MASKED, OUTCOME_SDC, OUTCOME_HANG, OUTCOME_CRASH, OUTCOME_MASKED}
+	for i, result := range results {
+		if result.Fault != faults[i] || result.Outcome != expected[i] {
+			t.Logf("expected %s to be %s but got %+v", faults[i], expected[i], result)
+			t.FailNow()
+		}
+	}
+	if !strings.Contains(results[1].Detail, "R2 is 0x0006 not 0x0005") || !strings.Contains(results[1].Detail, "RAM 0x0A00 is 0x0006 not 0x0005") {
+		t.Logf("expected R2 and RAM to differ but got %s", results[1].Detail)
+		t.FailNow()
+	}
+
+	counts := Count(results)
+	if counts[OUTCOME_MASKED] != 2 || counts[OUTCOME_SDC] != 1 || counts[OUTCOME_HANG] != 1 || counts[OUTCOME_CRASH] != 1 {
+		t.Logf("unexpected counts %v", counts)
+		t.FailNow()
+	}
+
+	if _, err := c.RunAll(context.Background(), []fault.Fault{{Target: "cpu.nothing", Kind: fault.FLIP, Line: 3}}, nil); err == nil {
+		t.Logf("expected an error for a signal that does not exist")
+		t.FailNow()
+	}
+}
+
+func TestCampaignNeedsProgramToHalt(t *testing.T) {
+	instructions, _ := (&asm.Parser{}).Parse(strings.NewReader(`
+	loop:
+		JMP loop
+	`))
+	bin, _ := (&asm.Assembler{}).Process(computer.CODE_REGION_START, instructions)
+	if _, err := New(context.Background(), executable.Raw(bin), 100); err == nil {
+		t.Logf("expected an error for a program that does not halt")
+		t.FailNow()
+	}
+}
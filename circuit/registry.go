@@ -0,0 +1,179 @@
+package circuit
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SIGNALS
+// a Registry names the wires of a circuit so they can be found without reaching into the
+// unexported fields of the components that hold them. The names are dotted paths from the
+// top of the circuit down, e.g. cpu.alu.adder.carry, and each component adds its own wires
+// under the path it is given. A signal is a single wire or a group of wires such as a bus,
+// the wires of a group can be looked up one at a time by index, e.g. cpu.stepper.out[3] or
+// cpu.mainBus[0] (wire 0 of a bus is the most significant bit)
+
+// Signal is a named wire or group of wires
+type Signal struct {
+	Path  string
+	Wires []*Wire
+}
+
+// Width is the number of wires in the signal
+func (s *Signal) Width() int {
+	return len(s.Wires)
+}
+
+// Value reads the wires as a number, the first wire is the most significant bit
+func (s *Signal) Value() uint64 {
+	var value uint64
+	for _, w := range s.Wires {
+		value <<= 1
+		if w.Get() {
+			value |= 1
+		}
+	}
+	return value
+}
+
+// Registry holds the signals of a circuit by path
+type Registry struct {
+	signals []*Signal
+	paths   map[string]*Signal
+
+	lock          sync.Mutex
+	subscriptions []*subscription
+}
+
+func NewRegistry() *Registry {
+	return &Registry{paths: make(map[string]*Signal)}
+}
+
+// Scope adds signals under a path in a registry
+type Scope struct {
+	registry *Registry
+	path     string
+}
+
+// Scope returns the scope for a top level name, e.g. cpu
+func (r *Registry) Scope(name string) Scope {
+	return Scope{r, name}
+}
+
+// Scope returns the scope for a part of this one, e.g. cpu.alu
+func (s Scope) Scope(name string) Scope {
+	return Scope{s.registry, s.path + "." + name}
+}
+
+// Add names a wire, or a group of wires, in the scope. Adding the same path twice is a
+// mistake in how the circuit was put together so it panics
+func (s Scope) Add(name string, wires ...*Wire) {
+	p := s.path + "." + name
+	if _, ok := s.registry.paths[p]; ok {
+		panic(fmt.Sprintf("there is already a signal called %s", p))
+	}
+	if len(wires) == 0 {
+		panic(fmt.Sprintf("signal %s has no wires", p))
+	}
+	signal := &Signal{p, wires}
+	s.registry.signals = append(s.registry.signals, signal)
+	s.registry.paths[p] = signal
+}
+
+// Signals returns every signal in the order they were added
+func (r *Registry) Signals() []*Signal {
+	return r.signals
+}
+
+// Lookup finds a signal by its path, or a single wire of one with <path>[<index>]
+func (r *Registry) Lookup(p string) (*Signal, bool) {
+	if signal, ok := r.paths[p]; ok {
+		return signal, true
+	}
+
+	open := strings.LastIndex(p, "[")
+	if open < 0 || !strings.HasSuffix(p, "]") {
+		return nil, false
+	}
+	signal, ok := r.paths[p[:open]]
+	if !ok {
+		return nil, false
+	}
+	index, err := strconv.Atoi(p[open+1 : len(p)-1])
+	if err != nil || index < 0 || index >= signal.Width() {
+		return nil, false
+	}
+	return &Signal{p, signal.Wires[index : index+1]}, true
+}
+
+// List returns the signals whose paths match a glob (see path.Match), e.g. cpu.*.enable
+func (r *Registry) List(pattern string) ([]*Signal, error) {
+	var signals []*Signal
+	for _, signal := range r.signals {
+		match, err := path.Match(pattern, signal.Path)
+		if err != nil {
+			return nil, fmt.Errorf("bad signal pattern '%s': %v", pattern, err)
+		}
+		if match {
+			signals = append(signals, signal)
+		}
+	}
+	return signals, nil
+}
+
+// SUBSCRIPTIONS
+// wires don't tell anyone when they change, that would slow down every gate, so whatever
+// is updating the circuit calls Check at the points where it is settled (the CPU does this
+// every clock phase) and the subscribers to any signal that has changed since the last
+// Check are told then. A signal that changes and changes back in between is not noticed
+
+type subscription struct {
+	signal *Signal
+	fn     func(*Signal)
+	last   uint64
+}
+
+// Subscribe calls fn with the signal whenever Check finds it has changed, until the
+// returned function is called
+func (r *Registry) Subscribe(p string, fn func(*Signal)) (func(), error) {
+	signal, ok := r.Lookup(p)
+	if !ok {
+		return nil, fmt.Errorf("there is no signal called %s", p)
+	}
+
+	s := &subscription{signal, fn, signal.Value()}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// the list is copied rather than appended to as Check may be going through it
+	r.subscriptions = append(append([]*subscription(nil), r.subscriptions...), s)
+	return func() { r.unsubscribe(s) }, nil
+}
+
+func (r *Registry) unsubscribe(s *subscription) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var remaining []*subscription
+	for _, other := range r.subscriptions {
+		if other != s {
+			remaining = append(remaining, other)
+		}
+	}
+	r.subscriptions = remaining
+}
+
+// Check tells the subscribers of every signal that has changed since the last Check
+func (r *Registry) Check() {
+	r.lock.Lock()
+	subscriptions := r.subscriptions
+	r.lock.Unlock()
+
+	for _, s := range subscriptions {
+		if value := s.signal.Value(); value != s.last {
+			s.last = value
+			s.fn(s.signal)
+		}
+	}
+}
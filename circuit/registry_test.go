@@ -0,0 +1,121 @@
+package circuit
+
+import (
+	"testing"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewRegistry()
+	carry := NewWire("", true)
+	bus := []*Wire{NewWire("", true), NewWire("", false), NewWire("", true)}
+	s := r.Scope("cpu")
+	s.Scope("alu").Scope("adder").Add("carry", carry)
+	s.Add("bus", bus...)
+
+	signal, ok := r.Lookup("cpu.alu.adder.carry")
+	if !ok || signal.Width() != 1 || signal.Value() != 1 {
+		t.Logf("expected cpu.alu.adder.carry to be a single wire that is on")
+		t.FailNow()
+	}
+
+	signal, ok = r.Lookup("cpu.bus")
+	if !ok || signal.Width() != 3 || signal.Value() != 5 {
+		t.Logf("expected cpu.bus to be 3 wires reading 5")
+		t.FailNow()
+	}
+
+	for path, expected := range map[string]uint64{"cpu.bus[0]": 1, "cpu.bus[1]": 0, "cpu.bus[2]": 1} {
+		signal, ok := r.Lookup(path)
+		if !ok || signal.Path != path || signal.Width() != 1 || signal.Value() != expected {
+			t.Logf("expected %s to be a single wire reading %d", path, expected)
+			t.FailNow()
+		}
+	}
+
+	for _, path := range []string{"cpu", "cpu.alu", "cpu.bus[3]", "cpu.bus[-1]", "cpu.bus[x]", "cpu.alu.adder.carry[1]"} {
+		if _, ok := r.Lookup(path); ok {
+			t.Logf("expected no signal called %s", path)
+			t.FailNow()
+		}
+	}
+}
+
+func TestRegistryList(t *testing.T) {
+	r := NewRegistry()
+	s := r.Scope("cpu")
+	for _, name := range []string{"r0", "r1", "acc"} {
+		s.Scope(name).Add("set", NewWire("", false))
+		s.Scope(name).Add("enable", NewWire("", false))
+	}
+
+	if len(r.Signals()) != 6 {
+		t.Logf("expected 6 signals but got %d", len(r.Signals()))
+		t.FailNow()
+	}
+
+	signals, err := r.List("cpu.r?.set")
+	if err != nil || len(signals) != 2 || signals[0].Path != "cpu.r0.set" || signals[1].Path != "cpu.r1.set" {
+		t.Logf("expected cpu.r0.set and cpu.r1.set but got %v, %v", signals, err)
+		t.FailNow()
+	}
+
+	if _, err := r.List("cpu.[r"); err == nil {
+		t.Logf("expected an error for a bad pattern")
+		t.FailNow()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Logf("expected adding the same signal twice to panic")
+			t.FailNow()
+		}
+	}()
+	s.Scope("r0").Add("set", NewWire("", false))
+}
+
+func TestRegistrySubscribe(t *testing.T) {
+	r := NewRegistry()
+	bus := []*Wire{NewWire("", false), NewWire("", false)}
+	r.Scope("cpu").Add("bus", bus...)
+
+	var all, second []uint64
+	cancelAll, err := r.Subscribe("cpu.bus", func(s *Signal) { all = append(all, s.Value()) })
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	cancelSecond, _ := r.Subscribe("cpu.bus[1]", func(s *Signal) { second = append(second, s.Value()) })
+
+	bus[1].Update(true)
+	r.Check()
+	// no change, so no one is told
+	r.Check()
+	// both wires change, the bus subscriber is only told once
+	bus[0].Update(true)
+	bus[1].Update(false)
+	r.Check()
+	// changed and changed back between checks
+	bus[0].Update(false)
+	bus[0].Update(true)
+	r.Check()
+	cancelAll()
+	bus[1].Update(true)
+	r.Check()
+	cancelSecond()
+	bus[1].Update(false)
+	r.Check()
+
+	if len(all) != 2 || all[0] != 1 || all[1] != 2 {
+		t.Logf("expected the bus to change to 1 then 2 but got %v", all)
+		t.FailNow()
+	}
+	if len(second) != 3 || second[0] != 1 || second[1] != 0 || second[2] != 1 {
+		t.Logf("expected wire 1 to change to 1, 0 then 1 but got %v", second)
+		t.FailNow()
+	}
+
+	if _, err := r.Subscribe("cpu.nothing", func(*Signal) {}); err == nil {
+		t.Logf("expected an error subscribing to a signal that does not exist")
+		t.FailNow()
+	}
+}
@@ -3,6 +3,9 @@ package circuit
 type Wire struct {
 	Name  string
 	value bool
+
+	// a faulty wire holds its value whatever it is updated with
+	stuck bool
 }
 
 func NewWire(name string, value bool) *Wire {
@@ -13,9 +16,22 @@ func NewWire(name string, value bool) *Wire {
 }
 
 func (w *Wire) Update(value bool) {
-	w.value = value
+	if !w.stuck {
+		w.value = value
+	}
 }
 
 func (w *Wire) Get() bool {
 	return w.value
 }
+
+// Stick makes the wire hold value from now on, as if it were shorted to ground or the supply
+func (w *Wire) Stick(value bool) {
+	w.stuck = true
+	w.value = value
+}
+
+// Unstick lets the wire change again, it keeps the stuck value until it is next updated
+func (w *Wire) Unstick() {
+	w.stuck = false
+}
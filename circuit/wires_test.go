@@ -0,0 +1,36 @@
+package circuit
+
+import (
+	"testing"
+)
+
+func TestWireStick(t *testing.T) {
+	w := NewWire("", false)
+	w.Stick(true)
+	w.Update(false)
+	if !w.Get() {
+		t.Logf("expected a wire stuck at 1 to stay on when updated")
+		t.FailNow()
+	}
+
+	// the wire keeps its stuck value until it is next updated
+	w.Unstick()
+	if !w.Get() {
+		t.Logf("expected the wire to keep its value when unstuck")
+		t.FailNow()
+	}
+	w.Update(false)
+	if w.Get() {
+		t.Logf("expected the wire to change once unstuck")
+		t.FailNow()
+	}
+
+	// gates are built from wires, so a stuck output stays put whatever the inputs are
+	gate := NewANDGate()
+	gate.output.Stick(false)
+	gate.Update(true, true)
+	if gate.Output() {
+		t.Logf("expected the gate's output to be stuck at 0")
+		t.FailNow()
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strconv"
 
 	"github.com/djhworld/simple-computer/asm"
+	"github.com/djhworld/simple-computer/executable"
 )
 
 const USER_CODE_START = uint16(0x0500)
@@ -15,6 +19,11 @@ const USER_CODE_START = uint16(0x0500)
 var inputFile = flag.String("i", "", "input file (default: stdin)")
 var outputFile = flag.String("o", "", "output file (default: stdout)")
 var render = flag.Bool("s", false, "output assembly as string")
+var labelsFile = flag.String("labels", "", "write the address of each label to this file, for the debugger")
+var listingFile = flag.String("l", "", "write a listing of each source line with its address and machine code to this file")
+var object = flag.Bool("c", false, "write a relocatable object for the linker instead of a bin, -format, -entry, -labels and -s cannot be used with it")
+var format = flag.String("format", "bin", "what to write: bin, exe (with an entry point, labels and source lines), ihex (Intel HEX) or srec (Motorola S-records)")
+var entry = flag.String("entry", "", "the label or address the executable starts running at (default: the start of the code)")
 
 func exitWithError(message string, err error, exitCode int) {
 	fmt.Fprintln(os.Stderr, message, err)
@@ -26,24 +35,46 @@ func exitWithError(message string, err error, exitCode int) {
 func main() {
 	flag.Parse()
 
+	if *object {
+		// the linker decides where an object goes, so these would be silently ignored
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "format", "entry", "labels", "s":
+				exitWithError("error parsing flags: ", fmt.Errorf("-%s cannot be used with -c", f.Name), 5)
+			}
+		})
+	}
+
+	switch *format {
+	case "bin", "exe", "ihex", "srec":
+	default:
+		exitWithError("error parsing format: ", fmt.Errorf("'%s' is not one of bin, exe, ihex or srec", *format), 5)
+	}
+
 	reader, err := getReaderFor(*inputFile)
 	if err != nil {
 		exitWithError("error reading input: ", err, 5)
 	}
 	defer reader.Close()
 
-	parser := asm.Parser{}
-	instructions, err := parser.Parse(reader)
+	// the source is read twice if there is a listing
+	source, err := io.ReadAll(reader)
+	if err != nil {
+		exitWithError("error reading input: ", err, 5)
+	}
+
+	parser := asm.Parser{File: *inputFile}
+	instructions, err := parser.Parse(bytes.NewReader(source))
 	if err != nil {
-		exitWithError("error parsing input: ", err, 104)
+		exitWithError("error parsing input:\n", err, 104)
 	}
 
-	asm := asm.Assembler{}
+	assembler := asm.Assembler{Positions: parser.Positions()}
 
-	if *render == false {
-		rawIns, err := asm.Process(USER_CODE_START, instructions)
+	if *object {
+		obj, err := assembler.Object(instructions)
 		if err != nil {
-			exitWithError("error assembling input: ", err, 104)
+			exitWithError("error assembling input:\n", err, 104)
 		}
 
 		writer, err := getWriterFor(*outputFile)
@@ -52,11 +83,32 @@ func main() {
 		}
 		defer writer.Close()
 
-		if err := binary.Write(writer, binary.LittleEndian, rawIns); err != nil {
+		if err := asm.WriteObject(writer, obj); err != nil {
 			exitWithError("error writing output handle: ", err, 5)
 		}
+	} else if *render == false {
+		rawIns, err := assembler.Process(USER_CODE_START, instructions)
+		if err != nil {
+			exitWithError("error assembling input:\n", err, 104)
+		}
+
+		writer, err := getWriterFor(*outputFile)
+		if err != nil {
+			exitWithError("error getting output handle: ", err, 104)
+		}
+		defer writer.Close()
+
+		if err := writeProgram(writer, &assembler, rawIns); err != nil {
+			exitWithError("error writing output handle: ", err, 5)
+		}
+
+		if *labelsFile != "" {
+			if err := writeLabels(*labelsFile, assembler.Labels()); err != nil {
+				exitWithError("error writing labels: ", err, 5)
+			}
+		}
 	} else {
-		str, err := asm.ToString(USER_CODE_START, instructions)
+		str, err := assembler.ToString(USER_CODE_START, instructions)
 		if err != nil {
 			exitWithError("error assembling input: ", err, 104)
 		}
@@ -68,7 +120,92 @@ func main() {
 		defer writer.Close()
 
 		fmt.Fprint(writer, str)
+		return
+	}
+
+	if *listingFile != "" {
+		listing, err := getWriterFor(*listingFile)
+		if err != nil {
+			exitWithError("error getting listing handle: ", err, 5)
+		}
+		defer listing.Close()
+
+		if err := assembler.WriteListing(listing, *inputFile, bytes.NewReader(source)); err != nil {
+			exitWithError("error writing listing: ", err, 5)
+		}
+	}
+}
+
+// writeProgram writes the assembled words in the chosen -format
+func writeProgram(w io.Writer, assembler *asm.Assembler, words []uint16) error {
+	if *format == "bin" {
+		return binary.Write(w, binary.LittleEndian, words)
+	}
+
+	e, err := buildExecutable(assembler)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "ihex":
+		return e.WriteIntelHex(w)
+	case "srec":
+		return e.WriteSRecord(w)
+	}
+	return e.Write(w)
+}
+
+func buildExecutable(assembler *asm.Assembler) (*executable.Executable, error) {
+	e := &executable.Executable{
+		Entry:    USER_CODE_START,
+		Segments: assembler.Segments(),
+		Symbols:  assembler.Labels(),
+	}
+
+	if *entry != "" {
+		if address, ok := assembler.Labels()[*entry]; ok {
+			e.Entry = address
+		} else if address, err := strconv.ParseUint(*entry, 0, 16); err == nil {
+			e.Entry = uint16(address)
+		} else {
+			return nil, fmt.Errorf("entry '%s' is not a label or an address", *entry)
+		}
+	}
+
+	for _, line := range assembler.SourceMap() {
+		file := line.Position.File
+		if file == "" {
+			file = "<input>"
+		}
+		e.Lines = append(e.Lines, executable.SourceLine{Address: line.Address, File: file, Line: line.Position.Line})
+	}
+	return e, nil
+}
+
+func writeLabels(file string, labels map[string]uint16) error {
+	writer, err := getWriterFor(file)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if labels[names[i]] == labels[names[j]] {
+			return names[i] < names[j]
+		}
+		return labels[names[i]] < labels[names[j]]
+	})
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(writer, "%s 0x%04X\n", name, labels[name]); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func getReaderFor(file string) (io.ReadCloser, error) {
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/djhworld/simple-computer/campaign"
+	"github.com/djhworld/simple-computer/executable"
+	"github.com/djhworld/simple-computer/fault"
+)
+
+// runs a program once for each fault in a spec file and writes the outcome of each as a line
+// of JSON to stdout, with a count of each outcome on stderr at the end
+
+var binFile = flag.String("bin", "", "the bin file to run")
+var faultsFile = flag.String("faults", "", "the fault spec file, one <target> <stuck-at-0|stuck-at-1|flip> [cycle] per line")
+var maxInstructions = flag.Int("max-instructions", 1000000, "the program has to halt within this many instructions without any faults, 0 for no limit")
+
+func exitWithError(message string, err error, exitCode int) {
+	fmt.Fprintln(os.Stderr, message, err)
+	fmt.Fprint(os.Stderr, "\n")
+	flag.Usage()
+	os.Exit(exitCode)
+}
+
+func main() {
+	flag.Parse()
+	if *binFile == "" {
+		exitWithError("no bin file given", nil, 5)
+	}
+	if *faultsFile == "" {
+		exitWithError("no fault spec file given", nil, 5)
+	}
+
+	program, err := executable.ReadFile(*binFile)
+	if err != nil {
+		exitWithError("error attempting to parse bin file", err, 5)
+	}
+	faults, err := fault.ReadSpecFile(*faultsFile)
+	if err != nil {
+		exitWithError("error reading fault spec file", err, 5)
+	}
+
+	ctx := context.Background()
+	c, err := campaign.New(ctx, program, *maxInstructions)
+	if err != nil {
+		exitWithError("error running program without faults", err, 5)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	results, err := c.RunAll(ctx, faults, func(result campaign.Result) {
+		encoder.Encode(result)
+	})
+	if err != nil {
+		exitWithError("error running campaign", err, 5)
+	}
+
+	counts := campaign.Count(results)
+	fmt.Fprintf(os.Stderr, "%d faults, %d instructions without faults:", len(results), c.Instructions())
+	for _, outcome := range campaign.OUTCOMES {
+		fmt.Fprintf(os.Stderr, " %s %d", outcome, counts[outcome])
+	}
+	fmt.Fprintln(os.Stderr)
+}
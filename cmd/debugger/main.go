@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/djhworld/simple-computer/computer"
+	"github.com/djhworld/simple-computer/debugger"
+	"github.com/djhworld/simple-computer/executable"
+)
+
+var binFile = flag.String("bin", "", "the bin file to load into the computer")
+var labelsFile = flag.String("labels", "", "label file written by the assembler, lets labels be used instead of addresses (default: the labels in the executable)")
+var fastCore = flag.Bool("fast", false, "run on the behavioural CPU core instead of the gate level one")
+var historyBudget = flag.Int("history", debugger.DEFAULT_HISTORY_BUDGET>>20, "MB of memory kept for going backwards with reverse-step and reverse-continue, 0 turns it off")
+var gdbAddress = flag.String("gdb", "", "serve the GDB remote serial protocol on this address (e.g. localhost:1234) instead of reading commands")
+
+func exitWithError(message string, err error, exitCode int) {
+	fmt.Fprintln(os.Stderr, message, err)
+	fmt.Fprint(os.Stderr, "\n")
+	flag.Usage()
+	os.Exit(exitCode)
+}
+
+func main() {
+	flag.Parse()
+	if *binFile == "" {
+		exitWithError("no bin file given", nil, 5)
+	}
+
+	program, err := executable.ReadFile(*binFile)
+	if err != nil {
+		exitWithError("error attempting to parse bin file", err, 5)
+	}
+
+	// an executable can carry its own labels, a label file replaces them
+	labels := program.Symbols
+	if labels == nil {
+		labels = make(map[string]uint16)
+	}
+	if *labelsFile != "" {
+		f, err := os.Open(*labelsFile)
+		if err != nil {
+			exitWithError("error opening label file", err, 5)
+		}
+		labels, err = debugger.ReadLabels(f)
+		f.Close()
+		if err != nil {
+			exitWithError("error reading label file", err, 5)
+		}
+	}
+
+	var options []computer.Option
+	if *fastCore {
+		options = append(options, computer.WithFastCore())
+	}
+
+	// the screen is never started so nothing reads from these
+	screenChannel := make(chan *[160][240]byte)
+	quitChannel := make(chan bool, 10)
+
+	comp := computer.NewComputer(screenChannel, quitChannel, options...)
+	if err := comp.Load(program); err != nil {
+		exitWithError("error loading bin file", err, 5)
+	}
+	comp.Boot()
+
+	d := debugger.NewDebugger(comp.CPU(), labels, os.Stdout, debugger.WithHistoryBudget(*historyBudget<<20))
+
+	if *gdbAddress != "" {
+		serveGDB(d, *gdbAddress)
+		return
+	}
+
+	// ctrl-c pauses a running program rather than exiting
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		for range interrupts {
+			d.Interrupt()
+		}
+	}()
+
+	fmt.Println(debugger.HELP)
+	if err := d.Run(os.Stdin); err != nil {
+		exitWithError("error reading commands", err, 5)
+	}
+}
+
+func serveGDB(d *debugger.Debugger, address string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		exitWithError("error listening for gdb", err, 5)
+	}
+	defer listener.Close()
+
+	log.Println("Waiting for gdb to connect on", listener.Addr())
+	conn, err := listener.Accept()
+	if err != nil {
+		exitWithError("error accepting gdb connection", err, 5)
+	}
+	defer conn.Close()
+
+	log.Println("gdb connected from", conn.RemoteAddr())
+	if err := d.ServeGDB(conn); err != nil {
+		exitWithError("error talking to gdb", err, 5)
+	}
+}
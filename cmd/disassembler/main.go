@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/djhworld/simple-computer/asm"
+)
+
+var inputFile = flag.String("i", "", "input bin file (default: stdin)")
+var outputFile = flag.String("o", "", "output file (default: stdout)")
+var origin = flag.String("origin", "0x0500", "the address the program is loaded at")
+
+func exitWithError(message string, err error, exitCode int) {
+	fmt.Fprintln(os.Stderr, message, err)
+	fmt.Fprint(os.Stderr, "\n")
+	flag.Usage()
+	os.Exit(exitCode)
+}
+
+func main() {
+	flag.Parse()
+
+	start, err := strconv.ParseUint(*origin, 0, 16)
+	if err != nil {
+		exitWithError("error parsing origin: ", err, 5)
+	}
+
+	reader, err := getReaderFor(*inputFile)
+	if err != nil {
+		exitWithError("error reading input: ", err, 5)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		exitWithError("error reading input: ", err, 5)
+	}
+	if len(data)%2 != 0 {
+		exitWithError("error reading input: ", fmt.Errorf("size of input is not an even number (bytes = %d)", len(data)), 5)
+	}
+
+	program := make([]uint16, len(data)/2)
+	for i := range program {
+		program[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+
+	instructions, err := asm.Disassemble(program, uint16(start))
+	if err != nil {
+		exitWithError("error disassembling input: ", err, 104)
+	}
+
+	writer, err := getWriterFor(*outputFile)
+	if err != nil {
+		exitWithError("error getting output handle: ", err, 104)
+	}
+	defer writer.Close()
+
+	disassembly := asm.Instructions{}
+	disassembly.Add(instructions...)
+	fmt.Fprintf(writer, "; disassembled from 0x%04X\n", start)
+	fmt.Fprint(writer, disassembly.String())
+}
+
+func getReaderFor(file string) (io.ReadCloser, error) {
+	if file == "" {
+		return os.Stdin, nil
+	}
+
+	return os.Open(file)
+}
+
+func getWriterFor(file string) (io.WriteCloser, error) {
+	if file == "" {
+		return os.Stdout, nil
+	}
+
+	return os.Create(file)
+}
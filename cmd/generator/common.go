@@ -111,15 +111,14 @@ func initialiseCommonCode() []asm.Instruction {
 	instructions := asm.Instructions{}
 
 	instructions.Add(
-		asm.DEFSYMBOL{"LINE-WIDTH", 0x001E},
-		asm.DEFSYMBOL{"CALL-RETURN-ADDRESS", 0xFF33},
-		asm.DEFSYMBOL{"ONE", 0x0001},
-		asm.DEFSYMBOL{"LINEX", 0xFF01},
-		asm.DEFSYMBOL{"PEN-POSITION-ADDR", 0x0400},
-		asm.DEFSYMBOL{"KEYCODE-REGISTER", 0x0401},
-
-		asm.DEFSYMBOL{"DISPLAY-ADAPTER-ADDR", 0x0007},
-		asm.DEFSYMBOL{"KEY-ADAPTER-ADDR", 0x000F},
+		asm.DEFSYMBOL{"LINE-WIDTH", asm.NUMBER{0x001E}},
+		asm.DEFSYMBOL{"ONE", asm.NUMBER{0x0001}},
+		asm.DEFSYMBOL{"LINEX", asm.NUMBER{0xFF01}},
+		asm.DEFSYMBOL{"PEN-POSITION-ADDR", asm.NUMBER{0x0400}},
+		asm.DEFSYMBOL{"KEYCODE-REGISTER", asm.NUMBER{0x0401}},
+
+		asm.DEFSYMBOL{"DISPLAY-ADAPTER-ADDR", asm.NUMBER{0x0007}},
+		asm.DEFSYMBOL{"KEY-ADAPTER-ADDR", asm.NUMBER{0x000F}},
 	)
 
 	instructions.Add(
@@ -150,7 +149,7 @@ func routine_loadFontDescriptions(label string) []asm.Instruction {
 		)
 	}
 
-	instructions.Add(asm.JR{asm.REG3})
+	instructions.Add(asm.RET{})
 	return instructions.Get()
 }
 
@@ -158,12 +157,6 @@ func routine_pollKeyboard(labelPrefix string) []asm.Instruction {
 	instructions := asm.Instructions{}
 	instructions.Add(asm.DEFLABEL{labelPrefix})
 
-	// push retun address
-	instructions.Add(
-		asm.DATA{asm.REG2, asm.SYMBOL{"CALL-RETURN-ADDRESS"}},
-		asm.STORE{asm.REG2, asm.REG3},
-	)
-
 	instructions.Add(
 		asm.DATA{asm.REG2, asm.NUMBER{0x000F}}, //select keyboard keyboard
 		asm.OUT{asm.ADDRESS_MODE, asm.REG2},
@@ -187,9 +180,7 @@ func routine_pollKeyboard(labelPrefix string) []asm.Instruction {
 	// return to callee
 	instructions.Add(
 		asm.CLF{},
-		asm.DATA{asm.REG3, asm.SYMBOL{"CALL-RETURN-ADDRESS"}},
-		asm.LOAD{asm.REG3, asm.REG3},
-		asm.JR{asm.REG3},
+		asm.RET{},
 	)
 
 	return instructions.Get()
@@ -212,8 +203,6 @@ func routine_drawFontCharacter(labelPrefix string) []asm.Instruction {
 	instructions.Add(asm.DEFLABEL{labelPrefix})
 
 	instructions.Add(
-		asm.DATA{asm.REG2, asm.SYMBOL{"CALL-RETURN-ADDRESS"}},
-		asm.STORE{asm.REG2, asm.REG3},
 		asm.DATA{asm.REG2, asm.SYMBOL{"PEN-POSITION-ADDR"}},
 		asm.LOAD{asm.REG2, asm.REG2},
 	)
@@ -380,9 +369,7 @@ func routine_drawFontCharacter(labelPrefix string) []asm.Instruction {
 	// return to callee
 	instructions.Add(
 		asm.CLF{},
-		asm.DATA{asm.REG3, asm.SYMBOL{"CALL-RETURN-ADDRESS"}},
-		asm.LOAD{asm.REG3, asm.REG3},
-		asm.JR{asm.REG3},
+		asm.RET{},
 	)
 
 	return instructions.Get()
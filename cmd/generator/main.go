@@ -13,7 +13,7 @@ import (
 // 0x0000 - 0x03FF ASCII table
 // 0x0400 - 0x0400 pen position
 // 0x0401 - 0x0401 keycode register
-// 0x0500 - 0xFEFD user code + memory
+// 0x0500 - 0xFEFD user code + memory (stack grows downwards from 0xFEFD)
 // 0xFEFE - 0xFEFF used to jump back to user code
 // 0xFF00 - 0xFFFF temporary variables
 func main() {
@@ -174,8 +174,6 @@ func routine_drawBrush(labelPrefix string) []asm.Instruction {
 	instructions.Add(asm.DEFLABEL{labelPrefix})
 
 	instructions.Add(
-		asm.DATA{asm.REG2, asm.SYMBOL{"CALL-RETURN-ADDRESS"}},
-		asm.STORE{asm.REG2, asm.REG3},
 		asm.DATA{asm.REG2, asm.SYMBOL{"PEN-POSITION-ADDR"}},
 		asm.LOAD{asm.REG2, asm.REG2},
 	)
@@ -308,9 +306,7 @@ func routine_drawBrush(labelPrefix string) []asm.Instruction {
 	// return to callee
 	instructions.Add(
 		asm.CLF{},
-		asm.DATA{asm.REG3, asm.SYMBOL{"CALL-RETURN-ADDRESS"}},
-		asm.LOAD{asm.REG3, asm.REG3},
-		asm.JR{asm.REG3},
+		asm.RET{},
 	)
 
 	return instructions.Get()
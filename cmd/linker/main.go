@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/djhworld/simple-computer/asm"
+	"github.com/djhworld/simple-computer/linker"
+)
+
+var outputFile = flag.String("o", "", "output bin file (default: stdout)")
+var textAddress = flag.String("text", "0x0500", "the address the code goes at, the bin is loaded here")
+var dataAddress = flag.String("data", "", "the address the data goes at (default: straight after the code)")
+var labelsFile = flag.String("labels", "", "write the address of each .global label to this file, for the debugger")
+
+func exitWithError(message string, err error, exitCode int) {
+	fmt.Fprintln(os.Stderr, message, err)
+	fmt.Fprint(os.Stderr, "\n")
+	fmt.Fprintln(os.Stderr, "usage: linker [flags] object...")
+	flag.PrintDefaults()
+	os.Exit(exitCode)
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		exitWithError("no object files given", nil, 5)
+	}
+
+	layout := linker.Layout{}
+	text, err := strconv.ParseUint(*textAddress, 0, 16)
+	if err != nil {
+		exitWithError("error parsing text address: ", err, 5)
+	}
+	layout.Text = uint16(text)
+	if *dataAddress != "" {
+		data, err := strconv.ParseUint(*dataAddress, 0, 16)
+		if err != nil {
+			exitWithError("error parsing data address: ", err, 5)
+		}
+		layout.Data = uint16(data)
+	}
+
+	modules := []linker.Module{}
+	for _, file := range flag.Args() {
+		object, err := readObject(file)
+		if err != nil {
+			exitWithError(fmt.Sprintf("error reading %s: ", file), err, 5)
+		}
+		modules = append(modules, linker.Module{Name: file, Object: object})
+	}
+
+	image, err := linker.Link(modules, layout)
+	if err != nil {
+		exitWithError("error linking:\n", err, 104)
+	}
+
+	writer, err := getWriterFor(*outputFile)
+	if err != nil {
+		exitWithError("error getting output handle: ", err, 104)
+	}
+	defer writer.Close()
+
+	if err := binary.Write(writer, binary.LittleEndian, image.Words); err != nil {
+		exitWithError("error writing output handle: ", err, 5)
+	}
+
+	if *labelsFile != "" {
+		if err := writeLabels(*labelsFile, image.Symbols); err != nil {
+			exitWithError("error writing labels: ", err, 5)
+		}
+	}
+}
+
+func readObject(file string) (*asm.Object, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return asm.ReadObject(f)
+}
+
+func writeLabels(file string, labels map[string]uint16) error {
+	writer, err := getWriterFor(file)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if labels[names[i]] == labels[names[j]] {
+			return names[i] < names[j]
+		}
+		return labels[names[i]] < labels[names[j]]
+	})
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(writer, "%s 0x%04X\n", name, labels[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getWriterFor(file string) (io.WriteCloser, error) {
+	if file == "" {
+		return os.Stdout, nil
+	}
+
+	return os.Create(file)
+}
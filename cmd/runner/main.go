@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/djhworld/simple-computer/computer"
+	"github.com/djhworld/simple-computer/cpu"
+	"github.com/djhworld/simple-computer/executable"
+	"github.com/djhworld/simple-computer/trace"
+)
+
+// EXIT_LIMIT is the exit code used when the program is still running when the instruction
+// limit or the timeout is reached, the same as the timeout command
+const EXIT_LIMIT = 124
+
+// EXIT_TOO_LARGE is the exit code used when the exit register is over 255, as only the low
+// 8 bits of an exit code reach the caller and 0x0100 would otherwise look like success
+const EXIT_TOO_LARGE = 255
+
+var binFile = flag.String("bin", "", "the bin file to load into the computer")
+var fastCore = flag.Bool("fast", false, "run on the behavioural CPU core instead of the gate level one")
+var maxInstructions = flag.Int("max-instructions", 1000000, "stop after this many instructions, 0 for no limit")
+var timeout = flag.Duration("timeout", 0, "stop after this long, 0 for no limit")
+var stopAt = flag.String("stop-at", "", "stop when the next instruction to run is at this address")
+var exitRegister = flag.String("exit-register", "R0", "register (R0-R3) holding the exit code when the program stops by itself, values over 255 exit with 255")
+var dumpMemory = flag.String("dump-memory", "", "memory to include in the output as <start>:<length>, e.g. 0x0A00:16")
+var framebuffer = flag.Bool("framebuffer", true, "include the rendered screen in the output")
+var traceFile = flag.String("trace", "", "write a record of every instruction run to this file")
+var traceFormat = flag.String("trace-format", trace.FORMAT_JSON, "format of the trace, json (one record per line) or binary")
+var traceRange = flag.String("trace-range", "", "only trace instructions at these addresses, a comma separated list of <start>-<end>, e.g. 0x0500-0x05FF")
+var traceClass = flag.String("trace-class", "", "only trace these classes of instruction, a comma separated list of alu, memory, data, jump, call, stack, io, interrupt, halt and unknown")
+var vcdFile = flag.String("vcd", "", "write the CPU's buses and control wires to this VCD file every clock phase, for viewing in GTKWave (gate level CPU only)")
+var vcdSignals = flag.String("vcd-signals", "*", "the signals to write to the VCD file, a comma separated list of paths or globs, e.g. cpu.mainBus,cpu.stepper.*,cpu.*.enable")
+var faultsFile = flag.String("faults", "", "put the faults in this spec file into the CPU, one <target> <stuck-at-0|stuck-at-1|flip> [cycle] per line (gate level CPU only)")
+
+// Result is written to stdout as JSON once the program stops
+type Result struct {
+	StopReason   string                 `json:"stop_reason"`
+	Instructions int                    `json:"instructions"`
+	ExitCode     int                    `json:"exit_code"`
+	Registers    computer.RegisterState `json:"registers"`
+	Memory       *MemoryDump            `json:"memory,omitempty"`
+	Framebuffer  []string               `json:"framebuffer,omitempty"`
+}
+
+type MemoryDump struct {
+	Start uint16   `json:"start"`
+	Words []uint16 `json:"words"`
+}
+
+func exitWithError(message string, err error, exitCode int) {
+	fmt.Fprintln(os.Stderr, message, err)
+	fmt.Fprint(os.Stderr, "\n")
+	flag.Usage()
+	os.Exit(exitCode)
+}
+
+func main() {
+	flag.Parse()
+	if *binFile == "" {
+		exitWithError("no bin file given", nil, 5)
+	}
+
+	program, err := executable.ReadFile(*binFile)
+	if err != nil {
+		exitWithError("error attempting to parse bin file", err, 5)
+	}
+
+	register, err := parseRegister(*exitRegister)
+	if err != nil {
+		exitWithError("error parsing exit register", err, 5)
+	}
+
+	var dump *MemoryDump
+	var dumpLength int
+	if *dumpMemory != "" {
+		start, length, err := parseMemoryRange(*dumpMemory)
+		if err != nil {
+			exitWithError("error parsing memory range", err, 5)
+		}
+		dump = &MemoryDump{Start: start}
+		dumpLength = length
+	}
+
+	stopReason := ""
+	stopWhenStuck := computer.StopWhenStuck()
+	conditions := []computer.StopCondition{
+		func(c cpu.Core) bool {
+			if stopWhenStuck(c) {
+				stopReason = "stuck"
+				return true
+			}
+			return false
+		},
+	}
+	if *stopAt != "" {
+		address, err := strconv.ParseUint(*stopAt, 0, 16)
+		if err != nil {
+			exitWithError("error parsing stop address", err, 5)
+		}
+		stopAtAddress := computer.StopAtAddress(uint16(address))
+		conditions = append(conditions, func(c cpu.Core) bool {
+			if stopAtAddress(c) {
+				stopReason = "stop-at"
+				return true
+			}
+			return false
+		})
+	}
+
+	var options []computer.Option
+	if *fastCore {
+		options = append(options, computer.WithFastCore())
+	}
+
+	// the screen is rendered once at the end rather than by screen control, so nothing reads these
+	screenChannel := make(chan *[160][240]byte)
+	quitChannel := make(chan bool, 10)
+
+	comp := computer.NewComputer(screenChannel, quitChannel, options...)
+	if err := comp.Load(program); err != nil {
+		exitWithError("error loading bin file", err, 5)
+	}
+	comp.Boot()
+
+	if *traceFile != "" {
+		f, err := comp.TraceFile(*traceFile, *traceFormat, *traceRange, *traceClass)
+		if err != nil {
+			exitWithError("error opening trace", err, 5)
+		}
+		defer f.Close()
+	}
+
+	if *faultsFile != "" {
+		if err := comp.InjectFaultFile(*faultsFile); err != nil {
+			exitWithError("error injecting faults", err, 5)
+		}
+	}
+
+	if *vcdFile != "" {
+		f, err := comp.WaveformFile(*vcdFile, *vcdSignals)
+		if err != nil {
+			exitWithError("error opening VCD file", err, 5)
+		}
+		defer f.Close()
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	instructions, stopped, err := comp.RunUntil(ctx, *maxInstructions, conditions...)
+	if err != nil && err != ctx.Err() {
+		exitWithError("error running program", err, 5)
+	}
+	if err := comp.FlushTrace(); err != nil {
+		exitWithError("error writing trace", err, 5)
+	}
+	if err := comp.FlushWaveform(); err != nil {
+		exitWithError("error writing VCD file", err, 5)
+	}
+
+	result := Result{Instructions: instructions, Registers: comp.Registers()}
+	switch {
+	case stopped:
+		result.StopReason = stopReason
+		if comp.CPU().Halted() {
+			result.StopReason = "halt"
+		}
+		result.ExitCode = int(comp.CPU().Register(register))
+		if result.ExitCode > 255 {
+			fmt.Fprintf(os.Stderr, "warning: R%d is %d, which does not fit in an exit code, exiting with %d\n", register, result.ExitCode, EXIT_TOO_LARGE)
+			result.ExitCode = EXIT_TOO_LARGE
+		}
+	case err != nil:
+		result.StopReason = "timeout"
+		result.ExitCode = EXIT_LIMIT
+	default:
+		result.StopReason = "max-instructions"
+		result.ExitCode = EXIT_LIMIT
+	}
+
+	if dump != nil {
+		dump.Words = comp.ReadRAM(dump.Start, dumpLength)
+		result.Memory = dump
+	}
+
+	if *framebuffer {
+		for _, row := range comp.Framebuffer() {
+			var line strings.Builder
+			for _, pixel := range row {
+				line.WriteByte('0' + pixel)
+			}
+			result.Framebuffer = append(result.Framebuffer, line.String())
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		exitWithError("error writing result", err, 5)
+	}
+
+	os.Exit(result.ExitCode)
+}
+
+func parseRegister(s string) (int, error) {
+	switch strings.ToUpper(s) {
+	case "R0":
+		return 0, nil
+	case "R1":
+		return 1, nil
+	case "R2":
+		return 2, nil
+	case "R3":
+		return 3, nil
+	}
+	return 0, fmt.Errorf("'%s' is not one of R0-R3", s)
+}
+
+func parseMemoryRange(s string) (uint16, int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected <start>:<length> but got '%s'", s)
+	}
+	start, err := strconv.ParseUint(parts[0], 0, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(parts[1], 0, 17)
+	if err != nil || length > 0x10000 {
+		return 0, 0, fmt.Errorf("length '%s' must be a number up to 0x10000", parts[1])
+	}
+	return uint16(start), int(length), nil
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/go-gl/glfw/v3.2/glfw"
 )
 
+// SNAPSHOT_KEY is the key that saves a snapshot, it is not passed on to the keyboard
+const SNAPSHOT_KEY = glfw.KeyF5
+
 // GlfwIO is for running the system using GLFW.
 // libglfw3 will be required on the system
 type GlfwIO struct {
@@ -16,6 +19,7 @@ type GlfwIO struct {
 	screenChannel   chan *[160][240]byte
 	keyPressChannel chan *io.KeyPress
 	quitChannel     chan bool
+	onSnapshotKey   func()
 }
 
 func NewGlfwIO(screenChannel chan *[160][240]byte, keyPressChannel chan *io.KeyPress, quitChannel chan bool) *GlfwIO {
@@ -29,9 +33,15 @@ func NewGlfwIO(screenChannel chan *[160][240]byte, keyPressChannel chan *io.KeyP
 		screenChannel,
 		keyPressChannel,
 		quitChannel,
+		nil,
 	}
 }
 
+// OnSnapshotKey sets what to do when SNAPSHOT_KEY is pressed
+func (i *GlfwIO) OnSnapshotKey(handler func()) {
+	i.onSnapshotKey = handler
+}
+
 func (i *GlfwIO) Run() {
 	clock := time.Tick(33 * time.Millisecond)
 	for {
@@ -55,6 +65,13 @@ func (i *GlfwIO) Init(title string) error {
 	}
 
 	i.glfwDisplay.window.SetKeyCallback(func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+		if key == SNAPSHOT_KEY {
+			if action == glfw.Press && i.onSnapshotKey != nil {
+				i.onSnapshotKey()
+			}
+			return
+		}
+
 		if action == glfw.Repeat {
 			i.keyPressChannel <- &down_key_presses[int(key)]
 			return
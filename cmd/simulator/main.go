@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/binary"
 	"flag"
 	"fmt"
 	"log"
@@ -10,10 +9,10 @@ import (
 	"strings"
 	"time"
 
-	goio "io"
-
 	"github.com/djhworld/simple-computer/computer"
+	"github.com/djhworld/simple-computer/executable"
 	"github.com/djhworld/simple-computer/io"
+	"github.com/djhworld/simple-computer/trace"
 )
 
 func init() {
@@ -25,75 +24,112 @@ func init() {
 var binFile = flag.String("bin", "/dev/stdin", "the bin file to load into the computer")
 var printState = flag.Bool("print-state", false, "print the computer state to stdout")
 var printStateSampleSize = flag.Int("print-state-every", 512, "how often in steps to print the computer state. lower will decrease performance.")
+var fastCore = flag.Bool("fast", false, "run on the behavioural CPU core instead of the gate level one")
+var loadSnapshot = flag.String("load-snapshot", "", "carry on from a snapshot instead of loading a bin file, it must have been saved with the same core")
+var snapshotFile = flag.String("snapshot", "simulator.snapshot", "the file a snapshot is saved to when F5 is pressed")
+var traceFile = flag.String("trace", "", "write a record of every instruction run to this file")
+var traceFormat = flag.String("trace-format", trace.FORMAT_JSON, "format of the trace, json (one record per line) or binary")
+var traceRange = flag.String("trace-range", "", "only trace instructions at these addresses, a comma separated list of <start>-<end>, e.g. 0x0500-0x05FF")
+var traceClass = flag.String("trace-class", "", "only trace these classes of instruction, a comma separated list of alu, memory, data, jump, call, stack, io, interrupt, halt and unknown")
+var vcdFile = flag.String("vcd", "", "write the CPU's buses and control wires to this VCD file every clock phase, for viewing in GTKWave (gate level CPU only)")
+var vcdSignals = flag.String("vcd-signals", "*", "the signals to write to the VCD file, a comma separated list of paths or globs, e.g. cpu.mainBus,cpu.stepper.*,cpu.*.enable")
+var faultsFile = flag.String("faults", "", "put the faults in this spec file into the CPU, one <target> <stuck-at-0|stuck-at-1|flip> [cycle] per line (gate level CPU only)")
 
 func main() {
 	flag.Parse()
 	fmt.Println("\nDaniel's Simple Computer (based on the Scott CPU)")
 	fmt.Println(strings.Repeat("-", 80))
 
-	bin, err := read(*binFile)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "error attempting to parse bin file", err)
-		os.Exit(5)
+	// a snapshot has the program in it already
+	var program *executable.Executable
+	if *loadSnapshot == "" {
+		var err error
+		program, err = executable.ReadFile(*binFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error attempting to parse bin file", err)
+			os.Exit(5)
+		}
 	}
 
-	run(bin)
+	run(program)
 }
 
-func run(bin []uint16) {
+func run(program *executable.Executable) {
 	keyPressChannel := make(chan *io.KeyPress)
 	screenChannel := make(chan *[160][240]byte)
 	quitChannel := make(chan bool, 10)
 
 	glfw := NewGlfwIO(screenChannel, keyPressChannel, quitChannel)
-	if err := glfw.Init(fmt.Sprintf("%s", *binFile)); err != nil {
+	title := *binFile
+	if *loadSnapshot != "" {
+		title = *loadSnapshot
+	}
+	if err := glfw.Init(title); err != nil {
 		fmt.Fprintln(os.Stderr, "error received initialising GLFW instnace", err)
 		os.Exit(5)
 	}
 
-	comp := computer.NewComputer(screenChannel, quitChannel)
+	var options []computer.Option
+	if *fastCore {
+		options = append(options, computer.WithFastCore())
+	}
+
+	comp := computer.NewComputer(screenChannel, quitChannel, options...)
 	keyboard := io.NewKeyboard(keyPressChannel, quitChannel)
 	comp.ConnectKeyboard(keyboard)
-	comp.LoadToRAM(0x0500, bin)
-
-	go keyboard.Run()
-	go comp.Run(time.Tick(1*time.Nanosecond), computer.PrintStateConfig{*printState, *printStateSampleSize})
-
-	glfw.Run()
-}
+	if *loadSnapshot != "" {
+		if err := comp.RestoreFile(*loadSnapshot); err != nil {
+			fmt.Fprintln(os.Stderr, "error loading snapshot", err)
+			os.Exit(5)
+		}
+	} else if err := comp.Load(program); err != nil {
+		fmt.Fprintln(os.Stderr, "error loading bin file", err)
+		os.Exit(5)
+	}
 
-func read(filename string) ([]uint16, error) {
-	var reader goio.ReadCloser
-	if r, err := os.Open(filename); err != nil {
-		return nil, err
-	} else {
-		reader = r
+	glfw.OnSnapshotKey(func() {
+		if err := comp.SnapshotFile(*snapshotFile); err != nil {
+			log.Println("error saving snapshot", err)
+			return
+		}
+		log.Printf("Saved snapshot to %s", *snapshotFile)
+	})
+	log.Printf("Press F5 to save a snapshot to %s", *snapshotFile)
+
+	if *traceFile != "" {
+		f, err := comp.TraceFile(*traceFile, *traceFormat, *traceRange, *traceClass)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error opening trace", err)
+			os.Exit(5)
+		}
+		defer f.Close()
 	}
-	defer reader.Close()
 
-	size, err := countUint16s(filename)
-	if err != nil {
-		return nil, err
+	if *faultsFile != "" {
+		if err := comp.InjectFaultFile(*faultsFile); err != nil {
+			fmt.Fprintln(os.Stderr, "error injecting faults", err)
+			os.Exit(5)
+		}
 	}
 
-	instructions := make([]uint16, size)
-	if err := binary.Read(reader, binary.LittleEndian, &instructions); err != nil {
-		return nil, err
+	if *vcdFile != "" {
+		f, err := comp.WaveformFile(*vcdFile, *vcdSignals)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error opening VCD file", err)
+			os.Exit(5)
+		}
+		defer f.Close()
 	}
 
-	return instructions, nil
-}
+	go keyboard.Run()
+	go comp.Run(time.Tick(1*time.Nanosecond), computer.PrintStateConfig{*printState, *printStateSampleSize})
 
-func countUint16s(filename string) (int64, error) {
-	if stat, err := os.Stat(filename); err != nil {
-		return -1, err
-	} else {
-		filesize := stat.Size()
-		if filesize%2 != 0 {
-			return -1, fmt.Errorf("size of file '%s' is not an even number (bytes = %d)", filename, filesize)
-		}
-		uint16s := filesize / 2
-		log.Println("Size of", filename, "is", uint16s, "unsigned 16-bit integers")
-		return uint16s, nil
+	glfw.Run()
+
+	if err := comp.FlushTrace(); err != nil {
+		log.Println("error writing trace", err)
+	}
+	if err := comp.FlushWaveform(); err != nil {
+		log.Println("error writing VCD file", err)
 	}
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/djhworld/simple-computer/trace"
+)
+
+var inputFile = flag.String("i", "", "input binary trace written with -trace-format binary (default: stdin)")
+var outputFile = flag.String("o", "", "output file (default: stdout)")
+var traceRange = flag.String("trace-range", "", "only print instructions at these addresses, a comma separated list of <start>-<end>, e.g. 0x0500-0x05FF")
+var traceClass = flag.String("trace-class", "", "only print these classes of instruction, a comma separated list of alu, memory, data, jump, call, stack, io, interrupt, halt and unknown")
+
+func exitWithError(message string, err error, exitCode int) {
+	fmt.Fprintln(os.Stderr, message, err)
+	fmt.Fprint(os.Stderr, "\n")
+	flag.Usage()
+	os.Exit(exitCode)
+}
+
+func main() {
+	flag.Parse()
+
+	filter, err := trace.ParseFilter(*traceRange, *traceClass)
+	if err != nil {
+		exitWithError("error parsing filter: ", err, 5)
+	}
+
+	reader, err := getReaderFor(*inputFile)
+	if err != nil {
+		exitWithError("error reading input: ", err, 5)
+	}
+	defer reader.Close()
+
+	records, err := trace.NewReader(reader)
+	if err != nil {
+		exitWithError("error reading input: ", err, 5)
+	}
+
+	writer, err := getWriterFor(*outputFile)
+	if err != nil {
+		exitWithError("error getting output handle: ", err, 104)
+	}
+	defer writer.Close()
+
+	// the binary trace is written out again as one line of JSON per record
+	sink := trace.Filtered(trace.NewJSONSink(writer), filter)
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sink.Flush()
+			exitWithError("error reading trace: ", err, 104)
+		}
+		if err := sink.Write(record); err != nil {
+			exitWithError("error writing output: ", err, 104)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		exitWithError("error writing output: ", err, 104)
+	}
+}
+
+func getReaderFor(file string) (io.ReadCloser, error) {
+	if file == "" {
+		return os.Stdin, nil
+	}
+
+	return os.Open(file)
+}
+
+func getWriterFor(file string) (io.WriteCloser, error) {
+	if file == "" {
+		return os.Stdout, nil
+	}
+
+	return os.Create(file)
+}
@@ -1,21 +1,25 @@
 package components
 
 import (
-	"github.com/djhworld/simple-computer/arch"
 	"github.com/djhworld/simple-computer/circuit"
 )
 
 type Adder struct {
-	inputs   [32]circuit.Wire
+	inputs   []circuit.Wire
 	carryIn  circuit.Wire
-	adds     [arch.BUS_WIDTH]Add2
+	adds     []Add2
 	carryOut circuit.Wire
-	outputs  [arch.BUS_WIDTH]circuit.Wire
+	outputs  []circuit.Wire
 	next     Component
 }
 
-func NewAdder() *Adder {
+// NewAdder builds an adder for two values of width bits, one on the first width input wires
+// and the other on the rest
+func NewAdder(width int) *Adder {
 	a := new(Adder)
+	a.inputs = make([]circuit.Wire, width*2)
+	a.adds = make([]Add2, width)
+	a.outputs = make([]circuit.Wire, width)
 
 	for i, _ := range a.adds {
 		a.adds[i] = *NewAdd2()
@@ -36,6 +40,13 @@ func (a *Adder) SetInputWire(index int, value bool) {
 	a.inputs[index].Update(value)
 }
 
+// AddSignals names the adder's carry wires and its outputs
+func (a *Adder) AddSignals(s circuit.Scope) {
+	s.Add("carryIn", &a.carryIn)
+	s.Add("carry", &a.carryOut)
+	s.Add("out", wires(a.outputs)...)
+}
+
 func (a *Adder) Carry() bool {
 	return a.carryOut.Get()
 }
@@ -43,8 +54,8 @@ func (a *Adder) Carry() bool {
 func (a *Adder) Update(carryIn bool) {
 	a.carryIn.Update(carryIn)
 
-	awire := 31
-	bwire := 15
+	awire := len(a.inputs) - 1
+	bwire := len(a.adds) - 1
 	for i := len(a.adds) - 1; i >= 0; i-- {
 		aval := a.inputs[awire].Get()
 		bval := a.inputs[bwire].Get()
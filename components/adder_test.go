@@ -29,7 +29,7 @@ func TestAdder(t *testing.T) {
 }
 
 func testAdderReturnsCorrectResult(inputA int, inputB int, carryIn bool, expectedResult int, expectedCarry bool, t *testing.T) {
-	a := NewAdder()
+	a := NewAdder(arch.BUS_WIDTH)
 	setWireOnComponent32(a, inputA, inputB)
 
 	a.Update(carryIn)
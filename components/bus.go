@@ -1,6 +1,9 @@
 package components
 
-import "github.com/djhworld/simple-computer/circuit"
+import (
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/circuit"
+)
 
 type Bus struct {
 	wires []circuit.Wire
@@ -18,6 +21,25 @@ func NewBus(width int) *Bus {
 	return b
 }
 
+// Width is the number of wires in the bus
+func (b *Bus) Width() int {
+	return b.width
+}
+
+// Wires returns the bus's wires, wire 0 is the most significant bit
+func (b *Bus) Wires() []*circuit.Wire {
+	return wires(b.wires)
+}
+
+// wires points at each wire in a slice, so they can be added to a circuit.Registry
+func wires(w []circuit.Wire) []*circuit.Wire {
+	pointers := make([]*circuit.Wire, len(w))
+	for i := range w {
+		pointers[i] = &w[i]
+	}
+	return pointers
+}
+
 func (b *Bus) ConnectOutput(Component) {
 
 }
@@ -29,10 +51,11 @@ func (b *Bus) GetOutputWire(index int) bool {
 	return b.wires[index].Get()
 }
 
-func (b *Bus) SetValue(value uint16) {
+// SetValue puts a value on the bus, the bits above its width are ignored
+func (b *Bus) SetValue(value arch.Word) {
 	var x = 0
 	for i := b.width - 1; i >= 0; i-- {
-		r := (value & (1 << uint16(x)))
+		r := (value & (1 << uint(x)))
 		if r != 0 {
 			b.SetInputWire(i, true)
 		} else {
@@ -43,6 +66,18 @@ func (b *Bus) SetValue(value uint16) {
 	}
 }
 
+func (b *Bus) Value() arch.Word {
+	var value arch.Word
+	var x = 0
+	for i := b.width - 1; i >= 0; i-- {
+		if b.GetOutputWire(i) {
+			value = value | (1 << uint(x))
+		}
+		x++
+	}
+	return value
+}
+
 func (b *Bus) String() string {
 	result := ""
 	for i := 0; i < b.width; i++ {
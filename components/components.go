@@ -13,14 +13,17 @@ type Component interface {
 }
 
 type Enabler struct {
-	inputs  [arch.BUS_WIDTH]circuit.Wire
-	gates   [arch.BUS_WIDTH]circuit.ANDGate
-	outputs [arch.BUS_WIDTH]circuit.Wire
+	inputs  []circuit.Wire
+	gates   []circuit.ANDGate
+	outputs []circuit.Wire
 	next    Component
 }
 
-func NewEnabler() *Enabler {
+func NewEnabler(width int) *Enabler {
 	e := new(Enabler)
+	e.inputs = make([]circuit.Wire, width)
+	e.gates = make([]circuit.ANDGate, width)
+	e.outputs = make([]circuit.Wire, width)
 
 	for i, _ := range e.gates {
 		e.gates[i] = *circuit.NewANDGate()
@@ -55,15 +58,18 @@ func (e *Enabler) Update(enable bool) {
 
 // TODO not sure if this is exactly how this should look...
 type LeftShifter struct {
-	inputs   [arch.BUS_WIDTH]circuit.Wire
-	outputs  [arch.BUS_WIDTH]circuit.Wire
+	inputs   []circuit.Wire
+	outputs  []circuit.Wire
 	shiftIn  circuit.Wire
 	shiftOut circuit.Wire
 	next     Component
 }
 
-func NewLeftShifter() *LeftShifter {
-	return new(LeftShifter)
+func NewLeftShifter(width int) *LeftShifter {
+	l := new(LeftShifter)
+	l.inputs = make([]circuit.Wire, width)
+	l.outputs = make([]circuit.Wire, width)
+	return l
 }
 
 func (l *LeftShifter) ConnectOutput(b Component) {
@@ -85,34 +91,25 @@ func (l *LeftShifter) ShiftOut() bool {
 func (l *LeftShifter) Update(shiftIn bool) {
 	l.shiftIn.Update(shiftIn)
 	l.shiftOut.Update(l.inputs[0].Get())
-	l.outputs[0].Update(l.inputs[1].Get())
-	l.outputs[1].Update(l.inputs[2].Get())
-	l.outputs[2].Update(l.inputs[3].Get())
-	l.outputs[3].Update(l.inputs[4].Get())
-	l.outputs[4].Update(l.inputs[5].Get())
-	l.outputs[5].Update(l.inputs[6].Get())
-	l.outputs[6].Update(l.inputs[7].Get())
-	l.outputs[7].Update(l.inputs[8].Get())
-	l.outputs[8].Update(l.inputs[9].Get())
-	l.outputs[9].Update(l.inputs[10].Get())
-	l.outputs[10].Update(l.inputs[11].Get())
-	l.outputs[11].Update(l.inputs[12].Get())
-	l.outputs[12].Update(l.inputs[13].Get())
-	l.outputs[13].Update(l.inputs[14].Get())
-	l.outputs[14].Update(l.inputs[15].Get())
-	l.outputs[15].Update(l.shiftIn.Get())
+	for i := 0; i < len(l.outputs)-1; i++ {
+		l.outputs[i].Update(l.inputs[i+1].Get())
+	}
+	l.outputs[len(l.outputs)-1].Update(l.shiftIn.Get())
 }
 
 type RightShifter struct {
-	inputs   [arch.BUS_WIDTH]circuit.Wire
+	inputs   []circuit.Wire
 	shiftIn  circuit.Wire
 	shiftOut circuit.Wire
-	outputs  [arch.BUS_WIDTH]circuit.Wire
+	outputs  []circuit.Wire
 	next     Component
 }
 
-func NewRightShifter() *RightShifter {
-	return new(RightShifter)
+func NewRightShifter(width int) *RightShifter {
+	r := new(RightShifter)
+	r.inputs = make([]circuit.Wire, width)
+	r.outputs = make([]circuit.Wire, width)
+	return r
 }
 
 func (r *RightShifter) ConnectOutput(b Component) {
@@ -134,34 +131,23 @@ func (r *RightShifter) ShiftOut() bool {
 func (r *RightShifter) Update(shiftIn bool) {
 	r.shiftIn.Update(shiftIn)
 	r.outputs[0].Update(r.shiftIn.Get())
-	r.outputs[1].Update(r.inputs[0].Get())
-	r.outputs[2].Update(r.inputs[1].Get())
-	r.outputs[3].Update(r.inputs[2].Get())
-	r.outputs[4].Update(r.inputs[3].Get())
-	r.outputs[5].Update(r.inputs[4].Get())
-	r.outputs[6].Update(r.inputs[5].Get())
-	r.outputs[7].Update(r.inputs[6].Get())
-	r.outputs[8].Update(r.inputs[7].Get())
-	r.outputs[9].Update(r.inputs[8].Get())
-	r.outputs[10].Update(r.inputs[9].Get())
-	r.outputs[11].Update(r.inputs[10].Get())
-	r.outputs[12].Update(r.inputs[11].Get())
-	r.outputs[13].Update(r.inputs[12].Get())
-	r.outputs[14].Update(r.inputs[13].Get())
-	r.outputs[15].Update(r.inputs[14].Get())
-	r.shiftOut.Update(r.inputs[15].Get())
+	for i := 1; i < len(r.outputs); i++ {
+		r.outputs[i].Update(r.inputs[i-1].Get())
+	}
+	r.shiftOut.Update(r.inputs[len(r.inputs)-1].Get())
 }
 
 type IsZero struct {
-	inputs  [arch.BUS_WIDTH]circuit.Wire
+	inputs  []circuit.Wire
 	orer    ORer
 	notGate circuit.NOTGate
 	output  circuit.Wire
 }
 
-func NewIsZero() *IsZero {
+func NewIsZero(width int) *IsZero {
 	z := new(IsZero)
-	z.orer = *NewORer()
+	z.inputs = make([]circuit.Wire, width)
+	z.orer = *NewORer(width)
 	z.notGate = *circuit.NewNOTGate()
 
 	return z
@@ -187,7 +173,7 @@ func (z *IsZero) SetInputWire(index int, value bool) {
 func (z *IsZero) Update() {
 	for i, _ := range z.inputs {
 		z.orer.SetInputWire(i, z.inputs[i].Get())
-		z.orer.SetInputWire(i+arch.BUS_WIDTH, z.inputs[i].Get())
+		z.orer.SetInputWire(i+len(z.inputs), z.inputs[i].Get())
 	}
 	z.orer.Update()
 
@@ -206,14 +192,17 @@ func (z *IsZero) Update() {
 }
 
 type NOTer struct {
-	inputs  [arch.BUS_WIDTH]circuit.Wire
-	gates   [arch.BUS_WIDTH]circuit.NOTGate
-	outputs [arch.BUS_WIDTH]circuit.Wire
+	inputs  []circuit.Wire
+	gates   []circuit.NOTGate
+	outputs []circuit.Wire
 	next    Component
 }
 
-func NewNOTer() *NOTer {
+func NewNOTer(width int) *NOTer {
 	n := new(NOTer)
+	n.inputs = make([]circuit.Wire, width)
+	n.gates = make([]circuit.NOTGate, width)
+	n.outputs = make([]circuit.Wire, width)
 
 	for i, _ := range n.gates {
 		n.gates[i] = *circuit.NewNOTGate()
@@ -242,14 +231,19 @@ func (n *NOTer) Update() {
 }
 
 type ANDer struct {
-	inputs  [arch.BUS_WIDTH * 2]circuit.Wire
-	gates   [arch.BUS_WIDTH]circuit.ANDGate
-	outputs [arch.BUS_WIDTH]circuit.Wire
+	inputs  []circuit.Wire
+	gates   []circuit.ANDGate
+	outputs []circuit.Wire
 	next    Component
 }
 
-func NewANDer() *ANDer {
+// NewANDer builds an ANDer for two values of width bits, one on the first width input wires
+// and the other on the rest
+func NewANDer(width int) *ANDer {
 	a := new(ANDer)
+	a.inputs = make([]circuit.Wire, width*2)
+	a.gates = make([]circuit.ANDGate, width)
+	a.outputs = make([]circuit.Wire, width)
 
 	for i, _ := range a.gates {
 		a.gates[i] = *circuit.NewANDGate()
@@ -271,7 +265,7 @@ func (a *ANDer) SetInputWire(index int, value bool) {
 }
 
 func (a *ANDer) Update() {
-	awire := arch.BUS_WIDTH
+	awire := len(a.gates)
 	bwire := 0
 	for i, _ := range a.gates {
 		a.gates[i].Update(a.inputs[awire].Get(), a.inputs[bwire].Get())
@@ -282,14 +276,19 @@ func (a *ANDer) Update() {
 }
 
 type ORer struct {
-	inputs  [arch.BUS_WIDTH * 2]circuit.Wire
-	gates   [arch.BUS_WIDTH]circuit.ORGate
-	outputs [arch.BUS_WIDTH]circuit.Wire
+	inputs  []circuit.Wire
+	gates   []circuit.ORGate
+	outputs []circuit.Wire
 	next    Component
 }
 
-func NewORer() *ORer {
+// NewORer builds an ORer for two values of width bits, one on the first width input wires
+// and the other on the rest
+func NewORer(width int) *ORer {
 	o := new(ORer)
+	o.inputs = make([]circuit.Wire, width*2)
+	o.gates = make([]circuit.ORGate, width)
+	o.outputs = make([]circuit.Wire, width)
 
 	for i, _ := range o.gates {
 		o.gates[i] = *circuit.NewORGate()
@@ -311,7 +310,7 @@ func (o *ORer) SetInputWire(index int, value bool) {
 }
 
 func (o *ORer) Update() {
-	awire := arch.BUS_WIDTH
+	awire := len(o.gates)
 	bwire := 0
 	for i, _ := range o.gates {
 		o.gates[i].Update(o.inputs[awire].Get(), o.inputs[bwire].Get())
@@ -322,14 +321,19 @@ func (o *ORer) Update() {
 }
 
 type XORer struct {
-	inputs  [arch.BUS_WIDTH * 2]circuit.Wire
-	gates   [arch.BUS_WIDTH]circuit.XORGate
-	outputs [arch.BUS_WIDTH]circuit.Wire
+	inputs  []circuit.Wire
+	gates   []circuit.XORGate
+	outputs []circuit.Wire
 	next    Component
 }
 
-func NewXORer() *XORer {
+// NewXORer builds an XORer for two values of width bits, one on the first width input wires
+// and the other on the rest
+func NewXORer(width int) *XORer {
 	o := new(XORer)
+	o.inputs = make([]circuit.Wire, width*2)
+	o.gates = make([]circuit.XORGate, width)
+	o.outputs = make([]circuit.Wire, width)
 
 	for i, _ := range o.gates {
 		o.gates[i] = *circuit.NewXORGate()
@@ -351,7 +355,7 @@ func (o *XORer) SetInputWire(index int, value bool) {
 }
 
 func (o *XORer) Update() {
-	awire := arch.BUS_WIDTH
+	awire := len(o.gates)
 	bwire := 0
 	for i, _ := range o.gates {
 		o.gates[i].Update(o.inputs[awire].Get(), o.inputs[bwire].Get())
@@ -427,18 +431,21 @@ func (g *Compare2) Update(inputA, inputB, equalIn, isLargerIn bool) {
 }
 
 type Comparator struct {
-	inputs       [arch.BUS_WIDTH * 2]circuit.Wire
+	inputs       []circuit.Wire
 	equalIn      circuit.Wire
 	aIsLargerIn  circuit.Wire
-	compares     [arch.BUS_WIDTH]Compare2
-	outputs      [arch.BUS_WIDTH]circuit.Wire
+	compares     []Compare2
+	outputs      []circuit.Wire
 	equalOut     circuit.Wire
 	aIsLargerOut circuit.Wire
 	next         Component
 }
 
-func NewComparator() *Comparator {
+func NewComparator(width int) *Comparator {
 	c := new(Comparator)
+	c.inputs = make([]circuit.Wire, width*2)
+	c.compares = make([]Compare2, width)
+	c.outputs = make([]circuit.Wire, width)
 
 	for i, _ := range c.compares {
 		c.compares[i] = *NewCompare2()
@@ -464,9 +471,9 @@ func (c *Comparator) Update() {
 	c.equalIn.Update(true)
 	c.aIsLargerIn.Update(false)
 
-	// top 16 bits are <b>, bottom 16 bits are <a>
+	// top half of the inputs are <b>, bottom half are <a>
 	awire := 0
-	bwire := arch.BUS_WIDTH
+	bwire := len(c.compares)
 
 	for i := range c.compares {
 		c.compares[i].Update(c.inputs[awire].Get(), c.inputs[bwire].Get(), c.equalIn.Get(), c.aIsLargerIn.Get())
@@ -492,20 +499,32 @@ func (g *Comparator) Larger() bool {
 type BusOne struct {
 	inputBus  *Bus
 	outputBus *Bus
-	inputs    [arch.BUS_WIDTH]circuit.Wire
+	inputs    []circuit.Wire
 	bus1      circuit.Wire
-	andGates  [arch.BUS_WIDTH - 1]circuit.ANDGate
+	andGates  []circuit.ANDGate
 	notGate   circuit.NOTGate
 	orGate    circuit.ORGate
-	outputs   [arch.BUS_WIDTH]circuit.Wire
+	outputs   []circuit.Wire
 	next      Component
+
+	// when minusOne is on every output wire is forced high, giving all ones (0xFFFF on a 16 bit
+	// bus) so that the ALU adder can decrement the value on the other input
+	minusOne        circuit.Wire
+	minusOneORGates []circuit.ORGate
 }
 
+// NewBusOne builds a bus 1 as wide as its input bus
 func NewBusOne(inputBus, outputBus *Bus) *BusOne {
 	b := new(BusOne)
 	b.inputBus = inputBus
 	b.outputBus = outputBus
 
+	width := inputBus.Width()
+	b.inputs = make([]circuit.Wire, width)
+	b.andGates = make([]circuit.ANDGate, width-1)
+	b.outputs = make([]circuit.Wire, width)
+	b.minusOneORGates = make([]circuit.ORGate, width)
+
 	for i, _ := range b.andGates {
 		b.andGates[i] = *circuit.NewANDGate()
 	}
@@ -513,6 +532,10 @@ func NewBusOne(inputBus, outputBus *Bus) *BusOne {
 	b.notGate = *circuit.NewNOTGate()
 	b.orGate = *circuit.NewORGate()
 
+	for i, _ := range b.minusOneORGates {
+		b.minusOneORGates[i] = *circuit.NewORGate()
+	}
+
 	return b
 }
 
@@ -536,62 +559,57 @@ func (b *BusOne) Disable() {
 	b.bus1.Update(false)
 }
 
+// AddSignals names the bus 1 and minus one wires and the outputs
+func (b *BusOne) AddSignals(s circuit.Scope) {
+	s.Add("enable", &b.bus1)
+	s.Add("minusOne", &b.minusOne)
+	s.Add("out", wires(b.outputs)...)
+}
+
+func (b *BusOne) EnableMinusOne() {
+	b.minusOne.Update(true)
+}
+
+func (b *BusOne) DisableMinusOne() {
+	b.minusOne.Update(false)
+}
+
 func (b *BusOne) Update() {
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+	for i := len(b.inputs) - 1; i >= 0; i-- {
 		b.inputs[i].Update(b.inputBus.GetOutputWire(i))
 	}
 
 	b.notGate.Update(b.bus1.Get())
 
-	b.andGates[0].Update(b.inputs[0].Get(), b.notGate.Output())
-	b.andGates[1].Update(b.inputs[1].Get(), b.notGate.Output())
-	b.andGates[2].Update(b.inputs[2].Get(), b.notGate.Output())
-	b.andGates[3].Update(b.inputs[3].Get(), b.notGate.Output())
-	b.andGates[4].Update(b.inputs[4].Get(), b.notGate.Output())
-	b.andGates[5].Update(b.inputs[5].Get(), b.notGate.Output())
-	b.andGates[6].Update(b.inputs[6].Get(), b.notGate.Output())
-	b.andGates[7].Update(b.inputs[7].Get(), b.notGate.Output())
-	b.andGates[8].Update(b.inputs[8].Get(), b.notGate.Output())
-	b.andGates[9].Update(b.inputs[9].Get(), b.notGate.Output())
-	b.andGates[10].Update(b.inputs[10].Get(), b.notGate.Output())
-	b.andGates[11].Update(b.inputs[11].Get(), b.notGate.Output())
-	b.andGates[12].Update(b.inputs[12].Get(), b.notGate.Output())
-	b.andGates[13].Update(b.inputs[13].Get(), b.notGate.Output())
-	b.andGates[14].Update(b.inputs[14].Get(), b.notGate.Output())
-	b.orGate.Update(b.inputs[15].Get(), b.bus1.Get())
-
-	b.outputs[0].Update(b.andGates[0].Output())
-	b.outputs[1].Update(b.andGates[1].Output())
-	b.outputs[2].Update(b.andGates[2].Output())
-	b.outputs[3].Update(b.andGates[3].Output())
-	b.outputs[4].Update(b.andGates[4].Output())
-	b.outputs[5].Update(b.andGates[5].Output())
-	b.outputs[6].Update(b.andGates[6].Output())
-	b.outputs[7].Update(b.andGates[7].Output())
-	b.outputs[8].Update(b.andGates[8].Output())
-	b.outputs[9].Update(b.andGates[9].Output())
-	b.outputs[10].Update(b.andGates[10].Output())
-	b.outputs[11].Update(b.andGates[11].Output())
-	b.outputs[12].Update(b.andGates[12].Output())
-	b.outputs[13].Update(b.andGates[13].Output())
-	b.outputs[14].Update(b.andGates[14].Output())
-	b.outputs[15].Update(b.orGate.Output())
-
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+	for i := 0; i < len(b.andGates); i++ {
+		b.andGates[i].Update(b.inputs[i].Get(), b.notGate.Output())
+	}
+	b.orGate.Update(b.inputs[len(b.inputs)-1].Get(), b.bus1.Get())
+
+	for i := 0; i < len(b.andGates); i++ {
+		b.minusOneORGates[i].Update(b.andGates[i].Output(), b.minusOne.Get())
+	}
+	b.minusOneORGates[len(b.minusOneORGates)-1].Update(b.orGate.Output(), b.minusOne.Get())
+
+	for i := 0; i < len(b.outputs); i++ {
+		b.outputs[i].Update(b.minusOneORGates[i].Output())
+	}
+
+	for i := len(b.outputs) - 1; i >= 0; i-- {
 		b.outputBus.SetInputWire(i, b.outputs[i].Get())
 	}
 }
 
 func (b *BusOne) String() string {
-	var output uint16
-	var x int = 0
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+	var output arch.Word
+	var x uint = 0
+	for i := len(b.outputs) - 1; i >= 0; i-- {
 		if b.outputs[i].Get() {
-			output = output | (1 << uint16(x))
+			output = output | (1 << x)
 		} else {
-			output = output & ^(1 << uint16(x))
+			output = output & ^(1 << x)
 		}
 		x++
 	}
-	return utils.ValueToString(output)
+	return utils.WordToString(output, len(b.outputs))
 }
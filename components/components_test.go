@@ -38,7 +38,7 @@ func TestEnabler(t *testing.T) {
 		d.SetInputWire(i, true)
 	}
 
-	enabler := NewEnabler()
+	enabler := NewEnabler(arch.BUS_WIDTH)
 	d.ConnectOutput(enabler)
 	d.Update()
 	enabler.Update(false)
@@ -69,7 +69,7 @@ func TestEnablerWithEnableOn(t *testing.T) {
 	d.SetInputWire(14, false)
 	d.SetInputWire(15, true)
 
-	enabler := NewEnabler()
+	enabler := NewEnabler(arch.BUS_WIDTH)
 	d.ConnectOutput(enabler)
 	d.Update()
 	enabler.Update(true)
@@ -101,7 +101,7 @@ func TestLeftShifter(t *testing.T) {
 }
 
 func testLeftShifter(input int, shiftIn bool, expectedOutput int, expectedShiftOut bool, t *testing.T) {
-	l := NewLeftShifter()
+	l := NewLeftShifter(arch.BUS_WIDTH)
 	setWireOnComponent16(l, input)
 	l.Update(shiftIn)
 	if output := getValueOfOutput(l, arch.BUS_WIDTH); output != expectedOutput {
@@ -132,7 +132,7 @@ func TestRightShifter(t *testing.T) {
 }
 
 func testRightShifter(input int, shiftIn bool, expectedOutput int, expectedShiftOut bool, t *testing.T) {
-	r := NewRightShifter()
+	r := NewRightShifter(arch.BUS_WIDTH)
 	setWireOnComponent16(r, input)
 	r.Update(shiftIn)
 	output := getValueOfOutput(r, arch.BUS_WIDTH)
@@ -146,7 +146,7 @@ func testRightShifter(input int, shiftIn bool, expectedOutput int, expectedShift
 }
 
 func TestNOTer(t *testing.T) {
-	n := NewNOTer()
+	n := NewNOTer(arch.BUS_WIDTH)
 
 	n.SetInputWire(0, false)
 	n.SetInputWire(1, true)
@@ -191,7 +191,7 @@ func TestNOTer(t *testing.T) {
 }
 
 func TestANDer(t *testing.T) {
-	a := NewANDer()
+	a := NewANDer(arch.BUS_WIDTH)
 
 	a.SetInputWire(0, true)
 	a.SetInputWire(1, true)
@@ -253,7 +253,7 @@ func TestANDer(t *testing.T) {
 }
 
 func TestORer(t *testing.T) {
-	o := NewORer()
+	o := NewORer(arch.BUS_WIDTH)
 
 	o.SetInputWire(0, false)
 	o.SetInputWire(1, true)
@@ -315,7 +315,7 @@ func TestORer(t *testing.T) {
 }
 
 func TestXORer(t *testing.T) {
-	o := NewXORer()
+	o := NewXORer(arch.BUS_WIDTH)
 
 	o.SetInputWire(0, true)
 	o.SetInputWire(1, true)
@@ -445,7 +445,7 @@ func TestComparator(t *testing.T) {
 }
 
 func testComparatorReturnsCorrectResult(inputA int, inputB int, expectedIsEqual bool, expectedIsLarger bool, t *testing.T) {
-	c := NewComparator()
+	c := NewComparator(arch.BUS_WIDTH)
 	setWireOnComponent32(c, inputA, inputB)
 
 	c.Update()
@@ -462,7 +462,7 @@ func testComparatorReturnsCorrectResult(inputA int, inputB int, expectedIsEqual
 }
 
 func TestIsZero(t *testing.T) {
-	z := NewIsZero()
+	z := NewIsZero(arch.BUS_WIDTH)
 	for i := 0; i < arch.BUS_WIDTH; i++ {
 		z.SetInputWire(i, false)
 	}
@@ -473,7 +473,7 @@ func TestIsZero(t *testing.T) {
 		t.FailNow()
 	}
 
-	z = NewIsZero()
+	z = NewIsZero(arch.BUS_WIDTH)
 	for i := 0; i < arch.BUS_WIDTH; i++ {
 		z.SetInputWire(i, true)
 	}
@@ -485,7 +485,7 @@ func TestIsZero(t *testing.T) {
 	}
 
 	for i := 0; i < arch.BUS_WIDTH; i++ {
-		z := NewIsZero()
+		z := NewIsZero(arch.BUS_WIDTH)
 
 		z.SetInputWire(i, true)
 
@@ -511,6 +511,19 @@ func TestBusOne(t *testing.T) {
 	}
 }
 
+func TestBusOneMinusOne(t *testing.T) {
+	inputBus := NewBus(arch.BUS_WIDTH)
+	outputBus := NewBus(arch.BUS_WIDTH)
+	b := NewBusOne(inputBus, outputBus)
+	b.EnableMinusOne()
+	for i := 0; i < 65536; i++ {
+		//should always return 0xFFFF regardless of input
+		testBusOneReturnsCorrectResult(b, inputBus, outputBus, i, false, 0xFFFF, t)
+	}
+	b.DisableMinusOne()
+	testBusOneReturnsCorrectResult(b, inputBus, outputBus, 0x1234, false, 0x1234, t)
+}
+
 func testBusOneReturnsCorrectResult(b *BusOne, inputBus, outputBus *Bus, input int, enableBus1 bool, expectedOutput int, t *testing.T) {
 	setWireOnComponent16(inputBus, input)
 
@@ -72,3 +72,27 @@ func (i *IOBus) Update(mode, dataOrAddress bool) {
 func (i *IOBus) GetOutputWire(index int) bool {
 	return i.wires[index].Get()
 }
+
+// AddSignals names the IO bus wires
+func (i *IOBus) AddSignals(s circuit.Scope) {
+	s.Add("set", &i.wires[CLOCK_SET])
+	s.Add("enable", &i.wires[CLOCK_ENABLE])
+	s.Add("mode", &i.wires[MODE])
+	s.Add("dataOrAddress", &i.wires[DATA_OR_ADDRESS])
+}
+
+// Wires returns the state of every wire, indexed by CLOCK_SET, CLOCK_ENABLE, MODE and DATA_OR_ADDRESS
+func (i *IOBus) Wires() [4]bool {
+	var wires [4]bool
+	for index := range i.wires {
+		wires[index] = i.wires[index].Get()
+	}
+	return wires
+}
+
+// SetWires sets every wire at once, the opposite of Wires
+func (i *IOBus) SetWires(wires [4]bool) {
+	for index := range i.wires {
+		i.wires[index].Update(wires[index])
+	}
+}
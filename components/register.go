@@ -14,16 +14,18 @@ type Register struct {
 	enable    circuit.Wire
 	word      *Word
 	enabler   *Enabler
-	outputs   [arch.BUS_WIDTH]circuit.Wire
+	outputs   []circuit.Wire
 	inputBus  *Bus
 	outputBus *Bus
 }
 
+// NewRegister builds a register as wide as its input bus
 func NewRegister(name string, inputBus *Bus, outputBus *Bus) *Register {
 	r := new(Register)
 	r.name = name
-	r.word = NewWord()
-	r.enabler = NewEnabler()
+	r.word = NewWord(inputBus.Width())
+	r.enabler = NewEnabler(inputBus.Width())
+	r.outputs = make([]circuit.Wire, inputBus.Width())
 	r.enable = *circuit.NewWire("E", false)
 	r.set = *circuit.NewWire("S", false)
 	r.inputBus = inputBus
@@ -52,8 +54,28 @@ func (r *Register) Unset() {
 	r.set.Update(false)
 }
 
+// AddSignals names the register's set and enable wires, the word it holds and its
+// outputs to the bus
+func (r *Register) AddSignals(s circuit.Scope) {
+	s.Add("set", &r.set)
+	s.Add("enable", &r.enable)
+	s.Add("word", r.WordWires()...)
+	s.Add("out", wires(r.outputs)...)
+}
+
+// WordWires returns the wires carrying the word the register holds, wire 0 is the most
+// significant bit
+func (r *Register) WordWires() []*circuit.Wire {
+	return r.word.outputWires()
+}
+
+// Width is the number of bits the register holds
+func (r *Register) Width() int {
+	return len(r.outputs)
+}
+
 func (r *Register) Update() {
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+	for i := len(r.outputs) - 1; i >= 0; i-- {
 		r.word.SetInputWire(i, r.inputBus.GetOutputWire(i))
 	}
 
@@ -65,16 +87,34 @@ func (r *Register) Update() {
 	}
 
 	if r.enable.Get() {
-		for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+		for i := len(r.outputs) - 1; i >= 0; i-- {
 			r.outputBus.SetInputWire(i, r.outputs[i].Get())
 		}
 	}
 }
 
-func (r *Register) Value() uint16 {
-	var value uint16
-	var x uint16 = 0
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
+// Load puts a value straight into the register's word without going through the input
+// bus, the set and enable wires are left as they are. The bits above its width are ignored
+func (r *Register) Load(value arch.Word) {
+	var x = 0
+	for i := len(r.outputs) - 1; i >= 0; i-- {
+		r.word.SetInputWire(i, value&(1<<uint(x)) != 0)
+		x++
+	}
+
+	r.word.Update(true)
+	r.word.Update(false)
+	r.enabler.Update(r.enable.Get())
+
+	for i := 0; i < len(r.enabler.outputs); i++ {
+		r.outputs[i].Update(r.enabler.outputs[i].Get())
+	}
+}
+
+func (r *Register) Value() arch.Word {
+	var value arch.Word
+	var x uint = 0
+	for i := len(r.outputs) - 1; i >= 0; i-- {
 		if r.word.GetOutputWire(i) {
 			value = value | (1 << x)
 		} else {
@@ -87,16 +127,6 @@ func (r *Register) Value() uint16 {
 }
 
 func (r *Register) String() string {
-	var output uint16
-	var x uint16 = 0
-	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
-		if r.outputs[i].Get() {
-			output = output | (1 << x)
-		} else {
-			output = output & ^(1 << x)
-		}
-		x++
-	}
 	enable := 0
 	set := 0
 	if r.enable.Get() {
@@ -106,5 +136,5 @@ func (r *Register) String() string {
 		set = 1
 	}
 
-	return fmt.Sprintf("%s: %s E: %d S: %d", r.name, utils.ValueToString(r.Value()), enable, set)
+	return fmt.Sprintf("%s: %s E: %d S: %d", r.name, utils.WordToString(r.Value(), r.Width()), enable, set)
 }
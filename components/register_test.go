@@ -152,6 +152,39 @@ func checkValueIs(b Component, expected uint16) bool {
 	return result == expected
 }
 
+func TestRegisterLoad(t *testing.T) {
+	b := NewBus(arch.BUS_WIDTH)
+	setBus(b, 0x1234)
+
+	r := NewRegister("r", b, b)
+	r.Load(0xBEEF)
+
+	if r.Value() != 0xBEEF {
+		t.Logf("expected %X but got %X", 0xBEEF, r.Value())
+		t.FailNow()
+	}
+
+	// bus should not be touched
+	if !checkBus(b, 0x1234) {
+		t.FailNow()
+	}
+
+	r.Enable()
+	r.Update()
+
+	// value should not change as set is off
+	if r.Value() != 0xBEEF {
+		t.Logf("expected %X but got %X", 0xBEEF, r.Value())
+		t.FailNow()
+	}
+
+	// and should be enabled onto the bus
+	if b.Value() != 0xBEEF {
+		t.Logf("expected %X on the bus but got %X", 0xBEEF, b.Value())
+		t.FailNow()
+	}
+}
+
 func checkRegisterOutput(r *Register, expected uint16) bool {
 	var result uint16
 	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
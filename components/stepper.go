@@ -6,22 +6,38 @@ import (
 	"github.com/djhworld/simple-computer/circuit"
 )
 
+// STEPPER_STEPS is the number of steps in the stepper described in the book
+const STEPPER_STEPS = 6
+
 type Stepper struct {
-	bits           [12]Bit
+	bits           []Bit
 	reset          circuit.Wire
 	resetNotGate   circuit.NOTGate
 	clockIn        circuit.Wire
 	clockInNotGate circuit.NOTGate
 	inputOrGates   [2]circuit.ORGate
-	outputs        [7]circuit.Wire
-	outputAndGates [5]circuit.ANDGate
+	outputs        []circuit.Wire
+	outputAndGates []circuit.ANDGate
 	outputOrGate   circuit.ORGate
-	outputNotGates [6]circuit.NOTGate
+	outputNotGates []circuit.NOTGate
+
+	// early reset lines, one per output, ANDed with the output of that step
+	resetLines    []circuit.Wire
+	resetAndGates []circuit.ANDGate
+	resetOrGates  []circuit.ORGate
 }
 
 func NewStepper() *Stepper {
+	return NewStepperOfLength(STEPPER_STEPS)
+}
+
+// NewStepperOfLength creates a stepper that runs for the given number of steps
+// before resetting, instructions that finish earlier can cut the cycle short
+// with ResetAfter
+func NewStepperOfLength(steps int) *Stepper {
 	s := new(Stepper)
 
+	s.bits = make([]Bit, steps*2)
 	for i, _ := range s.bits {
 		s.bits[i] = *NewBit()
 	}
@@ -32,18 +48,52 @@ func NewStepper() *Stepper {
 		s.inputOrGates[i] = *circuit.NewORGate()
 	}
 
+	s.outputs = make([]circuit.Wire, steps+1)
+
+	s.outputAndGates = make([]circuit.ANDGate, steps-1)
 	for i, _ := range s.outputAndGates {
 		s.outputAndGates[i] = *circuit.NewANDGate()
 	}
 	s.outputOrGate = *circuit.NewORGate()
 
+	s.outputNotGates = make([]circuit.NOTGate, steps)
 	for i, _ := range s.outputNotGates {
 		s.outputNotGates[i] = *circuit.NewNOTGate()
 	}
 
+	s.resetLines = make([]circuit.Wire, steps)
+	s.resetAndGates = make([]circuit.ANDGate, steps)
+	for i, _ := range s.resetAndGates {
+		s.resetAndGates[i] = *circuit.NewANDGate()
+	}
+	s.resetOrGates = make([]circuit.ORGate, steps)
+	for i, _ := range s.resetOrGates {
+		s.resetOrGates[i] = *circuit.NewORGate()
+	}
+
 	return s
 }
 
+// Steps returns the number of steps the stepper runs for before resetting
+func (s *Stepper) Steps() int {
+	return len(s.outputs) - 1
+}
+
+// ResetAfter wires up the early reset line for the given step (1 based), when
+// set the stepper will reset as soon as that step has completed instead of
+// running through to the end
+func (s *Stepper) ResetAfter(step int, reset bool) {
+	s.resetLines[step].Update(reset)
+}
+
+// AddSignals names the stepper's clock and reset wires and its outputs, out[0] is on
+// for step 1 and the last output resets the stepper
+func (s *Stepper) AddSignals(scope circuit.Scope) {
+	scope.Add("clock", &s.clockIn)
+	scope.Add("reset", &s.reset)
+	scope.Add("out", wires(s.outputs)...)
+}
+
 func (s *Stepper) GetOutputWire(index int) bool {
 	return s.outputs[index].Get()
 }
@@ -62,17 +112,33 @@ func (s *Stepper) String() string {
 
 func (s *Stepper) Update(clockIn bool) {
 	s.clockIn.Update(clockIn)
-	s.reset.Update(s.outputs[6].Get())
+	s.reset.Update(s.resetOutput())
 
 	s.step()
 
 	// reset is instant so should do it immediately
-	if s.outputs[6].Get() {
-		s.reset.Update(s.outputs[6].Get())
+	if s.resetOutput() {
+		s.reset.Update(true)
 		s.step()
 	}
 }
 
+func (s *Stepper) resetOutput() bool {
+	last := len(s.outputs) - 1
+
+	// the last output is always wired to reset, the others only if their reset line is set
+	for i := 0; i < last; i++ {
+		s.resetAndGates[i].Update(s.outputs[i].Get(), s.resetLines[i].Get())
+	}
+
+	s.resetOrGates[0].Update(s.outputs[last].Get(), s.resetAndGates[0].Output())
+	for i := 1; i < last; i++ {
+		s.resetOrGates[i].Update(s.resetOrGates[i-1].Output(), s.resetAndGates[i].Output())
+	}
+
+	return s.resetOrGates[last-1].Output()
+}
+
 func (s *Stepper) step() {
 	s.clockInNotGate.Update(s.clockIn.Get())
 	s.resetNotGate.Update(s.reset.Get())
@@ -85,36 +151,40 @@ func (s *Stepper) step() {
 	s.outputNotGates[0].Update(s.bits[1].Get())
 	s.outputOrGate.Update(s.outputNotGates[0].Output(), s.reset.Get())
 
-	s.bits[2].Update(s.bits[1].Get(), s.inputOrGates[0].Output())
-	s.bits[3].Update(s.bits[2].Get(), s.inputOrGates[1].Output())
-	s.outputNotGates[1].Update(s.bits[3].Get())
-	s.outputAndGates[0].Update(s.outputNotGates[1].Output(), s.bits[1].Get())
-
-	s.bits[4].Update(s.bits[3].Get(), s.inputOrGates[0].Output())
-	s.bits[5].Update(s.bits[4].Get(), s.inputOrGates[1].Output())
-	s.outputNotGates[2].Update(s.bits[5].Get())
-	s.outputAndGates[1].Update(s.outputNotGates[2].Output(), s.bits[3].Get())
-
-	s.bits[6].Update(s.bits[5].Get(), s.inputOrGates[0].Output())
-	s.bits[7].Update(s.bits[6].Get(), s.inputOrGates[1].Output())
-	s.outputNotGates[3].Update(s.bits[7].Get())
-	s.outputAndGates[2].Update(s.outputNotGates[3].Output(), s.bits[5].Get())
+	for i := 1; i < len(s.outputNotGates); i++ {
+		s.bits[i*2].Update(s.bits[(i*2)-1].Get(), s.inputOrGates[0].Output())
+		s.bits[(i*2)+1].Update(s.bits[i*2].Get(), s.inputOrGates[1].Output())
+		s.outputNotGates[i].Update(s.bits[(i*2)+1].Get())
+		s.outputAndGates[i-1].Update(s.outputNotGates[i].Output(), s.bits[(i*2)-1].Get())
+	}
 
-	s.bits[8].Update(s.bits[7].Get(), s.inputOrGates[0].Output())
-	s.bits[9].Update(s.bits[8].Get(), s.inputOrGates[1].Output())
-	s.outputNotGates[4].Update(s.bits[9].Get())
-	s.outputAndGates[3].Update(s.outputNotGates[4].Output(), s.bits[7].Get())
+	s.outputs[0].Update(s.outputOrGate.Output())
+	for i := 1; i < len(s.outputs)-1; i++ {
+		s.outputs[i].Update(s.outputAndGates[i-1].Output())
+	}
+	s.outputs[len(s.outputs)-1].Update(s.bits[len(s.bits)-1].Get())
+}
 
-	s.bits[10].Update(s.bits[9].Get(), s.inputOrGates[0].Output())
-	s.bits[11].Update(s.bits[10].Get(), s.inputOrGates[1].Output())
-	s.outputNotGates[5].Update(s.bits[11].Get())
-	s.outputAndGates[4].Update(s.outputNotGates[5].Output(), s.bits[9].Get())
+// State returns the memory bits followed by the outputs, Restore puts them back so a
+// stepper can be saved and carried on from the same step
+func (s *Stepper) State() []bool {
+	state := make([]bool, 0, len(s.bits)+len(s.outputs))
+	for i := range s.bits {
+		state = append(state, s.bits[i].Get())
+	}
+	for i := range s.outputs {
+		state = append(state, s.outputs[i].Get())
+	}
+	return state
+}
 
-	s.outputs[0].Update(s.outputOrGate.Output())
-	s.outputs[1].Update(s.outputAndGates[0].Output())
-	s.outputs[2].Update(s.outputAndGates[1].Output())
-	s.outputs[3].Update(s.outputAndGates[2].Output())
-	s.outputs[4].Update(s.outputAndGates[3].Output())
-	s.outputs[5].Update(s.outputAndGates[4].Output())
-	s.outputs[6].Update(s.bits[11].Get())
+// Restore sets the memory bits and outputs from a State of a stepper of the same length
+func (s *Stepper) Restore(state []bool) {
+	for i := range s.bits {
+		s.bits[i].Update(state[i], true)
+		s.bits[i].Update(state[i], false)
+	}
+	for i := range s.outputs {
+		s.outputs[i].Update(state[len(s.bits)+i])
+	}
 }
@@ -13,9 +13,56 @@ func TestStepper(t *testing.T) {
 	testStepperStateAfter(4, 4, t)
 	testStepperStateAfter(5, 5, t)
 	testStepperStateAfter(6, 6, t)
+	testStepperStateAfter(7, 1, t)
 }
+
+func TestStepperOfLength(t *testing.T) {
+	for cycles := 1; cycles <= 9; cycles++ {
+		testLongStepperStateAfter(cycles, cycles, false, t)
+	}
+	testLongStepperStateAfter(10, 1, false, t)
+}
+
+func TestStepperResetAfter(t *testing.T) {
+	testLongStepperStateAfter(6, 6, true, t)
+	testLongStepperStateAfter(7, 1, true, t)
+	testLongStepperStateAfter(8, 2, true, t)
+}
+
+func TestStepperRestore(t *testing.T) {
+	for cycles := 1; cycles <= 9; cycles++ {
+		stepper := NewStepperOfLength(9)
+		for i := 0; i < cycles; i++ {
+			stepper.Update(true)
+			stepper.Update(false)
+		}
+
+		restored := NewStepperOfLength(9)
+		restored.Restore(stepper.State())
+		for i := 0; i < 9; i++ {
+			if getOutput(restored) != getOutput(stepper) {
+				t.Logf("expected step %d but got %d, %d cycles after restoring at %d", getOutput(stepper), getOutput(restored), i, cycles)
+				t.FailNow()
+			}
+			for _, s := range []*Stepper{stepper, restored} {
+				s.Update(true)
+				s.Update(false)
+			}
+		}
+	}
+}
+
 func testStepperStateAfter(cycles, expectedOutput int, t *testing.T) {
-	stepper := NewStepper()
+	testStepper(NewStepper(), cycles, expectedOutput, t)
+}
+
+func testLongStepperStateAfter(cycles, expectedOutput int, resetAfter6 bool, t *testing.T) {
+	stepper := NewStepperOfLength(9)
+	stepper.ResetAfter(6, resetAfter6)
+	testStepper(stepper, cycles, expectedOutput, t)
+}
+
+func testStepper(stepper *Stepper, cycles, expectedOutput int, t *testing.T) {
 	for i := 0; i < cycles; i++ {
 		stepper.Update(true)
 		stepper.Update(false)
@@ -30,7 +77,7 @@ func testStepperStateAfter(cycles, expectedOutput int, t *testing.T) {
 
 func getOutput(stepper *Stepper) int {
 	fmt.Println(stepper)
-	for i := 0; i < 7; i++ {
+	for i := 0; i <= stepper.Steps(); i++ {
 		if stepper.GetOutputWire(i) {
 			return i + 1
 		}
@@ -1,7 +1,6 @@
 package components
 
 import (
-	"github.com/djhworld/simple-computer/arch"
 	"github.com/djhworld/simple-computer/circuit"
 )
 
@@ -30,6 +29,11 @@ func (m *Bit) Get() bool {
 	return m.wireO.Get()
 }
 
+// OutputWire is the wire holding the stored value
+func (m *Bit) OutputWire() *circuit.Wire {
+	return &m.wireO
+}
+
 func (m *Bit) Update(wireI bool, wireS bool) {
 	for i := 0; i < 2; i++ {
 		m.gates[0].Update(wireI, wireS)
@@ -41,14 +45,17 @@ func (m *Bit) Update(wireI bool, wireS bool) {
 }
 
 type Word struct {
-	inputs  [arch.BUS_WIDTH]circuit.Wire
-	bits    [arch.BUS_WIDTH]Bit
-	outputs [arch.BUS_WIDTH]circuit.Wire
+	inputs  []circuit.Wire
+	bits    []Bit
+	outputs []circuit.Wire
 	next    Component
 }
 
-func NewWord() *Word {
+func NewWord(width int) *Word {
 	w := new(Word)
+	w.inputs = make([]circuit.Wire, width)
+	w.bits = make([]Bit, width)
+	w.outputs = make([]circuit.Wire, width)
 	for i, _ := range w.bits {
 		w.bits[i] = *NewBit()
 	}
@@ -67,6 +74,10 @@ func (e *Word) SetInputWire(index int, value bool) {
 	e.inputs[index].Update(value)
 }
 
+func (e *Word) outputWires() []*circuit.Wire {
+	return wires(e.outputs[:])
+}
+
 func (e *Word) Update(set bool) {
 	for i := 0; i < len(e.inputs); i++ {
 		e.bits[i].Update(e.inputs[i].Get(), set)
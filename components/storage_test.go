@@ -35,7 +35,7 @@ func TestWord(t *testing.T) {
 		d.SetInputWire(i, true)
 	}
 
-	w := NewWord()
+	w := NewWord(arch.BUS_WIDTH)
 	d.ConnectOutput(w)
 	d.Update()
 	w.Update(false)
@@ -54,7 +54,7 @@ func TestWordWithSetOn(t *testing.T) {
 		d.SetInputWire(i, true)
 	}
 
-	w := NewWord()
+	w := NewWord(arch.BUS_WIDTH)
 	d.ConnectOutput(w)
 	d.Update()
 	w.Update(true)
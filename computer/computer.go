@@ -1,28 +1,55 @@
 package computer
 
 import (
+	"context"
 	"fmt"
+	goio "io"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/djhworld/simple-computer/components"
 	"github.com/djhworld/simple-computer/cpu"
 	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/executable"
+	"github.com/djhworld/simple-computer/fault"
 	"github.com/djhworld/simple-computer/io"
 	"github.com/djhworld/simple-computer/memory"
+	"github.com/djhworld/simple-computer/trace"
+	"github.com/djhworld/simple-computer/vcd"
 )
 
 const CODE_REGION_START = uint16(0x0500)
 
+// CODE_REGION_END is the last address user code can be loaded at, Boot puts a jump back
+// to the entry point in the two words after it
+const CODE_REGION_END = uint16(0xFEFD)
+
+// the stack grows downwards, so the first value pushed lands at 0xFEFD just
+// below the jump back to the code region
+const STACK_START = uint16(0xFEFE)
+
+// the keyboard raises IRQ 0 when a key is pressed, so its handler address goes in the first vector table entry
+const KEYBOARD_IRQ = 0
+
 type PrintStateConfig struct {
 	PrintState      bool
 	PrintStateEvery int
 }
 
 type SimpleComputer struct {
-	memory  *memory.Memory64K
-	cpu     *cpu.CPU
+	cpu     cpu.Core
 	mainBus *components.Bus
+	fast    bool
+	entry   uint16
+	booted  bool
+
+	// held while the CPU steps, so a snapshot is never taken part way through a step
+	lock sync.Mutex
+
+	tracer   *trace.Tracer
+	waveform *vcd.Writer
+	faults   *fault.Injector
 
 	displayAdapter  *io.DisplayAdapter
 	screenControl   *io.ScreenControl
@@ -32,18 +59,39 @@ type SimpleComputer struct {
 	quitChannel   chan bool
 }
 
-func NewComputer(screenChannel chan *[160][240]byte, quitChannel chan bool) *SimpleComputer {
+// Option changes how NewComputer builds the computer
+type Option func(*SimpleComputer)
+
+// WithFastCore runs programs on the behavioural FastCPU rather than the gate level CPU.
+// Both take the same number of steps per instruction, the fast core just gets through
+// them quicker
+func WithFastCore() Option {
+	return func(c *SimpleComputer) {
+		c.fast = true
+	}
+}
+
+func NewComputer(screenChannel chan *[160][240]byte, quitChannel chan bool, options ...Option) *SimpleComputer {
 	c := new(SimpleComputer)
 
 	c.screenChannel = screenChannel
 	c.quitChannel = quitChannel
+	c.entry = CODE_REGION_START
+
+	for _, option := range options {
+		option(c)
+	}
 
 	c.mainBus = components.NewBus(arch.BUS_WIDTH)
-	c.memory = memory.NewMemory64K(c.mainBus)
-	c.cpu = cpu.NewCPU(c.mainBus, c.memory)
+	if c.fast {
+		c.cpu = cpu.NewFastCPU(c.mainBus)
+	} else {
+		c.cpu = cpu.NewCPU(c.mainBus, memory.NewMemory64K(c.mainBus))
+	}
 
 	c.keyboardAdapter = io.NewKeyboardAdapter()
 	c.cpu.ConnectPeripheral(c.keyboardAdapter)
+	c.cpu.ConnectIRQ(KEYBOARD_IRQ, c.keyboardAdapter)
 
 	c.displayAdapter = io.NewDisplaydAdapter()
 	c.screenControl = io.NewScreenControl(c.displayAdapter, c.screenChannel, c.quitChannel)
@@ -70,39 +118,91 @@ func (c *SimpleComputer) LoadToRAM(offset uint16, values []uint16) {
 	}
 }
 
+// Load puts each segment of the executable in RAM and starts the program at its entry point
+// when booted. Unlike LoadToRAM it returns an error if anything is outside the code region
+func (c *SimpleComputer) Load(e *executable.Executable) error {
+	if e.Entry < CODE_REGION_START || e.Entry > CODE_REGION_END {
+		return fmt.Errorf("entry point 0x%04X is outside the code region 0x%04X - 0x%04X", e.Entry, CODE_REGION_START, CODE_REGION_END)
+	}
+	for _, segment := range e.Segments {
+		end := int(segment.Address) + len(segment.Words) - 1
+		if len(segment.Words) > 0 && (segment.Address < CODE_REGION_START || end > int(CODE_REGION_END)) {
+			return fmt.Errorf("segment 0x%04X - 0x%04X is outside the code region 0x%04X - 0x%04X", segment.Address, end, CODE_REGION_START, CODE_REGION_END)
+		}
+	}
+
+	for _, segment := range e.Segments {
+		c.LoadToRAM(segment.Address, segment.Words)
+	}
+	c.entry = e.Entry
+	return nil
+}
+
 func (c *SimpleComputer) loadToRAM(addr uint16, value uint16) {
 	c.putValueInRAM(addr, value)
 }
 
 func (c *SimpleComputer) putValueInRAM(address, value uint16) {
-	c.memory.AddressRegister.Set()
-	c.mainBus.SetValue(address)
-	c.memory.Update()
+	c.cpu.WriteMemory(address, value)
+}
+
+// CPU gives access to the CPU core, e.g. for a debugger to inspect and modify it
+func (c *SimpleComputer) CPU() cpu.Core {
+	return c.cpu
+}
 
-	c.memory.AddressRegister.Unset()
-	c.memory.Update()
+// Boot gets the computer ready to run the user code from its entry point, CODE_REGION_START
+// unless Load was given another. Run does this itself but anything driving the CPU
+// directly should call it first
+func (c *SimpleComputer) Boot() {
+	c.putValueInRAM(0xFEFE, 0x0040) //JMP back to the entry point if IAR reaches the end
+	c.putValueInRAM(0xFEFF, c.entry)
 
-	c.mainBus.SetValue(value)
-	c.memory.Set()
-	c.memory.Update()
+	// start at the entry point of user code
+	c.cpu.SetIAR(c.entry)
+	c.cpu.SetSP(STACK_START)
 
-	c.memory.Unset()
-	c.memory.Update()
+	// the gate level registers hold 0xFFFF until something is set in them, clear them so
+	// both CPU cores start from the same state
+	for i := 0; i < 4; i++ {
+		c.cpu.SetRegister(i, 0x0000)
+	}
+	c.cpu.SetFlags(0x0000)
+	c.booted = true
 }
 
+// Run boots the computer, unless it has been booted or restored from a snapshot already,
+// and runs it until the CPU halts, the screen keeps running afterwards
 func (c *SimpleComputer) Run(tickInterval <-chan time.Time, printStateConfig PrintStateConfig) {
 	log.Println("Starting computer....")
-	c.putValueInRAM(0xFEFE, 0x0040) //JMP back to code region start if IAR reaches the end
-	c.putValueInRAM(0xFEFF, CODE_REGION_START)
-
-	// start at offet of user code
-	c.cpu.SetIAR(CODE_REGION_START)
+	if !c.booted {
+		c.Boot()
+	}
 	go c.screenControl.Run()
 
+	if err := c.RunContext(context.Background(), tickInterval, printStateConfig); err != nil {
+		log.Println("Computer stopped:", err)
+		return
+	}
+	log.Printf("Computer halted at 0x%04X", c.cpu.IAR())
+}
+
+// RunContext steps the CPU on every tick until it halts or ctx is done. Unlike Run it
+// does not boot the computer or start the screen
+func (c *SimpleComputer) RunContext(ctx context.Context, tickInterval <-chan time.Time, printStateConfig PrintStateConfig) error {
 	steps := 0
 	for {
-		<-tickInterval
-		c.cpu.Step()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tickInterval:
+		}
+		c.lock.Lock()
+		err := c.step()
+		c.lock.Unlock()
+		if err != nil {
+			return err
+		}
 
 		if printStateConfig.PrintState {
 			if steps%printStateConfig.PrintStateEvery == 0 {
@@ -114,5 +214,232 @@ func (c *SimpleComputer) Run(tickInterval <-chan time.Time, printStateConfig Pri
 			}
 		}
 		steps++
+
+		if c.cpu.Halted() {
+			return nil
+		}
+	}
+}
+
+// step runs a single step of the CPU, through the tracer if there is one
+func (c *SimpleComputer) step() error {
+	if c.tracer != nil {
+		return c.tracer.Step()
+	}
+	c.cpu.Step()
+	return nil
+}
+
+// Trace writes a record to sink for every instruction the computer runs from now on, or
+// stops tracing if sink is nil. The tracer uses the CPU's memory observer so the computer
+// should not be traced while a debugger is attached
+func (c *SimpleComputer) Trace(sink trace.Sink) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if sink == nil {
+		c.tracer = nil
+		c.cpu.ObserveMemory(nil)
+		return
+	}
+	c.tracer = trace.NewTracer(c.cpu, sink)
+}
+
+// FlushTrace writes out any records the trace sink is holding on to
+func (c *SimpleComputer) FlushTrace() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.tracer == nil {
+		return nil
+	}
+	return c.tracer.Flush()
+}
+
+// Waveform samples the CPU signals matching patterns (see vcd.Select) every clock phase
+// from now on and writes them to w as a VCD file. Only the gate level CPU has signals
+func (c *SimpleComputer) Waveform(w goio.Writer, patterns string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	gates, ok := c.cpu.(*cpu.CPU)
+	if !ok {
+		return fmt.Errorf("the fast core has no signals to sample, use the gate level CPU")
 	}
+	signals, err := vcd.Select(gates.Signals(), patterns)
+	if err != nil {
+		return err
+	}
+	c.waveform = vcd.NewWriter(w, signals)
+	c.observeSignals(gates)
+	return nil
+}
+
+// FlushWaveform writes out any samples the VCD writer is holding on to
+func (c *SimpleComputer) FlushWaveform() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.waveform == nil {
+		return nil
+	}
+	return c.waveform.Flush()
+}
+
+// InjectFaults puts faults into the CPU (see the fault package), their cycles are counted
+// from now. Any faults injected before are taken out first, so nil takes them all out. Only
+// the gate level CPU has wires to put faults on
+func (c *SimpleComputer) InjectFaults(faults []fault.Fault) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	gates, ok := c.cpu.(*cpu.CPU)
+	if !ok {
+		return fmt.Errorf("the fast core has no wires to put faults on, use the gate level CPU")
+	}
+	if c.faults != nil {
+		c.faults.Remove()
+		c.faults = nil
+	}
+	if len(faults) > 0 {
+		injector, err := fault.NewInjector(gates, faults)
+		if err != nil {
+			return err
+		}
+		c.faults = injector
+	}
+	c.observeSignals(gates)
+	return nil
+}
+
+// observeSignals has the CPU call the fault injector and the VCD writer every clock phase,
+// the faults go in first so the waveform shows them
+func (c *SimpleComputer) observeSignals(gates *cpu.CPU) {
+	faults, waveform := c.faults, c.waveform
+	switch {
+	case faults == nil && waveform == nil:
+		gates.ObserveSignals(nil)
+	case faults == nil:
+		gates.ObserveSignals(waveform.Sample)
+	case waveform == nil:
+		gates.ObserveSignals(faults.Phase)
+	default:
+		gates.ObserveSignals(func() {
+			faults.Phase()
+			waveform.Sample()
+		})
+	}
+}
+
+// STUCK_INSTRUCTION_STEPS is how many steps RunUntil waits for an instruction to finish
+// before giving up on the CPU. It is a watchdog rather than the stepper's length
+// (cpu.MAX_INSTRUCTION_STEPS), far more steps than any instruction takes, so a working CPU
+// never gets near it but one with a fault in its clock or stepper can go on forever
+const STUCK_INSTRUCTION_STEPS = 1000
+
+// ErrInstructionStuck is returned by RunUntil when an instruction does not finish within
+// STUCK_INSTRUCTION_STEPS
+var ErrInstructionStuck = fmt.Errorf("instruction did not finish within %d steps", STUCK_INSTRUCTION_STEPS)
+
+// StopCondition is checked after every instruction run by RunUntil, returning true stops it
+type StopCondition func(cpu.Core) bool
+
+// StopAtAddress stops once the next instruction to run is at the given address
+func StopAtAddress(address uint16) StopCondition {
+	return func(c cpu.Core) bool {
+		return c.IAR() == address
+	}
+}
+
+// StopWhenStuck stops when an instruction jumps to itself with interrupts disabled, as
+// nothing can get the CPU out of that loop
+func StopWhenStuck() StopCondition {
+	last := -1
+	return func(c cpu.Core) bool {
+		stuck := int(c.IAR()) == last && !c.InterruptsEnabled()
+		last = int(c.IAR())
+		return stuck
+	}
+}
+
+// RunUntil runs instructions as fast as it can, without a clock or the screen, until the
+// CPU halts, one of the stop conditions is met, maxInstructions have run (if above zero)
+// or ctx is done. It returns the number of instructions run and whether the CPU halted or
+// a stop condition was met, or ErrInstructionStuck if an instruction never finishes
+func (c *SimpleComputer) RunUntil(ctx context.Context, maxInstructions int, stop ...StopCondition) (int, bool, error) {
+	instructions := 0
+	for maxInstructions <= 0 || instructions < maxInstructions {
+		if c.cpu.Halted() {
+			return instructions, true, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return instructions, false, ctx.Err()
+		default:
+		}
+
+		c.lock.Lock()
+		err := c.step()
+		for steps := 1; err == nil && !c.cpu.InstructionDone() && !c.cpu.Halted(); steps++ {
+			if steps == STUCK_INSTRUCTION_STEPS {
+				err = ErrInstructionStuck
+				break
+			}
+			err = c.step()
+		}
+		c.lock.Unlock()
+		if err != nil {
+			return instructions, false, err
+		}
+		instructions++
+
+		for _, condition := range stop {
+			if condition(c.cpu) {
+				return instructions, true, nil
+			}
+		}
+	}
+	return instructions, false, nil
+}
+
+type RegisterState struct {
+	R0                uint16 `json:"r0"`
+	R1                uint16 `json:"r1"`
+	R2                uint16 `json:"r2"`
+	R3                uint16 `json:"r3"`
+	IAR               uint16 `json:"iar"`
+	IR                uint16 `json:"ir"`
+	SP                uint16 `json:"sp"`
+	Flags             uint16 `json:"flags"`
+	InterruptsEnabled bool   `json:"interrupts_enabled"`
+}
+
+func (c *SimpleComputer) Registers() RegisterState {
+	return RegisterState{
+		R0:                c.cpu.Register(0),
+		R1:                c.cpu.Register(1),
+		R2:                c.cpu.Register(2),
+		R3:                c.cpu.Register(3),
+		IAR:               c.cpu.IAR(),
+		IR:                c.cpu.IR(),
+		SP:                c.cpu.SP(),
+		Flags:             c.cpu.Flags(),
+		InterruptsEnabled: c.cpu.InterruptsEnabled(),
+	}
+}
+
+// ReadRAM returns length words of RAM starting at offset
+func (c *SimpleComputer) ReadRAM(offset uint16, length int) []uint16 {
+	values := make([]uint16, length)
+	for i := range values {
+		values[i] = c.cpu.ReadMemory(offset + uint16(i))
+	}
+	return values
+}
+
+// Framebuffer renders the display RAM, one byte per pixel that is either 0x00 or 0x01
+func (c *SimpleComputer) Framebuffer() [160][240]byte {
+	c.screenControl.Update()
+	return c.screenControl.Output()
 }
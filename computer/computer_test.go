@@ -0,0 +1,445 @@
+package computer
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/djhworld/simple-computer/asm"
+	"github.com/djhworld/simple-computer/executable"
+	"github.com/djhworld/simple-computer/fault"
+	"github.com/djhworld/simple-computer/trace"
+)
+
+func setUpComputer(program string, t *testing.T, options ...Option) *SimpleComputer {
+	instructions, err := (&asm.Parser{}).Parse(strings.NewReader(program))
+	if err != nil {
+		t.Logf("could not parse program: %v", err)
+		t.FailNow()
+	}
+
+	a := asm.Assembler{}
+	bin, err := a.Process(CODE_REGION_START, instructions)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	c := NewComputer(make(chan *[160][240]byte), make(chan bool, 10), options...)
+	c.LoadToRAM(CODE_REGION_START, bin)
+	c.Boot()
+	return c
+}
+
+func TestRunUntilStuck(t *testing.T) {
+	for _, options := range [][]Option{nil, {WithFastCore()}} {
+		c := setUpComputer(`
+			DATA R0, 0x0A00
+			DATA R1, 0x002A
+			ST R0, R1
+		halt:
+			JMP halt
+		`, t, options...)
+
+		instructions, stopped, err := c.RunUntil(context.Background(), 100, StopWhenStuck())
+		if err != nil || !stopped {
+			t.Logf("expected program to get stuck but got %v, %v", stopped, err)
+			t.FailNow()
+		}
+
+		// stuck as soon as the JMP runs, IAR was already pointing at it
+		if instructions != 4 {
+			t.Logf("expected 4 instructions to run but got %d", instructions)
+			t.FailNow()
+		}
+
+		registers := c.Registers()
+		if registers.R1 != 0x002A || registers.IAR != 0x0505 || registers.R2 != 0x0000 {
+			t.Logf("unexpected registers %+v", registers)
+			t.FailNow()
+		}
+
+		if memory := c.ReadRAM(0x0A00, 2); memory[0] != 0x002A || memory[1] != 0x0000 {
+			t.Logf("unexpected memory %X", memory)
+			t.FailNow()
+		}
+	}
+}
+
+func TestRunUntilHalted(t *testing.T) {
+	for _, options := range [][]Option{nil, {WithFastCore()}} {
+		c := setUpComputer(`
+			DATA R0, 0x002A
+			HALT
+			DATA R0, 0x0001
+		`, t, options...)
+
+		instructions, stopped, err := c.RunUntil(context.Background(), 100)
+		if err != nil || !stopped || !c.CPU().Halted() {
+			t.Logf("expected program to halt but got %v, %v", stopped, err)
+			t.FailNow()
+		}
+		if instructions != 2 {
+			t.Logf("expected 2 instructions to run but got %d", instructions)
+			t.FailNow()
+		}
+		if registers := c.Registers(); registers.R0 != 0x002A || registers.IAR != 0x0503 {
+			t.Logf("unexpected registers %+v", registers)
+			t.FailNow()
+		}
+	}
+}
+
+func TestRunContextReturnsWhenHalted(t *testing.T) {
+	c := setUpComputer(`
+		DATA R0, 0x002A
+		HALT
+	`, t, WithFastCore())
+
+	ticker := time.NewTicker(time.Microsecond)
+	defer ticker.Stop()
+
+	if err := c.RunContext(context.Background(), ticker.C, PrintStateConfig{}); err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	if !c.CPU().Halted() || c.CPU().Register(0) != 0x002A {
+		t.Logf("expected CPU to halt with R0 = 2A but got %X", c.CPU().Register(0))
+		t.FailNow()
+	}
+}
+
+func TestRunUntilLimitAndAddress(t *testing.T) {
+	program := `
+loop:
+		DATA R0, 0x0001
+		ADD R0, R1
+		JMP loop
+	`
+	c := setUpComputer(program, t, WithFastCore())
+	instructions, stopped, _ := c.RunUntil(context.Background(), 10, StopWhenStuck())
+	if stopped || instructions != 10 {
+		t.Logf("expected to run 10 instructions without stopping but ran %d, %v", instructions, stopped)
+		t.FailNow()
+	}
+
+	c = setUpComputer(program, t, WithFastCore())
+	instructions, stopped, _ = c.RunUntil(context.Background(), 0, StopAtAddress(0x0503))
+	if !stopped || instructions != 2 {
+		t.Logf("expected to stop at the JMP after 2 instructions but ran %d, %v", instructions, stopped)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := c.RunUntil(ctx, 0); err != context.Canceled {
+		t.Logf("expected a cancelled context to stop the computer but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestFramebuffer(t *testing.T) {
+	// writes 0xFF00 to the first word of display RAM, lighting up the first 8 pixels
+	c := setUpComputer(`
+		DATA R0, 0x0007
+		OUT Addr, R0
+		DATA R0, 0x0000
+		OUT Data, R0
+		DATA R0, 0x00FF
+		OUT Data, R0
+	halt:
+		JMP halt
+	`, t, WithFastCore())
+
+	c.RunUntil(context.Background(), 100, StopWhenStuck())
+	screen := c.Framebuffer()
+
+	for x := 0; x < 16; x++ {
+		expected := byte(0)
+		if x < 8 {
+			expected = 1
+		}
+		if screen[0][x] != expected {
+			t.Logf("expected pixel %d to be %d but got %d", x, expected, screen[0][x])
+			t.FailNow()
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	instructions, err := (&asm.Parser{}).Parse(strings.NewReader(`
+		.org 0x0600
+	start:
+		DATA R1, 0x002A
+		HALT
+	`))
+	if err != nil {
+		t.Logf("could not parse program: %v", err)
+		t.FailNow()
+	}
+	a := asm.Assembler{}
+	bin, err := a.Process(0x0600, instructions)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	// the code is in its own segment and the data is not run
+	c := NewComputer(make(chan *[160][240]byte), make(chan bool, 10), WithFastCore())
+	err = c.Load(&executable.Executable{
+		Entry:    a.Labels()["start"],
+		Segments: []executable.Segment{{Address: 0x0600, Words: bin}, {Address: 0x0700, Words: []uint16{0x0001}}},
+	})
+	if err != nil {
+		t.Logf("unexpected error loading executable: %v", err)
+		t.FailNow()
+	}
+	c.Boot()
+
+	if _, stopped, _ := c.RunUntil(context.Background(), 100); !stopped || c.Registers().R1 != 0x002A {
+		t.Logf("expected to start at 0x0600 and halt but got %+v", c.Registers())
+		t.FailNow()
+	}
+	if memory := c.ReadRAM(0x0700, 1); memory[0] != 0x0001 {
+		t.Logf("expected the second segment at 0x0700 but got %X", memory)
+		t.FailNow()
+	}
+
+	for _, tc := range []struct {
+		executable *executable.Executable
+		expected   string
+	}{
+		{&executable.Executable{Entry: 0x0100}, "entry point 0x0100 is outside the code region 0x0500 - 0xFEFD"},
+		{&executable.Executable{Entry: 0x0500, Segments: []executable.Segment{{Address: 0x04FF, Words: []uint16{1, 2}}}}, "segment 0x04FF - 0x0500 is outside the code region 0x0500 - 0xFEFD"},
+		{&executable.Executable{Entry: 0x0500, Segments: []executable.Segment{{Address: 0xFEFD, Words: []uint16{1, 2}}}}, "segment 0xFEFD - 0xFEFE is outside the code region 0x0500 - 0xFEFD"},
+	} {
+		c := NewComputer(make(chan *[160][240]byte), make(chan bool, 10), WithFastCore())
+		if err := c.Load(tc.executable); err == nil || err.Error() != tc.expected {
+			t.Logf("expected error '%s' but got %v", tc.expected, err)
+			t.FailNow()
+		}
+	}
+}
+
+// KEYBOARD_PROGRAM draws to the screen until a key is pressed, the interrupt handler saves
+// the key at 0x0A00
+const KEYBOARD_PROGRAM = `
+	DATA R0, handler
+	DATA R1, 0x04FC
+	ST R1, R0
+	EI
+	DATA R2, 0x0000
+loop:
+	DATA R0, 0x0007
+	OUT Addr, R0
+	OUT Data, R2
+	OUT Data, R2
+	DATA R3, 0x0001
+	ADD R3, R2
+	JMP loop
+handler:
+	PUSH R0
+	PUSH R1
+	DATA R0, 0x000F
+	OUT Addr, R0
+	IN Data, R0
+	DATA R1, 0x0A00
+	ST R1, R0
+	POP R1
+	POP R0
+	IRET
+`
+
+func TestSnapshot(t *testing.T) {
+
+	for _, options := range [][]Option{nil, {WithFastCore()}} {
+		c := setUpComputer(KEYBOARD_PROGRAM, t, options...)
+		c.RunUntil(context.Background(), 40)
+
+		// part way through an instruction with a key waiting
+		c.keyboardAdapter.KeyboardInBus.SetValue(0x0041)
+		for i := 0; i < 3; i++ {
+			c.CPU().Step()
+		}
+
+		snapshot := &bytes.Buffer{}
+		if err := c.Snapshot(snapshot); err != nil {
+			t.Logf("unexpected error taking a snapshot: %v", err)
+			t.FailNow()
+		}
+		restored := NewComputer(make(chan *[160][240]byte), make(chan bool, 10), options...)
+		if err := restored.Restore(bytes.NewReader(snapshot.Bytes())); err != nil {
+			t.Logf("unexpected error restoring a snapshot: %v", err)
+			t.FailNow()
+		}
+		if !restored.booted {
+			t.Logf("expected a restored computer to count as booted")
+			t.FailNow()
+		}
+
+		for _, computer := range []*SimpleComputer{c, restored} {
+			computer.RunUntil(context.Background(), 100)
+		}
+		if expected, got := c.Registers(), restored.Registers(); expected != got {
+			t.Logf("expected registers %+v but got %+v", expected, got)
+			t.FailNow()
+		}
+		if key := restored.ReadRAM(0x0A00, 1); key[0] != 0x0041 {
+			t.Logf("expected the key to be handled after restoring but got %X", key)
+			t.FailNow()
+		}
+		if !reflect.DeepEqual(c.ReadRAM(0x0000, 0x10000), restored.ReadRAM(0x0000, 0x10000)) {
+			t.Logf("memory is different after restoring")
+			t.FailNow()
+		}
+		if c.Framebuffer() != restored.Framebuffer() || c.Framebuffer() == [160][240]byte{} {
+			t.Logf("expected the same picture on the screen after restoring")
+			t.FailNow()
+		}
+	}
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	c := NewComputer(make(chan *[160][240]byte), make(chan bool, 10), WithFastCore())
+	snapshot := &bytes.Buffer{}
+	c.Snapshot(snapshot)
+	valid := snapshot.Bytes()
+
+	newVersion := append([]byte{}, valid...)
+	newVersion[4] = 2
+
+	gate := NewComputer(make(chan *[160][240]byte), make(chan bool, 10))
+	for _, tc := range []struct {
+		computer *SimpleComputer
+		snapshot []byte
+		expected string
+	}{
+		{c, []byte("SCEX"), "not a snapshot"},
+		{c, newVersion, "unsupported snapshot version 2"},
+		{c, valid[:len(valid)-1], "snapshot is not valid: unexpected EOF"},
+		{gate, valid, "snapshot was taken on the fast core but the computer is running the gate level core"},
+	} {
+		if err := tc.computer.Restore(bytes.NewReader(tc.snapshot)); err == nil || err.Error() != tc.expected {
+			t.Logf("expected error '%s' but got %v", tc.expected, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var traces []string
+	for _, options := range [][]Option{nil, {WithFastCore()}} {
+		c := setUpComputer(KEYBOARD_PROGRAM, t, options...)
+		out := &bytes.Buffer{}
+		c.Trace(trace.NewJSONSink(out))
+
+		c.RunUntil(context.Background(), 40)
+		c.keyboardAdapter.KeyboardInBus.SetValue(0x0041)
+		if _, _, err := c.RunUntil(context.Background(), 20); err != nil {
+			t.Logf("unexpected error %v", err)
+			t.FailNow()
+		}
+		if err := c.FlushTrace(); err != nil {
+			t.Logf("unexpected error flushing the trace %v", err)
+			t.FailNow()
+		}
+
+		// nothing more is traced once it is stopped
+		c.Trace(nil)
+		c.RunUntil(context.Background(), 10)
+		traces = append(traces, out.String())
+	}
+
+	if traces[0] != traces[1] {
+		t.Logf("expected the same trace from both cores but got\n%s\nand\n%s", traces[0], traces[1])
+		t.FailNow()
+	}
+	lines := strings.Split(strings.TrimSpace(traces[0]), "\n")
+	if len(lines) != 60 {
+		t.Logf("expected 60 records but got %d", len(lines))
+		t.FailNow()
+	}
+	for _, expected := range []string{
+		`"disassembly":"interrupt","class":"interrupt","registers":[{"register":"SP","old":65278,"new":65276}]`,
+		`"disassembly":"IN Data, R0","class":"io","registers":[{"register":"R0","old":15,"new":65}],"flags":0,"io":[{"value":65}]}`,
+	} {
+		if !strings.Contains(traces[0], expected) {
+			t.Logf("expected the trace to contain %s", expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWaveform(t *testing.T) {
+	if err := setUpComputer(KEYBOARD_PROGRAM, t, WithFastCore()).Waveform(&bytes.Buffer{}, "*"); err == nil {
+		t.Logf("expected an error sampling the signals of the fast core")
+		t.FailNow()
+	}
+
+	c := setUpComputer(KEYBOARD_PROGRAM, t)
+	if err := c.Waveform(&bytes.Buffer{}, "nothing"); err == nil {
+		t.Logf("expected an error when no signal matches")
+		t.FailNow()
+	}
+
+	out := &bytes.Buffer{}
+	if err := c.Waveform(out, "cpu.clock,cpu.stepper.out[0]"); err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	c.RunUntil(context.Background(), 2)
+	if err := c.FlushWaveform(); err != nil {
+		t.Logf("unexpected error flushing the waveform %v", err)
+		t.FailNow()
+	}
+
+	// the clock changes twice a step and step1 comes on at the start of each instruction
+	if strings.Count(out.String(), "1!\n") != 12 || strings.Count(out.String(), "1\"\n") != 2 {
+		t.Logf("expected the clock to tick 12 times and step1 to come on twice but got\n%s", out.String())
+		t.FailNow()
+	}
+}
+
+func TestInjectFaults(t *testing.T) {
+	program := `
+		DATA R0, 0x0001
+		DATA R1, 0x0002
+		ADD R0, R1
+		HALT
+	`
+	faults := []fault.Fault{{Target: "cpu.r1.word[15]", Kind: fault.STUCK_AT_1}}
+	if err := setUpComputer(program, t, WithFastCore()).InjectFaults(faults); err == nil {
+		t.Logf("expected an error putting faults into the fast core")
+		t.FailNow()
+	}
+
+	c := setUpComputer(program, t)
+	if err := c.InjectFaults([]fault.Fault{{Target: "cpu.nothing", Kind: fault.FLIP}}); err == nil {
+		t.Logf("expected an error for a signal that does not exist")
+		t.FailNow()
+	}
+	if err := c.InjectFaults(faults); err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	c.RunUntil(context.Background(), 10)
+
+	// R1 reads 3 rather than 2, and the sum 4 is stored as 5
+	if registers := c.Registers(); registers.R0 != 0x0001 || registers.R1 != 0x0005 {
+		t.Logf("expected the lowest bit of R1 to be stuck at 1 but got %+v", registers)
+		t.FailNow()
+	}
+
+	if err := c.InjectFaults(nil); err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	c.CPU().SetRegister(1, 0x0002)
+	if c.Registers().R1 != 0x0002 {
+		t.Logf("expected the fault to be taken out")
+		t.FailNow()
+	}
+}
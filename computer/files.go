@@ -0,0 +1,54 @@
+package computer
+
+import (
+	goio "io"
+	"os"
+
+	"github.com/djhworld/simple-computer/fault"
+	"github.com/djhworld/simple-computer/trace"
+)
+
+// TraceFile creates the file at path and starts tracing the computer to it in format (see
+// trace.NewSink), keeping only the instructions at addresses and in classes (see
+// trace.ParseFilter). The file should be closed once the trace has been flushed
+func (c *SimpleComputer) TraceFile(path, format, addresses, classes string) (goio.Closer, error) {
+	filter, err := trace.ParseFilter(addresses, classes)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := trace.NewSink(format, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.Trace(trace.Filtered(sink, filter))
+	return f, nil
+}
+
+// InjectFaultFile reads the fault spec file at path (see fault.ReadSpecFile) and puts its
+// faults into the CPU
+func (c *SimpleComputer) InjectFaultFile(path string) error {
+	faults, err := fault.ReadSpecFile(path)
+	if err != nil {
+		return err
+	}
+	return c.InjectFaults(faults)
+}
+
+// WaveformFile creates the file at path and starts sampling the CPU signals matching
+// patterns to it. The file should be closed once the waveform has been flushed
+func (c *SimpleComputer) WaveformFile(path, patterns string) (goio.Closer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Waveform(f, patterns); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
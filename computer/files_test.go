@@ -0,0 +1,79 @@
+package computer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	program := `
+		DATA R0, 0x0001
+		DATA R1, 0x0002
+		ADD R0, R1
+		HALT
+	`
+	dir := t.TempDir()
+	c := setUpComputer(program, t)
+
+	if _, err := c.TraceFile(filepath.Join(dir, "bad.trace"), "xml", "", ""); err == nil {
+		t.Logf("expected an error for a trace format that does not exist")
+		t.FailNow()
+	}
+	traceFile, err := c.TraceFile(filepath.Join(dir, "out.trace"), "json", "", "alu")
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+
+	if err := c.InjectFaultFile(filepath.Join(dir, "missing.faults")); err == nil {
+		t.Logf("expected an error for a fault file that does not exist")
+		t.FailNow()
+	}
+	faults := filepath.Join(dir, "r1.faults")
+	os.WriteFile(faults, []byte("cpu.r1.word[15] stuck-at-1\n"), 0644)
+	if err := c.InjectFaultFile(faults); err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+
+	waveformFile, err := c.WaveformFile(filepath.Join(dir, "out.vcd"), "cpu.clock")
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+
+	c.RunUntil(context.Background(), 10)
+	if err := c.FlushTrace(); err != nil {
+		t.Logf("unexpected error flushing the trace %v", err)
+		t.FailNow()
+	}
+	if err := c.FlushWaveform(); err != nil {
+		t.Logf("unexpected error flushing the waveform %v", err)
+		t.FailNow()
+	}
+	traceFile.Close()
+	waveformFile.Close()
+
+	// only the ADD is traced, and R1 is read as 3 because of the fault
+	out, _ := os.ReadFile(filepath.Join(dir, "out.trace"))
+	if lines := strings.Split(strings.TrimSpace(string(out)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"disassembly":"ADD R0, R1"`) {
+		t.Logf("expected the ADD to be traced but got\n%s", out)
+		t.FailNow()
+	}
+	if c.Registers().R1 != 0x0005 {
+		t.Logf("expected the lowest bit of R1 to be stuck at 1 but got %+v", c.Registers())
+		t.FailNow()
+	}
+	if out, _ := os.ReadFile(filepath.Join(dir, "out.vcd")); !strings.Contains(string(out), "$var wire 1 ! clock $end") {
+		t.Logf("expected the clock in the VCD file but got\n%s", out)
+		t.FailNow()
+	}
+
+	if _, err := setUpComputer(program, t, WithFastCore()).WaveformFile(filepath.Join(dir, "fast.vcd"), "*"); err == nil {
+		t.Logf("expected an error sampling the signals of the fast core")
+		t.FailNow()
+	}
+}
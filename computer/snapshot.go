@@ -0,0 +1,152 @@
+package computer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	goio "io"
+	"os"
+
+	"github.com/djhworld/simple-computer/arch"
+)
+
+// a snapshot is little-endian binary
+// ----------------------
+// "SCSS"                                      magic
+// uint16                                      version
+// uint8                                       core, SNAPSHOT_GATE_CORE or SNAPSHOT_FAST_CORE
+// uint16                                      entry point
+// uint16                                      main bus
+// ...                                         the CPU, see cpu.Core's Snapshot
+// ...                                         the display adapter and display RAM
+// ...                                         the keyboard adapter
+//
+// the CPU is saved as it is, so a snapshot of one core cannot be restored on the other
+
+const SNAPSHOT_MAGIC = "SCSS"
+const SNAPSHOT_VERSION = uint16(1)
+
+// the core a snapshot was taken on
+const (
+	SNAPSHOT_GATE_CORE = uint8(iota)
+	SNAPSHOT_FAST_CORE
+)
+
+var snapshotCoreNames = map[uint8]string{
+	SNAPSHOT_GATE_CORE: "gate level",
+	SNAPSHOT_FAST_CORE: "fast",
+}
+
+func (c *SimpleComputer) snapshotCore() uint8 {
+	if c.fast {
+		return SNAPSHOT_FAST_CORE
+	}
+	return SNAPSHOT_GATE_CORE
+}
+
+// Snapshot writes the complete state of the computer. It can be called while Run is
+// going, the snapshot is taken between two steps
+func (c *SimpleComputer) Snapshot(w goio.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := bufio.NewWriter(w)
+	out.WriteString(SNAPSHOT_MAGIC)
+	for _, v := range []interface{}{SNAPSHOT_VERSION, c.snapshotCore(), c.entry, uint16(c.mainBus.Value())} {
+		binary.Write(out, binary.LittleEndian, v)
+	}
+
+	if err := c.cpu.Snapshot(out); err != nil {
+		return err
+	}
+	if err := c.displayAdapter.Snapshot(out); err != nil {
+		return err
+	}
+	if err := c.keyboardAdapter.Snapshot(out); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// Restore reads a snapshot written by Snapshot on a computer with the same core, the
+// computer then carries on from where the snapshot was taken. Run does not boot a
+// restored computer. If there is an error the computer may be part restored and should
+// not be run
+func (c *SimpleComputer) Restore(r goio.Reader) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	in := bufio.NewReader(r)
+	magic := make([]byte, len(SNAPSHOT_MAGIC))
+	if _, err := goio.ReadFull(in, magic); err != nil || !bytes.Equal(magic, []byte(SNAPSHOT_MAGIC)) {
+		return fmt.Errorf("not a snapshot")
+	}
+
+	var version, entry, bus uint16
+	var core uint8
+	err := binary.Read(in, binary.LittleEndian, &version)
+	if err == nil && version != SNAPSHOT_VERSION {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	if err == nil {
+		err = binary.Read(in, binary.LittleEndian, &core)
+	}
+	if err == nil && core != c.snapshotCore() {
+		return fmt.Errorf("snapshot was taken on the %s core but the computer is running the %s core", snapshotCoreNames[core], snapshotCoreNames[c.snapshotCore()])
+	}
+	for _, v := range []interface{}{&entry, &bus} {
+		if err == nil {
+			err = binary.Read(in, binary.LittleEndian, v)
+		}
+	}
+
+	// the keyboard adapter works out its gates from the buses, so it goes last
+	if err == nil {
+		c.mainBus.SetValue(arch.Word(bus))
+		err = c.cpu.Restore(in)
+	}
+	if err == nil {
+		err = c.displayAdapter.Restore(in)
+	}
+	if err == nil {
+		err = c.keyboardAdapter.Restore(in)
+	}
+
+	if err == goio.EOF {
+		// the file ended part way through
+		err = goio.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot is not valid: %v", err)
+	}
+
+	c.entry = entry
+	c.booted = true
+	return nil
+}
+
+// SnapshotFile writes a snapshot to a file, replacing anything already there
+func (c *SimpleComputer) SnapshotFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RestoreFile restores a snapshot from a file
+func (c *SimpleComputer) RestoreFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.Restore(f)
+}
@@ -0,0 +1,137 @@
+package cpu
+
+import (
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/components"
+)
+
+// ARITHMETIC
+// subtraction and multi-word arithmetic, all three put the result in register B like ADD.
+// They use the adder with B inverted for a subtraction (see the alu package), the carry
+// flag going in for ADC and SBB and a carry in of 1 for SUB
+// ----------------------
+// 0x0300 = SUB R0, R0 (register B = register B - register A)
+// ...
+// 0x030F = SUB R3, R3
+
+// 0x0310 = ADC R0, R0 (register B = register B + register A + carry)
+// ...
+// 0x031F = ADC R3, R3
+
+// 0x0320 = SBB R0, R0 (register B = register B - register A - borrow)
+// ...
+// 0x032F = SBB R3, R3
+
+// unlike ADD the flags are worked out with the carry in, so the carry flag is the carry
+// out of the whole sum. After SUB and SBB it is set when there was no borrow (register
+// B >= register A), so the carry flag is the carry in of the next word up for both ADC and
+// SBB and a chain of them should start with ADD (after a CLF) or SUB. Register B is on the
+// ALU's A input, so the A flag is set when register B is larger than register A
+
+// arithmeticControl is the part of the control unit that wires up the arithmetic
+// instructions, each of its outputs is ORed into the matching control line
+type arithmeticControl struct {
+	subGate circuit.ANDGate
+	adcGate circuit.ANDGate
+	sbbGate circuit.ANDGate
+
+	instructionORGate components.ORGate3
+	invertBORGate     circuit.ORGate
+	carryFlagORGate   circuit.ORGate
+
+	step4Gate circuit.ANDGate
+	step5Gate circuit.ANDGate
+	step6Gate circuit.ANDGate
+
+	invertBGate   circuit.ANDGate
+	subCarryGate  circuit.ANDGate
+	flagCarryGate components.ANDGate3
+	carryInORGate circuit.ORGate
+}
+
+func newArithmeticControl() *arithmeticControl {
+	a := new(arithmeticControl)
+
+	a.subGate = *circuit.NewANDGate()
+	a.adcGate = *circuit.NewANDGate()
+	a.sbbGate = *circuit.NewANDGate()
+
+	a.instructionORGate = *components.NewORGate3()
+	a.invertBORGate = *circuit.NewORGate()
+	a.carryFlagORGate = *circuit.NewORGate()
+
+	a.step4Gate = *circuit.NewANDGate()
+	a.step5Gate = *circuit.NewANDGate()
+	a.step6Gate = *circuit.NewANDGate()
+
+	a.invertBGate = *circuit.NewANDGate()
+	a.subCarryGate = *circuit.NewANDGate()
+	a.flagCarryGate = *components.NewANDGate3()
+	a.carryInORGate = *circuit.NewORGate()
+
+	return a
+}
+
+// runArithmeticGates works out which arithmetic instruction (if any) is in the IR and
+// drives the control lines for the current step. The carry in is worked out here rather
+// than with the sets, so it has reached the ALU before FLAGS is set on step 5
+func (c *CPU) runArithmeticGates() {
+	a := &c.arithmetic
+	group := c.opcodeGroupGates[OPCODE_GROUP_ARITHMETIC].Output()
+
+	a.subGate.Update(group, c.instrDecoder3x8.selectorGates[0].Output())
+	a.adcGate.Update(group, c.instrDecoder3x8.selectorGates[1].Output())
+	a.sbbGate.Update(group, c.instrDecoder3x8.selectorGates[2].Output())
+
+	a.instructionORGate.Update(a.subGate.Output(), a.adcGate.Output(), a.sbbGate.Output())
+	a.invertBORGate.Update(a.subGate.Output(), a.sbbGate.Output())
+	a.carryFlagORGate.Update(a.adcGate.Output(), a.sbbGate.Output())
+
+	// step 4: register A -> TMP, the carry flag is kept in carry temp as for ADD
+	// step 5: register B -> ALU (ADD, with TMP inverted for SUB and SBB) -> ACC, and FLAGS
+	// step 6: ACC -> register B
+	a.step4Gate.Update(c.stepper.GetOutputWire(3), a.instructionORGate.Output())
+	a.step5Gate.Update(c.stepper.GetOutputWire(4), a.instructionORGate.Output())
+	a.step6Gate.Update(c.stepper.GetOutputWire(5), a.instructionORGate.Output())
+
+	a.invertBGate.Update(a.step5Gate.Output(), a.invertBORGate.Output())
+	a.subCarryGate.Update(a.step5Gate.Output(), a.subGate.Output())
+	a.flagCarryGate.Update(a.step5Gate.Output(), a.carryFlagORGate.Output(), c.carryTemp.Get())
+	a.carryInORGate.Update(a.subCarryGate.Output(), a.flagCarryGate.Output())
+}
+
+func (a *arithmeticControl) registerAEnable() bool {
+	return a.step4Gate.Output()
+}
+
+func (a *arithmeticControl) tmpSet() bool {
+	return a.step4Gate.Output()
+}
+
+func (a *arithmeticControl) registerBEnable() bool {
+	return a.step5Gate.Output()
+}
+
+func (a *arithmeticControl) accSet() bool {
+	return a.step5Gate.Output()
+}
+
+func (a *arithmeticControl) flagsSet() bool {
+	return a.step5Gate.Output()
+}
+
+func (a *arithmeticControl) invertB() bool {
+	return a.invertBGate.Output()
+}
+
+func (a *arithmeticControl) carryIn() bool {
+	return a.carryInORGate.Output()
+}
+
+func (a *arithmeticControl) accEnable() bool {
+	return a.step6Gate.Output()
+}
+
+func (a *arithmeticControl) registerBSet() bool {
+	return a.step6Gate.Output()
+}
@@ -0,0 +1,41 @@
+package cpu
+
+import (
+	goio "io"
+
+	"github.com/djhworld/simple-computer/io"
+)
+
+// Core is implemented by both the gate level CPU and the behavioural FastCPU.
+// Step advances the stepper by one step on either, so after the same number of
+// steps both cores will have run the same instructions
+type Core interface {
+	ConnectPeripheral(io.Peripheral)
+	ConnectIRQ(line int, source io.InterruptSource)
+	SetIAR(address uint16)
+	SetSP(address uint16)
+	ReadMemory(address uint16) uint16
+	WriteMemory(address uint16, value uint16)
+	InterruptsEnabled() bool
+	Halted() bool
+	Step()
+	String() string
+
+	// for debuggers, these read and write the registers directly
+	Register(index int) uint16
+	SetRegister(index int, value uint16)
+	IAR() uint16
+	IR() uint16
+	SetIR(value uint16)
+	SP() uint16
+	Flags() uint16
+	SetFlags(value uint16)
+	Phase() int
+	InstructionDone() bool
+	InterruptCycle() bool
+	ObserveMemory(observer MemoryObserver)
+
+	// Snapshot and Restore save and load the complete state of the core between steps
+	Snapshot(w goio.Writer) error
+	Restore(r goio.Reader) error
+}
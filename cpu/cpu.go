@@ -67,6 +67,11 @@ import (
 // 0x0022 = DATA R2
 // 0x0023 = DATA R3
 
+// HALT
+// stop the CPU (see halt.go)
+// ----------------------
+// 0x0024 = HALT
+
 // JR
 // set instruction address register to value in register
 // ----------------------
@@ -257,6 +262,29 @@ import (
 // 0x00FE = CMP R3, R2
 // 0x00FF = CMP R3, R3
 
+// EXTENDED INSTRUCTIONS
+// ----------------------
+// the instructions above only use the lower byte, bits 5-7 of the upper
+// byte select an opcode group (bits 0-4 must be zero) with group 0 being the
+// instructions above
+// 0x01XX = stack instructions (see stack.go)
+// 0x02XX = interrupt instructions (see interrupts.go)
+// 0x03XX = arithmetic instructions (see arithmetic.go)
+// 0x04XX = move and immediate instructions (see immediate.go)
+// 0x05XX = indexed memory instructions (see indexed.go)
+
+const (
+	OPCODE_GROUP_LEGACY     = 0
+	OPCODE_GROUP_STACK      = 1
+	OPCODE_GROUP_INTERRUPT  = 2
+	OPCODE_GROUP_ARITHMETIC = 3
+	OPCODE_GROUP_IMMEDIATE  = 4
+	OPCODE_GROUP_INDEXED    = 5
+)
+
+// MAX_INSTRUCTION_STEPS is the length of the stepper, most instructions reset it after step 6
+const MAX_INSTRUCTION_STEPS = 9
+
 const (
 	FLAGS_BUS_CARRY    = 0
 	FLAGS_BUS_A_LARGER = 1
@@ -296,6 +324,9 @@ func NewInstructionDecoder3x8() *InstructionDecoder3x8 {
 }
 
 type CPU struct {
+	// the number of bits in the buses and registers, see arch.BUS_WIDTHS
+	width int
+
 	gpReg0 components.Register
 	gpReg1 components.Register
 	gpReg2 components.Register
@@ -304,13 +335,17 @@ type CPU struct {
 	acc    components.Register
 	ir     components.Register
 	iar    components.Register
+	sp     components.Register
 	flags  components.Register
 
-	clockState bool
-	memory     *memory.Memory64K
-	alu        *alu.ALU
-	stepper    *components.Stepper
-	busOne     components.BusOne
+	clock          circuit.Wire
+	memory         *memory.Memory64K
+	memoryObserver MemoryObserver
+	signalObserver SignalObserver
+	signals        *circuit.Registry
+	alu            *alu.ALU
+	stepper        *components.Stepper
+	busOne         components.BusOne
 
 	mainBus       *components.Bus
 	tmpBus        *components.Bus
@@ -318,6 +353,7 @@ type CPU struct {
 	controlBus    *components.Bus
 	accBus        *components.Bus
 	aluToFlagsBus *components.Bus
+	flagsInBus    *components.Bus
 	flagsBus      *components.Bus
 	ioBus         *components.IOBus
 
@@ -332,11 +368,24 @@ type CPU struct {
 
 	instrDecoder3x8              InstructionDecoder3x8
 	instructionDecoderEnables2x4 [2]components.Decoder2x4
-	instructionDecoderSet2x4     components.Decoder2x4
+	instructionDecoderSet2x4     [2]components.Decoder2x4
 
 	irInstructionANDGate components.ANDGate3
 	irInstructionNOTGate circuit.NOTGate
 
+	opcodeGroupDecoder components.Decoder3x8
+	upperBitsORGate    components.ORGate5
+	upperBitsNOTGate   circuit.NOTGate
+	opcodeGroupGates   [8]components.ANDGate3
+	fetchStepGates     [3]circuit.ANDGate
+	legacyStepGates    [3]circuit.ANDGate
+	stack              stackControl
+	arithmetic         arithmeticControl
+	immediate          immediateControl
+	indexed            indexedControl
+	interrupts         interruptControl
+	halt               haltControl
+
 	ioBusEnableGate       circuit.ANDGate
 	registerAEnableORGate components.ORGate3
 	registerBEnableORGate components.ORGate4
@@ -350,9 +399,11 @@ type CPU struct {
 	iarEnableANDGate      circuit.ANDGate
 	ramEnableORGate       components.ORGate5
 	ramEnableANDGate      circuit.ANDGate
+	spEnableANDGate       circuit.ANDGate
 	gpRegEnableANDGates   [8]components.ANDGate3
 	gpRegEnableORGates    [4]circuit.ORGate
-	gpRegSetANDGates      [4]components.ANDGate3
+	gpRegSetANDGates      [8]components.ANDGate3
+	gpRegSetORGates       [4]circuit.ORGate
 
 	ioBusSetGate    circuit.ANDGate
 	irBit4NOTGate   circuit.NOTGate
@@ -367,8 +418,34 @@ type CPU struct {
 	tmpSetANDGate   circuit.ANDGate
 	flagsSetORGate  circuit.ORGate
 	flagsSetANDGate circuit.ANDGate
+	spSetANDGate    circuit.ANDGate
+	registerASet    circuit.Wire
 	registerBSet    circuit.Wire
 
+	// instructions that need more than 6 steps
+	longInstructionORGate   components.ORGate4
+	shortInstructionNOTGate circuit.NOTGate
+
+	// control lines with the legacy instructions ORed with the extended ones
+	busOneEnableExtORGate    components.ORGate5
+	busOneMinusOneExtORGate  circuit.ORGate
+	accEnableExtORGate       components.ORGate6
+	iarEnableExtORGate       components.ORGate5
+	ramEnableExtORGate       components.ORGate5
+	registerAEnableExtORGate components.ORGate4
+	registerBEnableExtORGate components.ORGate5
+	spEnableExtORGate        circuit.ORGate
+	marSetExtORGate          components.ORGate5
+	iarSetExtORGate          components.ORGate5
+	accSetExtORGate          components.ORGate6
+	ramSetExtORGate          components.ORGate4
+	registerBSetExtORGate    components.ORGate5
+	spSetExtORGate           circuit.ORGate
+	flagsSetExtORGate        components.ORGate4
+	tmpSetExtORGate          components.ORGate4
+	aluCarryInExtORGate      circuit.ORGate
+	aluOpStepExtORGate       circuit.ORGate
+
 	flagStateGates  [4]circuit.ANDGate
 	flagStateORGate components.ORGate4
 
@@ -380,15 +457,25 @@ type CPU struct {
 	peripherals []io.Peripheral
 }
 
+// NewCPU builds a CPU as wide as its main bus, which has to be one of arch.BUS_WIDTHS. The
+// instruction set is 16 bits wide whatever the width of the bus, see irBit
 func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 	c := new(CPU)
+	c.width = mainBus.Width()
+	supported := false
+	for _, width := range arch.BUS_WIDTHS {
+		supported = supported || width == c.width
+	}
+	if !supported {
+		panic(fmt.Sprintf("a CPU can't be built for a %d bit bus", c.width))
+	}
 
-	c.clockState = false
-	c.stepper = components.NewStepper()
+	c.clock = *circuit.NewWire("CLK", false)
+	c.stepper = components.NewStepperOfLength(MAX_INSTRUCTION_STEPS)
 	c.memory = memory
 
 	// REGISTERS
-	c.controlBus = components.NewBus(arch.BUS_WIDTH)
+	c.controlBus = components.NewBus(c.width)
 	c.mainBus = mainBus
 	c.gpReg0 = *components.NewRegister("R0", c.mainBus, c.mainBus)
 	c.gpReg1 = *components.NewRegister("R1", c.mainBus, c.mainBus)
@@ -397,18 +484,42 @@ func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 	c.ir = *components.NewRegister("IR", c.mainBus, c.controlBus)
 	c.ir.Disable()
 	c.iar = *components.NewRegister("IAR", c.mainBus, c.mainBus)
+	c.sp = *components.NewRegister("SP", c.mainBus, c.mainBus)
 
 	// Decoders
 	c.instructionDecoderEnables2x4[0] = *components.NewDecoder2x4()
 	c.instructionDecoderEnables2x4[1] = *components.NewDecoder2x4()
-	c.instructionDecoderSet2x4 = *components.NewDecoder2x4()
+	c.instructionDecoderSet2x4[0] = *components.NewDecoder2x4()
+	c.instructionDecoderSet2x4[1] = *components.NewDecoder2x4()
 
 	c.instrDecoder3x8 = *NewInstructionDecoder3x8()
 
+	c.opcodeGroupDecoder = *components.NewDecoder3x8()
+	c.upperBitsORGate = *components.NewORGate5()
+	c.upperBitsNOTGate = *circuit.NewNOTGate()
+	for i := range c.opcodeGroupGates {
+		c.opcodeGroupGates[i] = *components.NewANDGate3()
+	}
+	for i := range c.fetchStepGates {
+		c.fetchStepGates[i] = *circuit.NewANDGate()
+	}
+	for i := range c.legacyStepGates {
+		c.legacyStepGates[i] = *circuit.NewANDGate()
+	}
+	c.stack = *newStackControl()
+	c.arithmetic = *newArithmeticControl()
+	c.immediate = *newImmediateControl()
+	c.indexed = *newIndexedControl()
+	c.interrupts = *newInterruptControl(c.width)
+	c.halt = *newHaltControl()
+	c.longInstructionORGate = *components.NewORGate4()
+	c.shortInstructionNOTGate = *circuit.NewNOTGate()
+
 	// FLAGS
-	c.aluToFlagsBus = components.NewBus(arch.BUS_WIDTH)
-	c.flagsBus = components.NewBus(arch.BUS_WIDTH)
-	c.flags = *components.NewRegister("FLAGS", c.aluToFlagsBus, c.flagsBus)
+	c.aluToFlagsBus = components.NewBus(c.width)
+	c.flagsInBus = components.NewBus(c.width)
+	c.flagsBus = components.NewBus(c.width)
+	c.flags = *components.NewRegister("FLAGS", c.flagsInBus, c.flagsBus)
 	// flags register is always enabled, and we initialise it with value 0
 	updateEnableStatus(&c.flags, true)
 	updateSetStatus(&c.flags, true)
@@ -416,7 +527,7 @@ func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 	updateSetStatus(&c.flags, false)
 
 	// TMP
-	c.tmpBus = components.NewBus(arch.BUS_WIDTH)
+	c.tmpBus = components.NewBus(c.width)
 	c.tmp = *components.NewRegister("TMP", c.mainBus, c.tmpBus)
 	// tmp register is always enabled, and we initialise it with value 0
 	updateEnableStatus(&c.tmp, true)
@@ -425,11 +536,11 @@ func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 	updateSetStatus(&c.tmp, false)
 
 	// BUS 1
-	c.busOneOutput = components.NewBus(arch.BUS_WIDTH)
+	c.busOneOutput = components.NewBus(c.width)
 	c.busOne = *components.NewBusOne(c.tmpBus, c.busOneOutput)
 
 	// ACC
-	c.accBus = components.NewBus(arch.BUS_WIDTH)
+	c.accBus = components.NewBus(c.width)
 	c.acc = *components.NewRegister("ACC", c.accBus, c.mainBus)
 
 	// ALU
@@ -451,6 +562,15 @@ func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 	c.iarEnableANDGate = *circuit.NewANDGate()
 	c.ramEnableORGate = *components.NewORGate5()
 	c.ramEnableANDGate = *circuit.NewANDGate()
+	c.spEnableANDGate = *circuit.NewANDGate()
+	c.busOneEnableExtORGate = *components.NewORGate5()
+	c.busOneMinusOneExtORGate = *circuit.NewORGate()
+	c.accEnableExtORGate = *components.NewORGate6()
+	c.iarEnableExtORGate = *components.NewORGate5()
+	c.ramEnableExtORGate = *components.NewORGate5()
+	c.registerAEnableExtORGate = *components.NewORGate4()
+	c.registerBEnableExtORGate = *components.NewORGate5()
+	c.spEnableExtORGate = *circuit.NewORGate()
 
 	// Sets
 	c.irSetANDGate = *circuit.NewANDGate()
@@ -464,6 +584,17 @@ func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 	c.tmpSetANDGate = *circuit.NewANDGate()
 	c.flagsSetORGate = *circuit.NewORGate()
 	c.flagsSetANDGate = *circuit.NewANDGate()
+	c.spSetANDGate = *circuit.NewANDGate()
+	c.marSetExtORGate = *components.NewORGate5()
+	c.iarSetExtORGate = *components.NewORGate5()
+	c.accSetExtORGate = *components.NewORGate6()
+	c.ramSetExtORGate = *components.NewORGate4()
+	c.registerBSetExtORGate = *components.NewORGate5()
+	c.spSetExtORGate = *circuit.NewORGate()
+	c.flagsSetExtORGate = *components.NewORGate4()
+	c.tmpSetExtORGate = *components.NewORGate4()
+	c.aluCarryInExtORGate = *circuit.NewORGate()
+	c.aluOpStepExtORGate = *circuit.NewORGate()
 
 	c.carryTemp = *components.NewBit()
 	c.carryANDGate = *circuit.NewANDGate()
@@ -500,6 +631,10 @@ func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 		c.gpRegSetANDGates[i] = *components.NewANDGate3()
 	}
 
+	for i := range c.gpRegSetORGates {
+		c.gpRegSetORGates[i] = *circuit.NewORGate()
+	}
+
 	for i := range c.aluOpAndGates {
 		c.aluOpAndGates[i] = *components.NewANDGate3()
 	}
@@ -510,42 +645,83 @@ func NewCPU(mainBus *components.Bus, memory *memory.Memory64K) *CPU {
 
 	c.peripherals = make([]io.Peripheral, 0)
 
+	c.signals = circuit.NewRegistry()
+	c.addSignals(c.signals.Scope("cpu"))
+
 	return c
 }
 
+// Width is the number of bits in the CPU's buses and registers
+func (c *CPU) Width() int {
+	return c.width
+}
+
+// irBit reads bit i of the instruction in the IR, bit 0 being the most significant bit of
+// a 16 bit instruction. On a 32 bit bus the instruction is the lower 16 bits of the IR and
+// the rest is ignored. On an 8 bit bus the IR only holds the lower byte, the instructions
+// from the book, and the upper byte that selects the extended instructions reads as 0
+func (c *CPU) irBit(i int) bool {
+	i += c.width - 16
+	return i >= 0 && c.ir.Bit(i)
+}
+
 func (c *CPU) ConnectPeripheral(p io.Peripheral) {
 	p.Connect(c.ioBus, c.mainBus)
 	c.peripherals = append(c.peripherals, p)
 }
 
-// Jump IAR
+// Jump IAR, this also restarts a halted CPU
 func (c *CPU) SetIAR(address uint16) {
-	c.mainBus.SetValue(address)
+	c.clearHalted()
+	c.iar.Load(arch.Word(address))
+}
 
-	updateSetStatus(&c.iar, true)
-	runUpdateOn(&c.iar)
-	updateSetStatus(&c.iar, false)
-	runUpdateOn(&c.iar)
+// Set stack pointer
+func (c *CPU) SetSP(address uint16) {
+	c.sp.Load(arch.Word(address))
+}
+
+// ReadMemory returns the value at the given address, leaving MAR untouched
+func (c *CPU) ReadMemory(address uint16) uint16 {
+	return uint16(c.memory.Peek(arch.Word(address)))
+}
+
+// WriteMemory puts a value in RAM via MAR and the main bus, MAR is restored afterwards
+func (c *CPU) WriteMemory(address uint16, value uint16) {
+	mar := c.memory.AddressRegister.Value()
 
+	c.setMAR(arch.Word(address))
+	c.mainBus.SetValue(arch.Word(value))
+	c.memory.Set()
+	c.memory.Update()
+	c.memory.Unset()
+	c.memory.Update()
+
+	c.setMAR(mar)
 	c.clearMainBus()
 }
 
+func (c *CPU) setMAR(address arch.Word) {
+	c.mainBus.SetValue(address)
+	c.memory.AddressRegister.Set()
+	c.memory.Update()
+	c.memory.AddressRegister.Unset()
+	c.memory.Update()
+}
+
 func (c *CPU) Step() {
 	for i := 0; i < 2; i++ {
-		if c.clockState {
-			c.clockState = false
-		} else {
-			c.clockState = true
-		}
+		c.clock.Update(!c.clock.Get())
 
-		c.step(c.clockState)
+		c.step(c.clock.Get())
 	}
 }
 
 func (c *CPU) String() string {
-	return fmt.Sprintf("STEPPER: %s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\nBUS1: %s\n%s\n%s\n",
+	return fmt.Sprintf("STEPPER: %s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\nBUS1: %s\n%s\n%s\n",
 		c.stepper.String(),
 		c.iar.String(),
+		c.sp.String(),
 		c.memory.AddressRegister.String(),
 		c.ir.String(),
 		c.acc.String(),
@@ -561,13 +737,29 @@ func (c *CPU) String() string {
 }
 
 func (c *CPU) step(clockState bool) {
+	clockState = c.haltClock(clockState)
+	c.longInstructionORGate.Update(c.stack.longInstruction(), c.interrupts.longInstruction(), c.immediate.longInstruction(), c.indexed.longInstruction())
+	c.shortInstructionNOTGate.Update(c.longInstructionORGate.Output())
+	c.stepper.ResetAfter(6, c.shortInstructionNOTGate.Output())
+	c.stepper.ResetAfter(8, c.interrupts.taken.Get())
 	c.stepper.Update(clockState)
+	c.latchInterrupt(clockState)
+	c.updateOpcodeGroupDecoder()
+	c.runFetchStepGates()
+	c.runLegacyStepGates()
+	c.runHaltGates()
 	c.runStep4Gates()
 	c.runStep5Gates()
 	c.runStep6Gates()
+	c.runStackGates()
+	c.runArithmeticGates()
+	c.runImmediateGates()
+	c.runIndexedGates()
+	c.runInterruptGates()
 
 	c.runEnable(clockState)
 	c.updateStates()
+	c.notifySignalObserver()
 	if clockState {
 		c.runEnable(false)
 		c.updateStates()
@@ -575,6 +767,7 @@ func (c *CPU) step(clockState bool) {
 
 	c.runSet(clockState)
 	c.updateStates()
+	c.notifySignalObserver()
 	if clockState {
 		c.runSet(false)
 		c.updateStates()
@@ -585,7 +778,7 @@ func (c *CPU) step(clockState bool) {
 }
 
 func (c *CPU) clearMainBus() {
-	for i := 0; i < arch.BUS_WIDTH; i++ {
+	for i := 0; i < c.width; i++ {
 		c.mainBus.SetInputWire(i, false)
 	}
 }
@@ -594,6 +787,9 @@ func (c *CPU) updateStates() {
 	// IAR
 	runUpdateOn(&c.iar)
 
+	// SP
+	runUpdateOn(&c.sp)
+
 	// MAR
 	runUpdateOn(&c.memory.AddressRegister)
 
@@ -607,7 +803,9 @@ func (c *CPU) updateStates() {
 	runUpdateOn(&c.tmp)
 
 	// FLAGS
+	c.updateFlagsInput()
 	runUpdateOn(&c.flags)
+	c.updateInterruptEnablers()
 
 	// BUS1
 	runUpdateOn(&c.busOne)
@@ -631,6 +829,7 @@ func (c *CPU) updateStates() {
 	runUpdateOn(&c.gpReg3)
 
 	c.updateInstructionDecoder3x8()
+	c.updateOpcodeGroupDecoder()
 	c.updateIOBus()
 	c.updatePeripherals()
 }
@@ -642,63 +841,94 @@ func (c *CPU) updatePeripherals() {
 }
 
 func (c *CPU) updateIOBus() {
-	c.ioBus.Update(c.ir.Bit(12), c.ir.Bit(13))
+	c.ioBus.Update(c.irBit(12), c.irBit(13))
 }
 
 func (c *CPU) updateALU() {
 	//update ALU operation based on instruction register
-	c.aluOpAndGates[2].Update(c.ir.Bit(9), c.ir.Bit(8), c.stepper.GetOutputWire(4))
-	c.aluOpAndGates[1].Update(c.ir.Bit(10), c.ir.Bit(8), c.stepper.GetOutputWire(4))
-	c.aluOpAndGates[0].Update(c.ir.Bit(11), c.ir.Bit(8), c.stepper.GetOutputWire(4))
+	c.aluOpStepExtORGate.Update(c.legacyStepGates[1].Output(), c.immediate.aluOp())
+	c.aluOpAndGates[2].Update(c.irBit(9), c.irBit(8), c.aluOpStepExtORGate.Output())
+	c.aluOpAndGates[1].Update(c.irBit(10), c.irBit(8), c.aluOpStepExtORGate.Output())
+	c.aluOpAndGates[0].Update(c.irBit(11), c.irBit(8), c.aluOpStepExtORGate.Output())
 
 	c.alu.Op[2].Update(c.aluOpAndGates[2].Output())
 	c.alu.Op[1].Update(c.aluOpAndGates[1].Output())
 	c.alu.Op[0].Update(c.aluOpAndGates[0].Output())
 
-	c.alu.CarryIn.Update(c.carryANDGate.Output())
+	c.aluCarryInExtORGate.Update(c.carryANDGate.Output(), c.arithmetic.carryIn())
+	c.alu.CarryIn.Update(c.aluCarryInExtORGate.Output())
+	c.alu.InvertB.Update(c.arithmetic.invertB())
 	c.alu.Update()
 
 }
 
 func (c *CPU) updateInstructionDecoder3x8() {
-	c.instrDecoder3x8.bit0NOTGate.Update(c.ir.Bit(8))
+	c.instrDecoder3x8.bit0NOTGate.Update(c.irBit(8))
 
-	c.instrDecoder3x8.decoder.Update(c.ir.Bit(9), c.ir.Bit(10), c.ir.Bit(11))
+	c.instrDecoder3x8.decoder.Update(c.irBit(9), c.irBit(10), c.irBit(11))
 
 	for i := 0; i < 8; i++ {
 		c.instrDecoder3x8.selectorGates[i].Update(c.instrDecoder3x8.decoder.GetOutputWire(i), c.instrDecoder3x8.bit0NOTGate.Output())
 	}
 }
 
+func (c *CPU) updateOpcodeGroupDecoder() {
+	c.upperBitsORGate.Update(c.irBit(0), c.irBit(1), c.irBit(2), c.irBit(3), c.irBit(4))
+	c.upperBitsNOTGate.Update(c.upperBitsORGate.Output())
+
+	c.opcodeGroupDecoder.Update(c.irBit(5), c.irBit(6), c.irBit(7))
+
+	// nothing in the IR runs during an interrupt cycle
+	for i := 0; i < 8; i++ {
+		c.opcodeGroupGates[i].Update(c.opcodeGroupDecoder.GetOutputWire(i), c.upperBitsNOTGate.Output(), c.interrupts.notTaken())
+	}
+}
+
+// steps 1, 2 and 3 fetch the next instruction unless this is an interrupt cycle
+func (c *CPU) runFetchStepGates() {
+	for i := range c.fetchStepGates {
+		c.fetchStepGates[i].Update(c.stepper.GetOutputWire(i), c.interrupts.notTaken())
+	}
+}
+
+// steps 4, 5 and 6 of the legacy instructions only run if the IR holds one of them
+func (c *CPU) runLegacyStepGates() {
+	for i := range c.legacyStepGates {
+		c.legacyStepGates[i].Update(c.stepper.GetOutputWire(3+i), c.opcodeGroupGates[OPCODE_GROUP_LEGACY].Output())
+	}
+}
+
 func (c *CPU) runStep4Gates() {
-	c.step4Gates[0].Update(c.stepper.GetOutputWire(3), c.ir.Bit(8))
+	c.step4Gates[0].Update(c.legacyStepGates[0].Output(), c.irBit(8))
 
 	gate := 1
 	for selector := 0; selector < 7; selector++ {
-		c.step4Gates[gate].Update(c.stepper.GetOutputWire(3), c.instrDecoder3x8.selectorGates[selector].Output())
+		c.step4Gates[gate].Update(c.legacyStepGates[0].Output(), c.instrDecoder3x8.selectorGates[selector].Output())
 		gate++
 	}
+	// DATA shares its selector with HALT
+	c.step4Gates[3].Update(c.legacyStepGates[0].Output(), c.halt.dataGate.Output())
 
-	c.step4Gate3And.Update(c.stepper.GetOutputWire(3), c.instrDecoder3x8.selectorGates[7].Output(), c.ir.Bit(12))
-	c.irBit4NOTGate.Update(c.ir.Bit(12))
+	c.step4Gate3And.Update(c.legacyStepGates[0].Output(), c.instrDecoder3x8.selectorGates[7].Output(), c.irBit(12))
+	c.irBit4NOTGate.Update(c.irBit(12))
 }
 
 func (c *CPU) runStep5Gates() {
-	c.step5Gates[0].Update(c.stepper.GetOutputWire(4), c.ir.Bit(8))
-	c.step5Gates[1].Update(c.stepper.GetOutputWire(4), c.instrDecoder3x8.selectorGates[0].Output())
-	c.step5Gates[2].Update(c.stepper.GetOutputWire(4), c.instrDecoder3x8.selectorGates[1].Output())
-	c.step5Gates[3].Update(c.stepper.GetOutputWire(4), c.instrDecoder3x8.selectorGates[2].Output())
+	c.step5Gates[0].Update(c.legacyStepGates[1].Output(), c.irBit(8))
+	c.step5Gates[1].Update(c.legacyStepGates[1].Output(), c.instrDecoder3x8.selectorGates[0].Output())
+	c.step5Gates[2].Update(c.legacyStepGates[1].Output(), c.instrDecoder3x8.selectorGates[1].Output())
+	c.step5Gates[3].Update(c.legacyStepGates[1].Output(), c.halt.dataGate.Output())
 
-	c.step5Gates[4].Update(c.stepper.GetOutputWire(4), c.instrDecoder3x8.selectorGates[4].Output())
-	c.step5Gates[5].Update(c.stepper.GetOutputWire(4), c.instrDecoder3x8.selectorGates[5].Output())
+	c.step5Gates[4].Update(c.legacyStepGates[1].Output(), c.instrDecoder3x8.selectorGates[4].Output())
+	c.step5Gates[5].Update(c.legacyStepGates[1].Output(), c.instrDecoder3x8.selectorGates[5].Output())
 
-	c.step5Gate3And.Update(c.stepper.GetOutputWire(4), c.instrDecoder3x8.selectorGates[7].Output(), c.irBit4NOTGate.Output())
+	c.step5Gate3And.Update(c.legacyStepGates[1].Output(), c.instrDecoder3x8.selectorGates[7].Output(), c.irBit4NOTGate.Output())
 }
 
 func (c *CPU) runStep6Gates() {
-	c.step6Gates[0].Update(c.stepper.GetOutputWire(5), c.ir.Bit(8), c.irInstructionNOTGate.Output())
-	c.step6Gates2And.Update(c.stepper.GetOutputWire(5), c.instrDecoder3x8.selectorGates[2].Output())
-	c.step6Gates[1].Update(c.stepper.GetOutputWire(5), c.instrDecoder3x8.selectorGates[5].Output(), c.flagStateORGate.Output())
+	c.step6Gates[0].Update(c.legacyStepGates[2].Output(), c.irBit(8), c.irInstructionNOTGate.Output())
+	c.step6Gates2And.Update(c.legacyStepGates[2].Output(), c.halt.dataGate.Output())
+	c.step6Gates[1].Update(c.legacyStepGates[2].Output(), c.instrDecoder3x8.selectorGates[5].Output(), c.flagStateORGate.Output())
 }
 
 func (c *CPU) runEnable(state bool) {
@@ -707,6 +937,8 @@ func (c *CPU) runEnable(state bool) {
 	c.runEnableOnBusOne(state)
 	c.runEnableOnACC(state)
 	c.runEnableOnRAM(state)
+	c.runEnableOnSP(state)
+	c.runEnableOnInterruptEnablers(state)
 	c.runEnableOnRegisterB()
 	c.runEnableOnRegisterA()
 	c.runEnableGeneralPurposeRegisters(state)
@@ -719,48 +951,70 @@ func (c *CPU) runEnableOnIO(state bool) {
 
 func (c *CPU) runEnableOnRegisterB() {
 	c.registerBEnableORGate.Update(c.step4Gates[0].Output(), c.step5Gates[2].Output(), c.step4Gates[4].Output(), c.step4Gate3And.Output())
-	c.registerBEnable.Update(c.registerBEnableORGate.Output())
+	c.registerBEnableExtORGate.Update(c.registerBEnableORGate.Output(), c.stack.registerBEnable(), c.arithmetic.registerBEnable(), c.immediate.registerBEnable(), c.indexed.registerBEnable())
+	c.registerBEnable.Update(c.registerBEnableExtORGate.Output())
 }
 
 func (c *CPU) runEnableOnRegisterA() {
 	c.registerAEnableORGate.Update(c.step4Gates[1].Output(), c.step4Gates[2].Output(), c.step5Gates[0].Output())
-	c.registerAEnable.Update(c.registerAEnableORGate.Output())
+	c.registerAEnableExtORGate.Update(c.registerAEnableORGate.Output(), c.arithmetic.registerAEnable(), c.immediate.registerAEnable(), c.indexed.registerAEnable())
+	c.registerAEnable.Update(c.registerAEnableExtORGate.Output())
 }
 
 func (c *CPU) runEnableOnBusOne(state bool) {
-	c.busOneEnableORGate.Update(c.stepper.GetOutputWire(0), c.step4Gates[7].Output(), c.step4Gates[6].Output(), c.step4Gates[3].Output())
-	updateEnableStatus(&c.busOne, c.busOneEnableORGate.Output())
+	c.busOneEnableORGate.Update(c.fetchStepGates[0].Output(), c.step4Gates[7].Output(), c.step4Gates[6].Output(), c.step4Gates[3].Output())
+	c.busOneEnableExtORGate.Update(c.busOneEnableORGate.Output(), c.stack.busOneEnable(), c.interrupts.busOneEnable(), c.immediate.busOneEnable(), c.indexed.busOneEnable())
+	updateEnableStatus(&c.busOne, c.busOneEnableExtORGate.Output())
+
+	c.busOneMinusOneExtORGate.Update(c.stack.busOneMinusOne(), c.interrupts.busOneMinusOne())
+	if c.busOneMinusOneExtORGate.Output() {
+		c.busOne.EnableMinusOne()
+	} else {
+		c.busOne.DisableMinusOne()
+	}
 }
 
 func (c *CPU) runEnableOnACC(state bool) {
-	c.accEnableORGate.Update(c.stepper.GetOutputWire(2), c.step5Gates[5].Output(), c.step6Gates2And.Output(), c.step6Gates[0].Output())
-	c.accEnableANDGate.Update(state, c.accEnableORGate.Output())
+	c.accEnableORGate.Update(c.fetchStepGates[2].Output(), c.step5Gates[5].Output(), c.step6Gates2And.Output(), c.step6Gates[0].Output())
+	c.accEnableExtORGate.Update(c.accEnableORGate.Output(), c.stack.accEnable(), c.interrupts.accEnable(), c.arithmetic.accEnable(), c.immediate.accEnable(), c.indexed.accEnable())
+	c.accEnableANDGate.Update(state, c.accEnableExtORGate.Output())
 
 	updateEnableStatus(&c.acc, c.accEnableANDGate.Output())
 }
 
 func (c *CPU) runEnableOnIAR(state bool) {
-	c.iarEnableORGate.Update(c.stepper.GetOutputWire(0), c.step4Gates[3].Output(), c.step4Gates[5].Output(), c.step4Gates[6].Output())
-	c.iarEnableANDGate.Update(state, c.iarEnableORGate.Output())
+	c.iarEnableORGate.Update(c.fetchStepGates[0].Output(), c.step4Gates[3].Output(), c.step4Gates[5].Output(), c.step4Gates[6].Output())
+	c.iarEnableExtORGate.Update(c.iarEnableORGate.Output(), c.stack.iarEnable(), c.interrupts.iarEnable(), c.immediate.iarEnable(), c.indexed.iarEnable())
+	c.iarEnableANDGate.Update(state, c.iarEnableExtORGate.Output())
 	updateEnableStatus(&c.iar, c.iarEnableANDGate.Output())
 }
 
 func (c *CPU) runEnableOnRAM(state bool) {
 	c.ramEnableORGate.Update(
-		c.stepper.GetOutputWire(1),
+		c.fetchStepGates[1].Output(),
 		c.step6Gates[1].Output(),
 		c.step5Gates[4].Output(),
 		c.step5Gates[3].Output(),
 		c.step5Gates[1].Output(),
 	)
-	c.ramEnableANDGate.Update(state, c.ramEnableORGate.Output())
+	c.ramEnableExtORGate.Update(c.ramEnableORGate.Output(), c.stack.ramEnable(), c.interrupts.ramEnable(), c.immediate.ramEnable(), c.indexed.ramEnable())
+	c.ramEnableANDGate.Update(state, c.ramEnableExtORGate.Output())
 	updateEnableStatus(c.memory, c.ramEnableANDGate.Output())
+	if c.ramEnableANDGate.Output() {
+		c.notifyMemoryObserver(false)
+	}
+}
+
+func (c *CPU) runEnableOnSP(state bool) {
+	c.spEnableExtORGate.Update(c.stack.spEnable(), c.interrupts.spEnable())
+	c.spEnableANDGate.Update(state, c.spEnableExtORGate.Output())
+	updateEnableStatus(&c.sp, c.spEnableANDGate.Output())
 }
 
 func (c *CPU) runEnableGeneralPurposeRegisters(state bool) {
 
-	c.instructionDecoderEnables2x4[0].Update(c.ir.Bit(14), c.ir.Bit(15))
-	c.instructionDecoderEnables2x4[1].Update(c.ir.Bit(12), c.ir.Bit(13))
+	c.instructionDecoderEnables2x4[0].Update(c.irBit(14), c.irBit(15))
+	c.instructionDecoderEnables2x4[1].Update(c.irBit(12), c.irBit(13))
 
 	// R0
 	c.gpRegEnableANDGates[0].Update(state, c.registerBEnable.Get(), c.instructionDecoderEnables2x4[0].GetOutputWire(0))
@@ -788,7 +1042,7 @@ func (c *CPU) runEnableGeneralPurposeRegisters(state bool) {
 }
 
 func (c *CPU) runSet(state bool) {
-	c.irInstructionANDGate.Update(c.ir.Bit(11), c.ir.Bit(10), c.ir.Bit(9))
+	c.irInstructionANDGate.Update(c.irBit(11), c.irBit(10), c.irBit(9))
 	c.irInstructionNOTGate.Update(c.irInstructionANDGate.Output())
 
 	c.refreshFlagStateGates()
@@ -796,11 +1050,15 @@ func (c *CPU) runSet(state bool) {
 	c.runSetOnIO(state)
 	c.runSetOnMAR(state)
 	c.runSetOnIAR(state)
+	c.runSetOnSP(state)
 	c.runSetOnIR(state)
 	c.runSetOnACC(state)
 	c.runSetOnRAM(state)
 	c.runSetOnTMP(state)
 	c.runSetOnFLAGS(state)
+	c.runSetOnInterruptEnable(state)
+	c.runSetOnHalted(state)
+	c.runSetOnRegisterA()
 	c.runSetOnRegisterB()
 	c.runSetGeneralPurposeRegisters(state)
 }
@@ -808,22 +1066,22 @@ func (c *CPU) runSet(state bool) {
 func (c *CPU) refreshFlagStateGates() {
 	/*
 		// C
-		c.flagStateGates[0].Update(c.ir.Bit(12), c.flagsBus.GetOutputWire(FLAGS_BUS_CARRY))
+		c.flagStateGates[0].Update(c.irBit(12), c.flagsBus.GetOutputWire(FLAGS_BUS_CARRY))
 		// A
-		c.flagStateGates[1].Update(c.ir.Bit(13), c.flagsBus.GetOutputWire(FLAGS_BUS_A_LARGER))
+		c.flagStateGates[1].Update(c.irBit(13), c.flagsBus.GetOutputWire(FLAGS_BUS_A_LARGER))
 		// E
-		c.flagStateGates[2].Update(c.ir.Bit(14), c.flagsBus.GetOutputWire(FLAGS_BUS_EQUAL))
+		c.flagStateGates[2].Update(c.irBit(14), c.flagsBus.GetOutputWire(FLAGS_BUS_EQUAL))
 		// Z
-		c.flagStateGates[3].Update(c.ir.Bit(15), c.flagsBus.GetOutputWire(FLAGS_BUS_ZERO))
+		c.flagStateGates[3].Update(c.irBit(15), c.flagsBus.GetOutputWire(FLAGS_BUS_ZERO))
 	*/
 	// C
-	c.flagStateGates[0].Update(c.ir.Bit(12), c.flagsBus.GetOutputWire(FLAGS_BUS_CARRY))
+	c.flagStateGates[0].Update(c.irBit(12), c.flagsBus.GetOutputWire(FLAGS_BUS_CARRY))
 	// A
-	c.flagStateGates[1].Update(c.ir.Bit(13), c.flagsBus.GetOutputWire(FLAGS_BUS_A_LARGER))
+	c.flagStateGates[1].Update(c.irBit(13), c.flagsBus.GetOutputWire(FLAGS_BUS_A_LARGER))
 	// E
-	c.flagStateGates[2].Update(c.ir.Bit(14), c.flagsBus.GetOutputWire(FLAGS_BUS_EQUAL))
+	c.flagStateGates[2].Update(c.irBit(14), c.flagsBus.GetOutputWire(FLAGS_BUS_EQUAL))
 	// Z
-	c.flagStateGates[3].Update(c.ir.Bit(15), c.flagsBus.GetOutputWire(FLAGS_BUS_ZERO))
+	c.flagStateGates[3].Update(c.irBit(15), c.flagsBus.GetOutputWire(FLAGS_BUS_ZERO))
 
 	c.flagStateORGate.Update(
 		c.flagStateGates[0].Output(),
@@ -840,43 +1098,52 @@ func (c *CPU) runSetOnIO(state bool) {
 
 func (c *CPU) runSetOnMAR(state bool) {
 	c.marSetORGate.Update(
-		c.stepper.GetOutputWire(0),
+		c.fetchStepGates[0].Output(),
 		c.step4Gates[3].Output(),
 		c.step4Gates[6].Output(),
 		c.step4Gates[1].Output(),
 		c.step4Gates[2].Output(),
 		c.step4Gates[5].Output(),
 	)
-	c.marSetANDGate.Update(state, c.marSetORGate.Output())
+	c.marSetExtORGate.Update(c.marSetORGate.Output(), c.stack.marSet(), c.interrupts.marSet(), c.immediate.marSet(), c.indexed.marSet())
+	c.marSetANDGate.Update(state, c.marSetExtORGate.Output())
 	updateSetStatus(&c.memory.AddressRegister, c.marSetANDGate.Output())
 }
 
 func (c *CPU) runSetOnIAR(state bool) {
 	c.iarSetORGate.Update(
-		c.stepper.GetOutputWire(2),
+		c.fetchStepGates[2].Output(),
 		c.step4Gates[4].Output(),
 		c.step5Gates[4].Output(),
 		c.step5Gates[5].Output(),
 		c.step6Gates2And.Output(),
 		c.step6Gates[1].Output(),
 	)
-	c.iarSetANDGate.Update(state, c.iarSetORGate.Output())
+	c.iarSetExtORGate.Update(c.iarSetORGate.Output(), c.stack.iarSet(), c.interrupts.iarSet(), c.immediate.iarSet(), c.indexed.iarSet())
+	c.iarSetANDGate.Update(state, c.iarSetExtORGate.Output())
 	updateSetStatus(&c.iar, c.iarSetANDGate.Output())
 }
 
+func (c *CPU) runSetOnSP(state bool) {
+	c.spSetExtORGate.Update(c.stack.spSet(), c.interrupts.spSet())
+	c.spSetANDGate.Update(state, c.spSetExtORGate.Output())
+	updateSetStatus(&c.sp, c.spSetANDGate.Output())
+}
+
 func (c *CPU) runSetOnIR(state bool) {
-	c.irSetANDGate.Update(state, c.stepper.GetOutputWire(1))
+	c.irSetANDGate.Update(state, c.fetchStepGates[1].Output())
 	updateSetStatus(&c.ir, c.irSetANDGate.Output())
 }
 
 func (c *CPU) runSetOnACC(state bool) {
 	c.accSetORGate.Update(
-		c.stepper.GetOutputWire(0),
+		c.fetchStepGates[0].Output(),
 		c.step4Gates[3].Output(),
 		c.step4Gates[6].Output(),
 		c.step5Gates[0].Output(),
 	)
-	c.accSetANDGate.Update(state, c.accSetORGate.Output())
+	c.accSetExtORGate.Update(c.accSetORGate.Output(), c.stack.accSet(), c.interrupts.accSet(), c.arithmetic.accSet(), c.immediate.accSet(), c.indexed.accSet())
+	c.accSetANDGate.Update(state, c.accSetExtORGate.Output())
 	updateSetStatus(&c.acc, c.accSetANDGate.Output())
 }
 
@@ -885,17 +1152,23 @@ func (c *CPU) runSetOnFLAGS(state bool) {
 		c.step5Gates[0].Output(),
 		c.step4Gates[7].Output(),
 	)
-	c.flagsSetANDGate.Update(state, c.flagsSetORGate.Output())
+	c.flagsSetExtORGate.Update(c.flagsSetORGate.Output(), c.interrupts.flagsRestore(), c.arithmetic.flagsSet(), c.immediate.flagsSet())
+	c.flagsSetANDGate.Update(state, c.flagsSetExtORGate.Output())
 	updateSetStatus(&c.flags, c.flagsSetANDGate.Output())
 }
 
 func (c *CPU) runSetOnRAM(state bool) {
-	c.ramSetANDGate.Update(state, c.step5Gates[2].Output())
+	c.ramSetExtORGate.Update(c.step5Gates[2].Output(), c.stack.ramSet(), c.interrupts.ramSet(), c.indexed.ramSet())
+	c.ramSetANDGate.Update(state, c.ramSetExtORGate.Output())
 	updateSetStatus(c.memory, c.ramSetANDGate.Output())
+	if c.ramSetANDGate.Output() {
+		c.notifyMemoryObserver(true)
+	}
 }
 
 func (c *CPU) runSetOnTMP(state bool) {
-	c.tmpSetANDGate.Update(state, c.step4Gates[0].Output())
+	c.tmpSetExtORGate.Update(c.step4Gates[0].Output(), c.arithmetic.tmpSet(), c.immediate.tmpSet(), c.indexed.tmpSet())
+	c.tmpSetANDGate.Update(state, c.tmpSetExtORGate.Output())
 	updateSetStatus(&c.tmp, c.tmpSetANDGate.Output())
 
 	// We will add a new memory bit called
@@ -913,28 +1186,42 @@ func (c *CPU) runSetOnRegisterB() {
 		c.step5Gates[3].Output(),
 		c.step5Gate3And.Output(),
 	)
+	c.registerBSetExtORGate.Update(c.registerBSetORGate.Output(), c.stack.registerBSet(), c.arithmetic.registerBSet(), c.immediate.registerBSet(), c.indexed.registerBSet())
+
+	c.registerBSet.Update(c.registerBSetExtORGate.Output())
+}
 
-	c.registerBSet.Update(c.registerBSetORGate.Output())
+func (c *CPU) runSetOnRegisterA() {
+	c.registerASet.Update(c.indexed.registerASet())
 }
 
 func (c *CPU) runSetGeneralPurposeRegisters(state bool) {
-	c.instructionDecoderSet2x4.Update(c.ir.Bit(14), c.ir.Bit(15))
+	c.instructionDecoderSet2x4[0].Update(c.irBit(14), c.irBit(15))
+	c.instructionDecoderSet2x4[1].Update(c.irBit(12), c.irBit(13))
 
 	// R0
-	c.gpRegSetANDGates[0].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4.GetOutputWire(0))
-	updateSetStatus(&c.gpReg0, c.gpRegSetANDGates[0].Output())
+	c.gpRegSetANDGates[0].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4[0].GetOutputWire(0))
+	c.gpRegSetANDGates[4].Update(state, c.registerASet.Get(), c.instructionDecoderSet2x4[1].GetOutputWire(0))
+	c.gpRegSetORGates[0].Update(c.gpRegSetANDGates[4].Output(), c.gpRegSetANDGates[0].Output())
+	updateSetStatus(&c.gpReg0, c.gpRegSetORGates[0].Output())
 
 	// R1
-	c.gpRegSetANDGates[1].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4.GetOutputWire(1))
-	updateSetStatus(&c.gpReg1, c.gpRegSetANDGates[1].Output())
+	c.gpRegSetANDGates[1].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4[0].GetOutputWire(1))
+	c.gpRegSetANDGates[5].Update(state, c.registerASet.Get(), c.instructionDecoderSet2x4[1].GetOutputWire(1))
+	c.gpRegSetORGates[1].Update(c.gpRegSetANDGates[5].Output(), c.gpRegSetANDGates[1].Output())
+	updateSetStatus(&c.gpReg1, c.gpRegSetORGates[1].Output())
 
 	// R2
-	c.gpRegSetANDGates[2].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4.GetOutputWire(2))
-	updateSetStatus(&c.gpReg2, c.gpRegSetANDGates[2].Output())
+	c.gpRegSetANDGates[2].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4[0].GetOutputWire(2))
+	c.gpRegSetANDGates[6].Update(state, c.registerASet.Get(), c.instructionDecoderSet2x4[1].GetOutputWire(2))
+	c.gpRegSetORGates[2].Update(c.gpRegSetANDGates[6].Output(), c.gpRegSetANDGates[2].Output())
+	updateSetStatus(&c.gpReg2, c.gpRegSetORGates[2].Output())
 
 	// R3
-	c.gpRegSetANDGates[3].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4.GetOutputWire(3))
-	updateSetStatus(&c.gpReg3, c.gpRegSetANDGates[3].Output())
+	c.gpRegSetANDGates[3].Update(state, c.registerBSet.Get(), c.instructionDecoderSet2x4[0].GetOutputWire(3))
+	c.gpRegSetANDGates[7].Update(state, c.registerASet.Get(), c.instructionDecoderSet2x4[1].GetOutputWire(3))
+	c.gpRegSetORGates[3].Update(c.gpRegSetANDGates[7].Output(), c.gpRegSetANDGates[3].Output())
+	updateSetStatus(&c.gpReg3, c.gpRegSetORGates[3].Output())
 }
 
 func runUpdateOn(component Updatable) {
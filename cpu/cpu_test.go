@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/circuit"
 	"github.com/djhworld/simple-computer/components"
 	"github.com/djhworld/simple-computer/memory"
 )
@@ -15,9 +16,12 @@ func SetUpCPU() *CPU {
 	return NewCPU(BUS, MEMORY)
 }
 
+// ClearMem zeroes every cell directly rather than through the bus, which is much quicker,
+// then writes the last one through the bus, which leaves MAR at 0xFFFF the same as
+// writing every cell through the bus did
 func ClearMem() {
 	for i := uint16(0); i < 65535; i++ {
-		setMemoryLocation2(MEMORY, i, 0x0000)
+		MEMORY.Poke(arch.Word(i), 0x0000)
 	}
 	setMemoryLocation2(MEMORY, 0xFFFF, 0x0000)
 }
@@ -277,7 +281,7 @@ func testST(instruction uint16, inputRegisters [4]uint16, expectedValueAddress,
 
 	doFetchDecodeExecute(c)
 
-	if c.gpReg0.Value() != expectedValue {
+	if uint16(c.gpReg0.Value()) != expectedValue {
 		t.Logf("Expected register 0 to have value of: %X but got %X", expectedValue, c.gpReg0.Value())
 		t.FailNow()
 	}
@@ -893,6 +897,199 @@ func testSubtract(inputA, inputB uint16, t *testing.T) {
 	checkRegister(c, 1, inputA-inputB, t)
 }
 
+func TestSUB(t *testing.T) {
+	ClearMem()
+
+	var inputs [4]uint16 = [4]uint16{0x0002, 0x0103, 0xFD04, 0x0005}
+	for a := 0; a < 4; a++ {
+		for b := 0; b < 4; b++ {
+			expected := inputs
+			expected[b] = inputs[b] - inputs[a]
+			testInstruction(0x0300+uint16(a<<2|b), inputs, expected, t)
+		}
+	}
+}
+
+// unlike ADD, the arithmetic instructions work out the flags with the carry in
+func TestArithmeticFlags(t *testing.T) {
+	ClearMem()
+	// SUB R0, R1
+	testArithmeticFlags(0x0301, 0x0003, 0x0005, false, 0x0002, true, true, false, false, t)
+	testArithmeticFlags(0x0301, 0x0005, 0x0005, false, 0x0000, true, false, true, true, t)
+	testArithmeticFlags(0x0301, 0x0005, 0x0003, true, 0xFFFE, false, false, false, false, t)
+
+	// ADC R0, R1
+	testArithmeticFlags(0x0311, 0x0001, 0x0002, true, 0x0004, false, true, false, false, t)
+	testArithmeticFlags(0x0311, 0x0000, 0xFFFF, true, 0x0000, true, true, false, true, t)
+	testArithmeticFlags(0x0311, 0x0001, 0xFFFF, false, 0x0000, true, true, false, true, t)
+
+	// SBB R0, R1
+	testArithmeticFlags(0x0321, 0x0003, 0x0005, true, 0x0002, true, true, false, false, t)
+	testArithmeticFlags(0x0321, 0x0003, 0x0005, false, 0x0001, true, true, false, false, t)
+	testArithmeticFlags(0x0321, 0x0005, 0x0005, false, 0xFFFF, false, false, true, false, t)
+	testArithmeticFlags(0x0321, 0x0000, 0x0001, false, 0x0000, true, true, false, true, t)
+}
+
+func testArithmeticFlags(instruction, registerA, registerB uint16, carry bool, expectedValue uint16, expectedCarry, expectedIsLarger, expectedIsEqual, expectedIsZero bool, t *testing.T) {
+	c := SetUpCPU()
+	setMemoryLocation(c, 0x0000, instruction)
+	setRegisters(c, [4]uint16{registerA, registerB, 0x0000, 0x0000})
+	if carry {
+		setFlagsRegister(c, FLAG_CARRY)
+	}
+
+	c.SetIAR(0x0000)
+	doFetchDecodeExecute(c)
+
+	checkRegister(c, 1, expectedValue, t)
+	checkFlagsRegister(c, expectedCarry, expectedIsLarger, expectedIsEqual, expectedIsZero, t)
+}
+
+// 32 bit numbers in R1:R0 and R3:R2, the carry flag carries from the lower word to the upper
+func TestMultiWordArithmetic(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	setMemoryLocation(c, 0x0000, 0x0060) // CLF
+	setMemoryLocation(c, 0x0001, 0x0088) // ADD R2, R0
+	setMemoryLocation(c, 0x0002, 0x031D) // ADC R3, R1
+	setMemoryLocation(c, 0x0003, 0x0308) // SUB R2, R0
+	setMemoryLocation(c, 0x0004, 0x032D) // SBB R3, R1
+
+	// 0x0001FFFF + 0x00000001
+	setRegisters(c, [4]uint16{0xFFFF, 0x0001, 0x0001, 0x0000})
+	c.SetIAR(0x0000)
+	doFetchDecodeExecute(c)
+	doFetchDecodeExecute(c)
+	doFetchDecodeExecute(c)
+	checkRegisters(c, 0x0000, 0x0002, 0x0001, 0x0000, t)
+
+	// 0x00020000 - 0x00000001
+	doFetchDecodeExecute(c)
+	doFetchDecodeExecute(c)
+	checkRegisters(c, 0xFFFF, 0x0001, 0x0001, 0x0000, t)
+	checkFlagsRegister(c, true, true, false, false, t)
+}
+
+func TestMOV(t *testing.T) {
+	ClearMem()
+
+	var inputs [4]uint16 = [4]uint16{0x0002, 0x0103, 0xFD04, 0x0005}
+	for a := 0; a < 4; a++ {
+		for b := 0; b < 4; b++ {
+			expected := inputs
+			expected[b] = inputs[a]
+			testInstruction(0x0400+uint16(a<<2|b), inputs, expected, t)
+		}
+	}
+}
+
+func TestImmediate(t *testing.T) {
+	ClearMem()
+	// ADDI R1, 0x0005
+	testImmediate(0x0481, 0x0003, 0x0005, 0x0008, false, false, false, false, t)
+	testImmediate(0x0481, 0xFFFF, 0x0001, 0x0000, true, true, false, true, t)
+	// ANDI R2, 0x0F0F
+	testImmediate(0x04C2, 0x1234, 0x0F0F, 0x0204, false, true, false, false, t)
+	// ORI R3, 0x0F00
+	testImmediate(0x04D3, 0x1234, 0x0F00, 0x1F34, false, true, false, false, t)
+	// XORI R0, 0x1234
+	testImmediate(0x04E0, 0x1234, 0x1234, 0x0000, false, false, true, true, t)
+	// CMPI R1, 0x0010
+	testImmediate(0x04F1, 0x0020, 0x0010, 0x0020, false, true, false, false, t)
+	testImmediate(0x04F1, 0x0010, 0x0010, 0x0010, false, false, true, false, t)
+}
+
+func testImmediate(instruction, register, value, expectedValue uint16, expectedCarry, expectedIsLarger, expectedIsEqual, expectedIsZero bool, t *testing.T) {
+	c := SetUpCPU()
+	setMemoryLocation(c, 0x0000, instruction)
+	setMemoryLocation(c, 0x0001, value)
+	// DATA R0, 0x00AB
+	setMemoryLocation(c, 0x0002, 0x0020)
+	setMemoryLocation(c, 0x0003, 0x00AB)
+
+	inputs := [4]uint16{0x0001, 0x0001, 0x0001, 0x0001}
+	inputs[instruction&0x0003] = register
+	setRegisters(c, inputs)
+	c.SetIAR(0x0000)
+
+	// the immediate instructions take 9 steps rather than 6
+	doSteps(c, MAX_INSTRUCTION_STEPS)
+	checkIAR(c, 0x0002, t)
+	checkRegister(c, int(instruction&0x0003), expectedValue, t)
+	checkFlagsRegister(c, expectedCarry, expectedIsLarger, expectedIsEqual, expectedIsZero, t)
+
+	doFetchDecodeExecute(c)
+	checkRegister(c, 0, 0x00AB, t)
+}
+
+func TestIndexedLoadStore(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	setMemoryLocation(c, 0x0000, 0x0501) // LD R1, [R0 + 0x0100]
+	setMemoryLocation(c, 0x0001, 0x0100)
+	setMemoryLocation(c, 0x0002, 0x0516) // ST [R1 + 0x0002], R2
+	setMemoryLocation(c, 0x0003, 0x0002)
+	setMemoryLocation(c, 0x0004, 0x0503) // LD R3, [R0 + 0xFFFF]
+	setMemoryLocation(c, 0x0005, 0xFFFF)
+	setMemoryLocation(c, 0x0120, 0x0BEE)
+	setMemoryLocation(c, 0x0BF0, 0x0000)
+	setMemoryLocation(c, 0x001F, 0x0F1F)
+
+	setRegisters(c, [4]uint16{0x0020, 0x0001, 0x1234, 0x0001})
+	setFlagsRegister(c, FLAG_EQUAL)
+	c.SetIAR(0x0000)
+
+	// the offset has been read by step 6 but the load needs 9 steps
+	doFetchDecodeExecute(c)
+	checkIAR(c, 0x0002, t)
+	checkRegisters(c, 0x0020, 0x0001, 0x1234, 0x0001, t)
+
+	doSteps(c, 3)
+	checkRegisters(c, 0x0020, 0x0BEE, 0x1234, 0x0001, t)
+	checkFlagsRegister(c, false, false, true, false, t)
+
+	doSteps(c, MAX_INSTRUCTION_STEPS)
+	checkIAR(c, 0x0004, t)
+	checkMemoryLocation(c, 0x0BF0, 0x1234, t)
+
+	// the address wraps around
+	doSteps(c, MAX_INSTRUCTION_STEPS)
+	checkRegisters(c, 0x0020, 0x0BEE, 0x1234, 0x0F1F, t)
+	checkFlagsRegister(c, false, false, true, false, t)
+}
+
+func TestPostIncrementLoadStore(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	setMemoryLocation(c, 0x0000, 0x0521) // LD R1, [R0]+
+	setMemoryLocation(c, 0x0001, 0x0532) // ST [R0]+, R2
+	setMemoryLocation(c, 0x0002, 0x0525) // LD R1, [R1]+
+	setMemoryLocation(c, 0x0040, 0xAAAA)
+	setMemoryLocation(c, 0x0041, 0x0000)
+
+	setRegisters(c, [4]uint16{0x0040, 0x0001, 0x5555, 0x0001})
+	c.SetIAR(0x0000)
+
+	doSteps(c, 4)
+	checkRegisters(c, 0x0040, 0x0001, 0x5555, 0x0001, t)
+	doSteps(c, 1)
+	checkRegisters(c, 0x0040, 0xAAAA, 0x5555, 0x0001, t)
+	doSteps(c, 1)
+	checkRegisters(c, 0x0041, 0xAAAA, 0x5555, 0x0001, t)
+
+	doFetchDecodeExecute(c)
+	checkRegisters(c, 0x0042, 0xAAAA, 0x5555, 0x0001, t)
+	checkMemoryLocation(c, 0x0041, 0x5555, t)
+
+	// register A is written back after the load
+	doFetchDecodeExecute(c)
+	checkRegisters(c, 0x0042, 0xAAAB, 0x5555, 0x0001, t)
+	checkIAR(c, 0x0003, t)
+}
+
 func TestMultiply(t *testing.T) {
 	ClearMem()
 	testMultiply(0, 0, t)
@@ -940,6 +1137,399 @@ func testMultiply(inputA, inputB uint16, t *testing.T) {
 	checkRegister(c, 2, inputA*inputB, t)
 }
 
+func TestPUSH(t *testing.T) {
+	testPUSH(0x0100, [4]uint16{0x0010, 0x0011, 0x0012, 0x0013}, 0xFEFE, 0x0010, t)
+	testPUSH(0x0101, [4]uint16{0x0010, 0x0011, 0x0012, 0x0013}, 0xFEFE, 0x0011, t)
+	testPUSH(0x0102, [4]uint16{0x0010, 0x0011, 0x0012, 0x0013}, 0x0001, 0x0012, t)
+	testPUSH(0x0103, [4]uint16{0x0010, 0x0011, 0x0012, 0x0013}, 0x0000, 0x0013, t)
+}
+
+func testPUSH(instruction uint16, inputRegisters [4]uint16, sp uint16, expectedValue uint16, t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	setMemoryLocation(c, 0x0500, instruction)
+	setRegisters(c, inputRegisters)
+	c.SetIAR(0x0500)
+	c.SetSP(sp)
+
+	doFetchDecodeExecute(c)
+
+	checkIAR(c, 0x0501, t)
+	checkSP(c, sp-1, t)
+	checkMemoryLocation(c, sp-1, expectedValue, t)
+	checkRegisters(c, inputRegisters[0], inputRegisters[1], inputRegisters[2], inputRegisters[3], t)
+}
+
+func TestPOP(t *testing.T) {
+	testPOP(0x0110, 0xFEFD, 0x1234, [4]uint16{0x1234, 0x0011, 0x0012, 0x0013}, t)
+	testPOP(0x0111, 0xFEFD, 0x1234, [4]uint16{0x0010, 0x1234, 0x0012, 0x0013}, t)
+	testPOP(0x0112, 0x0000, 0x1234, [4]uint16{0x0010, 0x0011, 0x1234, 0x0013}, t)
+	testPOP(0x0113, 0xFFFF, 0x1234, [4]uint16{0x0010, 0x0011, 0x0012, 0x1234}, t)
+}
+
+func testPOP(instruction uint16, sp uint16, stackValue uint16, expectedRegisters [4]uint16, t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	setMemoryLocation(c, 0x0500, instruction)
+	setMemoryLocation(c, sp, stackValue)
+	setRegisters(c, [4]uint16{0x0010, 0x0011, 0x0012, 0x0013})
+	c.SetIAR(0x0500)
+	c.SetSP(sp)
+
+	doFetchDecodeExecute(c)
+
+	checkIAR(c, 0x0501, t)
+	checkSP(c, sp+1, t)
+	checkRegisters(c, expectedRegisters[0], expectedRegisters[1], expectedRegisters[2], expectedRegisters[3], t)
+}
+
+func TestPUSHThenPOP(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	// PUSH R0, PUSH R1, PUSH R2, POP R3, POP R2, POP R1
+	program := []uint16{0x0100, 0x0101, 0x0102, 0x0113, 0x0112, 0x0111}
+	for i, instr := range program {
+		setMemoryLocation(c, 0x0500+uint16(i), instr)
+	}
+	setRegisters(c, [4]uint16{0x00AA, 0x00BB, 0x00CC, 0x00DD})
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+
+	for range program {
+		doFetchDecodeExecute(c)
+	}
+
+	checkIAR(c, 0x0506, t)
+	checkSP(c, 0xFEFE, t)
+	checkRegisters(c, 0x00AA, 0x00AA, 0x00BB, 0x00CC, t)
+}
+
+func TestPUSHAndPOPDoNotChangeFlags(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	// ADD R0, R1 (sets carry and zero), PUSH R1, POP R2
+	setMemoryLocation(c, 0x0500, 0x0081)
+	setMemoryLocation(c, 0x0501, 0x0101)
+	setMemoryLocation(c, 0x0502, 0x0112)
+	setRegisters(c, [4]uint16{0x0001, 0xFFFF, 0x0002, 0x0003})
+	c.SetIAR(0x0500)
+	c.SetSP(0x0001)
+
+	doFetchDecodeExecute(c)
+	checkFlagsRegister(c, true, false, false, true, t)
+
+	doFetchDecodeExecute(c)
+	checkFlagsRegister(c, true, false, false, true, t)
+
+	doFetchDecodeExecute(c)
+	checkFlagsRegister(c, true, false, false, true, t)
+	checkRegisters(c, 0x0001, 0x0000, 0x0000, 0x0003, t)
+}
+
+func TestCALL(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	setMemoryLocation(c, 0x0500, 0x0120)
+	setMemoryLocation(c, 0x0501, 0x0A00)
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+
+	// CALL takes 9 steps rather than 6
+	doFetchDecodeExecute(c)
+	checkIAR(c, 0x0501, t)
+
+	doSteps(c, 3)
+	checkIAR(c, 0x0A00, t)
+	checkSP(c, 0xFEFD, t)
+	checkMemoryLocation(c, 0xFEFD, 0x0502, t)
+}
+
+func TestCALLThenRET(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	// CALL 0x0A00
+	setMemoryLocation(c, 0x0500, 0x0120)
+	setMemoryLocation(c, 0x0501, 0x0A00)
+	// DATA R0, 0x00FF
+	setMemoryLocation(c, 0x0502, 0x0020)
+	setMemoryLocation(c, 0x0503, 0x00FF)
+
+	// DATA R1, 0x00EE
+	setMemoryLocation(c, 0x0A00, 0x0021)
+	setMemoryLocation(c, 0x0A01, 0x00EE)
+	// RET
+	setMemoryLocation(c, 0x0A02, 0x0130)
+
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+
+	doSteps(c, 9)
+	checkIAR(c, 0x0A00, t)
+
+	doFetchDecodeExecute(c)
+	checkIAR(c, 0x0A02, t)
+	checkRegister(c, 1, 0x00EE, t)
+
+	doFetchDecodeExecute(c)
+	checkIAR(c, 0x0502, t)
+	checkSP(c, 0xFEFE, t)
+
+	doFetchDecodeExecute(c)
+	checkIAR(c, 0x0504, t)
+	checkRegister(c, 0, 0x00FF, t)
+}
+
+func TestNestedCALLs(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	// recursively sums 1..R0 into R2
+	program := []uint16{
+		0x0021, 0xFFFF, // 0x0500: DATA R1, 0xFFFF
+		0x0022, 0x0000, // 0x0502: DATA R2, 0x0000
+		0x0023, 0x0000, // 0x0504: DATA R3, 0x0000
+		0x0020, 0x000A, // 0x0506: DATA R0, 0x000A
+		0x0120, 0x050C, // 0x0508: CALL sum
+		0x0040, 0x050A, // 0x050A: JMP 0x050A
+		0x00F3,         // 0x050C: sum: CMP R0, R3
+		0x0052, 0x0517, // 0x050D: JMPE done
+		0x0100,         // 0x050F: PUSH R0
+		0x0060,         // 0x0510: CLF
+		0x0084,         // 0x0511: ADD R1, R0
+		0x0120, 0x050C, // 0x0512: CALL sum
+		0x0110, // 0x0514: POP R0
+		0x0060, // 0x0515: CLF
+		0x0082, // 0x0516: ADD R0, R2
+		0x0130, // 0x0517: done: RET
+	}
+	for i, instr := range program {
+		setMemoryLocation(c, 0x0500+uint16(i), instr)
+	}
+
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+
+	runUntilIAR(c, 0x050A, 5000, t)
+	doFetchDecodeExecute(c)
+
+	checkIAR(c, 0x050A, t)
+	checkSP(c, 0xFEFE, t)
+	checkRegister(c, 2, 55, t)
+}
+
+func TestEIAndDI(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	setMemoryLocation(c, 0x0500, 0x0200)
+	setMemoryLocation(c, 0x0501, 0x0210)
+	c.SetIAR(0x0500)
+
+	if c.InterruptsEnabled() {
+		t.FailNow()
+	}
+
+	doFetchDecodeExecute(c)
+	if !c.InterruptsEnabled() {
+		t.FailNow()
+	}
+
+	doFetchDecodeExecute(c)
+	if c.InterruptsEnabled() {
+		t.FailNow()
+	}
+	checkIAR(c, 0x0502, t)
+}
+
+func TestInterruptIgnoredWhenDisabled(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	source := NewDumbInterruptSource()
+	c.ConnectIRQ(0, source)
+	source.Raise(true)
+
+	setMemoryLocation(c, INTERRUPT_VECTOR_TABLE, 0x0A00)
+	setMemoryLocation(c, 0x0500, 0x0060)
+	setMemoryLocation(c, 0x0501, 0x0060)
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+
+	doFetchDecodeExecute(c)
+	doFetchDecodeExecute(c)
+
+	checkIAR(c, 0x0502, t)
+	checkSP(c, 0xFEFE, t)
+}
+
+func TestInterruptThenIRET(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	source := NewDumbInterruptSource()
+	c.ConnectIRQ(0, source)
+
+	setMemoryLocation(c, INTERRUPT_VECTOR_TABLE, 0x0A00)
+	program := []uint16{
+		0x0200,         // 0x0500: EI
+		0x00F4,         // 0x0501: CMP R1, R0
+		0x0040, 0x0502, // 0x0502: JMP 0x0502
+	}
+	for i, instr := range program {
+		setMemoryLocation(c, 0x0500+uint16(i), instr)
+	}
+	// handler
+	setMemoryLocation(c, 0x0A00, 0x0060) // CLF
+	setMemoryLocation(c, 0x0A01, 0x0220) // IRET
+
+	setRegisters(c, [4]uint16{0x0001, 0x0002, 0x0000, 0x0000})
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+
+	doFetchDecodeExecute(c)
+	doFetchDecodeExecute(c)
+	checkFlagsRegister(c, false, true, false, false, t)
+	flags := c.flags.Value()
+
+	// the interrupt cycle replaces the fetch of the JMP and takes 8 steps
+	source.Raise(true)
+	doSteps(c, 8)
+	checkIAR(c, 0x0A00, t)
+	checkSP(c, 0xFEFC, t)
+	checkMemoryLocation(c, 0xFEFD, 0x0502, t)
+	checkMemoryLocation(c, 0xFEFC, uint16(flags), t)
+	if c.InterruptsEnabled() {
+		t.FailNow()
+	}
+
+	// the handler has serviced the peripheral so it lowers the line
+	source.Raise(false)
+	doFetchDecodeExecute(c)
+	checkFlagsRegister(c, false, false, false, false, t)
+
+	// IRET takes 9 steps
+	doSteps(c, 9)
+	checkIAR(c, 0x0502, t)
+	checkSP(c, 0xFEFE, t)
+	checkFlagsRegister(c, false, true, false, false, t)
+	if !c.InterruptsEnabled() {
+		t.FailNow()
+	}
+
+	doFetchDecodeExecute(c)
+	checkIAR(c, 0x0502, t)
+}
+
+func TestInterruptLowestLineWins(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	sources := []*DumbInterruptSource{NewDumbInterruptSource(), NewDumbInterruptSource(), NewDumbInterruptSource()}
+	for i, source := range sources {
+		c.ConnectIRQ(i+1, source)
+	}
+
+	setMemoryLocation(c, INTERRUPT_VECTOR_TABLE+1, 0x0A00)
+	setMemoryLocation(c, INTERRUPT_VECTOR_TABLE+2, 0x0B00)
+	setMemoryLocation(c, INTERRUPT_VECTOR_TABLE+3, 0x0C00)
+	setMemoryLocation(c, 0x0500, 0x0200)
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+
+	doFetchDecodeExecute(c)
+
+	sources[1].Raise(true)
+	sources[2].Raise(true)
+	doSteps(c, 8)
+	checkIAR(c, 0x0B00, t)
+
+	sources[1].Raise(false)
+	sources[2].Raise(false)
+	sources[0].Raise(true)
+	setMemoryLocation(c, 0x0B00, 0x0200)
+	doFetchDecodeExecute(c)
+	doSteps(c, 8)
+	checkIAR(c, 0x0A00, t)
+	checkSP(c, 0xFEFA, t)
+}
+
+func TestHALT(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+
+	source := NewDumbInterruptSource()
+	c.ConnectIRQ(0, source)
+	setMemoryLocation(c, INTERRUPT_VECTOR_TABLE, 0x0A00)
+
+	// EI, DATA R1 0x1234, HALT, DATA R2 0x5678
+	setMemoryLocation(c, 0x0500, 0x0200)
+	setMemoryLocation(c, 0x0501, 0x0021)
+	setMemoryLocation(c, 0x0502, 0x1234)
+	setMemoryLocation(c, 0x0503, 0x0024)
+	setMemoryLocation(c, 0x0504, 0x0022)
+	setMemoryLocation(c, 0x0505, 0x5678)
+	c.SetIAR(0x0500)
+	c.SetSP(0xFEFE)
+	setRegisters(c, [4]uint16{})
+
+	for i := 0; i < 3; i++ {
+		doFetchDecodeExecute(c)
+	}
+	if !c.Halted() {
+		t.Logf("expected CPU to be halted")
+		t.FailNow()
+	}
+	checkIAR(c, 0x0504, t)
+	checkRegisters(c, 0x0000, 0x1234, 0x0000, 0x0000, t)
+
+	// nothing runs once halted, not even an interrupt
+	source.Raise(true)
+	doSteps(c, 100)
+	checkIAR(c, 0x0504, t)
+	checkSP(c, 0xFEFE, t)
+	checkRegisters(c, 0x0000, 0x1234, 0x0000, 0x0000, t)
+	if phase := c.Phase(); phase != 6 {
+		t.Logf("expected stepper to stay on step 6 but got %d", phase)
+		t.FailNow()
+	}
+	source.Raise(false)
+
+	c.SetIAR(0x0504)
+	if c.Halted() {
+		t.Logf("expected SetIAR to restart the CPU")
+		t.FailNow()
+	}
+	doFetchDecodeExecute(c)
+	checkIAR(c, 0x0506, t)
+	checkRegisters(c, 0x0000, 0x1234, 0x5678, 0x0000, t)
+}
+
+func TestHALTRange(t *testing.T) {
+	for instruction := uint16(0x0024); instruction <= 0x002F; instruction++ {
+		ClearMem()
+		c := SetUpCPU()
+
+		setMemoryLocation(c, 0x0500, instruction)
+		setMemoryLocation(c, 0x0501, 0x1234)
+		c.SetIAR(0x0500)
+		setRegisters(c, [4]uint16{})
+
+		doFetchDecodeExecute(c)
+		if !c.Halted() {
+			t.Logf("expected %X to halt", instruction)
+			t.FailNow()
+		}
+		checkIAR(c, 0x0501, t)
+		checkRegisters(c, 0x0000, 0x0000, 0x0000, 0x0000, t)
+	}
+}
+
 func TestIOInputInstruction(t *testing.T) {
 	ClearMem()
 	// IN Data, RB
@@ -997,7 +1587,7 @@ func testIOOutputInstruction(instruction uint16, inputRegisters [4]uint16, expec
 
 	doFetchDecodeExecute(c)
 
-	if peripheral.value.Value() != expectedPeripheralValue {
+	if uint16(peripheral.value.Value()) != expectedPeripheralValue {
 		t.FailNow()
 	}
 
@@ -1049,9 +1639,9 @@ func (p *DumbPeripheral) refreshValue(addressValue, dataValue uint16) {
 
 	if p.ioBus.GetOutputWire(components.DATA_OR_ADDRESS) {
 		//address mode
-		p.mainBus.SetValue(addressValue)
+		p.mainBus.SetValue(arch.Word(addressValue))
 	} else {
-		p.mainBus.SetValue(dataValue)
+		p.mainBus.SetValue(arch.Word(dataValue))
 	}
 	p.value.Update()
 	p.value.Unset()
@@ -1077,21 +1667,60 @@ func (p *DumbPeripheral) updateSet() {
 	}
 }
 
+// DumbInterruptSource raises its IRQ line when told to
+type DumbInterruptSource struct {
+	irq *circuit.Wire
+}
+
+func NewDumbInterruptSource() *DumbInterruptSource {
+	return new(DumbInterruptSource)
+}
+
+func (p *DumbInterruptSource) Connect(ioBus *components.IOBus, mainBus *components.Bus) {}
+
+func (p *DumbInterruptSource) Update() {}
+
+func (p *DumbInterruptSource) ConnectIRQ(irq *circuit.Wire) {
+	p.irq = irq
+}
+
+func (p *DumbInterruptSource) Raise(value bool) {
+	p.irq.Update(value)
+}
+
 func doFetchDecodeExecute(c *CPU) {
 	for i := 0; i < 6; i++ {
 		c.Step()
 	}
 }
 
+func doSteps(c *CPU, steps int) {
+	for i := 0; i < steps; i++ {
+		c.Step()
+	}
+}
+
+// runs whole instructions until the IAR holds the given address
+func runUntilIAR(c *CPU, address uint16, maxSteps int, t *testing.T) {
+	for i := 0; i < maxSteps; i++ {
+		c.Step()
+		if c.stepper.GetOutputWire(0) && uint16(c.iar.Value()) == address {
+			return
+		}
+	}
+	t.Logf("IAR did not reach %X within %d steps, got %X", address, maxSteps, c.iar.Value())
+	t.FailNow()
+}
+
 func setMemoryLocation(c *CPU, address uint16, value uint16) {
 	c.memory.AddressRegister.Set()
-	c.mainBus.SetValue(address)
+	c.mainBus.SetValue(arch.Word(address))
 	c.memory.Update()
 
 	c.memory.AddressRegister.Unset()
 	c.memory.Update()
 
-	c.mainBus.SetValue(value)
+	c.mainBus.SetValue(arch.Word(value))
 	c.memory.Set()
 	c.memory.Update()
 
@@ -1101,13 +1730,13 @@ func setMemoryLocation(c *CPU, address uint16, value uint16) {
 
 func setMemoryLocation2(m *memory.Memory64K, address uint16, value uint16) {
 	m.AddressRegister.Set()
-	BUS.SetValue(address)
+	BUS.SetValue(arch.Word(address))
 	m.Update()
 
 	m.AddressRegister.Unset()
 	m.Update()
 
-	BUS.SetValue(value)
+	BUS.SetValue(arch.Word(value))
 	m.Set()
 	m.Update()
 
@@ -1120,28 +1749,28 @@ func setRegister(c *CPU, register int, value uint16) {
 	case 0:
 		c.gpReg0.Set()
 		c.gpReg0.Update()
-		c.mainBus.SetValue(value)
+		c.mainBus.SetValue(arch.Word(value))
 		c.gpReg0.Update()
 		c.gpReg0.Unset()
 		c.gpReg0.Update()
 	case 1:
 		c.gpReg1.Set()
 		c.gpReg1.Update()
-		c.mainBus.SetValue(value)
+		c.mainBus.SetValue(arch.Word(value))
 		c.gpReg1.Update()
 		c.gpReg1.Unset()
 		c.gpReg1.Update()
 	case 2:
 		c.gpReg2.Set()
 		c.gpReg2.Update()
-		c.mainBus.SetValue(value)
+		c.mainBus.SetValue(arch.Word(value))
 		c.gpReg2.Update()
 		c.gpReg2.Unset()
 		c.gpReg2.Update()
 	case 3:
 		c.gpReg3.Set()
 		c.gpReg3.Update()
-		c.mainBus.SetValue(value)
+		c.mainBus.SetValue(arch.Word(value))
 		c.gpReg3.Update()
 		c.gpReg3.Unset()
 		c.gpReg3.Update()
@@ -1149,14 +1778,41 @@ func setRegister(c *CPU, register int, value uint16) {
 }
 
 func checkIAR(c *CPU, expValue uint16, t *testing.T) {
-	if c.iar.Value() != expValue {
+	if uint16(c.iar.Value()) != expValue {
 		t.Logf("Expected IAR to have value of: %X but got %X", expValue, c.iar.Value())
 		t.FailNow()
 	}
 }
 
+func checkSP(c *CPU, expValue uint16, t *testing.T) {
+	if uint16(c.sp.Value()) != expValue {
+		t.Logf("Expected SP to have value of: %X but got %X", expValue, c.sp.Value())
+		t.FailNow()
+	}
+}
+
+func checkMemoryLocation(c *CPU, address uint16, expValue uint16, t *testing.T) {
+	c.memory.AddressRegister.Set()
+	c.mainBus.SetValue(arch.Word(address))
+	c.memory.Update()
+
+	c.memory.AddressRegister.Unset()
+	c.memory.Update()
+
+	c.memory.Enable()
+	c.memory.Update()
+	c.memory.Disable()
+	c.memory.Update()
+
+	if value := uint16(c.mainBus.Value()); value != expValue {
+		t.Logf("Expected memory location %X to have value of: %X but got %X", address, expValue, value)
+		t.FailNow()
+	}
+	c.clearMainBus()
+}
+
 func checkIR(c *CPU, expValue uint16, t *testing.T) {
-	if c.ir.Value() != expValue {
+	if uint16(c.ir.Value()) != expValue {
 		t.Logf("Expected IR to have value of: %X but got %X", expValue, c.ir.Value())
 		t.FailNow()
 	}
@@ -1185,13 +1841,13 @@ func checkRegister(c *CPU, register int, expectedValue uint16, t *testing.T) {
 	var regValue uint16
 	switch register {
 	case 0:
-		regValue = c.gpReg0.Value()
+		regValue = uint16(c.gpReg0.Value())
 	case 1:
-		regValue = c.gpReg1.Value()
+		regValue = uint16(c.gpReg1.Value())
 	case 2:
-		regValue = c.gpReg2.Value()
+		regValue = uint16(c.gpReg2.Value())
 	case 3:
-		regValue = c.gpReg3.Value()
+		regValue = uint16(c.gpReg3.Value())
 	default:
 		t.Logf("Unknown register %d", register)
 		t.FailNow()
@@ -0,0 +1,115 @@
+package cpu
+
+import (
+	"fmt"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/memory"
+)
+
+// DEBUGGING
+// the registers can be read and written directly, without going through the main bus,
+// so a debugger can inspect and modify a CPU between steps without disturbing it
+
+// MemoryObserver is told every time the CPU reads or writes RAM while running an instruction
+type MemoryObserver func(address uint16, write bool)
+
+// the values are 16 bits as in the Core interface, on an 8 bit CPU the upper byte is
+// dropped when setting a register and on a 32 bit CPU the upper 16 bits are
+
+// Register returns the value of general purpose register R0-R3
+func (c *CPU) Register(index int) uint16 {
+	return uint16(c.gpRegister(index).Value())
+}
+
+// SetRegister puts a value in general purpose register R0-R3
+func (c *CPU) SetRegister(index int, value uint16) {
+	c.gpRegister(index).Load(arch.Word(value))
+}
+
+func (c *CPU) gpRegister(index int) *components.Register {
+	switch index {
+	case 0:
+		return &c.gpReg0
+	case 1:
+		return &c.gpReg1
+	case 2:
+		return &c.gpReg2
+	case 3:
+		return &c.gpReg3
+	}
+	panic(fmt.Sprintf("there is no general purpose register R%d", index))
+}
+
+func (c *CPU) IAR() uint16 {
+	return uint16(c.iar.Value())
+}
+
+func (c *CPU) IR() uint16 {
+	return uint16(c.ir.Value())
+}
+
+// SetIR replaces the instruction in the IR, it is decoded again on the next step
+func (c *CPU) SetIR(value uint16) {
+	c.ir.Load(arch.Word(value))
+}
+
+// Memory returns the CPU's RAM
+func (c *CPU) Memory() *memory.Memory64K {
+	return c.memory
+}
+
+func (c *CPU) SP() uint16 {
+	return uint16(c.sp.Value())
+}
+
+func (c *CPU) Flags() uint16 {
+	return uint16(c.flags.Value())
+}
+
+func (c *CPU) SetFlags(value uint16) {
+	c.flags.Load(arch.Word(value))
+}
+
+// Phase returns the stepper step (1 based) that was run by the last call to Step
+func (c *CPU) Phase() int {
+	for i := 0; i < c.stepper.Steps(); i++ {
+		if c.stepper.GetOutputWire(i) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// InstructionDone is true when the last call to Step ran the final step of an
+// instruction or interrupt cycle, so the next call will start a new one
+func (c *CPU) InstructionDone() bool {
+	phase := c.Phase()
+	switch {
+	case c.interrupts.taken.Get():
+		return phase == INTERRUPT_CYCLE_STEPS
+	case c.stack.longInstruction() || c.interrupts.longInstruction() || c.immediate.longInstruction() || c.indexed.longInstruction():
+		return phase == MAX_INSTRUCTION_STEPS
+	default:
+		return phase == SHORT_INSTRUCTION_STEPS
+	}
+}
+
+// InterruptCycle is true when the last call to Step was part of an interrupt cycle rather
+// than an instruction
+func (c *CPU) InterruptCycle() bool {
+	return c.interrupts.taken.Get()
+}
+
+// ObserveMemory registers a function that is called with the address in MAR whenever
+// RAM is enabled onto the bus (a read) or set from it (a write)
+func (c *CPU) ObserveMemory(observer MemoryObserver) {
+	c.memoryObserver = observer
+}
+
+func (c *CPU) notifyMemoryObserver(write bool) {
+	if c.memoryObserver != nil {
+		c.memoryObserver(uint16(c.memory.AddressRegister.Value()), write)
+	}
+}
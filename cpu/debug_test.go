@@ -0,0 +1,212 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/djhworld/simple-computer/circuit"
+)
+
+func TestRegisterAccessors(t *testing.T) {
+	c := SetUpCPU()
+	BUS.SetValue(0x1234)
+
+	for i := 0; i < 4; i++ {
+		c.SetRegister(i, 0x0100+uint16(i))
+	}
+	c.SetIR(0x0081)
+	c.SetFlags(FLAG_EQUAL | FLAG_ZERO)
+	c.SetIAR(0x0600)
+	c.SetSP(0x3000)
+
+	for i := 0; i < 4; i++ {
+		if c.Register(i) != 0x0100+uint16(i) {
+			t.Logf("expected R%d to be %X but got %X", i, 0x0100+i, c.Register(i))
+			t.FailNow()
+		}
+	}
+	checkIR(c, 0x0081, t)
+	checkIAR(c, 0x0600, t)
+
+	if c.IR() != 0x0081 || c.IAR() != 0x0600 || c.SP() != 0x3000 {
+		t.Logf("expected IR=0081 IAR=0600 SP=3000 but got IR=%X IAR=%X SP=%X", c.IR(), c.IAR(), c.SP())
+		t.FailNow()
+	}
+
+	if c.Flags() != FLAG_EQUAL|FLAG_ZERO {
+		t.Logf("expected flags to be %X but got %X", FLAG_EQUAL|FLAG_ZERO, c.Flags())
+		t.FailNow()
+	}
+}
+
+func TestSetRegisterIsUsedByNextInstruction(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+	setMemoryLocation(c, 0x0500, 0x0081) // ADD R0, R1
+	c.SetIAR(0x0500)
+	c.SetFlags(0x0000)
+	c.SetRegister(0, 0x0002)
+	c.SetRegister(1, 0x0003)
+
+	doFetchDecodeExecute(c)
+
+	if c.Register(1) != 0x0005 {
+		t.Logf("expected R1 to be %X but got %X", 0x0005, c.Register(1))
+		t.FailNow()
+	}
+}
+
+func TestInstructionDone(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+	setMemoryLocation(c, 0x0500, 0x0081) // ADD R0, R1
+	setMemoryLocation(c, 0x0501, 0x0120) // CALL 0x0600
+	setMemoryLocation(c, 0x0502, 0x0600)
+	c.SetIAR(0x0500)
+	c.SetSP(0x3000)
+
+	expected := []bool{
+		false, false, false, false, false, true,
+		false, false, false, false, false, false, false, false, true,
+	}
+	for i, done := range expected {
+		c.Step()
+		phase := i + 1
+		if i >= 6 {
+			phase = i - 5
+		}
+		if c.Phase() != phase {
+			t.Logf("expected step %d but got %d", phase, c.Phase())
+			t.FailNow()
+		}
+		if c.InstructionDone() != done {
+			t.Logf("expected instruction done to be %v after step %d", done, c.Phase())
+			t.FailNow()
+		}
+	}
+	checkIAR(c, 0x0600, t)
+}
+
+func TestObserveMemory(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+	setMemoryLocation(c, 0x0500, 0x0011) // ST R0, R1
+	c.SetIAR(0x0500)
+	c.SetRegister(0, 0x0A00)
+	c.SetRegister(1, 0x00FF)
+
+	var reads, writes []uint16
+	c.ObserveMemory(func(address uint16, write bool) {
+		if write {
+			writes = append(writes, address)
+		} else {
+			reads = append(reads, address)
+		}
+	})
+
+	doFetchDecodeExecute(c)
+
+	if len(reads) != 1 || reads[0] != 0x0500 {
+		t.Logf("expected a read of the instruction at 0500 but got %X", reads)
+		t.FailNow()
+	}
+
+	if len(writes) != 1 || writes[0] != 0x0A00 {
+		t.Logf("expected a write to 0A00 but got %X", writes)
+		t.FailNow()
+	}
+}
+
+func TestSignals(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+	setMemoryLocation(c, 0x0500, 0x0081) // ADD R0, R1
+	c.SetIAR(0x0500)
+	c.SetFlags(0x0000)
+	c.SetRegister(0, 0x0002)
+	c.SetRegister(1, 0x0003)
+
+	signals := c.Signals()
+	for _, path := range []string{"cpu.mainBus", "cpu.stepper.out[3]", "cpu.alu.adder.carry", "cpu.r1.word", "cpu.ram.mar.set", "cpu.interrupts.taken"} {
+		if _, ok := signals.Lookup(path); !ok {
+			t.Logf("expected a signal called %s", path)
+			t.FailNow()
+		}
+	}
+	if r1, _ := signals.Lookup("cpu.r1.word"); r1.Value() != 0x0003 {
+		t.Logf("expected cpu.r1.word to be 3 but got %d", r1.Value())
+		t.FailNow()
+	}
+
+	// everything seen on each signal while the instruction runs
+	seen := make(map[string]map[uint64]bool)
+	samples := 0
+	c.ObserveSignals(func() {
+		samples++
+		for _, s := range signals.Signals() {
+			if seen[s.Path] == nil {
+				seen[s.Path] = make(map[uint64]bool)
+			}
+			seen[s.Path][s.Value()] = true
+		}
+	})
+	doFetchDecodeExecute(c)
+	c.ObserveSignals(nil)
+
+	// an enable and a set phase for each half of the clock
+	if samples != SHORT_INSTRUCTION_STEPS*4 {
+		t.Logf("expected %d samples but got %d", SHORT_INSTRUCTION_STEPS*4, samples)
+		t.FailNow()
+	}
+	for _, path := range []string{"cpu.clock", "cpu.ir.set", "cpu.r1.enable", "cpu.r1.set", "cpu.acc.set", "cpu.busOne.enable"} {
+		if !seen[path][1] {
+			t.Logf("expected %s to be on at some point", path)
+			t.FailNow()
+		}
+	}
+	if seen["cpu.ram.set"][1] {
+		t.Logf("expected cpu.ram.set to stay off")
+		t.FailNow()
+	}
+	// out[0] is step 1, the stepper never gets to step 7 on a short instruction
+	if !seen["cpu.stepper.out"][1<<9] || !seen["cpu.stepper.out"][1<<4] || seen["cpu.stepper.out"][1<<3] {
+		t.Logf("expected the stepper to go through steps 1 to 6 but got %v", seen["cpu.stepper.out"])
+		t.FailNow()
+	}
+	if !seen["cpu.mainBus"][0x0005] || !seen["cpu.r1.word"][0x0005] || !seen["cpu.alu.op"][0] {
+		t.Logf("expected the ALU to add and the sum to be on the main bus and in R1")
+		t.FailNow()
+	}
+
+	doFetchDecodeExecute(c)
+	if samples != SHORT_INSTRUCTION_STEPS*4 {
+		t.Logf("expected no samples once the observer is removed")
+		t.FailNow()
+	}
+}
+
+func TestSubscribeToSignal(t *testing.T) {
+	ClearMem()
+	c := SetUpCPU()
+	setMemoryLocation(c, 0x0500, 0x0081) // ADD R0, R1
+	c.SetIAR(0x0500)
+
+	var phases []int
+	cancel, err := c.Signals().Subscribe("cpu.r1.set", func(s *circuit.Signal) {
+		if s.Value() == 1 {
+			phases = append(phases, c.Phase())
+		}
+	})
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	doFetchDecodeExecute(c)
+	cancel()
+	doFetchDecodeExecute(c)
+
+	// ADD stores the result in register B on step 6
+	if len(phases) != 1 || phases[0] != 6 {
+		t.Logf("expected R1 to be set once on step 6 but got %v", phases)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,535 @@
+package cpu
+
+import (
+	"fmt"
+
+	"github.com/djhworld/simple-computer/alu"
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/io"
+	"github.com/djhworld/simple-computer/utils"
+)
+
+// flags register layout, the same as the gate level FLAGS register
+const (
+	FLAG_CARRY    = uint16(0x8000)
+	FLAG_A_LARGER = uint16(0x4000)
+	FLAG_EQUAL    = uint16(0x2000)
+	FLAG_ZERO     = uint16(0x1000)
+)
+
+const (
+	SHORT_INSTRUCTION_STEPS = 6
+	INTERRUPT_CYCLE_STEPS   = 8
+)
+
+// FastCPU is a behavioural implementation of the CPU, it uses plain registers and memory
+// rather than gates but runs the same instruction set with the same flags, and takes the
+// same number of steps for each instruction. The whole instruction is executed on its
+// last step so the state only matches the gate level CPU between instructions
+type FastCPU struct {
+	gpReg [4]uint16
+	ir    uint16
+	iar   uint16
+	sp    uint16
+	flags uint16
+
+	memory [65536]uint16
+
+	step              int
+	instructionLength int
+	interrupting      bool
+	interruptLine     uint16
+	interruptsEnabled bool
+	halted            bool
+	irqLines          [IRQ_LINES]circuit.Wire
+
+	mainBus        *components.Bus
+	ioBus          *components.IOBus
+	peripherals    []io.Peripheral
+	memoryObserver MemoryObserver
+}
+
+func NewFastCPU(mainBus *components.Bus) *FastCPU {
+	c := new(FastCPU)
+	c.mainBus = mainBus
+	c.ioBus = components.NewIOBus()
+	c.peripherals = make([]io.Peripheral, 0)
+	return c
+}
+
+func (c *FastCPU) ConnectPeripheral(p io.Peripheral) {
+	p.Connect(c.ioBus, c.mainBus)
+	c.peripherals = append(c.peripherals, p)
+}
+
+func (c *FastCPU) ConnectIRQ(line int, source io.InterruptSource) {
+	source.ConnectIRQ(&c.irqLines[line])
+}
+
+func (c *FastCPU) SetIAR(address uint16) {
+	c.iar = address
+	c.halted = false
+}
+
+func (c *FastCPU) SetSP(address uint16) {
+	c.sp = address
+}
+
+func (c *FastCPU) ReadMemory(address uint16) uint16 {
+	return c.memory[address]
+}
+
+func (c *FastCPU) WriteMemory(address uint16, value uint16) {
+	c.memory[address] = value
+}
+
+func (c *FastCPU) InterruptsEnabled() bool {
+	return c.interruptsEnabled
+}
+
+func (c *FastCPU) Halted() bool {
+	return c.halted
+}
+
+func (c *FastCPU) Register(index int) uint16 {
+	return c.gpReg[index]
+}
+
+func (c *FastCPU) SetRegister(index int, value uint16) {
+	c.gpReg[index] = value
+}
+
+func (c *FastCPU) IAR() uint16 {
+	return c.iar
+}
+
+func (c *FastCPU) IR() uint16 {
+	return c.ir
+}
+
+func (c *FastCPU) SetIR(value uint16) {
+	c.ir = value
+}
+
+func (c *FastCPU) SP() uint16 {
+	return c.sp
+}
+
+func (c *FastCPU) Flags() uint16 {
+	return c.flags
+}
+
+func (c *FastCPU) SetFlags(value uint16) {
+	c.flags = value
+}
+
+func (c *FastCPU) Phase() int {
+	if c.step == 0 {
+		return c.instructionLength
+	}
+	return c.step
+}
+
+func (c *FastCPU) InstructionDone() bool {
+	return c.step == 0
+}
+
+func (c *FastCPU) InterruptCycle() bool {
+	return c.interrupting
+}
+
+func (c *FastCPU) ObserveMemory(observer MemoryObserver) {
+	c.memoryObserver = observer
+}
+
+func (c *FastCPU) Step() {
+	if c.halted {
+		// the gate level CPU still updates its peripherals with the clock cut off
+		c.updatePeripherals()
+		return
+	}
+
+	if c.step == 0 {
+		c.begin()
+	}
+	c.step++
+
+	if c.step == c.instructionLength {
+		c.execute()
+		c.step = 0
+	}
+
+	c.updatePeripherals()
+}
+
+func (c *FastCPU) String() string {
+	stepper := ""
+	for i := 1; i <= MAX_INSTRUCTION_STEPS; i++ {
+		if i == c.step {
+			stepper += "* "
+		} else {
+			stepper += "- "
+		}
+	}
+
+	return fmt.Sprintf("STEPPER: %s\nIAR: %s\nSP: %s\nIR: %s\nR0: %s\nR1: %s\nR2: %s\nR3: %s\nFLAGS: %s\n",
+		stepper,
+		utils.ValueToString(c.iar),
+		utils.ValueToString(c.sp),
+		utils.ValueToString(c.ir),
+		utils.ValueToString(c.gpReg[0]),
+		utils.ValueToString(c.gpReg[1]),
+		utils.ValueToString(c.gpReg[2]),
+		utils.ValueToString(c.gpReg[3]),
+		utils.ValueToString(c.flags),
+	)
+}
+
+// begin runs at step 1, it either starts an interrupt cycle or fetches the next instruction
+func (c *FastCPU) begin() {
+	c.interrupting = false
+	if c.interruptsEnabled {
+		for line := range c.irqLines {
+			if c.irqLines[line].Get() {
+				c.interrupting = true
+				c.interruptLine = uint16(line)
+				c.instructionLength = INTERRUPT_CYCLE_STEPS
+				return
+			}
+		}
+	}
+
+	c.ir = c.read(c.iar)
+	c.iar++
+
+	c.instructionLength = SHORT_INSTRUCTION_STEPS
+	if (c.opcodeGroup() == OPCODE_GROUP_STACK || c.opcodeGroup() == OPCODE_GROUP_INTERRUPT) && c.selector() == 2 {
+		// CALL and IRET
+		c.instructionLength = MAX_INSTRUCTION_STEPS
+	}
+	if c.opcodeGroup() == OPCODE_GROUP_IMMEDIATE && c.ir&0x0080 != 0 {
+		c.instructionLength = MAX_INSTRUCTION_STEPS
+	}
+	if c.opcodeGroup() == OPCODE_GROUP_INDEXED && (c.selector() == 0 || c.selector() == 1) {
+		// loads and stores with an offset
+		c.instructionLength = MAX_INSTRUCTION_STEPS
+	}
+}
+
+func (c *FastCPU) execute() {
+	if c.interrupting {
+		c.push(c.iar)
+		c.push(c.flags)
+		c.interruptsEnabled = false
+		c.iar = c.read(INTERRUPT_VECTOR_TABLE + c.interruptLine)
+		return
+	}
+
+	switch c.opcodeGroup() {
+	case OPCODE_GROUP_LEGACY:
+		c.executeLegacy()
+	case OPCODE_GROUP_STACK:
+		c.executeStack()
+	case OPCODE_GROUP_INTERRUPT:
+		c.executeInterrupt()
+	case OPCODE_GROUP_ARITHMETIC:
+		c.executeArithmetic()
+	case OPCODE_GROUP_IMMEDIATE:
+		c.executeImmediate()
+	case OPCODE_GROUP_INDEXED:
+		c.executeIndexed()
+	}
+}
+
+// opcodeGroup is selected by bits 5-7 of the upper byte, -1 if any of bits 0-4 are set
+func (c *FastCPU) opcodeGroup() int {
+	if c.ir&0xF800 != 0 {
+		return -1
+	}
+	return int(c.ir >> 8)
+}
+
+func (c *FastCPU) registerA() *uint16 {
+	return &c.gpReg[(c.ir>>2)&0x0003]
+}
+
+func (c *FastCPU) registerB() *uint16 {
+	return &c.gpReg[c.ir&0x0003]
+}
+
+// selector is the output of the instruction decoder, -1 if bit 0 of the lower byte is set
+func (c *FastCPU) selector() int {
+	if c.ir&0x0080 != 0 {
+		return -1
+	}
+	return int(c.ir>>4) & 0x0007
+}
+
+func (c *FastCPU) executeLegacy() {
+	if c.ir&0x0080 != 0 {
+		c.executeALU(int(c.ir>>4) & 0x0007)
+		return
+	}
+
+	switch c.selector() {
+	case 0: // LD
+		*c.registerB() = c.read(*c.registerA())
+	case 1: // ST
+		c.write(*c.registerA(), *c.registerB())
+	case 2: // DATA, or HALT if any of the register A bits are set
+		if c.ir&0x000C != 0 {
+			c.halted = true
+			return
+		}
+		*c.registerB() = c.read(c.iar)
+		c.iar++
+	case 3: // JR
+		c.iar = *c.registerB()
+	case 4: // JMP
+		c.iar = c.read(c.iar)
+	case 5: // JMP(CAEZ)
+		if (c.flags>>12)&c.ir&0x000F != 0 {
+			c.iar = c.read(c.iar)
+		} else {
+			c.iar++
+		}
+	case 6: // CLF
+		c.flags = 0x0000
+	case 7: // IN/OUT
+		if c.ir&0x0008 != 0 {
+			c.output()
+		} else {
+			c.input()
+		}
+	}
+}
+
+// executeALU works out the flags the same way as the ALU and control unit. The FLAGS
+// register is set before the carry in reaches the ALU, so the carry and zero flags come
+// from the operation without the carry in, while register B gets the result with it.
+// The carry flag is only driven by ADD, SHR and SHL, it is cleared by everything else
+func (c *FastCPU) executeALU(op int) {
+	result := c.runALU(op, *c.registerA(), *c.registerB(), uint16(c.carry()))
+	if op != alu.CMP {
+		*c.registerB() = result
+	}
+}
+
+// runALU runs an ALU operation, sets the flags from it and returns the result
+func (c *FastCPU) runALU(op int, a, b, carryIn uint16) uint16 {
+	var result, flagsResult uint16
+	carry := false
+	switch op {
+	case alu.ADD:
+		flagsResult = a + b
+		result = flagsResult + carryIn
+		carry = uint32(a)+uint32(b) > 0xFFFF
+	case alu.SHR:
+		flagsResult = a >> 1
+		result = flagsResult | carryIn<<15
+		carry = a&0x0001 != 0
+	case alu.SHL:
+		flagsResult = a << 1
+		result = flagsResult | carryIn
+		carry = a&0x8000 != 0
+	case alu.NOT:
+		flagsResult = ^a
+	case alu.AND:
+		flagsResult = a & b
+	case alu.OR:
+		flagsResult = a | b
+	case alu.XOR:
+		flagsResult = a ^ b
+	}
+	if op > alu.SHL {
+		result = flagsResult
+	}
+
+	var flags uint16
+	if carry {
+		flags |= FLAG_CARRY
+	}
+	if a > b {
+		flags |= FLAG_A_LARGER
+	}
+	if a == b {
+		flags |= FLAG_EQUAL
+	}
+	if flagsResult == 0 && op != alu.CMP {
+		flags |= FLAG_ZERO
+	}
+	c.flags = flags
+	return result
+}
+
+// executeArithmetic runs SUB, ADC and SBB. Register B is on the ALU's A input and register
+// A on its B input, and unlike ADD the flags are worked out with the carry in
+func (c *FastCPU) executeArithmetic() {
+	a := uint32(*c.registerB())
+	b := uint32(*c.registerA())
+
+	var sum uint32
+	switch c.selector() {
+	case 0: // SUB
+		sum = a + (^b & 0xFFFF) + 1
+	case 1: // ADC
+		sum = a + b + c.carry()
+	case 2: // SBB
+		sum = a + (^b & 0xFFFF) + c.carry()
+	default:
+		return
+	}
+
+	var flags uint16
+	if sum > 0xFFFF {
+		flags |= FLAG_CARRY
+	}
+	if a > b {
+		flags |= FLAG_A_LARGER
+	}
+	if a == b {
+		flags |= FLAG_EQUAL
+	}
+	if uint16(sum) == 0 {
+		flags |= FLAG_ZERO
+	}
+	c.flags = flags
+	*c.registerB() = uint16(sum)
+}
+
+// executeImmediate runs MOV and the immediate instructions, which put register B on the
+// ALU's A input and the word after the instruction on its B input with no carry in
+func (c *FastCPU) executeImmediate() {
+	if c.ir&0x0080 == 0 {
+		if c.selector() == 0 {
+			*c.registerB() = *c.registerA()
+		}
+		return
+	}
+
+	op := int(c.ir>>4) & 0x0007
+	value := c.read(c.iar)
+	c.iar++
+	result := c.runALU(op, *c.registerB(), value, 0)
+	if op != alu.CMP {
+		*c.registerB() = result
+	}
+}
+
+// executeIndexed runs the loads and stores with an offset or a post increment, the register
+// A increment is written back last
+func (c *FastCPU) executeIndexed() {
+	switch c.selector() {
+	case 0: // LD Rb, [Ra + value]
+		address := *c.registerA() + c.read(c.iar)
+		c.iar++
+		*c.registerB() = c.read(address)
+	case 1: // ST [Ra + value], Rb
+		address := *c.registerA() + c.read(c.iar)
+		c.iar++
+		c.write(address, *c.registerB())
+	case 2: // LD Rb, [Ra]+
+		address := *c.registerA()
+		*c.registerB() = c.read(address)
+		*c.registerA() = address + 1
+	case 3: // ST [Ra]+, Rb
+		address := *c.registerA()
+		c.write(address, *c.registerB())
+		*c.registerA() = address + 1
+	}
+}
+
+func (c *FastCPU) carry() uint32 {
+	if c.flags&FLAG_CARRY != 0 {
+		return 1
+	}
+	return 0
+}
+
+func (c *FastCPU) executeStack() {
+	switch c.selector() {
+	case 0: // PUSH
+		c.push(*c.registerB())
+	case 1: // POP
+		*c.registerB() = c.pop()
+	case 2: // CALL
+		c.push(c.iar + 1)
+		c.iar = c.read(c.iar)
+	case 3: // RET
+		c.iar = c.pop()
+	}
+}
+
+func (c *FastCPU) executeInterrupt() {
+	switch c.selector() {
+	case 0: // EI
+		c.interruptsEnabled = true
+	case 1: // DI
+		c.interruptsEnabled = false
+	case 2: // IRET
+		c.flags = c.pop()
+		c.iar = c.pop()
+		c.interruptsEnabled = true
+	}
+}
+
+func (c *FastCPU) push(value uint16) {
+	c.sp--
+	c.write(c.sp, value)
+}
+
+func (c *FastCPU) pop() uint16 {
+	value := c.read(c.sp)
+	c.sp++
+	return value
+}
+
+// read and write are the memory accesses made by instructions, unlike ReadMemory
+// and WriteMemory they are passed on to the memory observer
+func (c *FastCPU) read(address uint16) uint16 {
+	if c.memoryObserver != nil {
+		c.memoryObserver(address, false)
+	}
+	return c.memory[address]
+}
+
+func (c *FastCPU) write(address uint16, value uint16) {
+	if c.memoryObserver != nil {
+		c.memoryObserver(address, true)
+	}
+	c.memory[address] = value
+}
+
+// output and input drive the IO bus the same way the control unit does so the
+// peripherals cannot tell which core they are connected to
+func (c *FastCPU) output() {
+	c.ioBus.Update(true, c.ir&0x0004 != 0)
+	c.mainBus.SetValue(arch.Word(*c.registerB()))
+
+	c.ioBus.Set()
+	c.updatePeripherals()
+	c.ioBus.Unset()
+	c.updatePeripherals()
+
+	c.mainBus.SetValue(0x0000)
+}
+
+func (c *FastCPU) input() {
+	c.ioBus.Update(false, c.ir&0x0004 != 0)
+
+	c.ioBus.Enable()
+	c.updatePeripherals()
+	c.ioBus.Disable()
+	c.updatePeripherals()
+
+	*c.registerB() = uint16(c.mainBus.Value())
+	c.mainBus.SetValue(0x0000)
+}
+
+func (c *FastCPU) updatePeripherals() {
+	for _, p := range c.peripherals {
+		p.Update()
+	}
+}
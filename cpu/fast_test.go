@@ -0,0 +1,257 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/io"
+)
+
+// the differential tests run the same instructions through the gate level CPU and
+// the FastCPU and check the register, flag and memory state after each one
+
+const PROGRAM_INSTRUCTIONS = 1500
+
+type coreState struct {
+	registers         [4]uint16
+	iar               uint16
+	sp                uint16
+	flags             uint16
+	interruptsEnabled bool
+	halted            bool
+}
+
+func gateCoreState(c *CPU) coreState {
+	return coreState{
+		registers:         [4]uint16{uint16(c.gpReg0.Value()), uint16(c.gpReg1.Value()), uint16(c.gpReg2.Value()), uint16(c.gpReg3.Value())},
+		iar:               uint16(c.iar.Value()),
+		sp:                uint16(c.sp.Value()),
+		flags:             uint16(c.flags.Value()),
+		interruptsEnabled: c.InterruptsEnabled(),
+		halted:            c.Halted(),
+	}
+}
+
+func fastCoreState(c *FastCPU) coreState {
+	return coreState{
+		registers:         c.gpReg,
+		iar:               c.iar,
+		sp:                c.sp,
+		flags:             c.flags,
+		interruptsEnabled: c.interruptsEnabled,
+		halted:            c.halted,
+	}
+}
+
+func TestFastCPUMatchesCPUForEveryOpcode(t *testing.T) {
+	opcodes := []uint16{0x0380, 0x0580, 0x0600, 0x0800, 0x8000, 0xFFFF}
+	for opcode := uint16(0x0000); opcode <= 0x00FF; opcode++ {
+		opcodes = append(opcodes, opcode)
+	}
+	for opcode := uint16(0x0100); opcode <= 0x013F; opcode++ {
+		opcodes = append(opcodes, opcode)
+	}
+	for opcode := uint16(0x0200); opcode <= 0x023F; opcode++ {
+		opcodes = append(opcodes, opcode)
+	}
+	for opcode := uint16(0x0300); opcode <= 0x033F; opcode++ {
+		opcodes = append(opcodes, opcode)
+	}
+	for opcode := uint16(0x0400); opcode <= 0x043F; opcode++ {
+		opcodes = append(opcodes, opcode)
+	}
+	for opcode := uint16(0x0480); opcode <= 0x04FF; opcode++ {
+		opcodes = append(opcodes, opcode)
+	}
+	for opcode := uint16(0x0500); opcode <= 0x053F; opcode++ {
+		opcodes = append(opcodes, opcode)
+	}
+
+	setups := []struct {
+		registers [4]uint16
+		flags     uint16
+	}{
+		{[4]uint16{0x1234, 0x8001, 0x0F0F, 0xFFFF}, 0x0000},
+		{[4]uint16{0x0000, 0x0001, 0x7FFF, 0x8000}, FLAG_CARRY},
+		{[4]uint16{0xAAAA, 0x5555, 0x00FF, 0x0002}, FLAG_CARRY | FLAG_A_LARGER | FLAG_EQUAL | FLAG_ZERO},
+	}
+
+	for _, opcode := range opcodes {
+		for _, setup := range setups {
+			gate := SetUpCPU()
+			gate.ConnectPeripheral(NewDumbPeripheral())
+			fast := NewFastCPU(components.NewBus(arch.BUS_WIDTH))
+			fast.ConnectPeripheral(NewDumbPeripheral())
+
+			for _, core := range []Core{gate, fast} {
+				core.WriteMemory(0x0500, opcode)
+				core.WriteMemory(0x0501, 0x0A00)
+				for _, value := range setup.registers {
+					core.WriteMemory(value, value^0x5A5A)
+					// where the indexed loads and stores go, 0x0A00 is the second word
+					core.WriteMemory(value+0x0A00, value^0xA5A5)
+				}
+				core.WriteMemory(0x3000, 0x1111)
+				core.WriteMemory(0x3001, 0x2222)
+				core.SetIAR(0x0500)
+				core.SetSP(0x3000)
+			}
+			setRegisters(gate, setup.registers)
+			setFlagsRegister(gate, setup.flags)
+			fast.gpReg = setup.registers
+			fast.flags = setup.flags
+
+			runDifferential(gate, fast, 1, t)
+		}
+	}
+}
+
+func TestFastCPUMatchesCPUForPrograms(t *testing.T) {
+	programs, err := filepath.Glob("../_programs/*.bin")
+	if err != nil || len(programs) == 0 {
+		t.Logf("could not find any programs: %v", err)
+		t.FailNow()
+	}
+	if testing.Short() {
+		// each program takes a few seconds on the gate level CPU
+		programs = programs[:1]
+	}
+
+	for _, program := range programs {
+		t.Logf("running %s", program)
+		bin := readProgram(program, t)
+
+		ClearMem()
+		gate := SetUpCPU()
+		fast := NewFastCPU(components.NewBus(arch.BUS_WIDTH))
+
+		var keyboards []*io.KeyboardAdapter
+		for _, core := range []Core{gate, fast} {
+			keyboard := io.NewKeyboardAdapter()
+			core.ConnectPeripheral(keyboard)
+			core.ConnectIRQ(0, keyboard)
+			core.ConnectPeripheral(io.NewDisplaydAdapter())
+			keyboards = append(keyboards, keyboard)
+
+			for i, value := range bin {
+				core.WriteMemory(0x0500+uint16(i), value)
+			}
+			core.WriteMemory(0xFEFE, 0x0040)
+			core.WriteMemory(0xFEFF, 0x0500)
+			core.SetIAR(0x0500)
+			core.SetSP(0xFEFE)
+		}
+		// the gate level registers settle to 0xFFFF the first time they update unless
+		// they have been set, so start both cores from zero
+		setRegisters(gate, [4]uint16{})
+
+		runDifferential(gate, fast, PROGRAM_INSTRUCTIONS/2, t)
+
+		// press a key halfway through
+		for _, keyboard := range keyboards {
+			keyboard.KeyboardInBus.SetValue(0x0041)
+		}
+		runDifferential(gate, fast, PROGRAM_INSTRUCTIONS/2, t)
+
+		for address := 0; address <= 0xFFFF; address++ {
+			checkCoreMemory(gate, fast, uint16(address), t)
+		}
+	}
+}
+
+type memoryAccess struct {
+	address uint16
+	write   bool
+}
+
+// runDifferential steps both cores until the FastCPU has run the given number of
+// instructions, comparing their state and the memory they accessed after each one
+func runDifferential(gate *CPU, fast *FastCPU, instructions int, t *testing.T) {
+	var before [65536]uint16
+	var gateAccesses, fastAccesses []memoryAccess
+	gate.ObserveMemory(func(address uint16, write bool) {
+		gateAccesses = append(gateAccesses, memoryAccess{address, write})
+	})
+	fast.ObserveMemory(func(address uint16, write bool) {
+		fastAccesses = append(fastAccesses, memoryAccess{address, write})
+	})
+
+	for i := 0; i < instructions; i++ {
+		before = fast.memory
+		gateAccesses, fastAccesses = nil, nil
+		for {
+			gate.Step()
+			fast.Step()
+			if gate.InstructionDone() != fast.InstructionDone() {
+				t.Logf("instruction %X at %X: fast core finished %v but gate level finished %v at step %d", fast.ir, fast.iar, fast.InstructionDone(), gate.InstructionDone(), gate.Phase())
+				t.FailNow()
+			}
+			if gate.InterruptCycle() != fast.InterruptCycle() {
+				t.Logf("instruction %X at %X: fast core interrupt cycle %v but gate level %v at step %d", fast.ir, fast.iar, fast.InterruptCycle(), gate.InterruptCycle(), gate.Phase())
+				t.FailNow()
+			}
+			if fast.InstructionDone() {
+				break
+			}
+		}
+
+		if expected, got := fastCoreState(fast), gateCoreState(gate); expected != got {
+			t.Logf("instruction %X at %X: fast core state %+v but gate level state %+v", fast.ir, fast.iar, expected, got)
+			t.FailNow()
+		}
+
+		if !reflect.DeepEqual(fastAccesses, gateAccesses) {
+			t.Logf("instruction %X at %X: fast core accessed memory %+v but gate level accessed %+v", fast.ir, fast.iar, fastAccesses, gateAccesses)
+			t.FailNow()
+		}
+
+		for address := range before {
+			if before[address] != fast.memory[address] {
+				checkCoreMemory(gate, fast, uint16(address), t)
+			}
+		}
+		checkCoreMemory(gate, fast, uint16(gate.memory.AddressRegister.Value()), t)
+	}
+}
+
+func checkCoreMemory(gate *CPU, fast *FastCPU, address uint16, t *testing.T) {
+	if expected, got := fast.ReadMemory(address), gate.ReadMemory(address); expected != got {
+		t.Logf("memory location %X is %X on the fast core but %X on the gate level core", address, expected, got)
+		t.FailNow()
+	}
+}
+
+func setFlagsRegister(c *CPU, value uint16) {
+	c.flagsInBus.SetValue(arch.Word(value))
+	c.flags.Set()
+	c.flags.Update()
+	c.flags.Unset()
+	c.flags.Update()
+}
+
+func readProgram(filename string, t *testing.T) []uint16 {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Logf("could not open %s: %v", filename, err)
+		t.FailNow()
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		t.Logf("could not stat %s: %v", filename, err)
+		t.FailNow()
+	}
+
+	bin := make([]uint16, stat.Size()/2)
+	if err := binary.Read(f, binary.LittleEndian, &bin); err != nil {
+		t.Logf("could not read %s: %v", filename, err)
+		t.FailNow()
+	}
+	return bin
+}
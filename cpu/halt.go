@@ -0,0 +1,90 @@
+package cpu
+
+import (
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/components"
+)
+
+// HALT
+// HALT shares its selector with DATA, which only uses the register B bits, so DATA
+// with any of the register A bits set halts instead. It runs as a 6 step instruction
+// and on step 6 the halted bit is set, which cuts the clock off from the stepper and
+// the control unit so the CPU stays on step 6 of the HALT until SetIAR restarts it.
+// interrupts cannot wake a halted CPU as they are only latched on step 1
+// ----------------------
+// 0x0024 = HALT (0x0025 - 0x002F also halt)
+
+// haltControl is the part of the control unit that decodes HALT and gates the clock
+type haltControl struct {
+	registerAORGate  circuit.ORGate
+	registerANOTGate circuit.NOTGate
+	haltGate         circuit.ANDGate
+	dataGate         circuit.ANDGate
+
+	step6Gate circuit.ANDGate
+	setGate   circuit.ANDGate
+	halted    components.Bit
+
+	haltedNOTGate circuit.NOTGate
+	clockANDGate  circuit.ANDGate
+}
+
+func newHaltControl() *haltControl {
+	h := new(haltControl)
+
+	h.registerAORGate = *circuit.NewORGate()
+	h.registerANOTGate = *circuit.NewNOTGate()
+	h.haltGate = *circuit.NewANDGate()
+	h.dataGate = *circuit.NewANDGate()
+
+	h.step6Gate = *circuit.NewANDGate()
+	h.setGate = *circuit.NewANDGate()
+	h.halted = *components.NewBit()
+	h.halted.Update(false, true)
+	h.halted.Update(false, false)
+
+	h.haltedNOTGate = *circuit.NewNOTGate()
+	h.haltedNOTGate.Update(h.halted.Get())
+	h.clockANDGate = *circuit.NewANDGate()
+
+	return h
+}
+
+// haltClock passes the clock through unless the CPU is halted
+func (c *CPU) haltClock(clockState bool) bool {
+	h := &c.halt
+	h.haltedNOTGate.Update(h.halted.Get())
+	h.clockANDGate.Update(clockState, h.haltedNOTGate.Output())
+	return h.clockANDGate.Output()
+}
+
+// runHaltGates splits the DATA selector into DATA and HALT, it has to run before the
+// step 4, 5 and 6 gates as DATA is wired up through them
+func (c *CPU) runHaltGates() {
+	h := &c.halt
+
+	h.registerAORGate.Update(c.irBit(12), c.irBit(13))
+	h.registerANOTGate.Update(h.registerAORGate.Output())
+	h.haltGate.Update(c.instrDecoder3x8.selectorGates[2].Output(), h.registerAORGate.Output())
+	h.dataGate.Update(c.instrDecoder3x8.selectorGates[2].Output(), h.registerANOTGate.Output())
+
+	h.step6Gate.Update(c.legacyStepGates[2].Output(), h.haltGate.Output())
+}
+
+func (c *CPU) runSetOnHalted(state bool) {
+	h := &c.halt
+	h.setGate.Update(state, h.step6Gate.Output())
+	h.halted.Update(true, h.setGate.Output())
+}
+
+// Halted returns true once a HALT instruction has run, Step does nothing until SetIAR is called
+func (c *CPU) Halted() bool {
+	return c.halt.halted.Get()
+}
+
+func (c *CPU) clearHalted() {
+	h := &c.halt
+	h.halted.Update(false, true)
+	h.halted.Update(false, false)
+	h.haltedNOTGate.Update(h.halted.Get())
+}
@@ -0,0 +1,156 @@
+package cpu
+
+import (
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/components"
+)
+
+// MOVE AND IMMEDIATE
+// MOV copies register A into register B without going through RAM
+// ----------------------
+// 0x0400 = MOV R0, R0 (register B = register A)
+// ...
+// 0x040F = MOV R3, R3
+
+// the immediate instructions are 2 byte instructions that run an ALU operation on register B
+// and the word after the instruction, which is read into TMP the same way DATA reads it. The
+// lower byte is the same as the ALU instruction they mirror with the register A bits clear,
+// so the ALU op comes straight from the IR. Like CMP, CMPI only sets the flags
+// ----------------------
+// 0x0480 = ADDI R0, <value> (register B = register B + value)
+// ...
+// 0x0483 = ADDI R3, <value>
+
+// 0x04C0 = ANDI R0, <value>
+// 0x04D0 = ORI R0, <value>
+// 0x04E0 = XORI R0, <value>
+// 0x04F0 = CMPI R0, <value>
+
+// unlike ADD there is no carry in to ADDI. Register B is on the ALU's A input, so the A flag
+// is set when register B is larger than the value. The shift and NOT ops in this group ignore
+// the value, the assembler has no mnemonics for them
+
+// immediateControl is the part of the control unit that wires up MOV and the immediate
+// instructions, each of its outputs is ORed into the matching control line
+type immediateControl struct {
+	movGate       circuit.ANDGate
+	immediateGate circuit.ANDGate
+	cmpGate       components.ANDGate3
+	notCMPGate    circuit.NOTGate
+
+	movStep4Gate       circuit.ANDGate
+	immediateStepGates [5]circuit.ANDGate
+	writeBackGate      circuit.ANDGate
+
+	accSetORGate       circuit.ORGate
+	accEnableORGate    circuit.ORGate
+	registerBSetORGate circuit.ORGate
+}
+
+func newImmediateControl() *immediateControl {
+	m := new(immediateControl)
+
+	m.movGate = *circuit.NewANDGate()
+	m.immediateGate = *circuit.NewANDGate()
+	m.cmpGate = *components.NewANDGate3()
+	m.notCMPGate = *circuit.NewNOTGate()
+
+	m.movStep4Gate = *circuit.NewANDGate()
+	for i := range m.immediateStepGates {
+		m.immediateStepGates[i] = *circuit.NewANDGate()
+	}
+	m.writeBackGate = *circuit.NewANDGate()
+
+	m.accSetORGate = *circuit.NewORGate()
+	m.accEnableORGate = *circuit.NewORGate()
+	m.registerBSetORGate = *circuit.NewORGate()
+
+	return m
+}
+
+// runImmediateGates works out whether MOV or an immediate instruction is in the IR and
+// drives the control lines for the current step
+func (c *CPU) runImmediateGates() {
+	m := &c.immediate
+	group := c.opcodeGroupGates[OPCODE_GROUP_IMMEDIATE].Output()
+
+	m.movGate.Update(group, c.instrDecoder3x8.selectorGates[0].Output())
+	m.immediateGate.Update(group, c.irBit(8))
+	m.cmpGate.Update(c.irBit(9), c.irBit(10), c.irBit(11))
+	m.notCMPGate.Update(m.cmpGate.Output())
+
+	// MOV step 4: register A -> register B
+	m.movStep4Gate.Update(c.stepper.GetOutputWire(3), m.movGate.Output())
+
+	// step 4: BUS1, IAR -> ALU -> ACC, IAR -> MAR
+	// step 5: RAM -> TMP
+	// step 6: ACC -> IAR
+	// step 7: register B -> ALU -> ACC, and FLAGS
+	// step 8: ACC -> register B (not for CMPI)
+	for i := range m.immediateStepGates {
+		m.immediateStepGates[i].Update(c.stepper.GetOutputWire(3+i), m.immediateGate.Output())
+	}
+	m.writeBackGate.Update(m.immediateStepGates[4].Output(), m.notCMPGate.Output())
+
+	m.accSetORGate.Update(m.immediateStepGates[0].Output(), m.immediateStepGates[3].Output())
+	m.accEnableORGate.Update(m.immediateStepGates[2].Output(), m.writeBackGate.Output())
+	m.registerBSetORGate.Update(m.movStep4Gate.Output(), m.writeBackGate.Output())
+}
+
+func (m *immediateControl) busOneEnable() bool {
+	return m.immediateStepGates[0].Output()
+}
+
+func (m *immediateControl) iarEnable() bool {
+	return m.immediateStepGates[0].Output()
+}
+
+func (m *immediateControl) marSet() bool {
+	return m.immediateStepGates[0].Output()
+}
+
+func (m *immediateControl) accSet() bool {
+	return m.accSetORGate.Output()
+}
+
+func (m *immediateControl) ramEnable() bool {
+	return m.immediateStepGates[1].Output()
+}
+
+func (m *immediateControl) tmpSet() bool {
+	return m.immediateStepGates[1].Output()
+}
+
+func (m *immediateControl) accEnable() bool {
+	return m.accEnableORGate.Output()
+}
+
+func (m *immediateControl) iarSet() bool {
+	return m.immediateStepGates[2].Output()
+}
+
+func (m *immediateControl) registerAEnable() bool {
+	return m.movStep4Gate.Output()
+}
+
+func (m *immediateControl) registerBEnable() bool {
+	return m.immediateStepGates[3].Output()
+}
+
+func (m *immediateControl) registerBSet() bool {
+	return m.registerBSetORGate.Output()
+}
+
+func (m *immediateControl) flagsSet() bool {
+	return m.immediateStepGates[3].Output()
+}
+
+// aluOp is on while the ALU op in the IR should reach the ALU
+func (m *immediateControl) aluOp() bool {
+	return m.immediateStepGates[3].Output()
+}
+
+// the immediate instructions need steps 7 and 8
+func (m *immediateControl) longInstruction() bool {
+	return m.immediateGate.Output()
+}
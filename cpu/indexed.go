@@ -0,0 +1,192 @@
+package cpu
+
+import (
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/components"
+)
+
+// INDEXED MEMORY
+// loads and stores with the address worked out from register A, which LD and ST can only use
+// as it is. Register B is the register loaded or stored as for LD and ST, in the assembler the
+// address goes in square brackets
+// ----------------------
+// 0x0500 = LD R0, [R0 + <value>] (2 byte instruction, register B = RAM[register A + value])
+// 0x0501 = LD R1, [R0 + <value>]
+// ...
+// 0x050F = LD R3, [R3 + <value>]
+
+// 0x0510 = ST [R0 + <value>], R0 (2 byte instruction, RAM[register A + value] = register B)
+// ...
+// 0x051F = ST [R3 + <value>], R3
+
+// 0x0520 = LD R0, [R0]+ (register B = RAM[register A], then register A = register A + 1)
+// ...
+// 0x052F = LD R3, [R3]+
+
+// 0x0530 = ST [R0]+, R0 (RAM[register A] = register B, then register A = register A + 1)
+// ...
+// 0x053F = ST [R3]+, R3
+
+// the value is added to register A in the ALU the same way the IAR is incremented, so the
+// address wraps around at the end of RAM and the flags are left alone. If register A and B
+// are the same register a post increment load leaves it incremented rather than loaded
+
+// indexedControl is the part of the control unit that wires up the indexed loads and
+// stores, each of its outputs is ORed into the matching control line
+type indexedControl struct {
+	loadGate            circuit.ANDGate
+	storeGate           circuit.ANDGate
+	loadIncrementGate   circuit.ANDGate
+	storeIncrementGate  circuit.ANDGate
+	offsetORGate        circuit.ORGate
+	postIncrementORGate circuit.ORGate
+
+	offsetStepGates         [6]circuit.ANDGate
+	loadStep9Gate           circuit.ANDGate
+	storeStep9Gate          circuit.ANDGate
+	incrementStep4Gate      circuit.ANDGate
+	incrementStep6Gate      circuit.ANDGate
+	loadIncrementStep5Gate  circuit.ANDGate
+	storeIncrementStep5Gate circuit.ANDGate
+
+	loadORGate            circuit.ORGate
+	storeORGate           circuit.ORGate
+	busOneEnableORGate    circuit.ORGate
+	marSetORGate          components.ORGate3
+	accSetORGate          components.ORGate3
+	accEnableORGate       components.ORGate3
+	ramEnableORGate       circuit.ORGate
+	registerAEnableORGate circuit.ORGate
+}
+
+func newIndexedControl() *indexedControl {
+	x := new(indexedControl)
+
+	x.loadGate = *circuit.NewANDGate()
+	x.storeGate = *circuit.NewANDGate()
+	x.loadIncrementGate = *circuit.NewANDGate()
+	x.storeIncrementGate = *circuit.NewANDGate()
+	x.offsetORGate = *circuit.NewORGate()
+	x.postIncrementORGate = *circuit.NewORGate()
+
+	for i := range x.offsetStepGates {
+		x.offsetStepGates[i] = *circuit.NewANDGate()
+	}
+	x.loadStep9Gate = *circuit.NewANDGate()
+	x.storeStep9Gate = *circuit.NewANDGate()
+	x.incrementStep4Gate = *circuit.NewANDGate()
+	x.incrementStep6Gate = *circuit.NewANDGate()
+	x.loadIncrementStep5Gate = *circuit.NewANDGate()
+	x.storeIncrementStep5Gate = *circuit.NewANDGate()
+
+	x.loadORGate = *circuit.NewORGate()
+	x.storeORGate = *circuit.NewORGate()
+	x.busOneEnableORGate = *circuit.NewORGate()
+	x.marSetORGate = *components.NewORGate3()
+	x.accSetORGate = *components.NewORGate3()
+	x.accEnableORGate = *components.NewORGate3()
+	x.ramEnableORGate = *circuit.NewORGate()
+	x.registerAEnableORGate = *circuit.NewORGate()
+
+	return x
+}
+
+// runIndexedGates works out which indexed load or store (if any) is in the IR and drives
+// the control lines for the current step
+func (c *CPU) runIndexedGates() {
+	x := &c.indexed
+	group := c.opcodeGroupGates[OPCODE_GROUP_INDEXED].Output()
+
+	x.loadGate.Update(group, c.instrDecoder3x8.selectorGates[0].Output())
+	x.storeGate.Update(group, c.instrDecoder3x8.selectorGates[1].Output())
+	x.loadIncrementGate.Update(group, c.instrDecoder3x8.selectorGates[2].Output())
+	x.storeIncrementGate.Update(group, c.instrDecoder3x8.selectorGates[3].Output())
+	x.offsetORGate.Update(x.loadGate.Output(), x.storeGate.Output())
+	x.postIncrementORGate.Update(x.loadIncrementGate.Output(), x.storeIncrementGate.Output())
+
+	// step 4: BUS1, IAR -> ALU -> ACC, IAR -> MAR
+	// step 5: RAM -> TMP
+	// step 6: ACC -> IAR
+	// step 7: register A -> ALU (ADD) -> ACC
+	// step 8: ACC -> MAR
+	// step 9: LD: RAM -> register B. ST: register B -> RAM
+	for i := range x.offsetStepGates {
+		x.offsetStepGates[i].Update(c.stepper.GetOutputWire(3+i), x.offsetORGate.Output())
+	}
+	x.loadStep9Gate.Update(x.offsetStepGates[5].Output(), x.loadGate.Output())
+	x.storeStep9Gate.Update(x.offsetStepGates[5].Output(), x.storeGate.Output())
+
+	// step 4: register A -> MAR, BUS1, register A -> ALU -> ACC
+	// step 5: LD: RAM -> register B. ST: register B -> RAM
+	// step 6: ACC -> register A
+	x.incrementStep4Gate.Update(c.stepper.GetOutputWire(3), x.postIncrementORGate.Output())
+	x.incrementStep6Gate.Update(c.stepper.GetOutputWire(5), x.postIncrementORGate.Output())
+	x.loadIncrementStep5Gate.Update(c.stepper.GetOutputWire(4), x.loadIncrementGate.Output())
+	x.storeIncrementStep5Gate.Update(c.stepper.GetOutputWire(4), x.storeIncrementGate.Output())
+
+	x.loadORGate.Update(x.loadStep9Gate.Output(), x.loadIncrementStep5Gate.Output())
+	x.storeORGate.Update(x.storeStep9Gate.Output(), x.storeIncrementStep5Gate.Output())
+	x.busOneEnableORGate.Update(x.offsetStepGates[0].Output(), x.incrementStep4Gate.Output())
+	x.marSetORGate.Update(x.offsetStepGates[0].Output(), x.offsetStepGates[4].Output(), x.incrementStep4Gate.Output())
+	x.accSetORGate.Update(x.offsetStepGates[0].Output(), x.offsetStepGates[3].Output(), x.incrementStep4Gate.Output())
+	x.accEnableORGate.Update(x.offsetStepGates[2].Output(), x.offsetStepGates[4].Output(), x.incrementStep6Gate.Output())
+	x.ramEnableORGate.Update(x.offsetStepGates[1].Output(), x.loadORGate.Output())
+	x.registerAEnableORGate.Update(x.offsetStepGates[3].Output(), x.incrementStep4Gate.Output())
+}
+
+func (x *indexedControl) busOneEnable() bool {
+	return x.busOneEnableORGate.Output()
+}
+
+func (x *indexedControl) iarEnable() bool {
+	return x.offsetStepGates[0].Output()
+}
+
+func (x *indexedControl) marSet() bool {
+	return x.marSetORGate.Output()
+}
+
+func (x *indexedControl) accSet() bool {
+	return x.accSetORGate.Output()
+}
+
+func (x *indexedControl) ramEnable() bool {
+	return x.ramEnableORGate.Output()
+}
+
+func (x *indexedControl) tmpSet() bool {
+	return x.offsetStepGates[1].Output()
+}
+
+func (x *indexedControl) accEnable() bool {
+	return x.accEnableORGate.Output()
+}
+
+func (x *indexedControl) iarSet() bool {
+	return x.offsetStepGates[2].Output()
+}
+
+func (x *indexedControl) registerAEnable() bool {
+	return x.registerAEnableORGate.Output()
+}
+
+func (x *indexedControl) registerASet() bool {
+	return x.incrementStep6Gate.Output()
+}
+
+func (x *indexedControl) registerBEnable() bool {
+	return x.storeORGate.Output()
+}
+
+func (x *indexedControl) registerBSet() bool {
+	return x.loadORGate.Output()
+}
+
+func (x *indexedControl) ramSet() bool {
+	return x.storeORGate.Output()
+}
+
+// the loads and stores with an offset need steps 7, 8 and 9
+func (x *indexedControl) longInstruction() bool {
+	return x.offsetORGate.Output()
+}
@@ -0,0 +1,358 @@
+package cpu
+
+import (
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/io"
+)
+
+// INTERRUPTS
+// peripherals raise one of the IRQ lines and hold it high until serviced.
+// when the stepper wraps around to step 1 and interrupts are enabled, a raised line
+// replaces the next fetch with an interrupt cycle that pushes IAR, then FLAGS, disables
+// interrupts and jumps to the address held in the vector table entry for the line
+// (the lowest numbered line wins if more than one is raised)
+// ----------------------
+// 0x0200 = EI (enable interrupts)
+// 0x0210 = DI (disable interrupts)
+// 0x0220 = IRET (pops FLAGS and IAR, then enables interrupts)
+
+// IRQ_LINES is the number of interrupt request lines peripherals can raise
+const IRQ_LINES = 4
+
+// INTERRUPT_VECTOR_TABLE is the address of the handler address for IRQ line 0, line n is at INTERRUPT_VECTOR_TABLE + n
+const INTERRUPT_VECTOR_TABLE = uint16(0x04FC)
+
+// interruptControl is the interrupt controller plus the part of the control unit that
+// wires up the interrupt cycle and the EI/DI/IRET instructions, each of its outputs
+// is ORed into the matching control line
+type interruptControl struct {
+	irqLines [IRQ_LINES]circuit.Wire
+
+	pendingORGate  components.ORGate4
+	pendingANDGate circuit.ANDGate
+	enabled        components.Bit
+
+	// the interrupt is latched at the start of step 1 and held for the whole cycle
+	latchANDGate circuit.ANDGate
+	taken        components.Bit
+	takenNOTGate circuit.NOTGate
+
+	// priority encoder, picks the lowest raised line
+	lineNOTGates     [3]circuit.NOTGate
+	lineBit1ORGate   circuit.ORGate
+	lineBit1ANDGate  components.ANDGate3
+	lineBit0ANDGates [2]circuit.ANDGate
+	lineBit0ORGate   circuit.ORGate
+	lineBits         [2]components.Bit
+
+	vectorEnabler    components.Enabler
+	vectorEnableGate circuit.ANDGate
+	flagsEnabler     components.Enabler
+	flagsEnableGate  circuit.ANDGate
+
+	// FLAGS normally takes its input from the ALU, IRET restores it from the main bus
+	flagsRestoreNOTGate circuit.NOTGate
+	flagsALUGates       []circuit.ANDGate
+	flagsBusGates       []circuit.ANDGate
+	flagsInORGates      []circuit.ORGate
+
+	eiGate   circuit.ANDGate
+	diGate   circuit.ANDGate
+	iretGate circuit.ANDGate
+
+	entryStepGates [8]circuit.ANDGate
+	iretStepGates  [6]circuit.ANDGate
+	eiStep4Gate    circuit.ANDGate
+	diStep4Gate    circuit.ANDGate
+
+	decrementORGate  circuit.ORGate
+	popAddressORGate circuit.ORGate
+	spEnableORGate   circuit.ORGate
+	spSetORGate      components.ORGate4
+	marSetORGate     components.ORGate4
+	ramEnableORGate  components.ORGate3
+	ramSetORGate     circuit.ORGate
+	iarSetORGate     circuit.ORGate
+
+	enableValueORGate circuit.ORGate
+	enableSetORGate   components.ORGate4
+	enableSetANDGate  circuit.ANDGate
+
+	longInstructionORGate circuit.ORGate
+}
+
+// newInterruptControl builds the interrupt control for a CPU of width bits. On an 8 bit CPU
+// the vector address loses its upper byte, but as EI is an extended instruction that CPU
+// never takes an interrupt
+func newInterruptControl(width int) *interruptControl {
+	n := new(interruptControl)
+
+	n.pendingORGate = *components.NewORGate4()
+	n.pendingANDGate = *circuit.NewANDGate()
+	n.enabled = *components.NewBit()
+	n.enabled.Update(false, true)
+	n.enabled.Update(false, false)
+
+	n.latchANDGate = *circuit.NewANDGate()
+	n.taken = *components.NewBit()
+	n.taken.Update(false, true)
+	n.taken.Update(false, false)
+	n.takenNOTGate = *circuit.NewNOTGate()
+	n.takenNOTGate.Update(n.taken.Get())
+
+	for i := range n.lineNOTGates {
+		n.lineNOTGates[i] = *circuit.NewNOTGate()
+	}
+	n.lineBit1ORGate = *circuit.NewORGate()
+	n.lineBit1ANDGate = *components.NewANDGate3()
+	for i := range n.lineBit0ANDGates {
+		n.lineBit0ANDGates[i] = *circuit.NewANDGate()
+	}
+	n.lineBit0ORGate = *circuit.NewORGate()
+	for i := range n.lineBits {
+		n.lineBits[i] = *components.NewBit()
+		n.lineBits[i].Update(false, true)
+		n.lineBits[i].Update(false, false)
+	}
+
+	// the upper bits of the vector address are hard wired
+	n.vectorEnabler = *components.NewEnabler(width)
+	for i := 0; i < width-2; i++ {
+		n.vectorEnabler.SetInputWire(i, arch.Word(INTERRUPT_VECTOR_TABLE)&(1<<uint(width-1-i)) != 0)
+	}
+	n.vectorEnableGate = *circuit.NewANDGate()
+	n.flagsEnabler = *components.NewEnabler(width)
+	n.flagsEnableGate = *circuit.NewANDGate()
+
+	n.flagsRestoreNOTGate = *circuit.NewNOTGate()
+	n.flagsALUGates = make([]circuit.ANDGate, width)
+	n.flagsBusGates = make([]circuit.ANDGate, width)
+	n.flagsInORGates = make([]circuit.ORGate, width)
+	for i := 0; i < width; i++ {
+		n.flagsALUGates[i] = *circuit.NewANDGate()
+		n.flagsBusGates[i] = *circuit.NewANDGate()
+		n.flagsInORGates[i] = *circuit.NewORGate()
+	}
+
+	n.eiGate = *circuit.NewANDGate()
+	n.diGate = *circuit.NewANDGate()
+	n.iretGate = *circuit.NewANDGate()
+
+	for i := range n.entryStepGates {
+		n.entryStepGates[i] = *circuit.NewANDGate()
+	}
+	for i := range n.iretStepGates {
+		n.iretStepGates[i] = *circuit.NewANDGate()
+	}
+	n.eiStep4Gate = *circuit.NewANDGate()
+	n.diStep4Gate = *circuit.NewANDGate()
+
+	n.decrementORGate = *circuit.NewORGate()
+	n.popAddressORGate = *circuit.NewORGate()
+	n.spEnableORGate = *circuit.NewORGate()
+	n.spSetORGate = *components.NewORGate4()
+	n.marSetORGate = *components.NewORGate4()
+	n.ramEnableORGate = *components.NewORGate3()
+	n.ramSetORGate = *circuit.NewORGate()
+	n.iarSetORGate = *circuit.NewORGate()
+
+	n.enableValueORGate = *circuit.NewORGate()
+	n.enableSetORGate = *components.NewORGate4()
+	n.enableSetANDGate = *circuit.NewANDGate()
+
+	n.longInstructionORGate = *circuit.NewORGate()
+
+	return n
+}
+
+// latchInterrupt checks the IRQ lines at the start of each instruction, if interrupts
+// are enabled and a line is raised the next cycle becomes an interrupt cycle
+func (c *CPU) latchInterrupt(clockState bool) {
+	n := &c.interrupts
+
+	n.pendingORGate.Update(n.irqLines[0].Get(), n.irqLines[1].Get(), n.irqLines[2].Get(), n.irqLines[3].Get())
+	n.pendingANDGate.Update(n.pendingORGate.Output(), n.enabled.Get())
+
+	n.lineNOTGates[0].Update(n.irqLines[0].Get())
+	n.lineNOTGates[1].Update(n.irqLines[1].Get())
+	n.lineNOTGates[2].Update(n.irqLines[2].Get())
+	n.lineBit1ORGate.Update(n.irqLines[2].Get(), n.irqLines[3].Get())
+	n.lineBit1ANDGate.Update(n.lineNOTGates[0].Output(), n.lineNOTGates[1].Output(), n.lineBit1ORGate.Output())
+	n.lineBit0ANDGates[0].Update(n.lineNOTGates[2].Output(), n.irqLines[3].Get())
+	n.lineBit0ORGate.Update(n.irqLines[1].Get(), n.lineBit0ANDGates[0].Output())
+	n.lineBit0ANDGates[1].Update(n.lineNOTGates[0].Output(), n.lineBit0ORGate.Output())
+
+	n.latchANDGate.Update(clockState, c.stepper.GetOutputWire(0))
+	n.taken.Update(n.pendingANDGate.Output(), n.latchANDGate.Output())
+	n.lineBits[0].Update(n.lineBit0ANDGates[1].Output(), n.latchANDGate.Output())
+	n.lineBits[1].Update(n.lineBit1ANDGate.Output(), n.latchANDGate.Output())
+	n.takenNOTGate.Update(n.taken.Get())
+
+	n.vectorEnabler.SetInputWire(c.width-2, n.lineBits[1].Get())
+	n.vectorEnabler.SetInputWire(c.width-1, n.lineBits[0].Get())
+}
+
+// runInterruptGates drives the control lines for the interrupt cycle and for the
+// interrupt instructions in the IR
+func (c *CPU) runInterruptGates() {
+	n := &c.interrupts
+	group := c.opcodeGroupGates[OPCODE_GROUP_INTERRUPT].Output()
+
+	n.eiGate.Update(group, c.instrDecoder3x8.selectorGates[0].Output())
+	n.diGate.Update(group, c.instrDecoder3x8.selectorGates[1].Output())
+	n.iretGate.Update(group, c.instrDecoder3x8.selectorGates[2].Output())
+
+	for i := range n.entryStepGates {
+		n.entryStepGates[i].Update(c.stepper.GetOutputWire(i), n.taken.Get())
+	}
+	for i := range n.iretStepGates {
+		n.iretStepGates[i].Update(c.stepper.GetOutputWire(3+i), n.iretGate.Output())
+	}
+	n.eiStep4Gate.Update(c.stepper.GetOutputWire(3), n.eiGate.Output())
+	n.diStep4Gate.Update(c.stepper.GetOutputWire(3), n.diGate.Output())
+
+	// the interrupt cycle takes 8 steps and IRET takes 9
+	n.longInstructionORGate.Update(n.taken.Get(), n.iretGate.Output())
+
+	// interrupt cycle
+	// step 1: SP -> ALU (with BUS1 as -1) -> ACC
+	// step 2: ACC -> SP and MAR
+	// step 3: IAR -> RAM
+	// step 4: SP -> ALU (with BUS1 as -1) -> ACC
+	// step 5: ACC -> SP and MAR
+	// step 6: FLAGS -> RAM, interrupts disabled
+	// step 7: vector address -> MAR
+	// step 8: RAM -> IAR
+	//
+	// IRET
+	// step 4: SP -> MAR and ALU (with BUS1 as +1) -> ACC
+	// step 5: RAM -> FLAGS
+	// step 6: ACC -> SP
+	// step 7: SP -> MAR and ALU (with BUS1 as +1) -> ACC
+	// step 8: RAM -> IAR
+	// step 9: ACC -> SP, interrupts enabled
+	n.decrementORGate.Update(n.entryStepGates[0].Output(), n.entryStepGates[3].Output())
+	n.popAddressORGate.Update(n.iretStepGates[0].Output(), n.iretStepGates[3].Output())
+	n.spEnableORGate.Update(n.decrementORGate.Output(), n.popAddressORGate.Output())
+	n.spSetORGate.Update(n.entryStepGates[1].Output(), n.entryStepGates[4].Output(), n.iretStepGates[2].Output(), n.iretStepGates[5].Output())
+	n.marSetORGate.Update(n.entryStepGates[1].Output(), n.entryStepGates[4].Output(), n.entryStepGates[6].Output(), n.popAddressORGate.Output())
+	n.ramEnableORGate.Update(n.entryStepGates[7].Output(), n.iretStepGates[1].Output(), n.iretStepGates[4].Output())
+	n.ramSetORGate.Update(n.entryStepGates[2].Output(), n.entryStepGates[5].Output())
+	n.iarSetORGate.Update(n.entryStepGates[7].Output(), n.iretStepGates[4].Output())
+
+	n.enableValueORGate.Update(n.eiStep4Gate.Output(), n.iretStepGates[5].Output())
+	n.enableSetORGate.Update(n.eiStep4Gate.Output(), n.iretStepGates[5].Output(), n.diStep4Gate.Output(), n.entryStepGates[5].Output())
+}
+
+// ConnectIRQ connects an interrupt source to one of the IRQ lines
+func (c *CPU) ConnectIRQ(line int, source io.InterruptSource) {
+	source.ConnectIRQ(&c.interrupts.irqLines[line])
+}
+
+func (c *CPU) runSetOnInterruptEnable(state bool) {
+	n := &c.interrupts
+	n.enableSetANDGate.Update(state, n.enableSetORGate.Output())
+	n.enabled.Update(n.enableValueORGate.Output(), n.enableSetANDGate.Output())
+}
+
+// updateFlagsInput selects what the FLAGS register is set from
+func (c *CPU) updateFlagsInput() {
+	n := &c.interrupts
+	n.flagsRestoreNOTGate.Update(n.flagsRestore())
+
+	for i := 0; i < c.width; i++ {
+		n.flagsALUGates[i].Update(c.aluToFlagsBus.GetOutputWire(i), n.flagsRestoreNOTGate.Output())
+		n.flagsBusGates[i].Update(c.mainBus.GetOutputWire(i), n.flagsRestore())
+		n.flagsInORGates[i].Update(n.flagsALUGates[i].Output(), n.flagsBusGates[i].Output())
+		c.flagsInBus.SetInputWire(i, n.flagsInORGates[i].Output())
+	}
+}
+
+// updateInterruptEnablers puts FLAGS or the vector address on the main bus
+func (c *CPU) updateInterruptEnablers() {
+	n := &c.interrupts
+
+	for i := 0; i < c.width; i++ {
+		n.flagsEnabler.SetInputWire(i, c.flagsBus.GetOutputWire(i))
+	}
+	n.flagsEnabler.Update(n.flagsEnableGate.Output())
+	n.vectorEnabler.Update(n.vectorEnableGate.Output())
+
+	for i := 0; i < c.width; i++ {
+		if n.flagsEnableGate.Output() {
+			c.mainBus.SetInputWire(i, n.flagsEnabler.GetOutputWire(i))
+		}
+		if n.vectorEnableGate.Output() {
+			c.mainBus.SetInputWire(i, n.vectorEnabler.GetOutputWire(i))
+		}
+	}
+}
+
+func (c *CPU) runEnableOnInterruptEnablers(state bool) {
+	n := &c.interrupts
+	n.flagsEnableGate.Update(state, n.entryStepGates[5].Output())
+	n.vectorEnableGate.Update(state, n.entryStepGates[6].Output())
+}
+
+// InterruptsEnabled returns true if the CPU will respond to IRQ lines
+func (c *CPU) InterruptsEnabled() bool {
+	return c.interrupts.enabled.Get()
+}
+
+func (n *interruptControl) notTaken() bool {
+	return n.takenNOTGate.Output()
+}
+
+func (n *interruptControl) spEnable() bool {
+	return n.spEnableORGate.Output()
+}
+
+func (n *interruptControl) spSet() bool {
+	return n.spSetORGate.Output()
+}
+
+func (n *interruptControl) busOneEnable() bool {
+	return n.popAddressORGate.Output()
+}
+
+func (n *interruptControl) busOneMinusOne() bool {
+	return n.decrementORGate.Output()
+}
+
+func (n *interruptControl) accEnable() bool {
+	return n.spSetORGate.Output()
+}
+
+func (n *interruptControl) accSet() bool {
+	return n.spEnableORGate.Output()
+}
+
+func (n *interruptControl) marSet() bool {
+	return n.marSetORGate.Output()
+}
+
+func (n *interruptControl) ramEnable() bool {
+	return n.ramEnableORGate.Output()
+}
+
+func (n *interruptControl) ramSet() bool {
+	return n.ramSetORGate.Output()
+}
+
+func (n *interruptControl) iarEnable() bool {
+	return n.entryStepGates[2].Output()
+}
+
+func (n *interruptControl) iarSet() bool {
+	return n.iarSetORGate.Output()
+}
+
+func (n *interruptControl) flagsRestore() bool {
+	return n.iretStepGates[1].Output()
+}
+
+func (n *interruptControl) longInstruction() bool {
+	return n.longInstructionORGate.Output()
+}
@@ -0,0 +1,73 @@
+package cpu
+
+import (
+	"github.com/djhworld/simple-computer/circuit"
+)
+
+// SIGNALS
+// the wires of the gate level CPU are named in a circuit.Registry when it is built, so
+// they can be found by path (e.g. cpu.mainBus, cpu.stepper.out[3] or cpu.alu.adder.carry)
+// and watched while it runs, like a logic analyser clipped on to the board. At every clock
+// phase, once the enables have been run (the values are on the buses) and once the sets
+// have been run (the values have been stored) for each half of the clock, the subscribers
+// to any signal that has changed are told and then the observer is called
+
+// SignalObserver is called every clock phase, when the signals can be sampled
+type SignalObserver func()
+
+// ObserveSignals registers a function that is called every clock phase, nil stops it
+func (c *CPU) ObserveSignals(observer SignalObserver) {
+	c.signalObserver = observer
+}
+
+func (c *CPU) notifySignalObserver() {
+	c.signals.Check()
+	if c.signalObserver != nil {
+		c.signalObserver()
+	}
+}
+
+// Signals returns the registry of the CPU's named wires
+func (c *CPU) Signals() *circuit.Registry {
+	return c.signals
+}
+
+func (c *CPU) addSignals(s circuit.Scope) {
+	s.Add("clock", &c.clock)
+	s.Add("mainBus", c.mainBus.Wires()...)
+	s.Add("controlBus", c.controlBus.Wires()...)
+	s.Add("accBus", c.accBus.Wires()...)
+	s.Add("tmpBus", c.tmpBus.Wires()...)
+	s.Add("busOneOutput", c.busOneOutput.Wires()...)
+	s.Add("aluToFlagsBus", c.aluToFlagsBus.Wires()...)
+	s.Add("flagsInBus", c.flagsInBus.Wires()...)
+	s.Add("flagsBus", c.flagsBus.Wires()...)
+	c.ioBus.AddSignals(s.Scope("ioBus"))
+	c.stepper.AddSignals(s.Scope("stepper"))
+
+	c.gpReg0.AddSignals(s.Scope("r0"))
+	c.gpReg1.AddSignals(s.Scope("r1"))
+	c.gpReg2.AddSignals(s.Scope("r2"))
+	c.gpReg3.AddSignals(s.Scope("r3"))
+	c.tmp.AddSignals(s.Scope("tmp"))
+	c.acc.AddSignals(s.Scope("acc"))
+	c.ir.AddSignals(s.Scope("ir"))
+	c.iar.AddSignals(s.Scope("iar"))
+	c.sp.AddSignals(s.Scope("sp"))
+	c.flags.AddSignals(s.Scope("flags"))
+	c.memory.AddSignals(s.Scope("ram"))
+
+	c.busOne.AddSignals(s.Scope("busOne"))
+	c.alu.AddSignals(s.Scope("alu"))
+	s.Add("carryLatch", c.carryTemp.OutputWire())
+
+	interrupts := s.Scope("interrupts")
+	irqLines := make([]*circuit.Wire, IRQ_LINES)
+	for i := range irqLines {
+		irqLines[i] = &c.interrupts.irqLines[i]
+	}
+	interrupts.Add("irq", irqLines...)
+	interrupts.Add("enabled", c.interrupts.enabled.OutputWire())
+	interrupts.Add("taken", c.interrupts.taken.OutputWire())
+	s.Add("halted", c.halt.halted.OutputWire())
+}
@@ -0,0 +1,230 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"fmt"
+	goio "io"
+
+	"github.com/djhworld/simple-computer/arch"
+)
+
+// SNAPSHOTS
+// Snapshot writes everything a core needs to carry on from the same step, and Restore
+// reads it back into another core of the same kind. Only registers, memory bits and wires
+// are saved, nearly every gate is worked out again from them before it is read and settle
+// works out the few that are not. The peripherals save their own state, see the io package
+// ----------------------
+// both are fixed size and little-endian, a gate level snapshot can only be restored on a
+// gate level CPU and a FastCPU snapshot on a FastCPU. Only a 16 bit gate level CPU can be
+// snapshot, like the rest of the computer the format is 16 bits wide
+
+// gateSnapshot is the state of the gate level CPU between steps
+type gateSnapshot struct {
+	Registers [4]uint16
+	TMP       uint16
+	ACC       uint16
+	IR        uint16
+	IAR       uint16
+	SP        uint16
+	Flags     uint16
+	MAR       uint16
+
+	// the stepper's memory bits followed by its outputs
+	Stepper [MAX_INSTRUCTION_STEPS*3 + 1]bool
+	Clock   bool
+
+	CarryTemp         bool
+	Halted            bool
+	InterruptsEnabled bool
+	InterruptTaken    bool
+	InterruptLine     [2]bool
+	IRQLines          [IRQ_LINES]bool
+	IOBus             [4]bool
+
+	Memory [65536]uint16
+}
+
+// Snapshot writes the state of the CPU, it should only be called between steps
+func (c *CPU) Snapshot(w goio.Writer) error {
+	if err := c.checkSnapshotWidth(); err != nil {
+		return err
+	}
+	s := new(gateSnapshot)
+	for i := range s.Registers {
+		s.Registers[i] = c.Register(i)
+	}
+	s.TMP = uint16(c.tmp.Value())
+	s.ACC = uint16(c.acc.Value())
+	s.IR = uint16(c.ir.Value())
+	s.IAR = uint16(c.iar.Value())
+	s.SP = uint16(c.sp.Value())
+	s.Flags = uint16(c.flags.Value())
+	s.MAR = uint16(c.memory.AddressRegister.Value())
+
+	copy(s.Stepper[:], c.stepper.State())
+	s.Clock = c.clock.Get()
+
+	s.CarryTemp = c.carryTemp.Get()
+	s.Halted = c.halt.halted.Get()
+	s.InterruptsEnabled = c.interrupts.enabled.Get()
+	s.InterruptTaken = c.interrupts.taken.Get()
+	for i := range s.InterruptLine {
+		s.InterruptLine[i] = c.interrupts.lineBits[i].Get()
+	}
+	for i := range s.IRQLines {
+		s.IRQLines[i] = c.interrupts.irqLines[i].Get()
+	}
+	s.IOBus = c.ioBus.Wires()
+
+	for i := range s.Memory {
+		s.Memory[i] = uint16(c.memory.Peek(arch.Word(i)))
+	}
+	return binary.Write(w, binary.LittleEndian, s)
+}
+
+// Restore reads a state written by Snapshot, the CPU carries on from the same step
+func (c *CPU) Restore(r goio.Reader) error {
+	if err := c.checkSnapshotWidth(); err != nil {
+		return err
+	}
+	s := new(gateSnapshot)
+	if err := binary.Read(r, binary.LittleEndian, s); err != nil {
+		return err
+	}
+
+	for i := range s.Registers {
+		c.SetRegister(i, s.Registers[i])
+	}
+	c.tmp.Load(arch.Word(s.TMP))
+	c.acc.Load(arch.Word(s.ACC))
+	c.ir.Load(arch.Word(s.IR))
+	c.iar.Load(arch.Word(s.IAR))
+	c.sp.Load(arch.Word(s.SP))
+	c.flags.Load(arch.Word(s.Flags))
+	c.memory.AddressRegister.Load(arch.Word(s.MAR))
+	for i := range s.Memory {
+		// loading a cell is slow, most of them will not have changed
+		if c.memory.Peek(arch.Word(i)) != arch.Word(s.Memory[i]) {
+			c.memory.Poke(arch.Word(i), arch.Word(s.Memory[i]))
+		}
+	}
+
+	c.stepper.Restore(s.Stepper[:])
+	c.clock.Update(s.Clock)
+
+	setBit := func(b interface{ Update(bool, bool) }, value bool) {
+		b.Update(value, true)
+		b.Update(value, false)
+	}
+	setBit(&c.carryTemp, s.CarryTemp)
+	setBit(&c.halt.halted, s.Halted)
+	setBit(&c.interrupts.enabled, s.InterruptsEnabled)
+	setBit(&c.interrupts.taken, s.InterruptTaken)
+	for i := range s.InterruptLine {
+		setBit(&c.interrupts.lineBits[i], s.InterruptLine[i])
+	}
+	for i := range s.IRQLines {
+		c.interrupts.irqLines[i].Update(s.IRQLines[i])
+	}
+	c.ioBus.SetWires(s.IOBus)
+
+	c.settle()
+	return nil
+}
+
+func (c *CPU) checkSnapshotWidth() error {
+	if c.width != arch.BUS_WIDTH {
+		return fmt.Errorf("a %d bit CPU can't be snapshot, only a %d bit one", c.width, arch.BUS_WIDTH)
+	}
+	return nil
+}
+
+// settle works out the gates that are read at the start of a step before they are
+// updated, from the registers and bits that have just been restored
+func (c *CPU) settle() {
+	c.halt.haltedNOTGate.Update(c.halt.halted.Get())
+	c.interrupts.takenNOTGate.Update(c.interrupts.taken.Get())
+
+	c.updateInstructionDecoder3x8()
+	c.updateOpcodeGroupDecoder()
+	c.runFetchStepGates()
+	c.runLegacyStepGates()
+	c.runHaltGates()
+	c.runStep4Gates()
+	c.runStep5Gates()
+	c.runStep6Gates()
+	c.runStackGates()
+	c.runArithmeticGates()
+	c.runImmediateGates()
+	c.runIndexedGates()
+	c.runInterruptGates()
+}
+
+// fastSnapshot is the state of the FastCPU between steps
+type fastSnapshot struct {
+	Registers [4]uint16
+	IR        uint16
+	IAR       uint16
+	SP        uint16
+	Flags     uint16
+
+	Step              uint8
+	InstructionLength uint8
+	Interrupting      bool
+	InterruptLine     uint16
+	InterruptsEnabled bool
+	Halted            bool
+	IRQLines          [IRQ_LINES]bool
+	IOBus             [4]bool
+
+	Memory [65536]uint16
+}
+
+// Snapshot writes the state of the FastCPU, it should only be called between steps
+func (c *FastCPU) Snapshot(w goio.Writer) error {
+	s := &fastSnapshot{
+		Registers:         c.gpReg,
+		IR:                c.ir,
+		IAR:               c.iar,
+		SP:                c.sp,
+		Flags:             c.flags,
+		Step:              uint8(c.step),
+		InstructionLength: uint8(c.instructionLength),
+		Interrupting:      c.interrupting,
+		InterruptLine:     c.interruptLine,
+		InterruptsEnabled: c.interruptsEnabled,
+		Halted:            c.halted,
+		IOBus:             c.ioBus.Wires(),
+		Memory:            c.memory,
+	}
+	for i := range s.IRQLines {
+		s.IRQLines[i] = c.irqLines[i].Get()
+	}
+	return binary.Write(w, binary.LittleEndian, s)
+}
+
+// Restore reads a state written by Snapshot, the FastCPU carries on from the same step
+func (c *FastCPU) Restore(r goio.Reader) error {
+	s := new(fastSnapshot)
+	if err := binary.Read(r, binary.LittleEndian, s); err != nil {
+		return err
+	}
+
+	c.gpReg = s.Registers
+	c.ir = s.IR
+	c.iar = s.IAR
+	c.sp = s.SP
+	c.flags = s.Flags
+	c.step = int(s.Step)
+	c.instructionLength = int(s.InstructionLength)
+	c.interrupting = s.Interrupting
+	c.interruptLine = s.InterruptLine
+	c.interruptsEnabled = s.InterruptsEnabled
+	c.halted = s.Halted
+	for i := range s.IRQLines {
+		c.irqLines[i].Update(s.IRQLines[i])
+	}
+	c.ioBus.SetWires(s.IOBus)
+	c.memory = s.Memory
+	return nil
+}
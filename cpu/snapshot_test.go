@@ -0,0 +1,177 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/memory"
+)
+
+// snapshotProgram runs through an interrupt, a carry, the stack and a CALL before halting
+var snapshotProgram = map[uint16][]uint16{
+	INTERRUPT_VECTOR_TABLE: {0x0600},
+	0x0500: {
+		0x0020, 0xFFFF, // DATA R0, 0xFFFF
+		0x0021, 0x0001, // DATA R1, 0x0001
+		0x0081,         // ADD R0, R1
+		0x0085,         // ADD R1, R1
+		0x0200,         // EI
+		0x0101,         // PUSH R1
+		0x0120, 0x0520, // CALL 0x0520
+		0x0112,         // POP R2
+		0x0023, 0x3000, // DATA R3, 0x3000
+		0x001E, // ST R3, R2
+		0x0024, // HALT
+	},
+	0x0520: {
+		0x00A5, // SHL R1
+		0x0130, // RET
+	},
+	0x0600: {
+		0x00B0, // NOT R0
+		0x0220, // IRET
+	},
+}
+
+func TestCPUSnapshotAtEveryStep(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the gate level CPU is slow to snapshot at every step, TestFastCPUSnapshotAtEveryStep still runs")
+	}
+	newCore := func() Core {
+		bus := components.NewBus(arch.BUS_WIDTH)
+		m := memory.NewMemory64K(bus)
+		// like the registers, each cell settles to 0xFFFF the first time it is selected unless it has been written
+		for address := 0; address <= 0xFFFF; address++ {
+			m.Poke(arch.Word(address), 0x0000)
+		}
+		return NewCPU(bus, m)
+	}
+	testSnapshotAtEveryStep(newCore(), newCore(), func(core Core, raised bool) {
+		core.(*CPU).interrupts.irqLines[0].Update(raised)
+	}, t)
+}
+
+func TestFastCPUSnapshotAtEveryStep(t *testing.T) {
+	newCore := func() Core {
+		return NewFastCPU(components.NewBus(arch.BUS_WIDTH))
+	}
+	testSnapshotAtEveryStep(newCore(), newCore(), func(core Core, raised bool) {
+		core.(*FastCPU).irqLines[0].Update(raised)
+	}, t)
+}
+
+func TestRestoreTruncatedSnapshot(t *testing.T) {
+	for _, core := range []Core{SetUpCPU(), NewFastCPU(components.NewBus(arch.BUS_WIDTH))} {
+		out := &bytes.Buffer{}
+		core.Snapshot(out)
+		if err := core.Restore(bytes.NewReader(out.Bytes()[:out.Len()/2])); err == nil {
+			t.Logf("expected an error restoring half of a snapshot")
+			t.FailNow()
+		}
+	}
+}
+
+// testSnapshotAtEveryStep runs the program to a few steps past halting, taking a snapshot
+// before each step, then restores each snapshot into the other core and checks it carries
+// on exactly as the original did
+func testSnapshotAtEveryStep(original, restored Core, setIRQ func(Core, bool), t *testing.T) {
+	for address, words := range snapshotProgram {
+		for i, word := range words {
+			original.WriteMemory(address+uint16(i), word)
+		}
+	}
+	original.SetIAR(0x0500)
+	original.SetSP(0xFEFE)
+	for i := 0; i < 4; i++ {
+		original.SetRegister(i, 0x0000)
+	}
+	original.SetFlags(0x0000)
+	// like the others, IR settles to 0xFFFF the first time it updates unless it has been set
+	original.SetIR(0x0000)
+	setIRQ(original, true)
+
+	step := func(core Core) {
+		core.Step()
+		// the handler is running, stop asking for it
+		if core.IAR() == 0x0600 {
+			setIRQ(core, false)
+		}
+	}
+	take := func(core Core) []byte {
+		out := &bytes.Buffer{}
+		if err := core.Snapshot(out); err != nil {
+			t.Logf("unexpected error taking a snapshot: %v", err)
+			t.FailNow()
+		}
+		return out.Bytes()
+	}
+
+	var snapshots [][]byte
+	var states []observedState
+	for halted := 0; halted < 10; {
+		if len(states) > 1000 {
+			t.Logf("program did not halt")
+			t.FailNow()
+		}
+		snapshots = append(snapshots, take(original))
+		states = append(states, observe(original))
+		step(original)
+		if original.Halted() {
+			halted++
+		}
+	}
+	states = append(states, observe(original))
+
+	// R1 is 1 from the carry, then doubled in the CALL. R0 is inverted by the interrupt handler
+	if original.ReadMemory(0x3000) != 0x0001 || original.Register(1) != 0x0002 || original.Register(0) != 0x0000 {
+		t.Logf("program did not run as expected, [0x3000] = %X, R1 = %X and R0 = %X", original.ReadMemory(0x3000), original.Register(1), original.Register(0))
+		t.FailNow()
+	}
+
+	// the core is reused, so everything not in the snapshot is left over from the last one
+	for steps, snapshot := range snapshots {
+		if err := restored.Restore(bytes.NewReader(snapshot)); err != nil {
+			t.Logf("unexpected error restoring the snapshot from step %d: %v", steps, err)
+			t.FailNow()
+		}
+		if !bytes.Equal(snapshot, take(restored)) {
+			t.Logf("snapshot from step %d is different once restored", steps)
+			t.FailNow()
+		}
+
+		for i := steps; i < len(states); i++ {
+			if got := observe(restored); got != states[i] {
+				t.Logf("state at step %d is %+v but %+v after restoring the snapshot from step %d", i, states[i], got, steps)
+				t.FailNow()
+			}
+			step(restored)
+		}
+	}
+}
+
+// observedState is what a program can see of a core, plus its progress through the instruction
+type observedState struct {
+	registers          [4]uint16
+	iar, ir, sp, flags uint16
+	phase              int
+	done, ei, halted   bool
+	result             uint16
+	stack              [8]uint16
+}
+
+func observe(c Core) observedState {
+	s := observedState{
+		iar: c.IAR(), ir: c.IR(), sp: c.SP(), flags: c.Flags(),
+		phase: c.Phase(), done: c.InstructionDone(), ei: c.InterruptsEnabled(), halted: c.Halted(),
+		result: c.ReadMemory(0x3000),
+	}
+	for i := range s.registers {
+		s.registers[i] = c.Register(i)
+	}
+	for i := range s.stack {
+		s.stack[i] = c.ReadMemory(0xFEF6 + uint16(i))
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+package cpu
+
+import (
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/components"
+)
+
+// STACK
+// the stack lives in RAM and grows downwards, SP is decremented before each
+// push and incremented after each pop so always points at the last value pushed.
+// decrementing is done by putting 0xFFFF on BUS1 and adding it to SP in the ALU
+// ----------------------
+// 0x0100 = PUSH R0
+// 0x0101 = PUSH R1
+// 0x0102 = PUSH R2
+// 0x0103 = PUSH R3
+
+// 0x0110 = POP R0
+// 0x0111 = POP R1
+// 0x0112 = POP R2
+// 0x0113 = POP R3
+
+// 0x0120 = CALL <value> (2 byte instruction, pushes return address)
+// 0x0130 = RET
+
+// stackControl is the part of the control unit that wires up the stack
+// instructions, each of its outputs is ORed into the matching control line
+type stackControl struct {
+	pushGate circuit.ANDGate
+	popGate  circuit.ANDGate
+	callGate circuit.ANDGate
+	retGate  circuit.ANDGate
+
+	// PUSH and CALL share the same first two steps, as do the last steps of POP and RET
+	decrementORGate circuit.ORGate
+	incrementORGate circuit.ORGate
+
+	decrementStep4Gate circuit.ANDGate
+	decrementStep5Gate circuit.ANDGate
+	incrementStep4Gate circuit.ANDGate
+	incrementStep6Gate circuit.ANDGate
+	pushStep6Gate      circuit.ANDGate
+	popStep5Gate       circuit.ANDGate
+	retStep5Gate       circuit.ANDGate
+	callStepGates      [4]circuit.ANDGate
+
+	spEnableORGate     circuit.ORGate
+	spSetORGate        circuit.ORGate
+	busOneEnableORGate circuit.ORGate
+	accEnableORGate    components.ORGate3
+	accSetORGate       components.ORGate3
+	marSetORGate       components.ORGate3
+	ramEnableORGate    components.ORGate3
+	ramSetORGate       circuit.ORGate
+	iarEnableORGate    circuit.ORGate
+	iarSetORGate       circuit.ORGate
+}
+
+func newStackControl() *stackControl {
+	s := new(stackControl)
+
+	s.pushGate = *circuit.NewANDGate()
+	s.popGate = *circuit.NewANDGate()
+	s.callGate = *circuit.NewANDGate()
+	s.retGate = *circuit.NewANDGate()
+
+	s.decrementORGate = *circuit.NewORGate()
+	s.incrementORGate = *circuit.NewORGate()
+
+	s.decrementStep4Gate = *circuit.NewANDGate()
+	s.decrementStep5Gate = *circuit.NewANDGate()
+	s.incrementStep4Gate = *circuit.NewANDGate()
+	s.incrementStep6Gate = *circuit.NewANDGate()
+	s.pushStep6Gate = *circuit.NewANDGate()
+	s.popStep5Gate = *circuit.NewANDGate()
+	s.retStep5Gate = *circuit.NewANDGate()
+	for i := range s.callStepGates {
+		s.callStepGates[i] = *circuit.NewANDGate()
+	}
+
+	s.spEnableORGate = *circuit.NewORGate()
+	s.spSetORGate = *circuit.NewORGate()
+	s.busOneEnableORGate = *circuit.NewORGate()
+	s.accEnableORGate = *components.NewORGate3()
+	s.accSetORGate = *components.NewORGate3()
+	s.marSetORGate = *components.NewORGate3()
+	s.ramEnableORGate = *components.NewORGate3()
+	s.ramSetORGate = *circuit.NewORGate()
+	s.iarEnableORGate = *circuit.NewORGate()
+	s.iarSetORGate = *circuit.NewORGate()
+
+	return s
+}
+
+// runStackGates works out which stack instruction (if any) is in the IR and
+// drives the control lines for the current step
+func (c *CPU) runStackGates() {
+	s := &c.stack
+	group := c.opcodeGroupGates[OPCODE_GROUP_STACK].Output()
+
+	s.pushGate.Update(group, c.instrDecoder3x8.selectorGates[0].Output())
+	s.popGate.Update(group, c.instrDecoder3x8.selectorGates[1].Output())
+	s.callGate.Update(group, c.instrDecoder3x8.selectorGates[2].Output())
+	s.retGate.Update(group, c.instrDecoder3x8.selectorGates[3].Output())
+
+	s.decrementORGate.Update(s.pushGate.Output(), s.callGate.Output())
+	s.incrementORGate.Update(s.popGate.Output(), s.retGate.Output())
+
+	s.decrementStep4Gate.Update(c.stepper.GetOutputWire(3), s.decrementORGate.Output())
+	s.decrementStep5Gate.Update(c.stepper.GetOutputWire(4), s.decrementORGate.Output())
+	s.incrementStep4Gate.Update(c.stepper.GetOutputWire(3), s.incrementORGate.Output())
+	s.incrementStep6Gate.Update(c.stepper.GetOutputWire(5), s.incrementORGate.Output())
+	s.pushStep6Gate.Update(c.stepper.GetOutputWire(5), s.pushGate.Output())
+	s.popStep5Gate.Update(c.stepper.GetOutputWire(4), s.popGate.Output())
+	s.retStep5Gate.Update(c.stepper.GetOutputWire(4), s.retGate.Output())
+	for i := range s.callStepGates {
+		s.callStepGates[i].Update(c.stepper.GetOutputWire(5+i), s.callGate.Output())
+	}
+
+	// step 4: SP -> ALU (with BUS1 as either -1 or +1) -> ACC, popping also sets MAR to SP
+	// step 5: PUSH/CALL: ACC -> SP and MAR. POP: RAM -> register B. RET: RAM -> IAR
+	// step 6: PUSH: register B -> RAM. POP/RET: ACC -> SP. CALL: IAR + 1 -> ACC
+	// step 7: CALL: ACC -> RAM (return address pushed onto stack)
+	// step 8: CALL: IAR -> MAR
+	// step 9: CALL: RAM -> IAR
+	s.spEnableORGate.Update(s.decrementStep4Gate.Output(), s.incrementStep4Gate.Output())
+	s.spSetORGate.Update(s.decrementStep5Gate.Output(), s.incrementStep6Gate.Output())
+	s.busOneEnableORGate.Update(s.incrementStep4Gate.Output(), s.callStepGates[0].Output())
+	s.accSetORGate.Update(s.decrementStep4Gate.Output(), s.incrementStep4Gate.Output(), s.callStepGates[0].Output())
+	s.accEnableORGate.Update(s.decrementStep5Gate.Output(), s.incrementStep6Gate.Output(), s.callStepGates[1].Output())
+	s.marSetORGate.Update(s.decrementStep5Gate.Output(), s.incrementStep4Gate.Output(), s.callStepGates[2].Output())
+	s.ramEnableORGate.Update(s.popStep5Gate.Output(), s.retStep5Gate.Output(), s.callStepGates[3].Output())
+	s.ramSetORGate.Update(s.pushStep6Gate.Output(), s.callStepGates[1].Output())
+	s.iarEnableORGate.Update(s.callStepGates[0].Output(), s.callStepGates[2].Output())
+	s.iarSetORGate.Update(s.retStep5Gate.Output(), s.callStepGates[3].Output())
+}
+
+func (s *stackControl) spEnable() bool {
+	return s.spEnableORGate.Output()
+}
+
+func (s *stackControl) spSet() bool {
+	return s.spSetORGate.Output()
+}
+
+func (s *stackControl) busOneEnable() bool {
+	return s.busOneEnableORGate.Output()
+}
+
+func (s *stackControl) busOneMinusOne() bool {
+	return s.decrementStep4Gate.Output()
+}
+
+func (s *stackControl) accEnable() bool {
+	return s.accEnableORGate.Output()
+}
+
+func (s *stackControl) accSet() bool {
+	return s.accSetORGate.Output()
+}
+
+func (s *stackControl) marSet() bool {
+	return s.marSetORGate.Output()
+}
+
+func (s *stackControl) ramEnable() bool {
+	return s.ramEnableORGate.Output()
+}
+
+func (s *stackControl) ramSet() bool {
+	return s.ramSetORGate.Output()
+}
+
+func (s *stackControl) iarEnable() bool {
+	return s.iarEnableORGate.Output()
+}
+
+func (s *stackControl) iarSet() bool {
+	return s.iarSetORGate.Output()
+}
+
+func (s *stackControl) registerBEnable() bool {
+	return s.pushStep6Gate.Output()
+}
+
+func (s *stackControl) registerBSet() bool {
+	return s.popStep5Gate.Output()
+}
+
+// CALL is the only stack instruction that needs more than 6 steps
+func (s *stackControl) longInstruction() bool {
+	return s.callGate.Output()
+}
@@ -0,0 +1,80 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/memory"
+)
+
+// widthProgram overflows an ADD with the widest value the bus holds, jumps on the carry and
+// stores and loads the value back, the instructions are the same at every width
+var widthProgram = []arch.Word{
+	0x0020, 0x0000, // DATA R0, <all ones>
+	0x0021, 0x0001, // DATA R1, 0x0001
+	0x0081,         // ADD R0, R1
+	0x0058, 0x000A, // JMPC 0x000A
+	0x0024, // HALT
+	0x0000, 0x0000,
+	0x0022, 0x0040, // DATA R2, 0x0040
+	0x0018, // ST R2, R0
+	0x000B, // LD R2, R3
+	0x0024, // HALT
+}
+
+// TestCPUWidths builds a gate level CPU for every width, which is slow, so with -short only
+// the default width is run. The alu, components and memory tests still cover every width
+func TestCPUWidths(t *testing.T) {
+	for _, width := range arch.BUS_WIDTHS {
+		if testing.Short() && width != arch.BUS_WIDTH {
+			t.Logf("skipping the %d bit CPU in short mode", width)
+			continue
+		}
+		bus := components.NewBus(width)
+		m := memory.NewMemory64K(bus)
+		for address, value := range widthProgram {
+			m.Poke(arch.Word(address), value)
+		}
+		m.Poke(1, arch.Mask(width))
+		m.Poke(0x0040, 0x0000)
+
+		c := NewCPU(bus, m)
+		if c.Width() != width {
+			t.Logf("Expected a %d bit CPU but got %d bits", width, c.Width())
+			t.FailNow()
+		}
+		c.SetIR(0x0000)
+		c.SetIAR(0x0000)
+		for i := 0; i < 100 && !c.Halted(); i++ {
+			c.Step()
+		}
+		if !c.Halted() || c.IAR() != 0x000F {
+			t.Logf("%d bits: expected to halt at 0x000F but got to %X", width, c.IAR())
+			t.FailNow()
+		}
+
+		expected := []arch.Word{arch.Mask(width), 0x0000, 0x0040, arch.Mask(width)}
+		for i, value := range expected {
+			if got := c.gpRegister(i).Value(); got != value {
+				t.Logf("%d bits: expected R%d to have value of: %X but got %X", width, i, value, got)
+				t.FailNow()
+			}
+		}
+		if got := m.Peek(0x0040); got != arch.Mask(width) {
+			t.Logf("%d bits: expected memory location 40 to have value of: %X but got %X", width, arch.Mask(width), got)
+			t.FailNow()
+		}
+	}
+}
+
+func TestCPUUnsupportedWidth(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Logf("Expected a 12 bit CPU to panic")
+			t.FailNow()
+		}
+	}()
+	bus := components.NewBus(12)
+	NewCPU(bus, nil)
+}
@@ -0,0 +1,665 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/djhworld/simple-computer/cpu"
+)
+
+// Watch says which memory accesses a watchpoint pauses on
+type Watch int
+
+const (
+	WATCH_READ Watch = 1 << iota
+	WATCH_WRITE
+	WATCH_READ_WRITE = WATCH_READ | WATCH_WRITE
+)
+
+const HELP = `commands:
+  break|b <addr|label>             pause before the instruction at the address runs
+  watch|w [r|w|rw] <addr|label>    pause when the address is read and/or written (default rw)
+  delete|d <addr|label>            remove the breakpoint and watchpoint at the address
+  info|i                           list breakpoints and watchpoints
+  step|s [n]                       run n instructions (default 1)
+  micro|m [n]                      run n stepper steps (default 1)
+  continue|c                       run until a breakpoint or watchpoint is hit
+  reverse-step|rs [n]              go back n instructions (default 1)
+  reverse-continue|rc              go back to the last breakpoint or write to a watchpoint
+  last-write|lw <addr|label>       find the instruction that last wrote to the address
+  regs|r                           print the registers
+  set <R0-R3|IAR|IR|SP|FLAGS> <v>  change a register
+  mem|x <addr|label> [n]           print n words of memory (default 8)
+  poke <addr|label> <value>        change a word of memory
+  help|h                           print this message
+  quit|q                           exit the debugger`
+
+// StopReason says why the debugger paused the CPU
+type StopReason int
+
+const (
+	STOP_NONE StopReason = iota
+	STOP_BREAKPOINT
+	STOP_WATCHPOINT
+	STOP_INTERRUPTED
+	STOP_HALTED
+	STOP_HISTORY_START
+)
+
+// Stop describes why the debugger paused, Address is the breakpoint or the memory
+// address that was accessed and Write says whether a watchpoint was hit by a write
+type Stop struct {
+	Reason  StopReason
+	Address uint16
+	Write   bool
+}
+
+// Debugger runs a CPU core a step or an instruction at a time, pausing at breakpoints
+// and watchpoints. Addresses can be given as numbers or as labels from the assembler
+type Debugger struct {
+	cpu    cpu.Core
+	labels map[string]uint16
+	out    io.Writer
+
+	breakpoints map[uint16]bool
+	watchpoints map[uint16]Watch
+
+	// the first watchpoint hit during the current step
+	hit *Stop
+
+	interrupted int32
+
+	history *history
+	budget  int
+}
+
+// Option changes how NewDebugger sets up the debugger
+type Option func(*Debugger)
+
+// WithHistoryBudget sets the memory in bytes that the history of instructions can use
+// for going backwards, 0 turns it off
+func WithHistoryBudget(budget int) Option {
+	return func(d *Debugger) {
+		d.budget = budget
+	}
+}
+
+func NewDebugger(core cpu.Core, labels map[string]uint16, out io.Writer, options ...Option) *Debugger {
+	d := new(Debugger)
+	d.cpu = core
+	d.labels = labels
+	if d.labels == nil {
+		d.labels = make(map[string]uint16)
+	}
+	d.out = out
+	d.breakpoints = make(map[uint16]bool)
+	d.watchpoints = make(map[uint16]Watch)
+	d.budget = DEFAULT_HISTORY_BUDGET
+	for _, option := range options {
+		option(d)
+	}
+	d.history = newHistory(core, d.budget)
+	d.cpu.ObserveMemory(d.observeMemory)
+	return d
+}
+
+// Run reads commands from in until it is exhausted or quit is entered
+func (d *Debugger) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(d.out, "(debug) ")
+	for scanner.Scan() {
+		quit, err := d.Execute(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(d.out, "error:", err)
+		}
+		if quit {
+			return nil
+		}
+		fmt.Fprint(d.out, "(debug) ")
+	}
+	return scanner.Err()
+}
+
+// Interrupt pauses a running continue command, it is safe to call from another goroutine.
+// If nothing is running the next continue stops after one instruction
+func (d *Debugger) Interrupt() {
+	atomic.StoreInt32(&d.interrupted, 1)
+}
+
+// Execute runs a single command, returning true if the debugger should exit
+func (d *Debugger) Execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	command, args := strings.ToLower(fields[0]), fields[1:]
+
+	switch command {
+	case "break", "b":
+		return false, d.breakCommand(args)
+	case "watch", "w":
+		return false, d.watchCommand(args)
+	case "delete", "d":
+		return false, d.deleteCommand(args)
+	case "info", "i":
+		d.printInfo()
+	case "step", "s":
+		return false, d.stepCommand(args, d.StepInstruction)
+	case "micro", "m":
+		return false, d.stepCommand(args, d.MicroStep)
+	case "continue", "c":
+		d.report(d.Continue())
+	case "reverse-step", "rs":
+		return false, d.reverseStepCommand(args)
+	case "reverse-continue", "rc":
+		stop, err := d.ReverseContinue()
+		if err != nil {
+			return false, err
+		}
+		d.report(stop)
+	case "last-write", "lw":
+		return false, d.lastWriteCommand(args)
+	case "regs", "r":
+		d.printRegisters()
+	case "set":
+		return false, d.setCommand(args)
+	case "mem", "x":
+		return false, d.memCommand(args)
+	case "poke":
+		return false, d.pokeCommand(args)
+	case "help", "h":
+		fmt.Fprintln(d.out, HELP)
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command '%s', try help", command)
+	}
+	return false, nil
+}
+
+// Resolve turns a label or a number (hex with 0x, otherwise decimal) into an address
+func (d *Debugger) Resolve(s string) (uint16, error) {
+	if address, ok := d.labels[s]; ok {
+		return address, nil
+	}
+	return parseValue(s)
+}
+
+func (d *Debugger) AddBreakpoint(address uint16) {
+	d.breakpoints[address] = true
+}
+
+func (d *Debugger) AddWatchpoint(address uint16, watch Watch) {
+	d.watchpoints[address] = watch
+}
+
+func (d *Debugger) RemoveBreakpoint(address uint16) {
+	delete(d.breakpoints, address)
+}
+
+func (d *Debugger) RemoveWatchpoint(address uint16) {
+	delete(d.watchpoints, address)
+}
+
+// MicroStep runs a single stepper step, pausing if a watchpoint is hit or the CPU has halted
+func (d *Debugger) MicroStep() Stop {
+	d.hit = nil
+	if err := d.history.beforeStep(); err != nil {
+		// carry on without going backwards rather than stop the program
+		fmt.Fprintln(d.out, "error: history turned off:", err)
+		d.history = newHistory(d.cpu, 0)
+	}
+	d.cpu.Step()
+	d.history.afterStep()
+	if d.hit != nil {
+		return *d.hit
+	}
+	if d.cpu.Halted() {
+		return Stop{Reason: STOP_HALTED, Address: d.cpu.IAR()}
+	}
+	return Stop{}
+}
+
+// StepInstruction runs until the current instruction has finished, pausing early if a
+// watchpoint is hit or the CPU halts
+func (d *Debugger) StepInstruction() Stop {
+	for {
+		if stop := d.MicroStep(); stop.Reason != STOP_NONE {
+			return stop
+		}
+		if d.cpu.InstructionDone() {
+			return Stop{}
+		}
+	}
+}
+
+// Continue runs instructions until the next one is at a breakpoint, a watchpoint is
+// hit, the CPU halts or Interrupt is called
+func (d *Debugger) Continue() Stop {
+	for {
+		if stop := d.StepInstruction(); stop.Reason != STOP_NONE {
+			return stop
+		}
+		if d.breakpoints[d.cpu.IAR()] {
+			return Stop{Reason: STOP_BREAKPOINT, Address: d.cpu.IAR()}
+		}
+		if atomic.SwapInt32(&d.interrupted, 0) != 0 {
+			return Stop{Reason: STOP_INTERRUPTED, Address: d.cpu.IAR()}
+		}
+	}
+}
+
+// ReverseStep goes back n instructions, if the CPU is part way through an instruction
+// going back to the start of it counts as one. It stops early at the start of the history
+func (d *Debugger) ReverseStep(n int) (Stop, error) {
+	if !d.history.enabled() {
+		return Stop{}, fmt.Errorf("there is no history to go back through")
+	}
+
+	back := uint64(n)
+	if d.history.running {
+		back--
+	}
+	target := d.history.instructions - back
+	stop := Stop{}
+	if oldest := d.history.oldest(); d.history.instructions-oldest < back {
+		target = oldest
+		stop.Reason = STOP_HISTORY_START
+	}
+
+	if err := d.history.rewind(target); err != nil {
+		return Stop{}, err
+	}
+	stop.Address = d.cpu.IAR()
+	return stop, nil
+}
+
+// ReverseContinue goes back to before the last instruction that was at a breakpoint or
+// wrote to a watchpoint, or to the start of the history. Reads are not in the history
+// so watchpoints only on reads are passed over
+func (d *Debugger) ReverseContinue() (Stop, error) {
+	if !d.history.enabled() {
+		return Stop{}, fmt.Errorf("there is no history to go back through")
+	}
+
+	oldest := d.history.oldest()
+	last := d.history.instructions
+	if d.history.running {
+		last++
+	}
+	for i := last; i > oldest; i-- {
+		stop := d.reverseStop(d.history.entry(i - 1))
+		if stop.Reason != STOP_NONE {
+			return stop, d.history.rewind(i - 1)
+		}
+	}
+
+	if err := d.history.rewind(oldest); err != nil {
+		return Stop{}, err
+	}
+	return Stop{Reason: STOP_HISTORY_START, Address: d.cpu.IAR()}, nil
+}
+
+// reverseStop says whether going back past an entry should stop at it
+func (d *Debugger) reverseStop(e *undoEntry) Stop {
+	if d.breakpoints[e.iar] {
+		return Stop{Reason: STOP_BREAKPOINT, Address: e.iar}
+	}
+	for i := int(e.writes) - 1; i >= 0; i-- {
+		if d.watchpoints[e.memory[i].address]&WATCH_WRITE != 0 {
+			return Stop{Reason: STOP_WATCHPOINT, Address: e.memory[i].address, Write: true}
+		}
+	}
+	return Stop{}
+}
+
+// LastWrite finds the last write to an address in the history
+func (d *Debugger) LastWrite(address uint16) (Write, bool) {
+	return d.history.lastWrite(address)
+}
+
+func (d *Debugger) observeMemory(address uint16, write bool) {
+	if d.history.rewinding {
+		return
+	}
+	if write {
+		d.history.recordWrite(address)
+	}
+	if d.hit != nil {
+		return
+	}
+
+	watch, ok := d.watchpoints[address]
+	if !ok {
+		return
+	}
+
+	if (write && watch&WATCH_WRITE != 0) || (!write && watch&WATCH_READ != 0) {
+		d.hit = &Stop{Reason: STOP_WATCHPOINT, Address: address, Write: write}
+	}
+}
+
+func (d *Debugger) breakCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: break <addr|label>")
+	}
+	address, err := d.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	d.AddBreakpoint(address)
+	fmt.Fprintf(d.out, "breakpoint at %s\n", d.describe(address))
+	return nil
+}
+
+func (d *Debugger) watchCommand(args []string) error {
+	watch := WATCH_READ_WRITE
+	if len(args) == 2 {
+		switch strings.ToLower(args[0]) {
+		case "r":
+			watch = WATCH_READ
+		case "w":
+			watch = WATCH_WRITE
+		case "rw":
+			watch = WATCH_READ_WRITE
+		default:
+			return fmt.Errorf("watch mode must be r, w or rw, not '%s'", args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: watch [r|w|rw] <addr|label>")
+	}
+
+	address, err := d.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	d.AddWatchpoint(address, watch)
+	fmt.Fprintf(d.out, "watchpoint (%s) at %s\n", watch, d.describe(address))
+	return nil
+}
+
+func (d *Debugger) deleteCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: delete <addr|label>")
+	}
+	address, err := d.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	_, isBreakpoint := d.breakpoints[address]
+	_, isWatchpoint := d.watchpoints[address]
+	if !isBreakpoint && !isWatchpoint {
+		return fmt.Errorf("nothing set at %s", d.describe(address))
+	}
+	d.RemoveBreakpoint(address)
+	d.RemoveWatchpoint(address)
+	return nil
+}
+
+func (d *Debugger) stepCommand(args []string, step func() Stop) error {
+	n := 1
+	if len(args) == 1 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 1 {
+			return fmt.Errorf("step count must be a positive number, not '%s'", args[0])
+		}
+		n = v
+	}
+
+	for i := 0; i < n; i++ {
+		if stop := step(); stop.Reason != STOP_NONE {
+			d.report(stop)
+			return nil
+		}
+	}
+	d.report(Stop{})
+	return nil
+}
+
+func (d *Debugger) reverseStepCommand(args []string) error {
+	n := 1
+	if len(args) == 1 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 1 {
+			return fmt.Errorf("step count must be a positive number, not '%s'", args[0])
+		}
+		n = v
+	}
+
+	stop, err := d.ReverseStep(n)
+	if err != nil {
+		return err
+	}
+	d.report(stop)
+	return nil
+}
+
+func (d *Debugger) lastWriteCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: last-write <addr|label>")
+	}
+	address, err := d.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	w, ok := d.LastWrite(address)
+	if !ok {
+		fmt.Fprintf(d.out, "%s has not been written in the history\n", d.describe(address))
+		return nil
+	}
+	fmt.Fprintf(d.out, "%s was written by the instruction at %s %d instructions ago, 0x%04X -> 0x%04X\n",
+		d.describe(address), d.describe(w.IAR), w.Ago, w.Old, w.New)
+	return nil
+}
+
+func (d *Debugger) setCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: set <R0-R3|IAR|IR|SP|FLAGS> <value>")
+	}
+	value, err := d.Resolve(args[1])
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "R0":
+		d.cpu.SetRegister(0, value)
+	case "R1":
+		d.cpu.SetRegister(1, value)
+	case "R2":
+		d.cpu.SetRegister(2, value)
+	case "R3":
+		d.cpu.SetRegister(3, value)
+	case "IAR":
+		d.cpu.SetIAR(value)
+	case "IR":
+		d.cpu.SetIR(value)
+	case "SP":
+		d.cpu.SetSP(value)
+	case "FLAGS":
+		d.cpu.SetFlags(value)
+	default:
+		return fmt.Errorf("unknown register '%s'", args[0])
+	}
+	d.history.clear()
+	return nil
+}
+
+func (d *Debugger) memCommand(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: mem <addr|label> [n]")
+	}
+	address, err := d.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	n := 8
+	if len(args) == 2 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 1 {
+			return fmt.Errorf("word count must be a positive number, not '%s'", args[1])
+		}
+		n = v
+	}
+
+	for i := 0; i < n; i++ {
+		if i%8 == 0 {
+			if i > 0 {
+				fmt.Fprintln(d.out)
+			}
+			fmt.Fprintf(d.out, "0x%04X:", address)
+		}
+		fmt.Fprintf(d.out, " 0x%04X", d.cpu.ReadMemory(address))
+		address++
+	}
+	fmt.Fprintln(d.out)
+	return nil
+}
+
+func (d *Debugger) pokeCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: poke <addr|label> <value>")
+	}
+	address, err := d.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	value, err := d.Resolve(args[1])
+	if err != nil {
+		return err
+	}
+	d.cpu.WriteMemory(address, value)
+	d.history.clear()
+	return nil
+}
+
+// report says why the debugger paused (if it was for a reason) and where the CPU is
+func (d *Debugger) report(stop Stop) {
+	switch stop.Reason {
+	case STOP_BREAKPOINT:
+		fmt.Fprintf(d.out, "breakpoint at %s\n", d.describe(stop.Address))
+	case STOP_WATCHPOINT:
+		if stop.Write {
+			fmt.Fprintf(d.out, "watchpoint write to %s\n", d.describe(stop.Address))
+		} else {
+			fmt.Fprintf(d.out, "watchpoint read of %s\n", d.describe(stop.Address))
+		}
+	case STOP_INTERRUPTED:
+		fmt.Fprintln(d.out, "interrupted")
+	case STOP_HALTED:
+		fmt.Fprintln(d.out, "halted, set IAR to restart")
+	case STOP_HISTORY_START:
+		fmt.Fprintln(d.out, "reached the start of the history")
+	}
+	fmt.Fprintf(d.out, "IAR %s, step %d", d.describe(d.cpu.IAR()), d.cpu.Phase())
+	if d.cpu.InstructionDone() {
+		fmt.Fprint(d.out, " (instruction done)")
+	}
+	fmt.Fprintln(d.out)
+}
+
+func (d *Debugger) printRegisters() {
+	fmt.Fprintf(d.out, "R0: 0x%04X  R1: 0x%04X  R2: 0x%04X  R3: 0x%04X\n",
+		d.cpu.Register(0), d.cpu.Register(1), d.cpu.Register(2), d.cpu.Register(3))
+	fmt.Fprintf(d.out, "IAR: %s  IR: 0x%04X  SP: 0x%04X\n", d.describe(d.cpu.IAR()), d.cpu.IR(), d.cpu.SP())
+	fmt.Fprintf(d.out, "FLAGS: 0x%04X [%s]  IE: %v  STEP: %d\n", d.cpu.Flags(), flagsString(d.cpu.Flags()), d.cpu.InterruptsEnabled(), d.cpu.Phase())
+}
+
+func (d *Debugger) printInfo() {
+	breakpoints := make([]int, 0, len(d.breakpoints))
+	for address := range d.breakpoints {
+		breakpoints = append(breakpoints, int(address))
+	}
+	sort.Ints(breakpoints)
+	for _, address := range breakpoints {
+		fmt.Fprintf(d.out, "breakpoint at %s\n", d.describe(uint16(address)))
+	}
+
+	watchpoints := make([]int, 0, len(d.watchpoints))
+	for address := range d.watchpoints {
+		watchpoints = append(watchpoints, int(address))
+	}
+	sort.Ints(watchpoints)
+	for _, address := range watchpoints {
+		fmt.Fprintf(d.out, "watchpoint (%s) at %s\n", d.watchpoints[uint16(address)], d.describe(uint16(address)))
+	}
+}
+
+// describe prints an address along with any labels that point at it
+func (d *Debugger) describe(address uint16) string {
+	var names []string
+	for name, labelAddress := range d.labels {
+		if labelAddress == address {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("0x%04X", address)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("0x%04X <%s>", address, strings.Join(names, ", "))
+}
+
+func (w Watch) String() string {
+	switch w {
+	case WATCH_READ:
+		return "r"
+	case WATCH_WRITE:
+		return "w"
+	default:
+		return "rw"
+	}
+}
+
+func flagsString(flags uint16) string {
+	s := ""
+	for i, name := range []string{"C", "A", "E", "Z"} {
+		if flags&(0x8000>>uint(i)) != 0 {
+			s += name
+		} else {
+			s += "-"
+		}
+	}
+	return s
+}
+
+func parseValue(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a label or a 16 bit number", s)
+	}
+	return uint16(v), nil
+}
+
+// ReadLabels reads a label file written by the assembler, each line holds a label name
+// followed by its address
+func ReadLabels(r io.Reader) (map[string]uint16, error) {
+	labels := make(map[string]uint16)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a label and an address", line)
+		}
+		address, err := parseValue(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		labels[fields[0]] = address
+	}
+	return labels, scanner.Err()
+}
@@ -0,0 +1,391 @@
+package debugger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/asm"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/cpu"
+)
+
+const PROGRAM = `
+	DATA R0, 0x0A00
+	DATA R1, 0x0001
+loop:
+	ADD R1, R2
+	ST R0, R2
+	JMP loop
+`
+
+func setUpDebugger(t *testing.T) (*Debugger, *bytes.Buffer) {
+	return setUpDebuggerWithProgram(PROGRAM, t)
+}
+
+func setUpDebuggerWithProgram(program string, t *testing.T, options ...Option) (*Debugger, *bytes.Buffer) {
+	instructions, err := (&asm.Parser{}).Parse(strings.NewReader(program))
+	if err != nil {
+		t.Logf("could not parse program: %v", err)
+		t.FailNow()
+	}
+
+	a := asm.Assembler{}
+	bin, err := a.Process(0x0500, instructions)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	c := cpu.NewFastCPU(components.NewBus(arch.BUS_WIDTH))
+	for i, value := range bin {
+		c.WriteMemory(0x0500+uint16(i), value)
+	}
+	c.SetIAR(0x0500)
+
+	out := new(bytes.Buffer)
+	return NewDebugger(c, a.Labels(), out, options...), out
+}
+
+func execute(d *Debugger, line string, t *testing.T) {
+	if _, err := d.Execute(line); err != nil {
+		t.Logf("command '%s' failed: %v", line, err)
+		t.FailNow()
+	}
+}
+
+func TestBreakpointOnLabel(t *testing.T) {
+	d, out := setUpDebugger(t)
+
+	execute(d, "break loop", t)
+	execute(d, "continue", t)
+
+	if d.cpu.IAR() != 0x0504 {
+		t.Logf("expected to stop at 0504 but stopped at %X", d.cpu.IAR())
+		t.FailNow()
+	}
+	if !strings.Contains(out.String(), "breakpoint at 0x0504 <loop>") {
+		t.Logf("expected breakpoint to be reported, got %q", out.String())
+		t.FailNow()
+	}
+
+	// continuing runs round the loop once and stops at the same place
+	execute(d, "continue", t)
+	if d.cpu.IAR() != 0x0504 || d.cpu.Register(2) != 0x0001 {
+		t.Logf("expected to stop at 0504 with R2 = 1 but stopped at %X with R2 = %X", d.cpu.IAR(), d.cpu.Register(2))
+		t.FailNow()
+	}
+}
+
+func TestWatchpointOnWrite(t *testing.T) {
+	d, out := setUpDebugger(t)
+
+	execute(d, "watch w 0x0A00", t)
+	execute(d, "continue", t)
+
+	// ST is the second instruction in the loop
+	if d.cpu.IAR() != 0x0506 {
+		t.Logf("expected to stop at ST but stopped at %X step %d", d.cpu.IAR(), d.cpu.Phase())
+		t.FailNow()
+	}
+	if !strings.Contains(out.String(), "watchpoint write to 0x0A00") {
+		t.Logf("expected watchpoint to be reported, got %q", out.String())
+		t.FailNow()
+	}
+	if d.cpu.ReadMemory(0x0A00) != 0x0001 {
+		t.Logf("expected 0A00 to hold 1 but got %X", d.cpu.ReadMemory(0x0A00))
+		t.FailNow()
+	}
+}
+
+func TestWatchpointOnReadIgnoresWrites(t *testing.T) {
+	d, _ := setUpDebugger(t)
+
+	execute(d, "watch r 0x0A00", t)
+	execute(d, "step 11", t)
+
+	// 2 DATA instructions then 3 times round the loop
+	if d.cpu.IAR() != 0x0504 || d.cpu.Register(2) != 0x0003 {
+		t.Logf("expected 11 instructions to run but stopped at %X with R2 = %X", d.cpu.IAR(), d.cpu.Register(2))
+		t.FailNow()
+	}
+}
+
+func TestMicroStep(t *testing.T) {
+	d, _ := setUpDebugger(t)
+
+	execute(d, "micro 3", t)
+	if d.cpu.Phase() != 3 || d.cpu.IR() != 0x0020 {
+		t.Logf("expected to be at step 3 of DATA but at step %d with IR %X", d.cpu.Phase(), d.cpu.IR())
+		t.FailNow()
+	}
+
+	execute(d, "step", t)
+	if !d.cpu.InstructionDone() || d.cpu.Register(0) != 0x0A00 {
+		t.Logf("expected DATA to have finished")
+		t.FailNow()
+	}
+}
+
+func TestStopsWhenHalted(t *testing.T) {
+	d, out := setUpDebuggerWithProgram(`
+	DATA R0, 0x0001
+	HALT
+	DATA R0, 0x0002
+	`, t)
+
+	execute(d, "continue", t)
+	if !d.cpu.Halted() || d.cpu.IAR() != 0x0503 {
+		t.Logf("expected to halt at 0x0503 but IAR = %X", d.cpu.IAR())
+		t.FailNow()
+	}
+	if !strings.Contains(out.String(), "halted") {
+		t.Logf("expected halt to be reported but got %s", out.String())
+		t.FailNow()
+	}
+
+	// stepping a halted CPU does nothing until IAR is set
+	execute(d, "step 5", t)
+	if d.cpu.IAR() != 0x0503 || d.cpu.Register(0) != 0x0001 {
+		t.Logf("expected nothing to run but IAR = %X", d.cpu.IAR())
+		t.FailNow()
+	}
+
+	execute(d, "set IAR 0x0503", t)
+	execute(d, "step", t)
+	if d.cpu.Halted() || d.cpu.Register(0) != 0x0002 {
+		t.Logf("expected setting IAR to restart the CPU but R0 = %X", d.cpu.Register(0))
+		t.FailNow()
+	}
+}
+
+func TestSetAndPoke(t *testing.T) {
+	d, out := setUpDebugger(t)
+
+	execute(d, "set r3 0xBEEF", t)
+	execute(d, "set FLAGS 0x8000", t)
+	execute(d, "poke 0x0A00 42", t)
+	execute(d, "regs", t)
+	execute(d, "mem 0x0A00 2", t)
+
+	if d.cpu.Register(3) != 0xBEEF || d.cpu.Flags() != 0x8000 || d.cpu.ReadMemory(0x0A00) != 42 {
+		t.Logf("registers or memory were not changed")
+		t.FailNow()
+	}
+	for _, expected := range []string{"R3: 0xBEEF", "[C---]", "0x0A00: 0x002A 0x0000"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Logf("expected output to contain %q, got %q", expected, out.String())
+			t.FailNow()
+		}
+	}
+
+	if _, err := d.Execute("set R4 1"); err == nil {
+		t.Logf("expected an error for an unknown register")
+		t.FailNow()
+	}
+}
+
+func TestReadLabels(t *testing.T) {
+	labels, err := ReadLabels(strings.NewReader("start 0x0500\n\nloop 0x0504\n"))
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	if len(labels) != 2 || labels["start"] != 0x0500 || labels["loop"] != 0x0504 {
+		t.Logf("unexpected labels %v", labels)
+		t.FailNow()
+	}
+
+	if _, err := ReadLabels(strings.NewReader("start\n")); err == nil {
+		t.Logf("expected an error for a label without an address")
+		t.FailNow()
+	}
+}
+
+// machineState is everything a program can see, for checking going backwards
+type machineState struct {
+	registers         [4]uint16
+	iar, sp, flags    uint16
+	interruptsEnabled bool
+	result, stackTop  uint16
+}
+
+func stateOf(d *Debugger) machineState {
+	s := machineState{iar: d.cpu.IAR(), sp: d.cpu.SP(), flags: d.cpu.Flags(), interruptsEnabled: d.cpu.InterruptsEnabled(),
+		result: d.cpu.ReadMemory(0x0A00), stackTop: d.cpu.ReadMemory(0xFEFD)}
+	for i := range s.registers {
+		s.registers[i] = d.cpu.Register(i)
+	}
+	return s
+}
+
+// INTERRUPTS_PROGRAM changes whether interrupts are enabled and uses the stack, so going
+// back over it needs the snapshots as well as the undo entries
+const INTERRUPTS_PROGRAM = `
+	DATA R0, 0x0A00
+	DATA R1, 0x0001
+	DATA R3, 0xFEFE
+	EI
+loop:
+	ADD R1, R2
+	PUSH R2
+	ST R0, R2
+	DI
+	POP R3
+	EI
+	JMP loop
+`
+
+func TestReverseStep(t *testing.T) {
+	for _, program := range []string{PROGRAM, INTERRUPTS_PROGRAM} {
+		d, _ := setUpDebuggerWithProgram(program, t)
+		d.cpu.SetSP(0xFEFE)
+
+		var states []machineState
+		for i := 0; i < 30; i++ {
+			states = append(states, stateOf(d))
+			execute(d, "step", t)
+		}
+
+		for i := len(states) - 1; i >= 0; i-- {
+			execute(d, "reverse-step", t)
+			if got := stateOf(d); got != states[i] {
+				t.Logf("expected %+v after going back to instruction %d but got %+v", states[i], i, got)
+				t.FailNow()
+			}
+		}
+
+		// going back from the start stays there, then running forward again does the same thing
+		stop, err := d.ReverseStep(1)
+		if err != nil || stop.Reason != STOP_HISTORY_START {
+			t.Logf("expected to stop at the start of the history but got %+v, %v", stop, err)
+			t.FailNow()
+		}
+		for i := range states {
+			if got := stateOf(d); got != states[i] {
+				t.Logf("expected %+v at instruction %d after going back but got %+v", states[i], i, got)
+				t.FailNow()
+			}
+			execute(d, "step", t)
+		}
+
+		execute(d, "reverse-step 10", t)
+		if got := stateOf(d); got != states[20] {
+			t.Logf("expected %+v after going back 10 instructions but got %+v", states[20], got)
+			t.FailNow()
+		}
+	}
+}
+
+func TestReverseStepPartWayThroughAnInstruction(t *testing.T) {
+	d, _ := setUpDebugger(t)
+
+	execute(d, "step 6", t)
+	before := stateOf(d)
+
+	execute(d, "micro 3", t)
+	if d.cpu.InstructionDone() {
+		t.Logf("expected to be part way through ST")
+		t.FailNow()
+	}
+
+	execute(d, "reverse-step", t)
+	if got := stateOf(d); got != before || !d.cpu.InstructionDone() {
+		t.Logf("expected to go back to the start of ST %+v but got %+v", before, got)
+		t.FailNow()
+	}
+}
+
+func TestReverseContinue(t *testing.T) {
+	d, out := setUpDebugger(t)
+
+	execute(d, "break loop", t)
+	for i := 0; i < 3; i++ {
+		execute(d, "continue", t)
+	}
+	if d.cpu.Register(2) != 0x0002 {
+		t.Logf("expected to be round the loop twice but R2 = %X", d.cpu.Register(2))
+		t.FailNow()
+	}
+
+	out.Reset()
+	execute(d, "reverse-continue", t)
+	if d.cpu.IAR() != 0x0504 || d.cpu.Register(2) != 0x0001 {
+		t.Logf("expected to go back to the last time round the loop but IAR = %X and R2 = %X", d.cpu.IAR(), d.cpu.Register(2))
+		t.FailNow()
+	}
+	if !strings.Contains(out.String(), "breakpoint at 0x0504 <loop>") {
+		t.Logf("expected breakpoint to be reported, got %q", out.String())
+		t.FailNow()
+	}
+
+	// a write to a watchpoint stops before the instruction that made it
+	execute(d, "delete loop", t)
+	execute(d, "watch w 0x0A00", t)
+	execute(d, "reverse-continue", t)
+	if d.cpu.IAR() != 0x0505 || d.cpu.ReadMemory(0x0A00) != 0x0000 {
+		t.Logf("expected to go back to the first ST but IAR = %X and [0A00] = %X", d.cpu.IAR(), d.cpu.ReadMemory(0x0A00))
+		t.FailNow()
+	}
+
+	out.Reset()
+	execute(d, "reverse-continue", t)
+	if d.cpu.IAR() != 0x0500 || !strings.Contains(out.String(), "reached the start of the history") {
+		t.Logf("expected to go back to the start but IAR = %X, got %q", d.cpu.IAR(), out.String())
+		t.FailNow()
+	}
+}
+
+func TestLastWrite(t *testing.T) {
+	d, out := setUpDebugger(t)
+
+	execute(d, "step 11", t)
+	execute(d, "last-write 0x0A00", t)
+	if !strings.Contains(out.String(), "0x0A00 was written by the instruction at 0x0505 2 instructions ago, 0x0002 -> 0x0003") {
+		t.Logf("expected the last ST to be found, got %q", out.String())
+		t.FailNow()
+	}
+
+	execute(d, "last-write 0x0A01", t)
+	if !strings.Contains(out.String(), "0x0A01 has not been written in the history") {
+		t.Logf("expected no write to be found, got %q", out.String())
+		t.FailNow()
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	// room for one snapshot and a few thousand entries
+	d, out := setUpDebuggerWithProgram(INTERRUPTS_PROGRAM, t, WithHistoryBudget(256<<10))
+	d.cpu.SetSP(0xFEFE)
+
+	execute(d, "step 100000", t)
+	if d.history.size != d.history.capacity || len(d.history.snapshots) != 1 {
+		t.Logf("expected the history to be full but it has %d entries and %d snapshots", d.history.size, len(d.history.snapshots))
+		t.FailNow()
+	}
+
+	execute(d, "reverse-step 100000", t)
+	if !strings.Contains(out.String(), "reached the start of the history") || d.cpu.Register(2) < 0x1000 {
+		t.Logf("expected to stop at the start of the history, R2 = %X", d.cpu.Register(2))
+		t.FailNow()
+	}
+}
+
+func TestChangingStateClearsHistory(t *testing.T) {
+	d, out := setUpDebugger(t)
+
+	execute(d, "step 5", t)
+	execute(d, "set R2 0x0010", t)
+	execute(d, "reverse-step", t)
+	if d.cpu.Register(2) != 0x0010 || !strings.Contains(out.String(), "reached the start of the history") {
+		t.Logf("expected the history to be cleared, R2 = %X", d.cpu.Register(2))
+		t.FailNow()
+	}
+
+	d, _ = setUpDebugger(t)
+	if _, err := NewDebugger(d.cpu, nil, out, WithHistoryBudget(0)).Execute("reverse-step"); err == nil {
+		t.Logf("expected an error going back without a history")
+		t.FailNow()
+	}
+}
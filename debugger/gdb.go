@@ -0,0 +1,529 @@
+package debugger
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GDB REMOTE SERIAL PROTOCOL
+// lets gdb (or lldb) drive the debugger over a connection, usually a TCP socket with
+// `target remote localhost:<port>`. The CPU is word addressed but gdb expects bytes, so
+// every address gdb sees is a byte address, twice the word address, with the low byte of
+// each word first, the same as in a bin file. That includes the pc, which is the IAR
+// doubled, and the breakpoint and resume addresses, which are halved on the way in. The
+// registers are sent in the order R0, R1, R2, R3, pc, FLAGS, low byte first. The pc is
+// 32 bits so it can reach the last word, the others are 16, see gdbTargetXML
+
+// GDB_REGISTERS is the number of registers in a g packet
+const GDB_REGISTERS = 6
+
+const (
+	GDB_REGISTER_IAR   = 4
+	GDB_REGISTER_FLAGS = 5
+)
+
+// gdbRegisterBytes is the size of each register in a g packet
+var gdbRegisterBytes = [GDB_REGISTERS]int{2, 2, 2, 2, 4, 2}
+
+// GDB_MEMORY_BYTES is the number of byte addresses gdb can use, two for every word
+const GDB_MEMORY_BYTES = 0x20000
+
+// gdbTargetXML is sent for qXfer:features:read so the client knows the registers in a g
+// packet and which one is the program counter
+const gdbTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <!-- byte address = 2 x word address, low byte first. pc is the IAR as a byte address -->
+  <feature name="org.simple-computer.core">
+    <reg name="r0" bitsize="16" type="uint16" regnum="0"/>
+    <reg name="r1" bitsize="16" type="uint16"/>
+    <reg name="r2" bitsize="16" type="uint16"/>
+    <reg name="r3" bitsize="16" type="uint16"/>
+    <reg name="pc" bitsize="32" type="code_ptr"/>
+    <reg name="flags" bitsize="16" type="uint16"/>
+  </feature>
+</target>
+`
+
+// gdbRegisterNames are the names in gdbTargetXML and the qRegisterInfo replies
+var gdbRegisterNames = [GDB_REGISTERS]string{"r0", "r1", "r2", "r3", "pc", "flags"}
+
+// signal numbers used in stop replies
+const (
+	SIGINT  = 2
+	SIGTRAP = 5
+)
+
+type gdbSession struct {
+	debugger *Debugger
+	conn     io.ReadWriter
+	input    chan byte
+	noAck    bool
+	lastStop Stop
+}
+
+// ServeGDB talks the remote serial protocol over conn until the client detaches, kills
+// the program or closes the connection
+func (d *Debugger) ServeGDB(conn io.ReadWriter) error {
+	s := &gdbSession{debugger: d, conn: conn, input: make(chan byte, 64)}
+
+	// bytes are read in the background so a ctrl-c from the client can interrupt a continue
+	errs := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(conn)
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				errs <- err
+				close(s.input)
+				return
+			}
+			s.input <- b
+		}
+	}()
+
+	for {
+		packet, ok := s.readPacket()
+		if !ok {
+			if err := <-errs; err != io.EOF {
+				return err
+			}
+			return nil
+		}
+
+		if packet == "k" {
+			// kill has no reply
+			return nil
+		}
+
+		reply, done := s.handle(packet)
+		if err := s.writePacket(reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// readPacket waits for a $<data>#<checksum> packet, acking it unless no ack mode is on.
+// Anything outside a packet (acks, stray interrupts) is ignored
+func (s *gdbSession) readPacket() (string, bool) {
+	for {
+		b, ok := <-s.input
+		if !ok {
+			return "", false
+		}
+		if b != '$' {
+			continue
+		}
+
+		var data []byte
+		for b, ok = <-s.input; ok && b != '#'; b, ok = <-s.input {
+			data = append(data, b)
+		}
+		checksum := make([]byte, 2)
+		for i := range checksum {
+			if checksum[i], ok = <-s.input; !ok {
+				return "", false
+			}
+		}
+
+		if s.noAck {
+			return string(data), true
+		}
+		expected, err := strconv.ParseUint(string(checksum), 16, 8)
+		if err != nil || uint8(expected) != gdbChecksum(data) {
+			s.conn.Write([]byte("-"))
+			continue
+		}
+		s.conn.Write([]byte("+"))
+		return string(data), true
+	}
+}
+
+func (s *gdbSession) writePacket(data string) error {
+	_, err := fmt.Fprintf(s.conn, "$%s#%02x", data, gdbChecksum([]byte(data)))
+	return err
+}
+
+// handle runs a packet and returns the reply, done is true when the session is over
+func (s *gdbSession) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", false
+	}
+	c := s.debugger.cpu
+	args := packet[1:]
+
+	switch packet[0] {
+	case '?':
+		return s.stopReply(), false
+	case 'g':
+		var registers []byte
+		for i := 0; i < GDB_REGISTERS; i++ {
+			registers = append(registers, littleEndian(s.register(i), gdbRegisterBytes[i])...)
+		}
+		return hex.EncodeToString(registers), false
+	case 'G':
+		registers, err := hex.DecodeString(args)
+		if err != nil || len(registers) != registerOffset(GDB_REGISTERS) {
+			return "E01", false
+		}
+		for i := 0; i < GDB_REGISTERS; i++ {
+			s.setRegister(i, fromLittleEndian(registers[registerOffset(i):registerOffset(i+1)]))
+		}
+		s.debugger.history.clear()
+		return "OK", false
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= GDB_REGISTERS {
+			return "E01", false
+		}
+		return hex.EncodeToString(littleEndian(s.register(int(n)), gdbRegisterBytes[n])), false
+	case 'P':
+		parts := strings.SplitN(args, "=", 2)
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		n, err := strconv.ParseUint(parts[0], 16, 8)
+		value, valueErr := hex.DecodeString(parts[1])
+		if err != nil || valueErr != nil || n >= GDB_REGISTERS || len(value) != gdbRegisterBytes[n] {
+			return "E01", false
+		}
+		s.setRegister(int(n), fromLittleEndian(value))
+		s.debugger.history.clear()
+		return "OK", false
+	case 'm':
+		address, length, err := parseAddressLength(args)
+		if err != nil || !inMemory(address, length) {
+			return "E01", false
+		}
+		var memory []byte
+		for i := address; i < address+length; i++ {
+			memory = append(memory, byte(c.ReadMemory(uint16(i/2))>>(8*(i%2))))
+		}
+		return hex.EncodeToString(memory), false
+	case 'M':
+		parts := strings.SplitN(args, ":", 2)
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		address, length, err := parseAddressLength(parts[0])
+		memory, dataErr := hex.DecodeString(parts[1])
+		if err != nil || dataErr != nil || !inMemory(address, length) || int(length) != len(memory) {
+			return "E01", false
+		}
+		// a byte is written by changing its half of the word it is in
+		for i, b := range memory {
+			address := address + uint32(i)
+			shift := 8 * (address % 2)
+			word := c.ReadMemory(uint16(address / 2))
+			c.WriteMemory(uint16(address/2), word&^(0xFF<<shift)|uint16(b)<<shift)
+		}
+		s.debugger.history.clear()
+		return "OK", false
+	case 'Z', 'z':
+		return s.handleBreakpoint(packet[0] == 'Z', args), false
+	case 's':
+		if !s.resumeAt(args) {
+			return "E01", false
+		}
+		s.lastStop = s.debugger.StepInstruction()
+		return s.stopReply(), false
+	case 'c':
+		if !s.resumeAt(args) {
+			return "E01", false
+		}
+		s.lastStop = s.continueUntilStopped()
+		return s.stopReply(), false
+	case 'b':
+		// reverse step and continue, gdb's reverse-stepi and reverse-continue
+		var err error
+		switch args {
+		case "s":
+			s.lastStop, err = s.debugger.ReverseStep(1)
+		case "c":
+			s.lastStop, err = s.debugger.ReverseContinue()
+		default:
+			return "", false
+		}
+		if err != nil {
+			return "E01", false
+		}
+		return s.stopReply(), false
+	case 'H':
+		// there is only one thread
+		return "OK", false
+	case 'D':
+		return "OK", true
+	case 'q':
+		return s.handleQuery(packet), false
+	case 'Q':
+		if packet == "QStartNoAckMode" {
+			// replies are never resent so only the incoming packets change
+			s.noAck = true
+			return "OK", false
+		}
+	}
+
+	// an empty reply tells the client the packet is not supported
+	return "", false
+}
+
+func (s *gdbSession) handleQuery(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return "PacketSize=1000;QStartNoAckMode+;qXfer:features:read+;ReverseStep+;ReverseContinue+"
+	case strings.HasPrefix(packet, "qXfer:features:read:"):
+		return readXfer(strings.TrimPrefix(packet, "qXfer:features:read:"))
+	case strings.HasPrefix(packet, "qRegisterInfo"):
+		return registerInfo(strings.TrimPrefix(packet, "qRegisterInfo"))
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// readXfer answers a qXfer:features:read packet, <annex>:<offset>,<length>, with the part of
+// the target description asked for, starting m if there is more to come or l if not
+func readXfer(args string) string {
+	parts := strings.SplitN(args, ":", 2)
+	if len(parts) != 2 {
+		return "E00"
+	}
+	if parts[0] != "target.xml" {
+		return "E00"
+	}
+	offset, length, err := parseAddressLength(parts[1])
+	if err != nil {
+		return "E00"
+	}
+
+	if offset >= uint32(len(gdbTargetXML)) {
+		return "l"
+	}
+	if uint64(offset)+uint64(length) >= uint64(len(gdbTargetXML)) {
+		return "l" + gdbTargetXML[offset:]
+	}
+	return "m" + gdbTargetXML[offset:offset+length]
+}
+
+// registerInfo answers lldb's qRegisterInfo<n> packet, which it uses instead of the target
+// description, with E45 once n is past the last register
+func registerInfo(args string) string {
+	n, err := strconv.ParseUint(args, 16, 8)
+	if err != nil || n >= GDB_REGISTERS {
+		return "E45"
+	}
+
+	info := fmt.Sprintf("name:%s;bitsize:%d;offset:%d;encoding:uint;format:hex;set:General Purpose Registers;dwarf:%d;", gdbRegisterNames[n], gdbRegisterBytes[n]*8, registerOffset(int(n)), n)
+	switch n {
+	case GDB_REGISTER_IAR:
+		info += "generic:pc;"
+	case GDB_REGISTER_FLAGS:
+		info += "generic:flags;"
+	}
+	return info
+}
+
+// handleBreakpoint adds or removes a breakpoint (type 0 or 1) or a watchpoint (type 2
+// write, 3 read, 4 access) from a Z or z packet: <type>,<address>,<kind>. Breakpoints
+// go on the word the byte address is in, watchpoints cover every word in the kind bytes
+// from the address
+func (s *gdbSession) handleBreakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) < 2 {
+		return "E01"
+	}
+	address, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return "E01"
+	}
+
+	var watch Watch
+	switch parts[0] {
+	case "0", "1":
+		if !inMemory(uint32(address), 1) {
+			return "E01"
+		}
+		if insert {
+			s.debugger.AddBreakpoint(uint16(address / 2))
+		} else {
+			s.debugger.RemoveBreakpoint(uint16(address / 2))
+		}
+		return "OK"
+	case "2":
+		watch = WATCH_WRITE
+	case "3":
+		watch = WATCH_READ
+	case "4":
+		watch = WATCH_READ_WRITE
+	default:
+		return ""
+	}
+
+	length := uint64(1)
+	if len(parts) > 2 {
+		if length, err = strconv.ParseUint(parts[2], 16, 32); err != nil || length == 0 {
+			return "E01"
+		}
+	}
+	if !inMemory(uint32(address), uint32(length)) {
+		return "E01"
+	}
+
+	for word := address / 2; word <= (address+length-1)/2; word++ {
+		if insert {
+			s.debugger.AddWatchpoint(uint16(word), watch)
+		} else {
+			s.debugger.RemoveWatchpoint(uint16(word))
+		}
+	}
+	return "OK"
+}
+
+// continueUntilStopped runs the debugger until it stops, interrupting it if the client
+// sends a ctrl-c (0x03) in the meantime
+func (s *gdbSession) continueUntilStopped() Stop {
+	done := make(chan Stop, 1)
+	go func() {
+		done <- s.debugger.Continue()
+	}()
+
+	for {
+		select {
+		case stop := <-done:
+			return stop
+		case b, ok := <-s.input:
+			if !ok || b == 0x03 {
+				s.debugger.Interrupt()
+			}
+			if !ok {
+				return <-done
+			}
+		}
+	}
+}
+
+// resumeAt handles the optional byte address on an s or c packet
+func (s *gdbSession) resumeAt(args string) bool {
+	if args == "" {
+		return true
+	}
+	address, err := strconv.ParseUint(args, 16, 32)
+	if err != nil || !inMemory(uint32(address), 1) {
+		return false
+	}
+	s.debugger.cpu.SetIAR(uint16(address / 2))
+	s.debugger.history.clear()
+	return true
+}
+
+func (s *gdbSession) stopReply() string {
+	switch s.lastStop.Reason {
+	case STOP_INTERRUPTED:
+		return fmt.Sprintf("S%02x", SIGINT)
+	case STOP_WATCHPOINT:
+		watch := "rwatch"
+		if s.lastStop.Write {
+			watch = "watch"
+		}
+		if s.debugger.watchpoints[s.lastStop.Address] == WATCH_READ_WRITE {
+			watch = "awatch"
+		}
+		return fmt.Sprintf("T%02x%s:%x;", SIGTRAP, watch, uint32(s.lastStop.Address)*2)
+	case STOP_BREAKPOINT:
+		return fmt.Sprintf("T%02xswbreak:;", SIGTRAP)
+	case STOP_HISTORY_START:
+		return fmt.Sprintf("T%02xreplaylog:begin;", SIGTRAP)
+	}
+	return fmt.Sprintf("S%02x", SIGTRAP)
+}
+
+// register returns a register as gdb sees it, the pc is a byte address
+func (s *gdbSession) register(n int) uint32 {
+	c := s.debugger.cpu
+	switch n {
+	case GDB_REGISTER_IAR:
+		return uint32(c.IAR()) * 2
+	case GDB_REGISTER_FLAGS:
+		return uint32(c.Flags())
+	}
+	return uint32(c.Register(n))
+}
+
+func (s *gdbSession) setRegister(n int, value uint32) {
+	c := s.debugger.cpu
+	switch n {
+	case GDB_REGISTER_IAR:
+		c.SetIAR(uint16(value / 2))
+	case GDB_REGISTER_FLAGS:
+		c.SetFlags(uint16(value))
+	default:
+		c.SetRegister(n, uint16(value))
+	}
+}
+
+// registerOffset is where register n starts in a g packet, in bytes
+func registerOffset(n int) int {
+	offset := 0
+	for i := 0; i < n; i++ {
+		offset += gdbRegisterBytes[i]
+	}
+	return offset
+}
+
+func parseAddressLength(s string) (uint32, uint32, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected <address>,<length> but got '%s'", s)
+	}
+	address, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(address), uint32(length), nil
+}
+
+// inMemory is true when every byte in the length bytes from the byte address is in memory
+func inMemory(address, length uint32) bool {
+	return uint64(address)+uint64(length) <= GDB_MEMORY_BYTES
+}
+
+func littleEndian(value uint32, size int) []byte {
+	bytes := make([]byte, size)
+	for i := range bytes {
+		bytes[i] = byte(value >> (8 * i))
+	}
+	return bytes
+}
+
+func fromLittleEndian(bytes []byte) uint32 {
+	var value uint32
+	for i, b := range bytes {
+		value |= uint32(b) << (8 * i)
+	}
+	return value
+}
+
+func gdbChecksum(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
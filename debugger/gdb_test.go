@@ -0,0 +1,253 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+type gdbClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	t      *testing.T
+}
+
+func setUpGDB(t *testing.T) (*Debugger, *gdbClient, chan error) {
+	d, _ := setUpDebugger(t)
+	server, client := net.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.ServeGDB(server)
+		server.Close()
+	}()
+
+	return d, &gdbClient{client, bufio.NewReader(client), t}, done
+}
+
+// send writes a packet and returns the reply, checking it was acked and its checksum
+func (g *gdbClient) send(packet string) string {
+	fmt.Fprintf(g.conn, "$%s#%02x", packet, gdbChecksum([]byte(packet)))
+
+	if ack, _ := g.reader.ReadByte(); ack != '+' {
+		g.t.Logf("expected %s to be acked but got %q", packet, ack)
+		g.t.FailNow()
+	}
+	return g.reply()
+}
+
+func (g *gdbClient) reply() string {
+	if start, _ := g.reader.ReadByte(); start != '$' {
+		g.t.Logf("expected start of a packet but got %q", start)
+		g.t.FailNow()
+	}
+	data, _ := g.reader.ReadString('#')
+	data = strings.TrimSuffix(data, "#")
+
+	checksum := make([]byte, 2)
+	g.reader.Read(checksum)
+	if string(checksum) != fmt.Sprintf("%02x", gdbChecksum([]byte(data))) {
+		g.t.Logf("bad checksum %s for %s", checksum, data)
+		g.t.FailNow()
+	}
+	return data
+}
+
+func (g *gdbClient) expect(packet, expected string) {
+	if reply := g.send(packet); reply != expected {
+		g.t.Logf("expected %s to reply %q but got %q", packet, expected, reply)
+		g.t.FailNow()
+	}
+}
+
+func TestGDBRegistersAndMemory(t *testing.T) {
+	d, g, done := setUpGDB(t)
+
+	g.expect("?", "S05")
+	g.expect("g", "0000000000000000000a00000000")
+	// DATA R0, 0x0A00, memory is byte addressed so word 0x0500 is at 0x0A00
+	g.expect("ma00,4", "2000000a")
+	g.expect("ma01,2", "0000")
+	g.expect("ma03,1", "0a")
+	g.expect("m1fffe,4", "E01")
+
+	g.expect("G"+"3412"+"0100"+"0200"+"0300"+"000a0000"+"0080", "OK")
+	if d.cpu.Register(0) != 0x1234 || d.cpu.Flags() != 0x8000 {
+		t.Logf("expected R0 = 1234 and FLAGS = 8000 but got %X and %X", d.cpu.Register(0), d.cpu.Flags())
+		t.FailNow()
+	}
+	g.expect("p3", "0300")
+	g.expect("P3=efbe", "OK")
+	g.expect("p3", "efbe")
+	g.expect("p6", "E01")
+
+	g.expect("M1400,4:01000200", "OK")
+	if d.cpu.ReadMemory(0x0A00) != 0x0001 || d.cpu.ReadMemory(0x0A01) != 0x0002 {
+		t.Logf("memory was not written")
+		t.FailNow()
+	}
+	g.expect("M1401,2:ff03", "OK")
+	if d.cpu.ReadMemory(0x0A00) != 0xFF01 || d.cpu.ReadMemory(0x0A01) != 0x0003 {
+		t.Logf("expected odd bytes to be written into 0A00 and 0A01 but got %04X and %04X", d.cpu.ReadMemory(0x0A00), d.cpu.ReadMemory(0x0A01))
+		t.FailNow()
+	}
+	g.expect("M1401,2:ff", "E01")
+	g.expect("vMustReplyEmpty", "")
+
+	g.expect("D", "OK")
+	if err := <-done; err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+}
+
+func TestGDBStepAndBreakpoints(t *testing.T) {
+	d, g, _ := setUpGDB(t)
+
+	g.expect("s", "S05")
+	if d.cpu.IAR() != 0x0502 || d.cpu.Register(0) != 0x0A00 {
+		t.Logf("expected one instruction to run but IAR = %X", d.cpu.IAR())
+		t.FailNow()
+	}
+
+	g.expect("Z0,a08,2", "OK")
+	g.expect("c", "T05swbreak:;")
+	if d.cpu.IAR() != 0x0504 {
+		t.Logf("expected to stop at 504 but IAR = %X", d.cpu.IAR())
+		t.FailNow()
+	}
+	g.expect("z0,a08,2", "OK")
+
+	// watchpoints are at byte addresses
+	g.expect("Z2,1400,2", "OK")
+	g.expect("c", "T05watch:1400;")
+	g.expect("z2,1400,2", "OK")
+	g.expect("Z3,1400,2", "OK")
+
+	// nothing reads 0A00 so only an interrupt will stop it
+	g.conn.Write([]byte("$c#63"))
+	if ack, _ := g.reader.ReadByte(); ack != '+' {
+		t.Logf("expected c to be acked")
+		t.FailNow()
+	}
+	g.conn.Write([]byte{0x03})
+	if reply := g.reply(); reply != "S02" {
+		t.Logf("expected interrupt to stop with S02 but got %s", reply)
+		t.FailNow()
+	}
+	g.expect("?", "S02")
+}
+
+func TestGDBPCIsAByteAddress(t *testing.T) {
+	d, g, _ := setUpGDB(t)
+
+	g.expect("s", "S05")
+	// IAR 0x0502 is byte address 0x0A04
+	g.expect("p4", "040a0000")
+	pc := d.cpu.IAR()
+	instruction := d.cpu.ReadMemory(pc)
+	g.expect("ma04,2", fmt.Sprintf("%02x%02x", byte(instruction), byte(instruction>>8)))
+
+	g.expect("P4=080a0000", "OK")
+	if d.cpu.IAR() != 0x0504 {
+		t.Logf("expected setting pc to 0A08 to set IAR to 0504 but got %X", d.cpu.IAR())
+		t.FailNow()
+	}
+	g.expect("P4=0000", "E01")
+
+	// resuming at a byte address
+	g.expect("sa00", "S05")
+	if d.cpu.IAR() != 0x0502 {
+		t.Logf("expected to step from 0500 to 0502 but IAR = %X", d.cpu.IAR())
+		t.FailNow()
+	}
+}
+
+func TestGDBReverse(t *testing.T) {
+	d, g, _ := setUpGDB(t)
+
+	g.expect("Z0,a08,2", "OK")
+	g.expect("c", "T05swbreak:;")
+	g.expect("c", "T05swbreak:;")
+
+	g.expect("bs", "S05")
+	if d.cpu.IAR() != 0x0506 || d.cpu.Register(2) != 0x0001 {
+		t.Logf("expected to go back to JMP but IAR = %X", d.cpu.IAR())
+		t.FailNow()
+	}
+	g.expect("bc", "T05swbreak:;")
+	if d.cpu.IAR() != 0x0504 || d.cpu.Register(2) != 0x0000 {
+		t.Logf("expected to go back to the first time round the loop but IAR = %X and R2 = %X", d.cpu.IAR(), d.cpu.Register(2))
+		t.FailNow()
+	}
+	g.expect("bc", "T05replaylog:begin;")
+	g.expect("bx", "")
+}
+
+func TestGDBNoAckMode(t *testing.T) {
+	_, g, _ := setUpGDB(t)
+
+	g.expect("qSupported:multiprocess+", "PacketSize=1000;QStartNoAckMode+;qXfer:features:read+;ReverseStep+;ReverseContinue+")
+	g.expect("QStartNoAckMode", "OK")
+
+	fmt.Fprintf(g.conn, "$g#67")
+	if reply := g.reply(); reply != "0000000000000000000a00000000" {
+		t.Logf("expected registers without an ack but got %s", reply)
+		t.FailNow()
+	}
+}
+
+func TestGDBTargetDescription(t *testing.T) {
+	d, g, _ := setUpGDB(t)
+
+	if reply := g.send("qSupported:xmlRegisters=i386"); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Logf("expected qXfer:features:read to be supported but got %s", reply)
+		t.FailNow()
+	}
+
+	// read it in small pieces the way gdb does with a small packet size
+	var xml string
+	for {
+		reply := g.send(fmt.Sprintf("qXfer:features:read:target.xml:%x,40", len(xml)))
+		xml += reply[1:]
+		if reply[0] == 'l' {
+			break
+		}
+		if reply[0] != 'm' {
+			t.Logf("expected a part of the target description but got %s", reply)
+			t.FailNow()
+		}
+	}
+	if xml != gdbTargetXML {
+		t.Logf("expected the target description but got %s", xml)
+		t.FailNow()
+	}
+	for _, reg := range []string{`name="r0"`, `name="r3"`, `name="pc" bitsize="32" type="code_ptr"`, `name="flags"`} {
+		if !strings.Contains(xml, reg) {
+			t.Logf("expected %s in the target description", reg)
+			t.FailNow()
+		}
+	}
+	g.expect("qXfer:features:read:other.xml:0,40", "E00")
+
+	// the 5th register is the pc
+	d.cpu.SetRegister(1, 0xBEEF)
+	g.expect("g", "0000efbe00000000"+"000a0000"+"0000")
+
+	g.expect("qRegisterInfo0", "name:r0;bitsize:16;offset:0;encoding:uint;format:hex;set:General Purpose Registers;dwarf:0;")
+	g.expect("qRegisterInfo4", "name:pc;bitsize:32;offset:8;encoding:uint;format:hex;set:General Purpose Registers;dwarf:4;generic:pc;")
+	g.expect("qRegisterInfo6", "E45")
+}
+
+func TestGDBBadChecksumIsNacked(t *testing.T) {
+	_, g, _ := setUpGDB(t)
+
+	g.conn.Write([]byte("$g#00"))
+	if nack, _ := g.reader.ReadByte(); nack != '-' {
+		t.Logf("expected bad checksum to be nacked but got %q", nack)
+		t.FailNow()
+	}
+	g.expect("g", "0000000000000000000a00000000")
+}
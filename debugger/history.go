@@ -0,0 +1,336 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"unsafe"
+
+	"github.com/djhworld/simple-computer/cpu"
+)
+
+// HISTORY
+// the debugger keeps a history of the instructions it has run so it can go backwards.
+// Each instruction gets an undo entry holding the registers from before it ran and the
+// memory it wrote, and every so often there is a snapshot of the whole core. Going back
+// undoes the entries one by one, or when an entry can't be undone (it changed whether
+// interrupts are enabled, halted the CPU, or the CPU is part way through an instruction)
+// the nearest older snapshot is restored and the instructions after it are run again.
+// ----------------------
+// the entries are a ring buffer and the oldest ones are dropped once the memory budget
+// is used up, a quarter of it goes on snapshots and the rest on entries. Peripherals are
+// not part of the history, running instructions again repeats any output they did
+
+// DEFAULT_HISTORY_BUDGET is the memory the history uses unless WithHistoryBudget is given
+const DEFAULT_HISTORY_BUDGET = 64 << 20
+
+// MAX_UNDO_WRITES is the most memory writes an entry can undo, an interrupt cycle pushes
+// IAR and FLAGS and no instruction writes more than that
+const MAX_UNDO_WRITES = 2
+
+// Write is a memory write found in the history, Ago is how many instructions have run
+// since the instruction at IAR that made it (0 if it is the current one)
+type Write struct {
+	Address uint16
+	Old     uint16
+	New     uint16
+	IAR     uint16
+	Ago     uint64
+}
+
+type memoryWrite struct {
+	address, old, new uint16
+}
+
+// undoEntry is the state before an instruction ran and the memory it changed
+type undoEntry struct {
+	registers         [4]uint16
+	iar, ir, sp       uint16
+	flags             uint16
+	interruptsEnabled bool
+	undoable          bool
+	writes            uint8
+	memory            [MAX_UNDO_WRITES]memoryWrite
+}
+
+type historySnapshot struct {
+	// the number of instructions that had run when it was taken
+	instruction uint64
+	data        []byte
+}
+
+type history struct {
+	core cpu.Core
+
+	budget   int
+	capacity int
+
+	// ring buffer of entries, head is the oldest and size the number in use
+	entries []undoEntry
+	head    int
+	size    int
+
+	// instructions is the number of instructions that have finished, the entry for the
+	// instruction that is running (if there is one) is current
+	instructions uint64
+	running      bool
+	current      undoEntry
+
+	snapshots []historySnapshot
+	slots     int
+	interval  uint64
+
+	// nothing is recorded while the history is putting the core back
+	rewinding bool
+}
+
+func newHistory(core cpu.Core, budget int) *history {
+	h := &history{core: core, budget: budget}
+	h.capacity = budget / 4 * 3 / int(unsafe.Sizeof(undoEntry{}))
+	return h
+}
+
+func (h *history) enabled() bool {
+	return h.capacity > 0
+}
+
+// clear forgets everything, it is called when the registers or memory are changed by
+// hand as running the instructions again would not make the same changes
+func (h *history) clear() {
+	h.entries = h.entries[:0]
+	h.head, h.size = 0, 0
+	h.instructions = 0
+	h.running = false
+	h.snapshots = nil
+}
+
+// beforeStep starts a new entry if the step about to run is the first of an instruction
+func (h *history) beforeStep() error {
+	if !h.enabled() || h.rewinding || h.running || h.core.Halted() {
+		return nil
+	}
+
+	if len(h.snapshots) == 0 || h.instructions-h.snapshots[len(h.snapshots)-1].instruction >= h.interval {
+		if err := h.takeSnapshot(); err != nil {
+			return err
+		}
+	}
+
+	c := h.core
+	h.current = undoEntry{iar: c.IAR(), ir: c.IR(), sp: c.SP(), flags: c.Flags(), interruptsEnabled: c.InterruptsEnabled()}
+	// if the history was cleared part way through an instruction, undoing the entry would
+	// leave the stepper where it is, so only the snapshot can get back to it
+	h.current.undoable = c.InstructionDone() || c.Phase() == 0
+	for i := range h.current.registers {
+		h.current.registers[i] = c.Register(i)
+	}
+	h.running = true
+	return nil
+}
+
+// afterStep finishes the entry once the instruction is done
+func (h *history) afterStep() {
+	if !h.running || h.rewinding || !h.core.InstructionDone() {
+		return
+	}
+
+	for i := 0; i < int(h.current.writes); i++ {
+		h.current.memory[i].new = h.core.ReadMemory(h.current.memory[i].address)
+	}
+	if h.core.Halted() || h.core.InterruptsEnabled() != h.current.interruptsEnabled {
+		h.current.undoable = false
+	}
+	h.push(h.current)
+	h.instructions++
+	h.running = false
+}
+
+// recordWrite is called before memory is written, while it still holds the old value
+func (h *history) recordWrite(address uint16) {
+	if !h.running || h.rewinding {
+		return
+	}
+	if int(h.current.writes) == MAX_UNDO_WRITES {
+		h.current.undoable = false
+		return
+	}
+	h.current.memory[h.current.writes] = memoryWrite{address: address, old: h.core.ReadMemory(address)}
+	h.current.writes++
+}
+
+func (h *history) takeSnapshot() error {
+	out := new(bytes.Buffer)
+	if err := h.core.Snapshot(out); err != nil {
+		return err
+	}
+
+	if h.slots == 0 {
+		// the size of a snapshot is only known once one has been taken
+		h.slots = h.budget / 4 / out.Len()
+		if h.slots < 1 {
+			h.slots = 1
+		}
+		h.interval = uint64(h.capacity / h.slots)
+		if h.interval < 1 {
+			h.interval = 1
+		}
+	}
+	if len(h.snapshots) == h.slots {
+		h.snapshots = append(h.snapshots[:0], h.snapshots[1:]...)
+	}
+	h.snapshots = append(h.snapshots, historySnapshot{instruction: h.instructions, data: out.Bytes()})
+	return nil
+}
+
+func (h *history) push(e undoEntry) {
+	switch {
+	case h.size < len(h.entries):
+		h.entries[(h.head+h.size)%len(h.entries)] = e
+		h.size++
+	case len(h.entries) < h.capacity:
+		// nothing has been dropped yet so head is 0
+		h.entries = append(h.entries, e)
+		h.size++
+	default:
+		h.entries[h.head] = e
+		h.head = (h.head + 1) % len(h.entries)
+	}
+}
+
+// entry returns the entry for the given instruction, which must be in the history
+func (h *history) entry(instruction uint64) *undoEntry {
+	if instruction == h.instructions && h.running {
+		return &h.current
+	}
+	oldest := h.instructions - uint64(h.size)
+	return &h.entries[(h.head+int(instruction-oldest))%len(h.entries)]
+}
+
+// oldest is the furthest back the history can go
+func (h *history) oldest() uint64 {
+	first := h.instructions - uint64(h.size)
+
+	// entries can be undone back to the newest one that can't
+	undo := h.instructions
+	if !h.running {
+		for undo > first && h.entry(undo-1).undoable {
+			undo--
+		}
+	}
+
+	// otherwise the oldest snapshot has to be run on from
+	if len(h.snapshots) == 0 {
+		return undo
+	}
+	snapshot := h.snapshots[0].instruction
+	if snapshot < first {
+		snapshot = first
+	}
+	if snapshot < undo {
+		return snapshot
+	}
+	return undo
+}
+
+// rewind puts the core back to how it was before the given instruction ran, the entries
+// after it are dropped
+func (h *history) rewind(instruction uint64) error {
+	if instruction < h.oldest() || instruction > h.instructions {
+		return fmt.Errorf("instruction %d is not in the history", instruction)
+	}
+	h.rewinding = true
+	defer func() { h.rewinding = false }()
+
+	undo := !h.running
+	for i := instruction; undo && i < h.instructions; i++ {
+		undo = h.entry(i).undoable
+	}
+
+	if undo {
+		for h.instructions > instruction {
+			h.undo(h.entry(h.instructions - 1))
+			h.pop()
+		}
+	} else if err := h.replay(instruction); err != nil {
+		return err
+	}
+
+	h.running = false
+	for len(h.snapshots) > 0 && h.snapshots[len(h.snapshots)-1].instruction > instruction {
+		h.snapshots = h.snapshots[:len(h.snapshots)-1]
+	}
+	return nil
+}
+
+// undo puts back the memory an entry wrote, newest first, then its registers
+func (h *history) undo(e *undoEntry) {
+	for i := int(e.writes) - 1; i >= 0; i-- {
+		h.core.WriteMemory(e.memory[i].address, e.memory[i].old)
+	}
+	for i := range e.registers {
+		h.core.SetRegister(i, e.registers[i])
+	}
+	h.core.SetIAR(e.iar)
+	h.core.SetIR(e.ir)
+	h.core.SetSP(e.sp)
+	h.core.SetFlags(e.flags)
+}
+
+// replay restores the newest snapshot from before the given instruction and runs on to it
+func (h *history) replay(instruction uint64) error {
+	n := len(h.snapshots) - 1
+	for n >= 0 && h.snapshots[n].instruction > instruction {
+		n--
+	}
+	if n < 0 {
+		return fmt.Errorf("no snapshot from before instruction %d", instruction)
+	}
+
+	snapshot := h.snapshots[n]
+	if err := h.core.Restore(bytes.NewReader(snapshot.data)); err != nil {
+		return err
+	}
+	for i := snapshot.instruction; i < instruction; i++ {
+		h.core.Step()
+		for !h.core.InstructionDone() {
+			h.core.Step()
+		}
+	}
+
+	for h.instructions > instruction {
+		h.pop()
+	}
+	return nil
+}
+
+// pop drops the newest entry
+func (h *history) pop() {
+	h.instructions--
+	if h.size > 0 {
+		h.size--
+	}
+}
+
+// lastWrite searches back through the history for the last write to an address
+func (h *history) lastWrite(address uint16) (Write, bool) {
+	first := h.instructions - uint64(h.size)
+	last := h.instructions
+	if h.running {
+		last++
+	}
+
+	for i := last; i > first; i-- {
+		e := h.entry(i - 1)
+		for j := int(e.writes) - 1; j >= 0; j-- {
+			if e.memory[j].address != address {
+				continue
+			}
+			w := Write{Address: address, Old: e.memory[j].old, New: e.memory[j].new, IAR: e.iar, Ago: h.instructions - (i - 1)}
+			if i-1 == h.instructions {
+				// still running, so the write has only just happened
+				w.New = h.core.ReadMemory(address)
+			}
+			return w, true
+		}
+	}
+	return Write{}, false
+}
@@ -0,0 +1,302 @@
+package executable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// an executable is little-endian binary
+// ----------------------
+// "SCEX"                                      magic
+// uint16                                      version
+// uint16                                      entry point
+// uint16                                      number of segments
+// each segment
+//     uint16                                  load address
+//     uint32 + words                          the words to load there
+// sections, until a section of kind 0
+//     uint8                                   kind, SYMBOLS_SECTION or LINES_SECTION
+//     uint32                                  length in bytes, sections that are not known are skipped
+//     ...
+//
+// Read also takes Intel HEX and S-records, see records.go. Anything else that does not start
+// with the magic is a raw bin, the words are loaded at RAW_ORIGIN and run from there
+
+const MAGIC = "SCEX"
+const VERSION = uint16(1)
+
+// RAW_ORIGIN is where a bin without a header is loaded and run from
+const RAW_ORIGIN = uint16(0x0500)
+
+// the kinds of optional section after the segments
+const (
+	END_SECTION = uint8(iota)
+	// uint32 count, then each name as a uint16 length and bytes followed by its uint16 address
+	SYMBOLS_SECTION
+	// uint32 count, then each uint16 address, the file as a uint16 length and bytes and the uint32 line
+	LINES_SECTION
+)
+
+// Segment is words to load at Address
+type Segment struct {
+	Address uint16
+	Words   []uint16
+}
+
+// SourceLine is the source line that the instruction at Address came from
+type SourceLine struct {
+	Address uint16
+	File    string
+	Line    int
+}
+
+// Executable is a program with where to load it and where to start running it
+type Executable struct {
+	Entry    uint16
+	Segments []Segment
+
+	// Symbols and Lines are optional, they are for debuggers
+	Symbols map[string]uint16
+	Lines   []SourceLine
+}
+
+// Raw is the executable for a bin without a header, loaded and run at RAW_ORIGIN
+func Raw(words []uint16) *Executable {
+	return &Executable{Entry: RAW_ORIGIN, Segments: []Segment{{RAW_ORIGIN, words}}}
+}
+
+// Write writes the executable with a header, see Read
+func (e *Executable) Write(w io.Writer) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	write := func(w io.Writer, values ...interface{}) {
+		for _, v := range values {
+			binary.Write(w, binary.LittleEndian, v)
+		}
+	}
+	writeString := func(w io.Writer, s string) {
+		write(w, uint16(len(s)))
+		io.WriteString(w, s)
+	}
+	writeSection := func(kind uint8, payload *bytes.Buffer) {
+		write(out, kind, uint32(payload.Len()))
+		out.Write(payload.Bytes())
+	}
+
+	out.WriteString(MAGIC)
+	write(out, VERSION, e.Entry, uint16(len(e.Segments)))
+	for _, segment := range e.Segments {
+		write(out, segment.Address, uint32(len(segment.Words)), segment.Words)
+	}
+
+	if len(e.Symbols) > 0 {
+		names := make([]string, 0, len(e.Symbols))
+		for name := range e.Symbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		payload := &bytes.Buffer{}
+		write(payload, uint32(len(names)))
+		for _, name := range names {
+			writeString(payload, name)
+			write(payload, e.Symbols[name])
+		}
+		writeSection(SYMBOLS_SECTION, payload)
+	}
+
+	if len(e.Lines) > 0 {
+		payload := &bytes.Buffer{}
+		write(payload, uint32(len(e.Lines)))
+		for _, line := range e.Lines {
+			write(payload, line.Address)
+			writeString(payload, line.File)
+			write(payload, uint32(line.Line))
+		}
+		writeSection(LINES_SECTION, payload)
+	}
+
+	write(out, END_SECTION)
+	return out.Flush()
+}
+
+// validate checks every segment fits in memory and none of them overlap
+func (e *Executable) validate() error {
+	if len(e.Segments) > 0xFFFF {
+		return fmt.Errorf("an executable can have at most %d segments", 0xFFFF)
+	}
+
+	segments := make([]Segment, len(e.Segments))
+	copy(segments, e.Segments)
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Address < segments[j].Address })
+
+	end := 0
+	for i, segment := range segments {
+		if int(segment.Address)+len(segment.Words) > 0x10000 {
+			return fmt.Errorf("segment at 0x%04X of %d words goes past the end of memory", segment.Address, len(segment.Words))
+		}
+		if i > 0 && int(segment.Address) < end {
+			return fmt.Errorf("segment at 0x%04X overlaps the segment at 0x%04X", segment.Address, segments[i-1].Address)
+		}
+		end = int(segment.Address) + len(segment.Words)
+	}
+	return nil
+}
+
+// Read reads an executable written by Write, Intel HEX, S-records or a raw bin of
+// little-endian words. Records are only recognised if the first one is valid, anything
+// else is read as a bin
+func Read(r io.Reader) (*Executable, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(MAGIC)) {
+		switch recordFormat(data) {
+		case ':':
+			return ReadIntelHex(bytes.NewReader(data))
+		case 'S':
+			return ReadSRecord(bytes.NewReader(data))
+		}
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("size of bin is not an even number (bytes = %d)", len(data))
+		}
+		words := make([]uint16, len(data)/2)
+		for i := range words {
+			words[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+		return Raw(words), nil
+	}
+
+	e, err := parse(bytes.NewReader(data[len(MAGIC):]))
+	if err != nil {
+		return nil, fmt.Errorf("executable is not valid: %v", err)
+	}
+	return e, nil
+}
+
+// ReadFile reads an executable or raw bin from a file. Files ending .hex or .ihex are always
+// read as Intel HEX and .srec, .s19, .s28, .s37 or .mot as S-records, so a mistake in the
+// first record is reported rather than the file being loaded as a bin
+func ReadFile(filename string) (*Executable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".hex", ".ihex":
+		return ReadIntelHex(f)
+	case ".srec", ".s19", ".s28", ".s37", ".mot":
+		return ReadSRecord(f)
+	}
+	return Read(f)
+}
+
+func parse(in *bytes.Reader) (*Executable, error) {
+	var err error
+	read := func(in io.Reader, values ...interface{}) {
+		for _, v := range values {
+			if err == nil {
+				err = binary.Read(in, binary.LittleEndian, v)
+			}
+		}
+	}
+	readString := func(in io.Reader) string {
+		var length uint16
+		read(in, &length)
+		if err != nil {
+			return ""
+		}
+		s := make([]byte, length)
+		_, err = io.ReadFull(in, s)
+		return string(s)
+	}
+
+	var version, segments uint16
+	e := &Executable{}
+	read(in, &version, &e.Entry, &segments)
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if version != VERSION {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+
+	for i := 0; i < int(segments) && err == nil; i++ {
+		var address uint16
+		var length uint32
+		read(in, &address, &length)
+		if err == nil && length > 0x10000 {
+			return nil, fmt.Errorf("segment at 0x%04X of %d words is bigger than memory", address, length)
+		}
+		words := make([]uint16, length)
+		read(in, words)
+		e.Segments = append(e.Segments, Segment{address, words})
+	}
+
+	for err == nil {
+		var kind uint8
+		read(in, &kind)
+		if err != nil || kind == END_SECTION {
+			break
+		}
+
+		var length uint32
+		read(in, &length)
+		if err == nil && int64(length) > int64(in.Len()) {
+			return nil, fmt.Errorf("section %d of %d bytes is longer than the file", kind, length)
+		}
+		payload := make([]byte, length)
+		read(in, payload)
+		section := bytes.NewReader(payload)
+
+		var count uint32
+		switch kind {
+		case SYMBOLS_SECTION:
+			read(section, &count)
+			e.Symbols = make(map[string]uint16)
+			for i := uint32(0); i < count && err == nil; i++ {
+				name := readString(section)
+				var address uint16
+				read(section, &address)
+				e.Symbols[name] = address
+			}
+		case LINES_SECTION:
+			read(section, &count)
+			for i := uint32(0); i < count && err == nil; i++ {
+				line := SourceLine{}
+				read(section, &line.Address)
+				line.File = readString(section)
+				var number uint32
+				read(section, &number)
+				line.Line = int(number)
+				e.Lines = append(e.Lines, line)
+			}
+		}
+	}
+
+	if err == io.EOF {
+		// the file ended part way through
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
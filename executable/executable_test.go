@@ -0,0 +1,116 @@
+package executable
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	e := &Executable{
+		Entry: 0x0510,
+		Segments: []Segment{
+			{0x0500, []uint16{0x0020, 0x0600, 0x0061}},
+			{0x0600, []uint16{0x0068, 0x0069, 0x0000}},
+		},
+		Symbols: map[string]uint16{"start": 0x0510, "message": 0x0600},
+		Lines:   []SourceLine{{0x0500, "main.asm", 3}, {0x0502, "main.asm", 4}},
+	}
+
+	out := &bytes.Buffer{}
+	if err := e.Write(out); err != nil {
+		t.Logf("unexpected error writing executable: %v", err)
+		t.FailNow()
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte(MAGIC)) {
+		t.Logf("expected executable to start with %s but got % X", MAGIC, out.Bytes()[:4])
+		t.FailNow()
+	}
+
+	read, err := Read(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Logf("unexpected error reading executable: %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(read, e) {
+		t.Logf("expected %+v but got %+v", e, read)
+		t.FailNow()
+	}
+
+	// the symbols and lines are optional
+	e = &Executable{Entry: 0x0500, Segments: []Segment{{0x0500, []uint16{0x0061}}}}
+	out.Reset()
+	e.Write(out)
+	if read, err := Read(out); err != nil || !reflect.DeepEqual(read, e) {
+		t.Logf("expected %+v but got %+v, %v", e, read, err)
+		t.FailNow()
+	}
+}
+
+func TestReadSkipsUnknownSections(t *testing.T) {
+	e := &Executable{Entry: 0x0500, Segments: []Segment{{0x0500, []uint16{0x0061}}}}
+	out := &bytes.Buffer{}
+	e.Write(out)
+
+	// put a section from a newer version in front of the end
+	data := out.Bytes()[:out.Len()-1]
+	data = append(data, 0x7F, 0x02, 0x00, 0x00, 0x00, 0xAA, 0xBB, END_SECTION)
+
+	read, err := Read(bytes.NewReader(data))
+	if err != nil || !reflect.DeepEqual(read, e) {
+		t.Logf("expected %+v but got %+v, %v", e, read, err)
+		t.FailNow()
+	}
+}
+
+func TestReadRaw(t *testing.T) {
+	read, err := Read(bytes.NewReader([]byte{0x20, 0x00, 0x00, 0x06, 0x61, 0x00}))
+	if err != nil {
+		t.Logf("unexpected error reading raw bin: %v", err)
+		t.FailNow()
+	}
+
+	expected := Raw([]uint16{0x0020, 0x0600, 0x0061})
+	if !reflect.DeepEqual(read, expected) || expected.Entry != RAW_ORIGIN {
+		t.Logf("expected %+v but got %+v", expected, read)
+		t.FailNow()
+	}
+
+	if _, err := Read(bytes.NewReader([]byte{0x20, 0x00, 0x00})); err == nil || !strings.Contains(err.Error(), "not an even number") {
+		t.Logf("expected an error for an odd number of bytes but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	overlapping := &Executable{Segments: []Segment{{0x0600, []uint16{1, 2}}, {0x0500, make([]uint16, 0x101)}}}
+	if err := overlapping.Write(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "segment at 0x0600 overlaps the segment at 0x0500") {
+		t.Logf("expected an overlap error but got %v", err)
+		t.FailNow()
+	}
+
+	tooBig := &Executable{Segments: []Segment{{0xFFFF, []uint16{1, 2}}}}
+	if err := tooBig.Write(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "past the end of memory") {
+		t.Logf("expected an end of memory error but got %v", err)
+		t.FailNow()
+	}
+
+	e := &Executable{Entry: 0x0500, Segments: []Segment{{0x0500, []uint16{0x0061}}}, Symbols: map[string]uint16{"start": 0x0500}}
+	out := &bytes.Buffer{}
+	e.Write(out)
+
+	for _, tc := range []struct {
+		data     []byte
+		expected string
+	}{
+		{out.Bytes()[:10], "executable is not valid: unexpected EOF"},
+		{out.Bytes()[:len(out.Bytes())-4], "executable is not valid: section 1 of"},
+		{append([]byte(MAGIC), 0x02, 0x00, 0x00, 0x05, 0x00, 0x00), "executable is not valid: unsupported version 2"},
+	} {
+		if _, err := Read(bytes.NewReader(tc.data)); err == nil || !strings.HasPrefix(err.Error(), tc.expected) {
+			t.Logf("expected error starting '%s' but got %v", tc.expected, err)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package executable
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Intel HEX record types
+const (
+	IHEX_DATA = iota
+	IHEX_END_OF_FILE
+	IHEX_EXTENDED_SEGMENT_ADDRESS
+	IHEX_START_SEGMENT_ADDRESS
+	IHEX_EXTENDED_LINEAR_ADDRESS
+	IHEX_START_LINEAR_ADDRESS
+)
+
+// WriteIntelHex writes the segments of the executable as Intel HEX records, with an
+// extended linear address record for the bytes above 0xFFFF and a start linear address
+// record for the entry point. Labels and source lines are not written
+func (e *Executable) WriteIntelHex(w io.Writer) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	record := func(kind byte, address uint16, data []byte) {
+		fields := append([]byte{byte(len(data)), byte(address >> 8), byte(address), kind}, data...)
+		sum := byte(0)
+		for _, b := range fields {
+			sum += b
+		}
+		fmt.Fprintf(out, ":%s%02X\n", strings.ToUpper(hex.EncodeToString(fields)), -sum)
+	}
+
+	upper := uint32(0)
+	for _, run := range e.byteRuns() {
+		for i := 0; i < len(run.data); {
+			address := run.address + uint32(i)
+			if address>>16 != upper {
+				upper = address >> 16
+				record(IHEX_EXTENDED_LINEAR_ADDRESS, 0, []byte{byte(upper >> 8), byte(upper)})
+			}
+
+			// a record cannot go over a 64K boundary
+			n := RECORD_BYTES
+			if left := len(run.data) - i; left < n {
+				n = left
+			}
+			if over := int(address&0xFFFF) + n - 0x10000; over > 0 {
+				n -= over
+			}
+			record(IHEX_DATA, uint16(address), run.data[i:i+n])
+			i += n
+		}
+	}
+
+	entry := uint32(e.Entry) * 2
+	record(IHEX_START_LINEAR_ADDRESS, 0, []byte{byte(entry >> 24), byte(entry >> 16), byte(entry >> 8), byte(entry)})
+	record(IHEX_END_OF_FILE, 0, nil)
+	return out.Flush()
+}
+
+// ReadIntelHex reads Intel HEX records written by WriteIntelHex or another tool. Each run
+// of words becomes a segment, and the entry point is RAW_ORIGIN if there is no start
+// address record
+func ReadIntelHex(r io.Reader) (*Executable, error) {
+	memory := recordMemory{}
+	entry := uint32(RAW_ORIGIN) * 2
+	base := uint32(0)
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		kind, address, data, err := parseIntelHexRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		switch kind {
+		case IHEX_DATA:
+			err = memory.put(base+uint32(address), data)
+		case IHEX_END_OF_FILE:
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return memory.executable(entry)
+		case IHEX_EXTENDED_SEGMENT_ADDRESS, IHEX_EXTENDED_LINEAR_ADDRESS:
+			if len(data) != 2 {
+				err = fmt.Errorf("extended address record should have 2 bytes but has %d", len(data))
+				break
+			}
+			base = uint32(data[0])<<8 | uint32(data[1])
+			if kind == IHEX_EXTENDED_SEGMENT_ADDRESS {
+				base <<= 4
+			} else {
+				base <<= 16
+			}
+		case IHEX_START_SEGMENT_ADDRESS, IHEX_START_LINEAR_ADDRESS:
+			if len(data) != 4 {
+				err = fmt.Errorf("start address record should have 4 bytes but has %d", len(data))
+				break
+			}
+			if kind == IHEX_START_SEGMENT_ADDRESS {
+				// CS:IP
+				entry = (uint32(data[0])<<8|uint32(data[1]))<<4 + (uint32(data[2])<<8 | uint32(data[3]))
+			} else {
+				entry = uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+			}
+		default:
+			err = fmt.Errorf("unknown record type %02X", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("there is no end of file record")
+}
+
+func parseIntelHexRecord(line string) (byte, uint16, []byte, error) {
+	if !strings.HasPrefix(line, ":") {
+		return 0, 0, nil, fmt.Errorf("record does not start with ':'")
+	}
+	fields, err := hex.DecodeString(line[1:])
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("record is not hex: %v", err)
+	}
+	if len(fields) < 5 {
+		return 0, 0, nil, fmt.Errorf("record is too short")
+	}
+	if length := int(fields[0]); len(fields) != length+5 {
+		return 0, 0, nil, fmt.Errorf("record says it has %d bytes of data but has %d", length, len(fields)-5)
+	}
+
+	sum := byte(0)
+	for _, b := range fields {
+		sum += b
+	}
+	if sum != 0 {
+		return 0, 0, nil, fmt.Errorf("checksum is %02X but should be %02X", fields[len(fields)-1], fields[len(fields)-1]-sum)
+	}
+	return fields[3], uint16(fields[1])<<8 | uint16(fields[2]), fields[4 : len(fields)-1], nil
+}
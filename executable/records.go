@@ -0,0 +1,110 @@
+package executable
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Intel HEX and S-records address bytes, so the words of an executable are written
+// little-endian with word address a at byte address 2a, the same as a bin
+
+// RECORD_BYTES is how many bytes are written in each data record
+const RECORD_BYTES = 16
+
+// byteRun is bytes starting at a byte address
+type byteRun struct {
+	address uint32
+	data    []byte
+}
+
+// byteRuns gives the bytes of each segment, in address order
+func (e *Executable) byteRuns() []byteRun {
+	runs := []byteRun{}
+	for _, segment := range e.Segments {
+		if len(segment.Words) == 0 {
+			continue
+		}
+		data := make([]byte, 0, len(segment.Words)*2)
+		for _, w := range segment.Words {
+			data = append(data, byte(w), byte(w>>8))
+		}
+		runs = append(runs, byteRun{uint32(segment.Address) * 2, data})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].address < runs[j].address })
+	return runs
+}
+
+// recordMemory collects the bytes of data records as they are read
+type recordMemory map[uint32]byte
+
+func (m recordMemory) put(address uint32, data []byte) error {
+	for i, b := range data {
+		a := address + uint32(i)
+		if a >= 0x20000 {
+			return fmt.Errorf("byte address 0x%05X is past the end of memory", a)
+		}
+		if _, ok := m[a]; ok {
+			return fmt.Errorf("byte address 0x%05X is written more than once", a)
+		}
+		m[a] = b
+	}
+	return nil
+}
+
+// executable turns the bytes into a segment for each run of words, every word needs
+// both of its bytes
+func (m recordMemory) executable(entry uint32) (*Executable, error) {
+	if entry%2 != 0 || entry >= 0x20000 {
+		return nil, fmt.Errorf("entry point byte address 0x%05X is not the start of a word", entry)
+	}
+
+	addresses := make([]uint32, 0, len(m))
+	for a := range m {
+		addresses = append(addresses, a)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+
+	e := &Executable{Entry: uint16(entry / 2)}
+	for i := 0; i < len(addresses); i += 2 {
+		low := addresses[i]
+		if low%2 != 0 || i+1 == len(addresses) || addresses[i+1] != low+1 {
+			return nil, fmt.Errorf("byte address 0x%05X is only half of a word", low)
+		}
+
+		word := uint16(m[low]) | uint16(m[low+1])<<8
+		n := len(e.Segments)
+		if n > 0 && int(e.Segments[n-1].Address)+len(e.Segments[n-1].Words) == int(low/2) {
+			e.Segments[n-1].Words = append(e.Segments[n-1].Words, word)
+		} else {
+			e.Segments = append(e.Segments, Segment{uint16(low / 2), []uint16{word}})
+		}
+	}
+	return e, nil
+}
+
+// recordFormat returns ':' if the first line of data is a valid Intel HEX record or 'S' if
+// it is a valid S-record, checksum and all, and 0 otherwise. Being printable is not enough
+// to tell a record file from a bin, the words of a bin of data or of instructions from the
+// opcode groups above 0 can all be printable characters
+func recordFormat(data []byte) byte {
+	line := bytes.TrimSpace(data)
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = bytes.TrimSpace(line[:end])
+	}
+	if len(line) == 0 {
+		return 0
+	}
+
+	switch line[0] {
+	case ':':
+		if _, _, _, err := parseIntelHexRecord(string(line)); err == nil {
+			return ':'
+		}
+	case 'S':
+		if _, _, _, err := parseSRecord(string(line)); err == nil {
+			return 'S'
+		}
+	}
+	return 0
+}
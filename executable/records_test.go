@@ -0,0 +1,165 @@
+package executable
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// two discontiguous segments, the second one above byte address 0xFFFF
+var recordsExecutable = &Executable{
+	Entry: 0x0510,
+	Segments: []Segment{
+		{0x0500, []uint16{0x0020, 0x1234, 0x0061}},
+		{0x8000, []uint16{0xABCD, 0x0001}},
+	},
+}
+
+func TestIntelHex(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := recordsExecutable.WriteIntelHex(out); err != nil {
+		t.Logf("unexpected error writing Intel HEX: %v", err)
+		t.FailNow()
+	}
+
+	expected := `:060A000020003412610029
+:020000040001F9
+:04000000CDAB010083
+:0400000500000A20CD
+:00000001FF
+`
+	if out.String() != expected {
+		t.Logf("expected\n%s\nbut got\n%s", expected, out.String())
+		t.FailNow()
+	}
+
+	read, err := Read(bytes.NewReader(out.Bytes()))
+	if err != nil || !reflect.DeepEqual(read, recordsExecutable) {
+		t.Logf("expected %+v but got %+v, %v", recordsExecutable, read, err)
+		t.FailNow()
+	}
+}
+
+func TestSRecord(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := recordsExecutable.WriteSRecord(out); err != nil {
+		t.Logf("unexpected error writing S-records: %v", err)
+		t.FailNow()
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"S0", "S2", "S2", "S5", "S8"}
+	if len(lines) != len(expected) {
+		t.Logf("expected %d records but got\n%s", len(expected), out.String())
+		t.FailNow()
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Logf("expected record %d to be %s but got %s", i, prefix, lines[i])
+			t.FailNow()
+		}
+	}
+	if lines[1] != "S20A000A0020003412610024" || lines[4] != "S804000A20D1" {
+		t.Logf("unexpected records\n%s", out.String())
+		t.FailNow()
+	}
+
+	read, err := Read(bytes.NewReader(out.Bytes()))
+	if err != nil || !reflect.DeepEqual(read, recordsExecutable) {
+		t.Logf("expected %+v but got %+v, %v", recordsExecutable, read, err)
+		t.FailNow()
+	}
+
+	// everything fits in 16 bits
+	small := &Executable{Entry: 0x0500, Segments: []Segment{{0x0500, []uint16{0x0061}}}}
+	out.Reset()
+	small.WriteSRecord(out)
+	if !strings.Contains(out.String(), "\nS1050A006100") || !strings.HasSuffix(out.String(), "\nS9030A00F2\n") {
+		t.Logf("expected S1 and S9 records but got\n%s", out.String())
+		t.FailNow()
+	}
+}
+
+func TestReadRecordsWithoutEntry(t *testing.T) {
+	read, err := Read(strings.NewReader("S1050A0061008F\n"))
+	expected := Raw([]uint16{0x0061})
+	if err != nil || !reflect.DeepEqual(read, expected) {
+		t.Logf("expected %+v but got %+v, %v", expected, read, err)
+		t.FailNow()
+	}
+}
+
+func TestReadMalformedRecords(t *testing.T) {
+	for _, tc := range []struct {
+		records  string
+		expected string
+	}{
+		{":020A00002000B5\n:00000001FF\n", "line 1: checksum is B5 but should be D4"},
+		{":030A00002000D4\n", "line 1: record says it has 3 bytes of data but has 2"},
+		{":020A00002000D4\n", "there is no end of file record"},
+		{":020A0000200ZD4\n", "line 1: record is not hex"},
+		{":020A000006200000D4\n", "line 1: record says it has 2 bytes of data but has 4"},
+		{":010A000020D5\n:00000001FF\n", "byte address 0x00A00 is only half of a word"},
+		{":020A00002000D4\n:020A00002000D4\n:00000001FF\n", "line 2: byte address 0x00A00 is written more than once"},
+		{":00000007F9\n", "line 1: unknown record type 07"},
+		{"S1050A006100EC\n", "line 1: checksum is EC but should be 8F"},
+		{"S4050A006100EB\n", "line 1: unknown record type S4"},
+		{"S1050A0061008F\nS5030002FA\n", "line 2: count record says there are 2 data records but there are 1"},
+		{"S9030A00F2\nS1050A0061008F\n", "line 2: there are records after the termination record"},
+		{"S9030A01F1\n", "entry point byte address 0x00A01 is not the start of a word"},
+	} {
+		// Read only recognises records with a valid first record, so a bad one would be read as a bin
+		read := ReadSRecord
+		if tc.records[0] == ':' {
+			read = ReadIntelHex
+		}
+		if _, err := read(strings.NewReader(tc.records)); err == nil || !strings.HasPrefix(err.Error(), tc.expected) {
+			t.Logf("expected error starting '%s' for\n%s\nbut got %v", tc.expected, tc.records, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestReadPrintableBin(t *testing.T) {
+	// all printable, but none of them start with a valid record so they are bins
+	for _, bin := range []string{":0:A", "S105", ":020A00002000B5\n:00000001FF\n"} {
+		read, err := Read(strings.NewReader(bin))
+		if err != nil || len(read.Segments) != 1 || len(read.Segments[0].Words) != len(bin)/2 {
+			t.Logf("expected %q to be read as a bin but got %+v, %v", bin, read, err)
+			t.FailNow()
+		}
+	}
+
+	read, err := Read(strings.NewReader(":020A00002000D4\n:00000001FF\n"))
+	if expected := Raw([]uint16{0x0020}); err != nil || read.Segments[0].Address != 0x0500 || !reflect.DeepEqual(read.Segments[0].Words, expected.Segments[0].Words) {
+		t.Logf("expected Intel HEX to be recognised but got %+v, %v", read, err)
+		t.FailNow()
+	}
+}
+
+func TestReadFileUsesExtension(t *testing.T) {
+	dir := t.TempDir()
+	for name, expected := range map[string]string{
+		"bad.hex":  "line 1: checksum is B5 but should be D4",
+		"bad.s19":  "line 1: record does not start with 'S'",
+		"bad.IHEX": "line 1: checksum is B5 but should be D4",
+	} {
+		records := ":020A00002000B5\n:00000001FF\n"
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(records), 0644)
+		if _, err := ReadFile(path); err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Logf("expected error starting '%s' for %s but got %v", expected, name, err)
+			t.FailNow()
+		}
+	}
+
+	path := filepath.Join(dir, "program.bin")
+	os.WriteFile(path, []byte(":020A00002000B5\n:00000001FF\n"), 0644)
+	if read, err := ReadFile(path); err != nil || len(read.Segments[0].Words) != 14 {
+		t.Logf("expected a bin with a bad first record to be read as a bin but got %+v, %v", read, err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,150 @@
+package executable
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SRECORD_HEADER is the text put in the S0 record
+const SRECORD_HEADER = "simple-computer"
+
+// addressBytes is the size of the address in each S-record type
+var addressBytes = map[byte]int{'0': 2, '1': 2, '2': 3, '3': 4, '5': 2, '6': 3, '7': 4, '8': 3, '9': 2}
+
+// WriteSRecord writes the segments of the executable as Motorola S-records, using S1
+// records with an S9 for the entry point if every byte address fits in 16 bits and S2
+// records with an S8 if not. Labels and source lines are not written
+func (e *Executable) WriteSRecord(w io.Writer) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	runs := e.byteRuns()
+	dataType, endType := byte('1'), byte('9')
+	if n := len(runs); (n > 0 && runs[n-1].address+uint32(len(runs[n-1].data)) > 0x10000) || uint32(e.Entry)*2 > 0xFFFF {
+		dataType, endType = '2', '8'
+	}
+
+	out := bufio.NewWriter(w)
+	record := func(kind byte, address uint32, data []byte) {
+		fields := []byte{byte(addressBytes[kind] + len(data) + 1)}
+		for i := addressBytes[kind] - 1; i >= 0; i-- {
+			fields = append(fields, byte(address>>(8*i)))
+		}
+		fields = append(fields, data...)
+		sum := byte(0)
+		for _, b := range fields {
+			sum += b
+		}
+		fmt.Fprintf(out, "S%c%s%02X\n", kind, strings.ToUpper(hex.EncodeToString(fields)), ^sum)
+	}
+
+	record('0', 0, []byte(SRECORD_HEADER))
+	count := 0
+	for _, run := range runs {
+		for i := 0; i < len(run.data); i += RECORD_BYTES {
+			end := i + RECORD_BYTES
+			if end > len(run.data) {
+				end = len(run.data)
+			}
+			record(dataType, run.address+uint32(i), run.data[i:end])
+			count++
+		}
+	}
+	if count <= 0xFFFF {
+		record('5', uint32(count), nil)
+	} else {
+		record('6', uint32(count), nil)
+	}
+	record(endType, uint32(e.Entry)*2, nil)
+	return out.Flush()
+}
+
+// ReadSRecord reads Motorola S-records written by WriteSRecord or another tool. Each run
+// of words becomes a segment, and the entry point is RAW_ORIGIN if there is no S7, S8
+// or S9 record
+func ReadSRecord(r io.Reader) (*Executable, error) {
+	memory := recordMemory{}
+	entry := uint32(RAW_ORIGIN) * 2
+	count := 0
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	ended := false
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if ended {
+			return nil, fmt.Errorf("line %d: there are records after the termination record", lineNumber)
+		}
+
+		kind, address, data, err := parseSRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		switch kind {
+		case '0':
+		case '1', '2', '3':
+			err = memory.put(address, data)
+			count++
+		case '5', '6':
+			if int(address) != count {
+				err = fmt.Errorf("count record says there are %d data records but there are %d", address, count)
+			}
+		case '7', '8', '9':
+			entry = address
+			ended = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return memory.executable(entry)
+}
+
+func parseSRecord(line string) (byte, uint32, []byte, error) {
+	if len(line) < 2 || line[0] != 'S' {
+		return 0, 0, nil, fmt.Errorf("record does not start with 'S'")
+	}
+	kind := line[1]
+	size, ok := addressBytes[kind]
+	if !ok {
+		return 0, 0, nil, fmt.Errorf("unknown record type S%c", kind)
+	}
+
+	fields, err := hex.DecodeString(line[2:])
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("record is not hex: %v", err)
+	}
+	if len(fields) < size+2 {
+		return 0, 0, nil, fmt.Errorf("record is too short")
+	}
+	if length := int(fields[0]); len(fields) != length+1 {
+		return 0, 0, nil, fmt.Errorf("record says it has %d bytes but has %d", length, len(fields)-1)
+	}
+
+	sum := byte(0)
+	for _, b := range fields[:len(fields)-1] {
+		sum += b
+	}
+	if checksum := fields[len(fields)-1]; checksum != ^sum {
+		return 0, 0, nil, fmt.Errorf("checksum is %02X but should be %02X", checksum, ^sum)
+	}
+
+	address := uint32(0)
+	for _, b := range fields[1 : size+1] {
+		address = address<<8 | uint32(b)
+	}
+	return kind, address, fields[size+1 : len(fields)-1], nil
+}
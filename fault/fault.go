@@ -0,0 +1,108 @@
+package fault
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FAULT SPECS
+// a spec file lists the faults to put into the gate level CPU, one per line:
+//
+//     <target> <kind> [cycle]
+//
+// the target is a signal path from the CPU's registry, e.g. cpu.mainBus, cpu.alu.adder.carry
+// or cpu.stepper.out[3] for a single wire of a group, or a word of RAM with
+// cpu.ram.cell[<address>] and a single bit of it with cpu.ram.cell[<address>][<bit>]. As
+// with buses, bit 0 is the most significant bit. The kind is one of
+//
+//     stuck-at-0  the wires read 0 whatever drives them, from the cycle on
+//     stuck-at-1  the wires read 1 whatever drives them, from the cycle on
+//     flip        the wires are inverted once at the cycle. A flipped wire is a glitch that
+//                 lasts until whatever drives it next updates it, a flipped RAM bit is an
+//                 upset that stays until the cell is written again
+//
+// the cycle is the number of steps of the CPU since the faults were injected and defaults
+// to 0. Anything after a # is a comment
+
+// Kind is what happens to the target's wires
+type Kind string
+
+const (
+	STUCK_AT_0 = Kind("stuck-at-0")
+	STUCK_AT_1 = Kind("stuck-at-1")
+	FLIP       = Kind("flip")
+)
+
+// KINDS is every kind of fault
+var KINDS = []Kind{STUCK_AT_0, STUCK_AT_1, FLIP}
+
+// Fault is a single fault from a spec file
+type Fault struct {
+	Target string `json:"target"`
+	Kind   Kind   `json:"kind"`
+	Cycle  uint64 `json:"cycle"`
+	// Line is the line of the spec file the fault was read from, 0 if it wasn't
+	Line int `json:"line,omitempty"`
+}
+
+// String is the fault as it would be written in a spec file
+func (f Fault) String() string {
+	return fmt.Sprintf("%s %s %d", f.Target, f.Kind, f.Cycle)
+}
+
+// ParseSpec reads the faults in a spec file, the targets are checked when they are injected
+func ParseSpec(r io.Reader) ([]Fault, error) {
+	var faults []Fault
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if comment := strings.Index(text, "#"); comment >= 0 {
+			text = text[:comment]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected <target> <kind> [cycle] but got '%s'", line, strings.TrimSpace(text))
+		}
+
+		f := Fault{Target: fields[0], Line: line}
+		for _, kind := range KINDS {
+			if Kind(fields[1]) == kind {
+				f.Kind = kind
+			}
+		}
+		if f.Kind == "" {
+			return nil, fmt.Errorf("line %d: unknown fault '%s', expected one of %v", line, fields[1], KINDS)
+		}
+		if len(fields) == 3 {
+			cycle, err := strconv.ParseUint(fields[2], 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: '%s' is not a cycle", line, fields[2])
+			}
+			f.Cycle = cycle
+		}
+		faults = append(faults, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return faults, nil
+}
+
+// ReadSpecFile reads the faults in a spec file on disk
+func ReadSpecFile(filename string) ([]Fault, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSpec(f)
+}
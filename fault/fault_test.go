@@ -0,0 +1,110 @@
+package fault
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/cpu"
+	"github.com/djhworld/simple-computer/memory"
+)
+
+func TestParseSpec(t *testing.T) {
+	faults, err := ParseSpec(strings.NewReader(`
+		# target                fault       cycle
+		cpu.mainBus[3]          stuck-at-1
+		cpu.alu.adder.carry     stuck-at-0  0x10 # from the 16th step
+
+		cpu.ram.cell[0x0A00][15] flip      250
+	`))
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+
+	expected := []Fault{
+		{"cpu.mainBus[3]", STUCK_AT_1, 0, 3},
+		{"cpu.alu.adder.carry", STUCK_AT_0, 16, 4},
+		{"cpu.ram.cell[0x0A00][15]", FLIP, 250, 6},
+	}
+	if len(faults) != len(expected) {
+		t.Logf("expected %d faults but got %v", len(expected), faults)
+		t.FailNow()
+	}
+	for i := range expected {
+		if faults[i] != expected[i] {
+			t.Logf("expected %+v but got %+v", expected[i], faults[i])
+			t.FailNow()
+		}
+	}
+
+	for _, spec := range []string{"cpu.mainBus", "cpu.mainBus stuck", "cpu.mainBus flip x", "cpu.mainBus flip 1 2"} {
+		if _, err := ParseSpec(strings.NewReader(spec)); err == nil {
+			t.Logf("expected an error parsing '%s'", spec)
+			t.FailNow()
+		}
+	}
+}
+
+func setUpCPU() *cpu.CPU {
+	bus := components.NewBus(arch.BUS_WIDTH)
+	c := cpu.NewCPU(bus, memory.NewMemory64K(bus))
+	c.SetIR(0)
+	c.SetIAR(0x0500)
+	return c
+}
+
+func TestInjector(t *testing.T) {
+	c := setUpCPU()
+	ram := c.Memory()
+	ram.Poke(0x0A00, 0x0000)
+	ram.Poke(0x0A01, 0x0000)
+
+	injector, err := NewInjector(c, []Fault{
+		{Target: "cpu.ram.cell[0x0A00][15]", Kind: STUCK_AT_1},
+		{Target: "cpu.ram.cell[0x0A01]", Kind: FLIP, Cycle: 2},
+		{Target: "cpu.r2.word", Kind: STUCK_AT_1, Cycle: 1},
+	})
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	c.ObserveSignals(injector.Phase)
+
+	// stuck-at faults for cycle 0 are there before the first step
+	ram.Poke(0x0A00, 0x0100)
+	if ram.Peek(0x0A00) != 0x0101 || c.Register(2) != 0x0000 {
+		t.Logf("expected bit 15 of 0x0A00 to be stuck at 1 and R2 to be untouched")
+		t.FailNow()
+	}
+
+	// the flip goes in during cycle 2
+	for cycle := 0; cycle < 3; cycle++ {
+		if ram.Peek(0x0A01) != 0x0000 {
+			t.Logf("expected 0x0A01 to be untouched before cycle 2 but it is 0x%04X at cycle %d", ram.Peek(0x0A01), cycle)
+			t.FailNow()
+		}
+		c.Step()
+	}
+	if ram.Peek(0x0A01) != 0xFFFF || c.Register(2) != 0xFFFF || injector.Cycle() != 3 {
+		t.Logf("expected 0x0A01 to have flipped and R2 to be stuck at 0xFFFF after 3 cycles")
+		t.FailNow()
+	}
+
+	// taking the faults out leaves the flip, the stuck wires change once they are updated
+	injector.Remove()
+	ram.Poke(0x0A00, 0x0100)
+	c.SetRegister(2, 0x002A)
+	if ram.Peek(0x0A00) != 0x0100 || ram.Peek(0x0A01) != 0xFFFF || c.Register(2) != 0x002A {
+		t.Logf("expected the stuck-at faults to be gone")
+		t.FailNow()
+	}
+
+	for _, target := range []string{"cpu.nothing", "cpu.mainBus[16]", "cpu.ram.cell[0x10000]", "cpu.ram.cell[0x0A00][16]"} {
+		if _, err := NewInjector(c, []Fault{{Target: target, Kind: FLIP, Line: 7}}); err == nil || !strings.HasPrefix(err.Error(), "line 7: ") {
+			t.Logf("expected an error on line 7 for %s but got %v", target, err)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package fault
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/circuit"
+	"github.com/djhworld/simple-computer/cpu"
+)
+
+// the CPU's registry only names the RAM's control wires and address register, the cells are
+// looked up here as naming all 64K of them would slow everything else that goes through it
+var ramCell = regexp.MustCompile(`^cpu\.ram\.cell\[([^\]]+)\](?:\[([^\]]+)\])?$`)
+
+// Injector puts faults into a gate level CPU. Its Phase method has to be called every
+// clock phase (see cpu.ObserveSignals) so it knows which cycle the CPU is on
+type Injector struct {
+	core   *cpu.CPU
+	faults []*injection
+	phase  uint64
+}
+
+type injection struct {
+	fault Fault
+	wires []*circuit.Wire
+
+	// for a RAM cell, so that a flip is stored in the cell rather than only being on its
+	// output wires until the cell is next updated
+	cell    bool
+	address arch.Word
+	mask    arch.Word
+
+	done bool
+}
+
+// NewInjector checks the faults' targets exist on the CPU and puts in the stuck-at faults
+// for cycle 0 straight away, so they are there from the first step
+func NewInjector(core *cpu.CPU, faults []Fault) (*Injector, error) {
+	i := &Injector{core: core}
+	for _, f := range faults {
+		injection, err := i.resolve(f)
+		if err != nil {
+			if f.Line > 0 {
+				return nil, fmt.Errorf("line %d: %v", f.Line, err)
+			}
+			return nil, err
+		}
+		i.faults = append(i.faults, injection)
+	}
+
+	for _, injection := range i.faults {
+		if injection.fault.Cycle == 0 && injection.fault.Kind != FLIP {
+			i.apply(injection)
+		}
+	}
+	return i, nil
+}
+
+func (i *Injector) resolve(f Fault) (*injection, error) {
+	if match := ramCell.FindStringSubmatch(f.Target); match != nil {
+		address, err := strconv.ParseUint(match[1], 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a 16 bit address", match[1])
+		}
+		if int(address) >= i.core.Memory().Size() {
+			return nil, fmt.Errorf("0x%04X is past the end of RAM", address)
+		}
+		width := i.core.Width()
+		wires := i.core.Memory().CellWires(arch.Word(address))
+		mask := arch.Mask(width)
+		if match[2] != "" {
+			bit, err := strconv.Atoi(match[2])
+			if err != nil || bit < 0 || bit >= width {
+				return nil, fmt.Errorf("'%s' is not a bit of a word", match[2])
+			}
+			wires = wires[bit : bit+1]
+			mask = 1 << uint(width-1-bit)
+		}
+		return &injection{fault: f, wires: wires, cell: true, address: arch.Word(address), mask: mask}, nil
+	}
+
+	signal, ok := i.core.Signals().Lookup(f.Target)
+	if !ok {
+		return nil, fmt.Errorf("there is no signal called %s", f.Target)
+	}
+	return &injection{fault: f, wires: signal.Wires}, nil
+}
+
+func (i *Injector) apply(injection *injection) {
+	injection.done = true
+	switch injection.fault.Kind {
+	case STUCK_AT_0, STUCK_AT_1:
+		for _, w := range injection.wires {
+			w.Stick(injection.fault.Kind == STUCK_AT_1)
+		}
+	case FLIP:
+		if injection.cell {
+			ram := i.core.Memory()
+			ram.Poke(injection.address, ram.Peek(injection.address)^injection.mask)
+			return
+		}
+		for _, w := range injection.wires {
+			w.Update(!w.Get())
+		}
+	}
+}
+
+// Phase puts in the faults for the cycle the CPU is on. They go in at the first phase of the
+// cycle, once the enables have run for the clock going high, so a flip is seen by the sets
+func (i *Injector) Phase() {
+	if i.phase%4 == 0 {
+		cycle := i.phase / 4
+		for _, injection := range i.faults {
+			if !injection.done && injection.fault.Cycle == cycle {
+				i.apply(injection)
+			}
+		}
+	}
+	i.phase++
+}
+
+// Cycle is the number of steps the CPU has taken since the faults were injected
+func (i *Injector) Cycle() uint64 {
+	return i.phase / 4
+}
+
+// Remove takes out the stuck-at faults, the wires keep their stuck values until whatever
+// drives them next updates them. A flipped RAM bit stays flipped
+func (i *Injector) Remove() {
+	for _, injection := range i.faults {
+		if injection.done && injection.fault.Kind != FLIP {
+			for _, w := range injection.wires {
+				w.Unstick()
+			}
+		}
+	}
+}
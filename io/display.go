@@ -187,6 +187,11 @@ func (s *ScreenControl) Run() {
 	}
 }
 
+// Output returns the pixels rendered by the last call to Update
+func (s *ScreenControl) Output() [160][240]byte {
+	return s.output
+}
+
 func (s *ScreenControl) Update() {
 	widthInBytes := uint16(30) // 30 * 8 = 240
 
@@ -203,7 +208,7 @@ func (s *ScreenControl) Update() {
 }
 
 func (s *ScreenControl) setOutputRAMAddress(address uint16) {
-	s.adapter.screenBus.SetValue(address)
+	s.adapter.screenBus.SetValue(arch.Word(address))
 	s.adapter.displayRAM.OutputAddressRegister.Set()
 	s.adapter.displayRAM.OutputAddressRegister.Update()
 	s.adapter.displayRAM.OutputAddressRegister.Unset()
@@ -33,6 +33,10 @@ type KeyboardAdapter struct {
 	notGatesForAndGate3 [2]circuit.NOTGate
 
 	andGate4 circuit.ANDGate
+
+	// the IRQ line is raised while a key is waiting to be read
+	irq            *circuit.Wire
+	keyDownORGates [arch.BUS_WIDTH - 1]circuit.ORGate
 }
 
 func NewKeyboardAdapter() *KeyboardAdapter {
@@ -60,11 +64,34 @@ func (k *KeyboardAdapter) Connect(ioBus *components.IOBus, mainBus *components.B
 	for i := range k.notGatesForAndGate3 {
 		k.notGatesForAndGate3[i] = *circuit.NewNOTGate()
 	}
+
+	for i := range k.keyDownORGates {
+		k.keyDownORGates[i] = *circuit.NewORGate()
+	}
+}
+
+// ConnectIRQ connects the adapter to the IRQ line it raises on a key down event
+func (k *KeyboardAdapter) ConnectIRQ(irq *circuit.Wire) {
+	k.irq = irq
 }
 
 func (k *KeyboardAdapter) Update() {
 	k.updateKeycodeReg()
 	k.update()
+	k.updateIRQ()
+}
+
+func (k *KeyboardAdapter) updateIRQ() {
+	if k.irq == nil {
+		return
+	}
+
+	k.keyDownORGates[0].Update(k.KeyboardInBus.GetOutputWire(0), k.KeyboardInBus.GetOutputWire(1))
+	for i := 1; i < len(k.keyDownORGates); i++ {
+		k.keyDownORGates[i].Update(k.keyDownORGates[i-1].Output(), k.KeyboardInBus.GetOutputWire(i+1))
+	}
+
+	k.irq.Update(k.keyDownORGates[len(k.keyDownORGates)-1].Output())
 }
 
 func (k *KeyboardAdapter) update() {
@@ -148,7 +175,7 @@ func (k *Keyboard) Run() {
 			return
 		case key := <-k.keyPressChannel:
 			if key.IsDown {
-				k.outBus.SetValue(uint16(key.Value))
+				k.outBus.SetValue(arch.Word(key.Value))
 			}
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/circuit"
 	"github.com/djhworld/simple-computer/components"
 )
 
@@ -40,6 +41,49 @@ func TestAdapterPutsKeycodeRegisterOnBusAndClearsIt(t *testing.T) {
 	}
 }
 
+func TestAdapterRaisesIRQUntilKeycodeIsRead(t *testing.T) {
+	ioBus := components.NewIOBus()
+	mainBus := components.NewBus(arch.BUS_WIDTH)
+	irq := circuit.NewWire("IRQ", false)
+
+	adapter := NewKeyboardAdapter()
+	adapter.Connect(ioBus, mainBus)
+	adapter.ConnectIRQ(irq)
+
+	adapter.Update()
+	if irq.Get() {
+		t.FailNow()
+	}
+
+	// key down
+	adapter.KeyboardInBus.SetValue(0x0041)
+	adapter.Update()
+	if !irq.Get() {
+		t.FailNow()
+	}
+
+	mainBus.SetValue(0x000F)
+	ioBus.Set()
+	ioBus.Update(true, true)
+	adapter.Update()
+	ioBus.Unset()
+	adapter.Update()
+
+	ioBus.Enable()
+	ioBus.Update(false, false)
+	adapter.Update()
+
+	adapter.Update()
+
+	if !checkBus(mainBus, 0x0041) {
+		t.FailNow()
+	}
+
+	if irq.Get() {
+		t.FailNow()
+	}
+}
+
 func checkBus(b *components.Bus, expected uint16) bool {
 	var x int = 0
 	var result uint16
@@ -1,6 +1,7 @@
 package io
 
 import (
+	"github.com/djhworld/simple-computer/circuit"
 	"github.com/djhworld/simple-computer/components"
 )
 
@@ -8,3 +9,10 @@ type Peripheral interface {
 	Connect(*components.IOBus, *components.Bus)
 	Update()
 }
+
+// InterruptSource is a peripheral that can raise an IRQ line, the line should
+// be held high until the CPU has serviced the peripheral
+type InterruptSource interface {
+	Peripheral
+	ConnectIRQ(*circuit.Wire)
+}
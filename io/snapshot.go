@@ -0,0 +1,99 @@
+package io
+
+import (
+	"encoding/binary"
+	goio "io"
+
+	"github.com/djhworld/simple-computer/arch"
+)
+
+// the adapters save their memory bits, registers and RAM as fixed size little-endian
+// binary so a computer can be carried on from a snapshot, see the cpu package for the
+// CPU's part. Both have to be connected before they can be snapshot or restored
+
+// displaySnapshot is the state of the display adapter, the RAM is in row and column order
+type displaySnapshot struct {
+	Active        bool
+	WriteToRAM    bool
+	InputAddress  uint16
+	OutputAddress uint16
+	RAM           [256 * 256]uint16
+}
+
+// Snapshot writes the state of the display adapter and its RAM
+func (k *DisplayAdapter) Snapshot(w goio.Writer) error {
+	s := &displaySnapshot{
+		Active:        k.displayAdapterActiveBit.Get(),
+		WriteToRAM:    k.writeToRAM.Get(),
+		InputAddress:  uint16(k.displayRAM.InputAddressRegister.Value()),
+		OutputAddress: uint16(k.displayRAM.OutputAddressRegister.Value()),
+	}
+	for i := 0; i < 256; i++ {
+		for j := 0; j < 256; j++ {
+			s.RAM[i*256+j] = uint16(k.displayRAM.data[i][j].Value())
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, s)
+}
+
+// Restore reads a state written by Snapshot
+func (k *DisplayAdapter) Restore(r goio.Reader) error {
+	s := new(displaySnapshot)
+	if err := binary.Read(r, binary.LittleEndian, s); err != nil {
+		return err
+	}
+
+	k.displayAdapterActiveBit.Update(s.Active, true)
+	k.displayAdapterActiveBit.Update(s.Active, false)
+	k.writeToRAM.Update(s.WriteToRAM, true)
+	k.writeToRAM.Update(s.WriteToRAM, false)
+	k.displayRAM.InputAddressRegister.Load(arch.Word(s.InputAddress))
+	k.displayRAM.OutputAddressRegister.Load(arch.Word(s.OutputAddress))
+	for i := 0; i < 256; i++ {
+		for j := 0; j < 256; j++ {
+			// loading a cell is slow, most of them will not have changed
+			if cell := &k.displayRAM.data[i][j]; cell.Value() != arch.Word(s.RAM[i*256+j]) {
+				cell.Load(arch.Word(s.RAM[i*256+j]))
+			}
+		}
+	}
+	return nil
+}
+
+// keyboardSnapshot is the state of the keyboard adapter, including a key press waiting
+// on the keyboard's bus
+type keyboardSnapshot struct {
+	KeyDown uint16
+	Memory  bool
+	Keycode uint16
+}
+
+// Snapshot writes the state of the keyboard adapter
+func (k *KeyboardAdapter) Snapshot(w goio.Writer) error {
+	s := &keyboardSnapshot{
+		KeyDown: uint16(k.KeyboardInBus.Value()),
+		Memory:  k.memoryBit.Get(),
+		Keycode: uint16(k.keycodeRegister.Value()),
+	}
+	return binary.Write(w, binary.LittleEndian, s)
+}
+
+// Restore reads a state written by Snapshot, the IO bus and main bus it is connected to
+// have to be restored first
+func (k *KeyboardAdapter) Restore(r goio.Reader) error {
+	s := new(keyboardSnapshot)
+	if err := binary.Read(r, binary.LittleEndian, s); err != nil {
+		return err
+	}
+
+	k.KeyboardInBus.SetValue(arch.Word(s.KeyDown))
+	k.memoryBit.Update(s.Memory, true)
+	k.memoryBit.Update(s.Memory, false)
+	k.keycodeRegister.Load(arch.Word(s.Keycode))
+
+	// updateKeycodeReg reads the gates as the last update left them, so work them out again.
+	// The IO bus clock is off between steps so this does not change the memory bit
+	k.update()
+	k.updateIRQ()
+	return nil
+}
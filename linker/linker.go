@@ -0,0 +1,133 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/djhworld/simple-computer/asm"
+)
+
+// Module is an object to link and the name used for it in errors, usually its file name
+type Module struct {
+	Name   string
+	Object *asm.Object
+}
+
+// Layout is where the linker places the sections. The code of each module goes one after
+// another from Text, then the data of each module goes from Data
+type Layout struct {
+	Text uint16
+	// Data is 0 to put the data straight after the code
+	Data uint16
+}
+
+// Image is a linked program that is loaded at Origin
+type Image struct {
+	Origin uint16
+	Words  []uint16
+	// Symbols is the address of every .global label
+	Symbols map[string]uint16
+}
+
+// Link places the sections of each module and fills in every relocation. Labels used
+// with .extern have to be defined with .global in exactly one module. Every problem
+// found is reported
+func Link(modules []Module, layout Layout) (*Image, error) {
+	var errs []error
+
+	// where each module's sections go
+	bases := make([][2]int, len(modules))
+	address := int(layout.Text)
+	for i, m := range modules {
+		bases[i][asm.TEXT_SECTION] = address
+		address += len(m.Object.Text)
+	}
+	textEnd := address
+
+	if layout.Data != 0 {
+		if int(layout.Data) < textEnd {
+			return nil, fmt.Errorf("data at 0x%04X overlaps the code, which ends at 0x%04X", layout.Data, textEnd)
+		}
+		address = int(layout.Data)
+	}
+	for i, m := range modules {
+		bases[i][asm.DATA_SECTION] = address
+		address += len(m.Object.Data)
+	}
+	if address > 0x10000 {
+		return nil, fmt.Errorf("the program ends at 0x%X, which is past the end of memory", address)
+	}
+
+	symbols := make(map[string]uint16)
+	definedBy := make(map[string]string)
+	for i, m := range modules {
+		for _, symbol := range m.Object.Symbols {
+			if symbol.Section == asm.UNDEFINED_SECTION {
+				continue
+			}
+			if other, ok := definedBy[symbol.Name]; ok {
+				errs = append(errs, fmt.Errorf("%s: label '%s' is already defined by %s", m.Name, symbol.Name, other))
+				continue
+			}
+			definedBy[symbol.Name] = m.Name
+			symbols[symbol.Name] = uint16(bases[i][symbol.Section]) + symbol.Offset
+		}
+	}
+	for _, m := range modules {
+		for _, symbol := range m.Object.Symbols {
+			if _, ok := definedBy[symbol.Name]; symbol.Section == asm.UNDEFINED_SECTION && !ok {
+				errs = append(errs, fmt.Errorf("%s: label '%s' is not defined by any module", m.Name, symbol.Name))
+			}
+		}
+	}
+
+	image := &Image{Origin: layout.Text, Words: make([]uint16, address-int(layout.Text)), Symbols: symbols}
+	for i, m := range modules {
+		copy(image.Words[bases[i][asm.TEXT_SECTION]-int(layout.Text):], m.Object.Text)
+		copy(image.Words[bases[i][asm.DATA_SECTION]-int(layout.Text):], m.Object.Data)
+	}
+
+	for i, m := range modules {
+		for _, relocation := range m.Object.Relocations {
+			sectionLength := len(m.Object.Text)
+			if relocation.Section == asm.DATA_SECTION {
+				sectionLength = len(m.Object.Data)
+			}
+			if relocation.Section > asm.DATA_SECTION || int(relocation.Offset) >= sectionLength {
+				errs = append(errs, fmt.Errorf("%s: relocation at %s+0x%04X is outside the section", m.Name, relocation.Section, relocation.Offset))
+				continue
+			}
+
+			var value uint16
+			switch relocation.Target {
+			case asm.TEXT_SECTION, asm.DATA_SECTION:
+				value = uint16(bases[i][relocation.Target])
+			default:
+				v, ok := symbols[relocation.Symbol]
+				if !ok {
+					// reported above if it was declared, otherwise the object is broken
+					if !declares(m.Object, relocation.Symbol) {
+						errs = append(errs, fmt.Errorf("%s: label '%s' is not defined by any module", m.Name, relocation.Symbol))
+					}
+					continue
+				}
+				value = v
+			}
+			image.Words[bases[i][relocation.Section]-int(layout.Text)+int(relocation.Offset)] += value
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return image, nil
+}
+
+func declares(object *asm.Object, name string) bool {
+	for _, symbol := range object.Symbols {
+		if symbol.Name == name && symbol.Section == asm.UNDEFINED_SECTION {
+			return true
+		}
+	}
+	return false
+}
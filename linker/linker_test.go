@@ -0,0 +1,126 @@
+package linker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/djhworld/simple-computer/asm"
+)
+
+const mainModule = `
+.extern print, message
+.global start
+start:
+	DATA R0, message
+	CALL print
+	JMP start
+.data
+count:
+	.word count, start + 1, 7
+`
+
+const libraryModule = `
+.global print, message
+print:
+	RET
+.data
+message:
+	.stringz "hi"
+`
+
+func assembleModule(name, source string, t *testing.T) Module {
+	p := asm.Parser{File: name}
+	instructions, err := p.Parse(strings.NewReader(source))
+	if err != nil {
+		t.Logf("could not parse %s: %v", name, err)
+		t.FailNow()
+	}
+
+	a := asm.Assembler{Positions: p.Positions()}
+	object, err := a.Object(instructions)
+	if err != nil {
+		t.Logf("could not assemble %s: %v", name, err)
+		t.FailNow()
+	}
+	return Module{name, object}
+}
+
+func TestLink(t *testing.T) {
+	modules := []Module{
+		assembleModule("main.asm", mainModule, t),
+		assembleModule("lib.asm", libraryModule, t),
+	}
+
+	image, err := Link(modules, Layout{Text: 0x0500})
+	if err != nil {
+		t.Logf("could not link: %v", err)
+		t.FailNow()
+	}
+
+	expected := []uint16{
+		// main.asm code
+		0x0020, 0x050A, 0x0120, 0x0506, 0x0040, 0x0500,
+		// lib.asm code
+		0x0130,
+		// main.asm data
+		0x0507, 0x0501, 0x0007,
+		// lib.asm data
+		0x6869, 0x0000,
+	}
+	if image.Origin != 0x0500 || !reflect.DeepEqual(image.Words, expected) {
+		t.Logf("expected %X at 0x0500 but got %X at 0x%04X", expected, image.Words, image.Origin)
+		t.FailNow()
+	}
+
+	symbols := map[string]uint16{"start": 0x0500, "print": 0x0506, "message": 0x050A}
+	if !reflect.DeepEqual(image.Symbols, symbols) {
+		t.Logf("expected symbols %v but got %v", symbols, image.Symbols)
+		t.FailNow()
+	}
+}
+
+func TestLinkDataAddress(t *testing.T) {
+	modules := []Module{
+		assembleModule("main.asm", mainModule, t),
+		assembleModule("lib.asm", libraryModule, t),
+	}
+
+	image, err := Link(modules, Layout{Text: 0x0500, Data: 0x0600})
+	if err != nil {
+		t.Logf("could not link: %v", err)
+		t.FailNow()
+	}
+
+	// the gap between the code and data is filled with zeros
+	if len(image.Words) != 0x0105 || image.Words[1] != 0x0603 || image.Words[0x07] != 0x0000 || image.Words[0x0100] != 0x0600 {
+		t.Logf("unexpected image %X", image.Words)
+		t.FailNow()
+	}
+
+	if _, err := Link(modules, Layout{Text: 0x0500, Data: 0x0502}); err == nil || !strings.Contains(err.Error(), "overlaps the code") {
+		t.Logf("expected data overlapping the code to be an error but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestLinkReportsEveryError(t *testing.T) {
+	modules := []Module{
+		assembleModule("main.asm", mainModule, t),
+		assembleModule("other.asm", ".global start\nstart:\n\tHALT\n", t),
+	}
+
+	_, err := Link(modules, Layout{Text: 0x0500})
+	if err == nil {
+		t.Logf("expected errors")
+		t.FailNow()
+	}
+
+	expected := "other.asm: label 'start' is already defined by main.asm\n" +
+		"main.asm: label 'print' is not defined by any module\n" +
+		"main.asm: label 'message' is not defined by any module"
+	if err.Error() != expected {
+		t.Logf("expected errors %q but got %q", expected, err.Error())
+		t.FailNow()
+	}
+}
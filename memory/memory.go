@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/djhworld/simple-computer/arch"
 	"github.com/djhworld/simple-computer/circuit"
 	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/utils"
 )
 
 type Cell struct {
@@ -41,25 +43,57 @@ func (c *Cell) Update(set bool, enable bool) {
 	c.value.Update()
 }
 
+// Value returns the word held in the cell
+func (c *Cell) Value() arch.Word {
+	return c.value.Value()
+}
+
+// Load puts a word straight into the cell without going through its buses
+func (c *Cell) Load(value arch.Word) {
+	c.value.Load(value)
+}
+
+// Memory64K is the RAM, its address is the lower 16 bits of the address register so a
+// 32 bit bus addresses the same 64K words as a 16 bit one. On an 8 bit bus the address is
+// the whole byte and there are only 256 words, as in the book
 type Memory64K struct {
 	AddressRegister components.Register
-	rowDecoder      components.Decoder8x256
-	colDecoder      components.Decoder8x256
-	data            [256][256]Cell
+	addressStart    int
+	rowDecoder      addressDecoder
+	colDecoder      addressDecoder
+	data            [][]Cell
 	set             circuit.Wire
 	enable          circuit.Wire
 	bus             *components.Bus
 }
 
+// NewMemory64K builds the RAM for a bus, its words are as wide as the bus
 func NewMemory64K(bus *components.Bus) *Memory64K {
 	m := new(Memory64K)
 	m.AddressRegister = *components.NewRegister("MAR", bus, bus)
-	m.rowDecoder = *components.NewDecoder8x256()
-	m.colDecoder = *components.NewDecoder8x256()
 	m.bus = bus
 
-	for i := 0; i < 256; i++ {
-		for j := 0; j < 256; j++ {
+	addressWidth := 16
+	if bus.Width() < addressWidth {
+		addressWidth = bus.Width()
+	}
+	m.addressStart = bus.Width() - addressWidth
+	switch addressWidth {
+	case 8:
+		m.rowDecoder = newDecoder4x16()
+		m.colDecoder = newDecoder4x16()
+	case 16:
+		m.rowDecoder = newDecoder8x256()
+		m.colDecoder = newDecoder8x256()
+	default:
+		panic(fmt.Sprintf("RAM can't be built for a %d bit bus", bus.Width()))
+	}
+
+	size := 1 << uint(addressWidth/2)
+	m.data = make([][]Cell, size)
+	for i := range m.data {
+		m.data[i] = make([]Cell, size)
+		for j := range m.data[i] {
 			m.data[i][j] = *NewCell(bus, bus)
 		}
 	}
@@ -67,6 +101,11 @@ func NewMemory64K(bus *components.Bus) *Memory64K {
 	return m
 }
 
+// Size is the number of words in the RAM
+func (m *Memory64K) Size() int {
+	return len(m.data) * len(m.data)
+}
+
 func (m *Memory64K) Enable() {
 	m.enable.Update(true)
 }
@@ -83,35 +122,103 @@ func (m *Memory64K) Unset() {
 	m.set.Update(false)
 }
 
+// AddSignals names the RAM's set and enable wires, and the address register's wires under mar
+func (m *Memory64K) AddSignals(s circuit.Scope) {
+	s.Add("set", &m.set)
+	s.Add("enable", &m.enable)
+	m.AddressRegister.AddSignals(s.Scope("mar"))
+}
+
 func (m *Memory64K) Update() {
 	m.AddressRegister.Update()
-	m.rowDecoder.Update(
-		m.AddressRegister.Bit(0),
-		m.AddressRegister.Bit(1),
-		m.AddressRegister.Bit(2),
-		m.AddressRegister.Bit(3),
-		m.AddressRegister.Bit(4),
-		m.AddressRegister.Bit(5),
-		m.AddressRegister.Bit(6),
-		m.AddressRegister.Bit(7),
-	)
-	m.colDecoder.Update(
-		m.AddressRegister.Bit(8),
-		m.AddressRegister.Bit(9),
-		m.AddressRegister.Bit(10),
-		m.AddressRegister.Bit(11),
-		m.AddressRegister.Bit(12),
-		m.AddressRegister.Bit(13),
-		m.AddressRegister.Bit(14),
-		m.AddressRegister.Bit(15),
-	)
-
-	var row int = m.rowDecoder.Index()
-	var col int = m.colDecoder.Index()
+	half := (m.AddressRegister.Width() - m.addressStart) / 2
+	var row int = m.rowDecoder.decode(&m.AddressRegister, m.addressStart)
+	var col int = m.colDecoder.decode(&m.AddressRegister, m.addressStart+half)
 
 	m.data[row][col].Update(m.set.Get(), m.enable.Get())
 }
 
+// Peek returns the value held at the given address without going through the
+// address register or the bus
+func (m *Memory64K) Peek(address arch.Word) arch.Word {
+	return m.cell(address).value.Value()
+}
+
+// Poke puts a value at the given address without going through the address register
+// or the bus
+func (m *Memory64K) Poke(address arch.Word, value arch.Word) {
+	m.cell(address).value.Load(value)
+}
+
+// CellWires returns the wires carrying the word held at the given address, wire 0 is the
+// most significant bit
+func (m *Memory64K) CellWires(address arch.Word) []*circuit.Wire {
+	return m.cell(address).value.WordWires()
+}
+
+// cell finds the cell the decoders select for an address
+func (m *Memory64K) cell(address arch.Word) *Cell {
+	half := uint(m.AddressRegister.Width()-m.addressStart) / 2
+	mask := arch.Mask(int(half))
+	return &m.data[m.rowDecoder.index(int(address>>half&mask))][m.colDecoder.index(int(address&mask))]
+}
+
+// an addressDecoder picks a row or column of cells from half of the address
+type addressDecoder interface {
+	// decode updates the decoder from the address register's bits starting at first, and
+	// returns the row or column it selects
+	decode(mar *components.Register, first int) int
+	// index is the row or column selected for half an address with the given value
+	index(value int) int
+	// Index is the row or column selected by the last decode
+	Index() int
+}
+
+type decoder4x16 struct {
+	components.Decoder4x16
+}
+
+func newDecoder4x16() *decoder4x16 {
+	return &decoder4x16{*components.NewDecoder4x16()}
+}
+
+func (d *decoder4x16) decode(mar *components.Register, first int) int {
+	d.Update(mar.Bit(first), mar.Bit(first+1), mar.Bit(first+2), mar.Bit(first+3))
+	return d.Index()
+}
+
+func (d *decoder4x16) index(value int) int {
+	return value
+}
+
+type decoder8x256 struct {
+	components.Decoder8x256
+}
+
+func newDecoder8x256() *decoder8x256 {
+	return &decoder8x256{*components.NewDecoder8x256()}
+}
+
+func (d *decoder8x256) decode(mar *components.Register, first int) int {
+	d.Update(
+		mar.Bit(first),
+		mar.Bit(first+1),
+		mar.Bit(first+2),
+		mar.Bit(first+3),
+		mar.Bit(first+4),
+		mar.Bit(first+5),
+		mar.Bit(first+6),
+		mar.Bit(first+7),
+	)
+	return d.Index()
+}
+
+// index is the output of a Decoder8x256 for the given byte, it selects its 4x16 decoder
+// with the lower nibble
+func (d *decoder8x256) index(value int) int {
+	return (value&0x0F)<<4 | value>>4
+}
+
 func (m *Memory64K) String() string {
 	var row int = m.rowDecoder.Index()
 	var col int = m.colDecoder.Index()
@@ -120,18 +227,9 @@ func (m *Memory64K) String() string {
 	builder.WriteString(fmt.Sprint("Memory\n--------------------------------------\n"))
 	builder.WriteString(fmt.Sprintf("RD: %d\tCD: %d\tS: %v\tE: %v\t%s\n", row, col, m.set.Get(), m.enable.Get(), m.AddressRegister.String()))
 
-	for i := 0; i < 256; i++ {
-		for j := 0; j < 256; j++ {
-			val := m.data[i][j].value.Value()
-			if val <= 0x000F {
-				builder.WriteString(fmt.Sprintf("0x000%X\t", val))
-			} else if val <= 0x00FF {
-				builder.WriteString(fmt.Sprintf("0x00%X\t", val))
-			} else if val <= 0x0FFF {
-				builder.WriteString(fmt.Sprintf("0x0%X\t", val))
-			} else {
-				builder.WriteString(fmt.Sprintf("0x%X\t", val))
-			}
+	for i := range m.data {
+		for j := range m.data[i] {
+			builder.WriteString(utils.WordToString(m.data[i][j].value.Value(), m.AddressRegister.Width()) + "\t")
 		}
 		builder.WriteString(fmt.Sprint("\n"))
 
@@ -15,13 +15,13 @@ func TestMemory64KWrite(t *testing.T) {
 	var q uint16 = 0xFFFF
 	for i = 0x0000; i < 0xFFFF; i++ {
 		m.AddressRegister.Set()
-		bus.SetValue(i)
+		bus.SetValue(arch.Word(i))
 		m.Update()
 
 		m.AddressRegister.Unset()
 		m.Update()
 
-		bus.SetValue(q)
+		bus.SetValue(arch.Word(q))
 		m.Set()
 		m.Update()
 
@@ -34,7 +34,7 @@ func TestMemory64KWrite(t *testing.T) {
 	var expected uint16 = 0xFFFF
 	for i = 0x0000; i < 0xFFFF; i++ {
 		m.AddressRegister.Set()
-		bus.SetValue(i)
+		bus.SetValue(arch.Word(i))
 		m.Update()
 
 		m.AddressRegister.Unset()
@@ -59,13 +59,13 @@ func TestMemory64KDoesNotUpdateWhenSetFlagIsOff(t *testing.T) {
 	var q uint16 = 0xFFFF
 	for i = 0x0000; i < 0xFFFF; i++ {
 		m.AddressRegister.Set()
-		bus.SetValue(i)
+		bus.SetValue(arch.Word(i))
 		m.Update()
 
 		m.AddressRegister.Unset()
 		m.Update()
 
-		bus.SetValue(q)
+		bus.SetValue(arch.Word(q))
 
 		m.Unset()
 		m.Update()
@@ -76,7 +76,7 @@ func TestMemory64KDoesNotUpdateWhenSetFlagIsOff(t *testing.T) {
 	var expected uint16 = 0xFFFF
 	for i = 0x0000; i < 0xFFFF; i++ {
 		m.AddressRegister.Set()
-		bus.SetValue(i)
+		bus.SetValue(arch.Word(i))
 		m.Update()
 
 		m.AddressRegister.Unset()
@@ -92,6 +92,124 @@ func TestMemory64KDoesNotUpdateWhenSetFlagIsOff(t *testing.T) {
 	}
 }
 
+func TestMemory64KPeek(t *testing.T) {
+	bus := components.NewBus(arch.BUS_WIDTH)
+	m := NewMemory64K(bus)
+
+	for _, address := range []uint16{0x0000, 0x00FF, 0x0100, 0x1234, 0xFFFF} {
+		m.AddressRegister.Set()
+		bus.SetValue(arch.Word(address))
+		m.Update()
+
+		m.AddressRegister.Unset()
+		m.Update()
+
+		bus.SetValue(arch.Word(^address))
+		m.Set()
+		m.Update()
+
+		m.Unset()
+		m.Update()
+	}
+
+	for _, address := range []uint16{0x0000, 0x00FF, 0x0100, 0x1234, 0xFFFF} {
+		if value := m.Peek(arch.Word(address)); value != arch.Word(^address) {
+			t.Logf("Expected %X at address %X but got %X", ^address, address, value)
+			t.FailNow()
+		}
+	}
+
+	if m.Peek(0x0001) != 0x0000 {
+		t.FailNow()
+	}
+}
+
+func TestMemory64KPoke(t *testing.T) {
+	bus := components.NewBus(arch.BUS_WIDTH)
+	m := NewMemory64K(bus)
+
+	for _, address := range []uint16{0x0000, 0x00FF, 0x0100, 0x1234, 0xFFFF} {
+		m.Poke(arch.Word(address), arch.Word(^address))
+	}
+
+	// read 0x1234 back through the address register and the bus
+	m.AddressRegister.Set()
+	bus.SetValue(0x1234)
+	m.Update()
+	m.AddressRegister.Unset()
+	m.Update()
+	m.Enable()
+	m.Update()
+	if bus.Value() != arch.Word(^uint16(0x1234)) {
+		t.Logf("Expected %X on the bus but got %X", ^uint16(0x1234), bus.Value())
+		t.FailNow()
+	}
+	m.Disable()
+	m.Update()
+
+	for _, address := range []uint16{0x0000, 0x00FF, 0x0100, 0xFFFF} {
+		if value := m.Peek(arch.Word(address)); value != arch.Word(^address) {
+			t.Logf("Expected %X at address %X but got %X", ^address, address, value)
+			t.FailNow()
+		}
+	}
+}
+
+func TestMemoryWidths(t *testing.T) {
+	for _, width := range arch.BUS_WIDTHS {
+		bus := components.NewBus(width)
+		m := NewMemory64K(bus)
+
+		size := 65536
+		if width == 8 {
+			size = 256
+		}
+		if m.Size() != size {
+			t.Logf("expected %d words of RAM on a %d bit bus but got %d", size, width, m.Size())
+			t.FailNow()
+		}
+
+		max := arch.Mask(width)
+		addresses := []arch.Word{0, 1, arch.Word(size / 2), arch.Word(size - 1)}
+		for _, address := range addresses {
+			m.AddressRegister.Set()
+			bus.SetValue(address)
+			m.Update()
+			m.AddressRegister.Unset()
+			m.Update()
+
+			bus.SetValue(max - address)
+			m.Set()
+			m.Update()
+			m.Unset()
+			m.Update()
+		}
+
+		for _, address := range addresses {
+			if value := m.Peek(address); value != max-address {
+				t.Logf("%d bits: expected 0x%X at 0x%X but got 0x%X", width, max-address, address, value)
+				t.FailNow()
+			}
+		}
+
+		// the address is the lower 16 bits of the address register
+		m.Poke(0x1234, 0x2A)
+		m.AddressRegister.Set()
+		bus.SetValue(max&^0xFFFF | 0x1234)
+		m.Update()
+		m.AddressRegister.Unset()
+		m.Update()
+		m.Enable()
+		m.Update()
+		if bus.Value() != 0x2A {
+			t.Logf("%d bits: expected 0x2A on the bus but got 0x%X", width, bus.Value())
+			t.FailNow()
+		}
+		m.Disable()
+		m.Update()
+	}
+}
+
 func checkBus(b *components.Bus, expected uint16) bool {
 	var result uint16
 	for i := arch.BUS_WIDTH - 1; i >= 0; i-- {
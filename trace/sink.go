@@ -0,0 +1,372 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/djhworld/simple-computer/asm"
+)
+
+// a binary trace is little-endian
+// ----------------------
+// "SCTR"                                      magic
+// uint16                                      version
+// then for each record
+// uvarint                                     cycle
+// uint16                                      IAR
+// uint8                                       bit 0 set for an interrupt cycle, bit 1 if there is an operand
+// uint16                                      opcode
+// uint16                                      operand, if there is one
+// uint16                                      flags
+// uint8                                       number of register changes
+//   uint8, uint16, uint16                     index in REGISTER_NAMES, old and new value
+// uvarint                                     number of memory accesses
+//   uint16, uint16, uint8                     address, value, 1 for a write
+// uint8                                       number of IO transfers
+//   uint8, uint16                             bit 0 set for OUT, bit 1 for address mode, value
+//
+// the disassembly and class are not stored, they are worked out again from the opcode
+
+const BINARY_MAGIC = "SCTR"
+const BINARY_VERSION = uint16(1)
+
+// the formats a trace can be written in
+const (
+	FORMAT_JSON   = "json"
+	FORMAT_BINARY = "binary"
+)
+
+const (
+	recordInterrupt = 1 << iota
+	recordOperand
+)
+
+const (
+	ioOutput = 1 << iota
+	ioAddress
+)
+
+// Sink is where a Tracer writes its records
+type Sink interface {
+	Write(r *Record) error
+	Flush() error
+}
+
+// NewSink returns a sink that writes records to w in the given format
+func NewSink(format string, w io.Writer) (Sink, error) {
+	switch format {
+	case FORMAT_JSON:
+		return NewJSONSink(w), nil
+	case FORMAT_BINARY:
+		return NewBinarySink(w), nil
+	}
+	return nil, fmt.Errorf("unknown trace format '%s', expected %s or %s", format, FORMAT_JSON, FORMAT_BINARY)
+}
+
+type jsonSink struct {
+	out     *bufio.Writer
+	encoder *json.Encoder
+}
+
+// NewJSONSink writes each record as a line of JSON
+func NewJSONSink(w io.Writer) Sink {
+	out := bufio.NewWriter(w)
+	return &jsonSink{out, json.NewEncoder(out)}
+}
+
+func (s *jsonSink) Write(r *Record) error {
+	return s.encoder.Encode(r)
+}
+
+func (s *jsonSink) Flush() error {
+	return s.out.Flush()
+}
+
+type binarySink struct {
+	out    *bufio.Writer
+	record bytes.Buffer
+}
+
+// NewBinarySink writes records in the compact binary format, see NewReader to read them back
+func NewBinarySink(w io.Writer) Sink {
+	s := &binarySink{out: bufio.NewWriter(w)}
+	s.out.WriteString(BINARY_MAGIC)
+	binary.Write(s.out, binary.LittleEndian, BINARY_VERSION)
+	return s
+}
+
+func (s *binarySink) Write(r *Record) error {
+	b := &s.record
+	b.Reset()
+	put := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(b, binary.LittleEndian, v)
+		}
+	}
+	varint := make([]byte, binary.MaxVarintLen64)
+
+	b.Write(varint[:binary.PutUvarint(varint, r.Cycle)])
+	bits := uint8(0)
+	if r.Interrupt {
+		bits |= recordInterrupt
+	}
+	if r.Operand != nil {
+		bits |= recordOperand
+	}
+	put(r.IAR, bits, r.Opcode)
+	if r.Operand != nil {
+		put(*r.Operand)
+	}
+	put(r.Flags)
+
+	put(uint8(len(r.Registers)))
+	for _, change := range r.Registers {
+		put(uint8(registerIndex(change.Register)), change.Old, change.New)
+	}
+
+	b.Write(varint[:binary.PutUvarint(varint, uint64(len(r.Memory)))])
+	for _, access := range r.Memory {
+		write := uint8(0)
+		if access.Write {
+			write = 1
+		}
+		put(access.Address, access.Value, write)
+	}
+
+	put(uint8(len(r.IO)))
+	for _, transfer := range r.IO {
+		mode := uint8(0)
+		if transfer.Output {
+			mode |= ioOutput
+		}
+		if transfer.Address {
+			mode |= ioAddress
+		}
+		put(mode, transfer.Value)
+	}
+
+	_, err := s.out.Write(b.Bytes())
+	return err
+}
+
+func (s *binarySink) Flush() error {
+	return s.out.Flush()
+}
+
+func registerIndex(name string) int {
+	for i, register := range REGISTER_NAMES {
+		if register == name {
+			return i
+		}
+	}
+	return len(REGISTER_NAMES)
+}
+
+// Reader reads the records from a binary trace
+type Reader struct {
+	in *bufio.Reader
+}
+
+// NewReader checks r holds a binary trace and returns a reader for its records
+func NewReader(r io.Reader) (*Reader, error) {
+	in := bufio.NewReader(r)
+	magic := make([]byte, len(BINARY_MAGIC))
+	if _, err := io.ReadFull(in, magic); err != nil || !bytes.Equal(magic, []byte(BINARY_MAGIC)) {
+		return nil, fmt.Errorf("not a binary trace")
+	}
+	var version uint16
+	if err := binary.Read(in, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("not a binary trace")
+	}
+	if version != BINARY_VERSION {
+		return nil, fmt.Errorf("unsupported trace version %d", version)
+	}
+	return &Reader{in}, nil
+}
+
+// Read returns the next record, or io.EOF once there are no more
+func (t *Reader) Read() (*Record, error) {
+	r := new(Record)
+	cycle, err := binary.ReadUvarint(t.in)
+	if err != nil {
+		// a trace can only end between records
+		return nil, err
+	}
+	r.Cycle = cycle
+
+	get := func(values ...interface{}) {
+		for _, v := range values {
+			if err == nil {
+				err = binary.Read(t.in, binary.LittleEndian, v)
+			}
+		}
+	}
+
+	var bits uint8
+	get(&r.IAR, &bits, &r.Opcode)
+	if bits&recordOperand != 0 {
+		r.Operand = new(uint16)
+		get(r.Operand)
+	}
+	get(&r.Flags)
+
+	var registers uint8
+	get(&registers)
+	for i := 0; err == nil && i < int(registers); i++ {
+		var index uint8
+		change := RegisterChange{}
+		get(&index, &change.Old, &change.New)
+		if err == nil && int(index) >= len(REGISTER_NAMES) {
+			err = fmt.Errorf("register %d is not one of %v", index, REGISTER_NAMES)
+		}
+		if err == nil {
+			change.Register = REGISTER_NAMES[index]
+			r.Registers = append(r.Registers, change)
+		}
+	}
+
+	var accesses uint64
+	if err == nil {
+		accesses, err = binary.ReadUvarint(t.in)
+	}
+	for i := uint64(0); err == nil && i < accesses; i++ {
+		var write uint8
+		access := MemoryAccess{}
+		get(&access.Address, &access.Value, &write)
+		access.Write = write != 0
+		r.Memory = append(r.Memory, access)
+	}
+
+	var transfers uint8
+	get(&transfers)
+	for i := 0; err == nil && i < int(transfers); i++ {
+		var mode uint8
+		transfer := IOTransfer{}
+		get(&mode, &transfer.Value)
+		transfer.Output = mode&ioOutput != 0
+		transfer.Address = mode&ioAddress != 0
+		r.IO = append(r.IO, transfer)
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bits&recordInterrupt != 0 {
+		r.Interrupt = true
+		r.Disassembly = "interrupt"
+		r.Class = CLASS_INTERRUPT
+	} else {
+		words := []uint16{r.Opcode}
+		if r.Operand != nil {
+			words = append(words, *r.Operand)
+		}
+		ins, _ := asm.DisassembleInstruction(words)
+		r.Disassembly, r.Class = describe(ins, r.Opcode)
+	}
+	return r, nil
+}
+
+// AddressRange is a range of instruction addresses, including both ends
+type AddressRange struct {
+	Start uint16
+	End   uint16
+}
+
+// Filter picks the records to keep, an empty list of ranges or classes keeps everything
+type Filter struct {
+	Ranges  []AddressRange
+	Classes []Class
+}
+
+// Match is true if the record's instruction is in one of the ranges and classes
+func (f Filter) Match(r *Record) bool {
+	inRange := len(f.Ranges) == 0
+	for _, addresses := range f.Ranges {
+		if r.IAR >= addresses.Start && r.IAR <= addresses.End {
+			inRange = true
+		}
+	}
+
+	inClass := len(f.Classes) == 0
+	for _, class := range f.Classes {
+		if r.Class == class {
+			inClass = true
+		}
+	}
+	return inRange && inClass
+}
+
+type filteredSink struct {
+	Sink
+	filter Filter
+}
+
+// Filtered only passes the records the filter matches on to sink
+func Filtered(sink Sink, filter Filter) Sink {
+	return &filteredSink{sink, filter}
+}
+
+func (s *filteredSink) Write(r *Record) error {
+	if !s.filter.Match(r) {
+		return nil
+	}
+	return s.Sink.Write(r)
+}
+
+// ParseFilter reads a filter from a comma separated list of address ranges, each
+// <start>-<end> (e.g. 0x0500-0x05FF), and a comma separated list of classes
+func ParseFilter(ranges, classes string) (Filter, error) {
+	f := Filter{}
+	for _, s := range splitList(ranges) {
+		parts := strings.Split(s, "-")
+		if len(parts) != 2 {
+			return f, fmt.Errorf("expected <start>-<end> but got '%s'", s)
+		}
+		start, err := strconv.ParseUint(parts[0], 0, 16)
+		if err != nil {
+			return f, fmt.Errorf("'%s' is not a 16 bit address", parts[0])
+		}
+		end, err := strconv.ParseUint(parts[1], 0, 16)
+		if err != nil {
+			return f, fmt.Errorf("'%s' is not a 16 bit address", parts[1])
+		}
+		if end < start {
+			return f, fmt.Errorf("range '%s' ends before it starts", s)
+		}
+		f.Ranges = append(f.Ranges, AddressRange{uint16(start), uint16(end)})
+	}
+
+	for _, s := range splitList(classes) {
+		known := false
+		for _, class := range CLASSES {
+			if Class(s) == class {
+				known = true
+			}
+		}
+		if !known {
+			return f, fmt.Errorf("unknown instruction class '%s', expected one of %v", s, CLASSES)
+		}
+		f.Classes = append(f.Classes, Class(s))
+	}
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
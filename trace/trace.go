@@ -0,0 +1,230 @@
+package trace
+
+import (
+	"fmt"
+
+	"github.com/djhworld/simple-computer/asm"
+	"github.com/djhworld/simple-computer/cpu"
+)
+
+// Class groups instructions by what they do, so a trace can be cut down to the ones of interest
+type Class string
+
+const (
+	CLASS_ALU       = Class("alu")
+	CLASS_MEMORY    = Class("memory")
+	CLASS_DATA      = Class("data")
+	CLASS_JUMP      = Class("jump")
+	CLASS_CALL      = Class("call")
+	CLASS_STACK     = Class("stack")
+	CLASS_IO        = Class("io")
+	CLASS_INTERRUPT = Class("interrupt")
+	CLASS_HALT      = Class("halt")
+	CLASS_UNKNOWN   = Class("unknown")
+)
+
+// CLASSES is every class
+var CLASSES = []Class{CLASS_ALU, CLASS_MEMORY, CLASS_DATA, CLASS_JUMP, CLASS_CALL, CLASS_STACK, CLASS_IO, CLASS_INTERRUPT, CLASS_HALT, CLASS_UNKNOWN}
+
+// REGISTER_NAMES are the registers whose changes are traced, IAR is left out as every
+// instruction changes it and the next record says where it went
+var REGISTER_NAMES = []string{"R0", "R1", "R2", "R3", "SP"}
+
+// Record is an instruction (or interrupt cycle) the CPU has finished
+type Record struct {
+	// Cycle is the number of steps run before the instruction started
+	Cycle       uint64           `json:"cycle"`
+	IAR         uint16           `json:"iar"`
+	Interrupt   bool             `json:"interrupt,omitempty"`
+	Opcode      uint16           `json:"opcode"`
+	Operand     *uint16          `json:"operand,omitempty"`
+	Disassembly string           `json:"disassembly"`
+	Class       Class            `json:"class"`
+	Registers   []RegisterChange `json:"registers,omitempty"`
+	Flags       uint16           `json:"flags"`
+	Memory      []MemoryAccess   `json:"memory,omitempty"`
+	IO          []IOTransfer     `json:"io,omitempty"`
+}
+
+// RegisterChange is a register the instruction changed
+type RegisterChange struct {
+	Register string `json:"register"`
+	Old      uint16 `json:"old"`
+	New      uint16 `json:"new"`
+}
+
+// MemoryAccess is a word of memory the instruction read or wrote, reading the instruction
+// itself is left out
+type MemoryAccess struct {
+	Address uint16 `json:"address"`
+	Value   uint16 `json:"value"`
+	Write   bool   `json:"write,omitempty"`
+}
+
+// IOTransfer is a word sent to or read from a device with OUT or IN
+type IOTransfer struct {
+	Output  bool   `json:"output,omitempty"`
+	Address bool   `json:"address,omitempty"`
+	Value   uint16 `json:"value"`
+}
+
+// Tracer steps a CPU core, writing a record to the sink each time an instruction finishes.
+// It takes over the core's memory observer
+type Tracer struct {
+	core cpu.Core
+	sink Sink
+
+	cycle   uint64
+	running bool
+	record  *Record
+	words   [2]uint16
+	before  [5]uint16
+	memory  []MemoryAccess
+}
+
+func NewTracer(core cpu.Core, sink Sink) *Tracer {
+	t := &Tracer{core: core, sink: sink}
+	core.ObserveMemory(t.observeMemory)
+	return t
+}
+
+// Step runs a single step of the core
+func (t *Tracer) Step() error {
+	if !t.running && !t.core.Halted() {
+		t.begin()
+	}
+	t.core.Step()
+	t.cycle++
+
+	// HALT stops the CPU part way through
+	if t.running && (t.core.InstructionDone() || t.core.Halted()) {
+		t.running = false
+		return t.sink.Write(t.finish())
+	}
+	return nil
+}
+
+// Flush writes out anything the sink is holding on to
+func (t *Tracer) Flush() error {
+	return t.sink.Flush()
+}
+
+func (t *Tracer) begin() {
+	iar := t.core.IAR()
+	t.record = &Record{Cycle: t.cycle, IAR: iar}
+	t.words = [2]uint16{t.core.ReadMemory(iar), t.core.ReadMemory(iar + 1)}
+	t.before = t.registers()
+	t.memory = t.memory[:0]
+	t.running = true
+}
+
+func (t *Tracer) finish() *Record {
+	r := t.record
+	memory := t.memory
+
+	if t.core.InterruptCycle() {
+		r.Interrupt = true
+		r.Disassembly = "interrupt"
+		r.Class = CLASS_INTERRUPT
+	} else {
+		r.Opcode = t.words[0]
+		ins, size := asm.DisassembleInstruction(t.words[:])
+		if size == 2 {
+			operand := t.words[1]
+			r.Operand = &operand
+		}
+		r.Disassembly, r.Class = describe(ins, r.Opcode)
+		r.IO = t.io(ins)
+
+		// leave out reading the instruction's own words, the operand may be read after
+		// the instruction has written something
+		var accesses []MemoryAccess
+		fetched := 0
+		for _, access := range memory {
+			if fetched < size && !access.Write && access.Address == r.IAR+uint16(fetched) {
+				fetched++
+				continue
+			}
+			accesses = append(accesses, access)
+		}
+		memory = accesses
+	}
+
+	after := t.registers()
+	for i := range after {
+		if after[i] != t.before[i] {
+			r.Registers = append(r.Registers, RegisterChange{REGISTER_NAMES[i], t.before[i], after[i]})
+		}
+	}
+	r.Flags = t.core.Flags()
+
+	for _, access := range memory {
+		if access.Write {
+			access.Value = t.core.ReadMemory(access.Address)
+		}
+		r.Memory = append(r.Memory, access)
+	}
+	return r
+}
+
+func (t *Tracer) registers() [5]uint16 {
+	return [5]uint16{t.core.Register(0), t.core.Register(1), t.core.Register(2), t.core.Register(3), t.core.SP()}
+}
+
+// observeMemory is called before a write, so the value written is read once the
+// instruction is done
+func (t *Tracer) observeMemory(address uint16, write bool) {
+	if !t.running {
+		return
+	}
+	access := MemoryAccess{Address: address, Write: write}
+	if !write {
+		access.Value = t.core.ReadMemory(address)
+	}
+	t.memory = append(t.memory, access)
+}
+
+func (t *Tracer) io(ins asm.Instruction) []IOTransfer {
+	switch v := ins.(type) {
+	case asm.IN:
+		return []IOTransfer{{Address: v.IoMode == asm.ADDRESS_MODE, Value: t.core.Register(int(v.ToRegister))}}
+	case asm.OUT:
+		return []IOTransfer{{Output: true, Address: v.IoMode == asm.ADDRESS_MODE, Value: t.core.Register(int(v.FromRegister))}}
+	}
+	return nil
+}
+
+// describe disassembles an instruction and works out its class, ins is nil if the opcode
+// is not one the assembler would emit
+func describe(ins asm.Instruction, opcode uint16) (string, Class) {
+	if ins == nil {
+		return fmt.Sprintf(".word 0x%04X", opcode), CLASS_UNKNOWN
+	}
+	return ins.String(), ClassOf(ins)
+}
+
+// ClassOf returns the class of an instruction
+func ClassOf(ins asm.Instruction) Class {
+	switch ins.(type) {
+	case asm.ADD, asm.ADC, asm.SUB, asm.SBB, asm.AND, asm.OR, asm.XOR, asm.NOT, asm.SHL, asm.SHR, asm.CMP, asm.CLF,
+		asm.ADDI, asm.ANDI, asm.ORI, asm.XORI, asm.CMPI:
+		return CLASS_ALU
+	case asm.LOAD, asm.STORE, asm.LOADINDEXED, asm.STOREINDEXED, asm.LOADINCREMENT, asm.STOREINCREMENT:
+		return CLASS_MEMORY
+	case asm.DATA, asm.MOV:
+		return CLASS_DATA
+	case asm.JMP, asm.JMPF, asm.JR:
+		return CLASS_JUMP
+	case asm.CALL, asm.RET:
+		return CLASS_CALL
+	case asm.PUSH, asm.POP:
+		return CLASS_STACK
+	case asm.IN, asm.OUT:
+		return CLASS_IO
+	case asm.EI, asm.DI, asm.IRET:
+		return CLASS_INTERRUPT
+	case asm.HALT:
+		return CLASS_HALT
+	}
+	return CLASS_UNKNOWN
+}
@@ -0,0 +1,221 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/djhworld/simple-computer/arch"
+	"github.com/djhworld/simple-computer/asm"
+	"github.com/djhworld/simple-computer/components"
+	"github.com/djhworld/simple-computer/cpu"
+	"github.com/djhworld/simple-computer/memory"
+)
+
+const PROGRAM = `
+	DATA R0, 0x0A00
+	DATA R1, 0x0005
+	ST R0, R1
+	LD R0, R2
+	PUSH R2
+	CALL double
+	POP R3
+	OUT Addr, R0
+	HALT
+double:
+	ADD R1, R1
+	RET
+`
+
+// recordSink keeps every record written to it
+type recordSink struct {
+	records []*Record
+}
+
+func (s *recordSink) Write(r *Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *recordSink) Flush() error {
+	return nil
+}
+
+func setUpCore(fast bool, t *testing.T) cpu.Core {
+	instructions, err := (&asm.Parser{}).Parse(strings.NewReader(PROGRAM))
+	if err != nil {
+		t.Logf("could not parse program: %v", err)
+		t.FailNow()
+	}
+	bin, err := (&asm.Assembler{}).Process(0x0500, instructions)
+	if err != nil {
+		t.Logf("could not assemble program: %v", err)
+		t.FailNow()
+	}
+
+	bus := components.NewBus(arch.BUS_WIDTH)
+	var core cpu.Core
+	if fast {
+		core = cpu.NewFastCPU(bus)
+	} else {
+		m := memory.NewMemory64K(bus)
+		// each cell settles to 0xFFFF the first time it is selected unless it has been written
+		for address := 0; address <= 0xFFFF; address++ {
+			m.Poke(arch.Word(address), 0x0000)
+		}
+		core = cpu.NewCPU(bus, m)
+		core.SetIR(0x0000)
+	}
+
+	for i, value := range bin {
+		core.WriteMemory(0x0500+uint16(i), value)
+	}
+	core.SetIAR(0x0500)
+	core.SetSP(0xFEFE)
+	for i := 0; i < 4; i++ {
+		core.SetRegister(i, 0x0000)
+	}
+	core.SetFlags(0x0000)
+	return core
+}
+
+func runTrace(core cpu.Core, sink Sink, t *testing.T) {
+	tracer := NewTracer(core, sink)
+	for steps := 0; !core.Halted(); steps++ {
+		if steps > 1000 {
+			t.Logf("program did not halt")
+			t.FailNow()
+		}
+		if err := tracer.Step(); err != nil {
+			t.Logf("unexpected error tracing: %v", err)
+			t.FailNow()
+		}
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Logf("unexpected error flushing: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestTraceRecords(t *testing.T) {
+	sink := &recordSink{}
+	runTrace(setUpCore(true, t), sink, t)
+
+	disassembly := []string{"DATA R0, 0x0A00", "DATA R1, 0x0005", "ST R0, R1", "LD R0, R2", "PUSH R2", "CALL 0x050C", "ADD R1, R1", "RET", "POP R3", "OUT Addr, R0", "HALT"}
+	if len(sink.records) != len(disassembly) {
+		t.Logf("expected %d records but got %d", len(disassembly), len(sink.records))
+		t.FailNow()
+	}
+	for i, r := range sink.records {
+		if r.Disassembly != disassembly[i] {
+			t.Logf("expected record %d to be %s but got %s", i, disassembly[i], r.Disassembly)
+			t.FailNow()
+		}
+	}
+
+	check := func(index int, expected Record) {
+		if got := *sink.records[index]; !reflect.DeepEqual(got, expected) {
+			t.Logf("expected record %d to be %+v but got %+v", index, expected, got)
+			t.FailNow()
+		}
+	}
+	operand := func(v uint16) *uint16 {
+		return &v
+	}
+
+	check(0, Record{Cycle: 0, IAR: 0x0500, Opcode: 0x0020, Operand: operand(0x0A00), Disassembly: "DATA R0, 0x0A00", Class: CLASS_DATA,
+		Registers: []RegisterChange{{"R0", 0x0000, 0x0A00}}})
+	check(2, Record{Cycle: 12, IAR: 0x0504, Opcode: 0x0011, Disassembly: "ST R0, R1", Class: CLASS_MEMORY,
+		Memory: []MemoryAccess{{0x0A00, 0x0005, true}}})
+	check(3, Record{Cycle: 18, IAR: 0x0505, Opcode: 0x0002, Disassembly: "LD R0, R2", Class: CLASS_MEMORY,
+		Registers: []RegisterChange{{"R2", 0x0000, 0x0005}}, Memory: []MemoryAccess{{0x0A00, 0x0005, false}}})
+	check(5, Record{Cycle: 30, IAR: 0x0507, Opcode: 0x0120, Operand: operand(0x050C), Disassembly: "CALL 0x050C", Class: CLASS_CALL,
+		Registers: []RegisterChange{{"SP", 0xFEFD, 0xFEFC}}, Memory: []MemoryAccess{{0xFEFC, 0x0509, true}}})
+	check(9, Record{Cycle: 57, IAR: 0x050A, Opcode: 0x007C, Disassembly: "OUT Addr, R0", Class: CLASS_IO, Flags: 0x2000,
+		IO: []IOTransfer{{Output: true, Address: true, Value: 0x0A00}}})
+}
+
+func TestCoresTraceTheSame(t *testing.T) {
+	var traces []string
+	for _, fast := range []bool{false, true} {
+		out := &bytes.Buffer{}
+		runTrace(setUpCore(fast, t), NewJSONSink(out), t)
+		traces = append(traces, out.String())
+	}
+	if traces[0] != traces[1] {
+		t.Logf("expected the same trace from both cores but the gate level CPU gave\n%s\nand the FastCPU\n%s", traces[0], traces[1])
+		t.FailNow()
+	}
+	if lines := strings.Count(traces[0], "\n"); lines != 11 {
+		t.Logf("expected a line for each instruction but got %d", lines)
+		t.FailNow()
+	}
+}
+
+func TestBinaryTraceRoundTrip(t *testing.T) {
+	records := &recordSink{}
+	runTrace(setUpCore(true, t), records, t)
+
+	out := &bytes.Buffer{}
+	runTrace(setUpCore(true, t), NewBinarySink(out), t)
+
+	reader, err := NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	for i, expected := range records.records {
+		got, err := reader.Read()
+		if err != nil || !reflect.DeepEqual(got, expected) {
+			t.Logf("expected record %d to be %+v but got %+v, %v", i, expected, got, err)
+			t.FailNow()
+		}
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		t.Logf("expected the end of the trace but got %v", err)
+		t.FailNow()
+	}
+
+	// cut off part way through the last record
+	reader, _ = NewReader(bytes.NewReader(out.Bytes()[:out.Len()-2]))
+	for err == nil {
+		_, err = reader.Read()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Logf("expected a truncated trace to be an error but got %v", err)
+		t.FailNow()
+	}
+
+	if _, err := NewReader(strings.NewReader("{\"cycle\":0}")); err == nil {
+		t.Logf("expected an error reading JSON as a binary trace")
+		t.FailNow()
+	}
+}
+
+func TestFilter(t *testing.T) {
+	filter, err := ParseFilter("0x0500-0x0505, 0x050C-0x050C", "memory,alu")
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+
+	sink := &recordSink{}
+	runTrace(setUpCore(true, t), Filtered(sink, filter), t)
+	var got []string
+	for _, r := range sink.records {
+		got = append(got, r.Disassembly)
+	}
+	if expected := []string{"ST R0, R1", "LD R0, R2", "ADD R1, R1"}; !reflect.DeepEqual(got, expected) {
+		t.Logf("expected %v but got %v", expected, got)
+		t.FailNow()
+	}
+
+	for _, bad := range [][2]string{{"0x0500", ""}, {"0x0505-0x0500", ""}, {"", "maths"}} {
+		if _, err := ParseFilter(bad[0], bad[1]); err == nil {
+			t.Logf("expected an error parsing %q and %q", bad[0], bad[1])
+			t.FailNow()
+		}
+	}
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+
+	"github.com/djhworld/simple-computer/arch"
 )
 
 func ValueToString(val uint16) string {
@@ -14,3 +16,8 @@ func ValueToString(val uint16) string {
 	}
 	return fmt.Sprintf("0x%X", val)
 }
+
+// WordToString formats a value with as many hex digits as a bus of the given width needs
+func WordToString(value arch.Word, width int) string {
+	return fmt.Sprintf("0x%0*X", (width+3)/4, value)
+}
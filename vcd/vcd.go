@@ -0,0 +1,198 @@
+package vcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/djhworld/simple-computer/circuit"
+)
+
+// VALUE CHANGE DUMP
+// a VCD file (IEEE 1364) lists the signals in a header, then the time of each sample
+// followed by the signals that changed since the one before. Waveform viewers such as
+// GTKWave show them as the traces of a logic analyser.
+// ----------------------
+// each sample is one time unit, there is no real time in the simulation so the timescale
+// is nominal. The dots in a signal's path become scopes, e.g. cpu.r0.enable is the wire
+// enable in the scope r0 inside the scope cpu
+
+// TIMESCALE is the length of a time unit given in the header
+const TIMESCALE = "1ns"
+
+// Writer writes samples of signals to a VCD file. Errors are kept until Flush, so Sample
+// can be called from a cpu.SignalObserver
+type Writer struct {
+	out     *bufio.Writer
+	signals []*circuit.Signal
+	ids     []string
+	last    []uint64
+	time    uint64
+	err     error
+}
+
+// NewWriter writes the header for the signals to w, each call to Sample then writes
+// the signals that have changed
+func NewWriter(w io.Writer, signals []*circuit.Signal) *Writer {
+	v := &Writer{out: bufio.NewWriter(w), signals: signals}
+	v.ids = make([]string, len(signals))
+	v.last = make([]uint64, len(signals))
+	for i := range signals {
+		v.ids[i] = identifier(i)
+	}
+	v.header()
+	return v
+}
+
+func (v *Writer) header() {
+	v.printf("$version simple-computer $end\n")
+	v.printf("$timescale %s $end\n", TIMESCALE)
+
+	// signals that share a scope are kept together, in the order the scope first appears
+	root := &scope{}
+	for i, signal := range v.signals {
+		s := root
+		parts := strings.Split(signal.Path, ".")
+		for _, name := range parts[:len(parts)-1] {
+			s = s.child(name)
+		}
+		s.vars = append(s.vars, variable{parts[len(parts)-1], i})
+	}
+	v.writeScope(root)
+	v.printf("$enddefinitions $end\n")
+}
+
+func (v *Writer) writeScope(s *scope) {
+	for _, variable := range s.vars {
+		v.printf("$var wire %d %s %s $end\n", v.signals[variable.index].Width(), v.ids[variable.index], variable.name)
+	}
+	for _, child := range s.children {
+		v.printf("$scope module %s $end\n", child.name)
+		v.writeScope(child)
+		v.printf("$upscope $end\n")
+	}
+}
+
+// Sample reads every signal and writes the ones that have changed, the first sample
+// writes them all
+func (v *Writer) Sample() {
+	if v.time == 0 {
+		v.printf("#0\n$dumpvars\n")
+		for i, signal := range v.signals {
+			v.last[i] = signal.Value()
+			v.change(i)
+		}
+		v.printf("$end\n")
+		v.time++
+		return
+	}
+
+	changed := false
+	for i, signal := range v.signals {
+		value := signal.Value()
+		if value == v.last[i] {
+			continue
+		}
+		if !changed {
+			v.printf("#%d\n", v.time)
+			changed = true
+		}
+		v.last[i] = value
+		v.change(i)
+	}
+	v.time++
+}
+
+func (v *Writer) change(i int) {
+	if v.signals[i].Width() == 1 {
+		v.printf("%d%s\n", v.last[i], v.ids[i])
+		return
+	}
+	v.printf("b%s %s\n", strconv.FormatUint(v.last[i], 2), v.ids[i])
+}
+
+// Flush writes out anything buffered, it returns the first error from writing
+func (v *Writer) Flush() error {
+	if v.err != nil {
+		return v.err
+	}
+	return v.out.Flush()
+}
+
+func (v *Writer) printf(format string, args ...interface{}) {
+	if v.err == nil {
+		_, v.err = fmt.Fprintf(v.out, format, args...)
+	}
+}
+
+type variable struct {
+	name  string
+	index int
+}
+
+type scope struct {
+	name     string
+	vars     []variable
+	children []*scope
+}
+
+func (s *scope) child(name string) *scope {
+	for _, c := range s.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &scope{name: name}
+	s.children = append(s.children, c)
+	return c
+}
+
+// identifier returns the short code for the nth signal, made from the printable
+// characters ! to ~
+func identifier(n int) string {
+	id := ""
+	for {
+		id += string(rune('!' + n%94))
+		n = n/94 - 1
+		if n < 0 {
+			return id
+		}
+	}
+}
+
+// Select picks out the signals in a registry matching a comma separated list of paths
+// or globs, e.g. "cpu.mainBus,cpu.stepper.out[0],cpu.*.enable". A path can be a single
+// wire of a signal (see circuit.Registry.Lookup), otherwise it is a glob
+func Select(registry *circuit.Registry, patterns string) ([]*circuit.Signal, error) {
+	var selected []*circuit.Signal
+	seen := make(map[string]bool)
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+
+		matches, err := registry.List(pattern)
+		if signal, ok := registry.Lookup(pattern); ok {
+			matches, err = []*circuit.Signal{signal}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no signal matches '%s'", pattern)
+		}
+
+		for _, signal := range matches {
+			if !seen[signal.Path] {
+				seen[signal.Path] = true
+				selected = append(selected, signal)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no signals given")
+	}
+	return selected, nil
+}
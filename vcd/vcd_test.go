@@ -0,0 +1,121 @@
+package vcd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/djhworld/simple-computer/circuit"
+)
+
+// testSignals is a registry with a few wires and buses
+func testSignals() *circuit.Registry {
+	registry := circuit.NewRegistry()
+	s := registry.Scope("cpu")
+	s.Add("clock", circuit.NewWire("", false))
+	s.Scope("r0").Add("word", wires(16)...)
+	s.Add("mainBus", wires(16)...)
+	s.Scope("r0").Add("enable", circuit.NewWire("", false))
+	return registry
+}
+
+func wires(n int) []*circuit.Wire {
+	var w []*circuit.Wire
+	for i := 0; i < n; i++ {
+		w = append(w, circuit.NewWire("", false))
+	}
+	return w
+}
+
+// set puts a value on a signal's wires
+func set(registry *circuit.Registry, path string, value uint16) {
+	signal, _ := registry.Lookup(path)
+	for i, w := range signal.Wires {
+		w.Update(value&(1<<uint(signal.Width()-1-i)) != 0)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	registry := testSignals()
+	set(registry, "cpu.r0.word", 0x0005)
+	out := &bytes.Buffer{}
+	v := NewWriter(out, registry.Signals())
+
+	v.Sample()
+	set(registry, "cpu.clock", 1)
+	set(registry, "cpu.r0.enable", 1)
+	set(registry, "cpu.mainBus", 0x0005)
+	v.Sample()
+	// nothing changed so no time is written
+	v.Sample()
+	set(registry, "cpu.r0.enable", 0)
+	v.Sample()
+	if err := v.Flush(); err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+
+	expected := `$version simple-computer $end
+$timescale 1ns $end
+$scope module cpu $end
+$var wire 1 ! clock $end
+$var wire 16 # mainBus $end
+$scope module r0 $end
+$var wire 16 " word $end
+$var wire 1 $ enable $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+0!
+b101 "
+b0 #
+0$
+$end
+#1
+1!
+b101 #
+1$
+#3
+0$
+`
+	if out.String() != expected {
+		t.Logf("expected\n%s\nbut got\n%s", expected, out.String())
+		t.FailNow()
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	for n, expected := range map[int]string{0: "!", 93: "~", 94: "!!", 95: "\"!", 94 + 94*94: "!!!"} {
+		if got := identifier(n); got != expected {
+			t.Logf("expected identifier %d to be %s but got %s", n, expected, got)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	registry := testSignals()
+	selected, err := Select(registry, "cpu.mainBus, cpu.r0.*, cpu.mainBus[15], cpu.clock")
+	if err != nil {
+		t.Logf("unexpected error %v", err)
+		t.FailNow()
+	}
+	var paths []string
+	for _, s := range selected {
+		paths = append(paths, s.Path)
+	}
+	expected := []string{"cpu.mainBus", "cpu.r0.word", "cpu.r0.enable", "cpu.mainBus[15]", "cpu.clock"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Logf("expected %v but got %v", expected, paths)
+		t.FailNow()
+	}
+
+	for _, bad := range []string{"", "cpu.acc.*", "[cpu", "cpu.mainBus[16]"} {
+		if _, err := Select(registry, bad); err == nil {
+			t.Logf("expected an error selecting %q", bad)
+			t.FailNow()
+		}
+	}
+}